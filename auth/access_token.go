@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thanhpk/randstr"
+	"github.com/thunder33345/bookstore"
+)
+
+// SigningKey signs and verifies access tokens
+// its ID is put in the header of the tokens it signs, so the key can be picked when verifying
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// accessTokenHeader is the header of the JWT, only HS256 is ever accepted
+type accessTokenHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// accessTokenActor is who is really acting, following the act claim of RFC 8693
+type accessTokenActor struct {
+	Subject uuid.UUID `json:"sub"`
+}
+
+// accessTokenClaims is what the access token carries, enough to authenticate requests without looking up the session
+type accessTokenClaims struct {
+	Subject   uuid.UUID `json:"sub"`
+	SessionID uuid.UUID `json:"sid"`
+	Email     string    `json:"email"`
+	//EmailVerifiedAt is the unix time the email was verified at, omitted if it hasn't been
+	EmailVerifiedAt *int64                 `json:"email_verified_at,omitempty"`
+	Permissions     []bookstore.Permission `json:"perms"`
+	//Actor is the impersonator, omitted unless the session is an impersonation
+	Actor     *accessTokenActor `json:"act,omitempty"`
+	IssuedAt  int64             `json:"iat"`
+	ExpiresAt int64             `json:"exp"`
+}
+
+// AccessTokensEnabled reports whether access tokens are issued, see WithAccessTokens
+func (a *Auth) AccessTokensEnabled() bool {
+	return len(a.signingKeys) > 0
+}
+
+// CreateAccessToken signs a short-lived access token for the session, returning it along with when it expires
+// the permissions are baked into the token, changes to them only apply once it's refreshed
+func (a *Auth) CreateAccessToken(ses bookstore.Session, permissions []bookstore.Permission) (string, time.Time, error) {
+	if !a.AccessTokensEnabled() {
+		return "", time.Time{}, bookstore.ErrAccessTokensDisabled
+	}
+	key := a.signingKeys[0]
+	now := time.Now()
+	expiresAt := now.Add(a.accessTokenTTL)
+	//the token can't outlive the session, which matters for impersonations as they are short
+	if ses.Meta.ExpiresAt != nil && ses.Meta.ExpiresAt.Before(expiresAt) {
+		expiresAt = *ses.Meta.ExpiresAt
+	}
+	claims := accessTokenClaims{
+		Subject:     ses.ID,
+		SessionID:   ses.Meta.ID,
+		Email:       ses.Email,
+		Permissions: permissions,
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   expiresAt.Unix(),
+	}
+	if ses.EmailVerifiedAt != nil {
+		verified := ses.EmailVerifiedAt.Unix()
+		claims.EmailVerifiedAt = &verified
+	}
+	if ses.Meta.ImpersonatorID != nil {
+		claims.Actor = &accessTokenActor{Subject: *ses.Meta.ImpersonatorID}
+	}
+
+	header, err := json.Marshal(accessTokenHeader{Algorithm: "HS256", Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("encoding access token header: %w", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("encoding access token claims: %w", err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign(key.Secret, signed)), expiresAt, nil
+}
+
+// VerifyAccessToken checks the signature and expiry of the access token, returning the session it was issued for
+// nothing is looked up, so the returned session only has the account ID, email, verification time, Meta.ID and
+// Meta.ImpersonatorID set, along with Session.Permissions
+func (a *Auth) VerifyAccessToken(token string) (bookstore.Session, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return bookstore.Session{}, bookstore.ErrMalformedSession
+	}
+	var header accessTokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return bookstore.Session{}, bookstore.ErrMalformedSession
+	}
+	//the algorithm is fixed, so a token can't pick a weaker one(e.g. none) for itself
+	if header.Algorithm != "HS256" {
+		return bookstore.Session{}, bookstore.ErrInvalidSession
+	}
+	key, ok := a.signingKey(header.KeyID)
+	if !ok {
+		return bookstore.Session{}, bookstore.ErrInvalidSession
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, sign(key.Secret, parts[0]+"."+parts[1])) {
+		return bookstore.Session{}, bookstore.ErrInvalidSession
+	}
+
+	var claims accessTokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return bookstore.Session{}, bookstore.ErrMalformedSession
+	}
+	if !time.Now().Before(time.Unix(claims.ExpiresAt, 0)) {
+		return bookstore.Session{}, bookstore.ErrExpiredAccessToken
+	}
+
+	ses := bookstore.Session{
+		Account:     bookstore.Account{ID: claims.Subject, Email: claims.Email},
+		Meta:        bookstore.SessionMeta{ID: claims.SessionID},
+		Permissions: claims.Permissions,
+	}
+	if claims.EmailVerifiedAt != nil {
+		verified := time.Unix(*claims.EmailVerifiedAt, 0)
+		ses.EmailVerifiedAt = &verified
+	}
+	if claims.Actor != nil {
+		ses.Meta.ImpersonatorID = &claims.Actor.Subject
+	}
+	return ses, nil
+}
+
+// RefreshSession rotates the token of the session, returning the new token along with the session
+// the old token stops working, presenting it again revokes the session, as either the client or whoever stole it is replaying it
+// suspended accounts are refused, so their access tokens run out within the access token TTL
+func (a *Auth) RefreshSession(ctx context.Context, token string) (string, bookstore.Session, error) {
+	tokenHash := hashToken(token)
+	ses, err := a.ses.GetSession(ctx, tokenHash)
+	if errors.Is(err, bookstore.ErrInvalidSession) {
+		return "", bookstore.Session{}, a.revokeReused(ctx, tokenHash)
+	}
+	if err != nil {
+		return "", bookstore.Session{}, err
+	}
+
+	now := time.Now()
+	if a.expired(ses.Meta, now) {
+		_ = a.ses.DeleteSession(ctx, tokenHash)
+		return "", bookstore.Session{}, bookstore.ErrInvalidSession
+	}
+	if ses.Suspended(now) {
+		return "", bookstore.Session{}, bookstore.NewAccountSuspendedError(ses.Suspension)
+	}
+
+	newToken := randstr.Base62(32)
+	err = a.ses.RotateSession(ctx, tokenHash, hashToken(newToken), now)
+	if errors.Is(err, bookstore.ErrInvalidSession) {
+		//another refresh using the same token won the race, which makes this one a reuse
+		return "", bookstore.Session{}, a.revokeReused(ctx, tokenHash)
+	}
+	if err != nil {
+		return "", bookstore.Session{}, err
+	}
+	ses.Meta.LastSeenAt = now
+	return newToken, ses, nil
+}
+
+// revokeReused deletes the session if the token was rotated away from it, returning the error to report for the token
+func (a *Auth) revokeReused(ctx context.Context, tokenHash string) error {
+	revoked, err := a.ses.DeleteRotatedSession(ctx, tokenHash)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return bookstore.ErrRefreshTokenReused
+	}
+	return bookstore.ErrInvalidSession
+}
+
+// signingKey finds the key by its ID
+func (a *Auth) signingKey(id string) (SigningKey, bool) {
+	for _, key := range a.signingKeys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return SigningKey{}, false
+}
+
+// sign computes the HS256 signature
+func sign(secret []byte, signed string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of the token
+func decodeSegment(segment string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+var testKey = SigningKey{ID: "current", Secret: []byte(strings.Repeat("k", 32))}
+
+// forgeAccessToken encodes the header and claims, signing them with HS256 under the secret regardless of what the header says
+func forgeAccessToken(t *testing.T, header accessTokenHeader, claims accessTokenClaims, secret []byte) string {
+	t.Helper()
+	encode := func(v any) string {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+	signed := encode(header) + "." + encode(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign(secret, signed))
+}
+
+// testClaims are the claims of an access token for a fresh account, expiring in a minute
+func testClaims() accessTokenClaims {
+	now := time.Now()
+	return accessTokenClaims{Subject: uuid.New(), SessionID: uuid.New(), Email: "reader@example.com",
+		Permissions: []bookstore.Permission{bookstore.PermissionCatalogWrite}, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()}
+}
+
+func TestAccessTokenRoundTrip(t *testing.T) {
+	old := SigningKey{ID: "old", Secret: []byte(strings.Repeat("o", 32))}
+	a := NewAuth(nil, WithAccessTokens(time.Minute, testKey, old))
+	verified := time.Now().Add(-time.Hour).Truncate(time.Second)
+	impersonator := uuid.New()
+	ses := bookstore.Session{
+		Account: bookstore.Account{ID: uuid.New(), Email: "reader@example.com", EmailVerifiedAt: &verified},
+		Meta:    bookstore.SessionMeta{ID: uuid.New(), ImpersonatorID: &impersonator},
+	}
+	token, expiresAt, err := a.CreateAccessToken(ses, []bookstore.Permission{bookstore.PermissionCatalogWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expiresAt); d <= 0 || d > time.Minute {
+		t.Errorf("got token expiring in %v, want within the TTL", d)
+	}
+	got, err := a.VerifyAccessToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != ses.ID || got.Email != ses.Email || got.Meta.ID != ses.Meta.ID || !got.EmailVerifiedAt.Equal(verified) ||
+		got.Meta.ImpersonatorID == nil || *got.Meta.ImpersonatorID != impersonator ||
+		len(got.Permissions) != 1 || got.Permissions[0] != bookstore.PermissionCatalogWrite {
+		t.Errorf("got session %+v, want the one the token was created for", got)
+	}
+
+	//tokens signed by a key that is being rotated out keep working
+	if _, err = a.VerifyAccessToken(forgeAccessToken(t, accessTokenHeader{Algorithm: "HS256", Type: "JWT", KeyID: "old"}, testClaims(), old.Secret)); err != nil {
+		t.Errorf("verifying a token signed by the old key: %v", err)
+	}
+	if _, _, err = NewAuth(nil).CreateAccessToken(ses, nil); !errors.Is(err, bookstore.ErrAccessTokensDisabled) {
+		t.Errorf("creating a token without signing keys: got %v, want ErrAccessTokensDisabled", err)
+	}
+}
+
+func TestAccessTokenRejected(t *testing.T) {
+	a := NewAuth(nil, WithAccessTokens(time.Minute, testKey))
+	header := accessTokenHeader{Algorithm: "HS256", Type: "JWT", KeyID: testKey.ID}
+	valid := forgeAccessToken(t, header, testClaims(), testKey.Secret)
+	if _, err := a.VerifyAccessToken(valid); err != nil {
+		t.Fatalf("verifying a valid token: %v", err)
+	}
+	parts := strings.Split(valid, ".")
+
+	expired := testClaims()
+	expired.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	escalated := testClaims()
+	escalated.Permissions = append(escalated.Permissions, bookstore.PermissionRolesWrite)
+	unknownKey, noAlg, otherAlg := header, header, header
+	unknownKey.KeyID = "unknown"
+	noAlg.Algorithm = "none"
+	otherAlg.Algorithm = "HS512"
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"expired", forgeAccessToken(t, header, expired, testKey.Secret), bookstore.ErrExpiredAccessToken},
+		{"signed by another secret", forgeAccessToken(t, header, testClaims(), []byte(strings.Repeat("x", 32))), bookstore.ErrInvalidSession},
+		{"claims changed after signing", parts[0] + "." + strings.Split(forgeAccessToken(t, header, escalated, nil), ".")[1] + "." + parts[2],
+			bookstore.ErrInvalidSession},
+		{"unknown key", forgeAccessToken(t, unknownKey, testClaims(), testKey.Secret), bookstore.ErrInvalidSession},
+		//alg confusion, the header can't pick how it's verified
+		{"alg none", strings.Join(strings.Split(forgeAccessToken(t, noAlg, testClaims(), nil), ".")[:2], ".") + ".", bookstore.ErrInvalidSession},
+		{"alg none signed", forgeAccessToken(t, noAlg, testClaims(), testKey.Secret), bookstore.ErrInvalidSession},
+		{"other alg", forgeAccessToken(t, otherAlg, testClaims(), testKey.Secret), bookstore.ErrInvalidSession},
+		{"signature left out", parts[0] + "." + parts[1] + ".", bookstore.ErrInvalidSession},
+		{"not a token", "not-a-token", bookstore.ErrMalformedSession},
+		{"undecodable header", "!." + parts[1] + "." + parts[2], bookstore.ErrMalformedSession},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := a.VerifyAccessToken(tt.token); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
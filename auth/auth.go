@@ -2,6 +2,9 @@ package auth
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/thanhpk/randstr"
@@ -9,57 +12,416 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// apiKeyPrefix makes api keys recognizable, e.g. by secret scanners
+const apiKeyPrefix = "bsk_"
+
 type Auth struct {
-	ses    session
-	pwCost int
+	ses session
+	//hasher hashes new passwords, fallbackHashers are only used to verify hashes made by other algorithms
+	hasher          Hasher
+	fallbackHashers []Hasher
+	//absoluteTimeout is how long a session lasts since it was created, 0 means it never expires
+	absoluteTimeout time.Duration
+	//idleTimeout is how long a session lasts without being used, 0 means it never expires
+	idleTimeout time.Duration
+	//resetTimeout is how long a password reset token stays valid
+	resetTimeout time.Duration
+	//verifyTimeout is how long an email verification token stays valid
+	verifyTimeout time.Duration
+	//emailFreeAttempts and ipFreeAttempts are how many logins can fail before backing off, see Auth.backoff
+	emailFreeAttempts int
+	ipFreeAttempts    int
+	//loginBaseDelay is the first backoff delay, 0 disables backing off
+	loginBaseDelay time.Duration
+	loginMaxDelay  time.Duration
+	//lockoutThreshold is how many failures lock out the email for lockoutDuration, 0 disables it
+	lockoutThreshold int
+	lockoutDuration  time.Duration
+	//totpIssuer is the name authenticator apps show next to the code
+	totpIssuer string
+	//challengeTimeout is how long there is to enter the two-factor code after the password
+	challengeTimeout time.Duration
+	//signingKeys sign access tokens using the first key, the rest are only used to verify them, none disables access tokens
+	signingKeys    []SigningKey
+	accessTokenTTL time.Duration
+	//impersonationTimeout is how long impersonation sessions last, regardless of activity
+	impersonationTimeout time.Duration
 }
 
-func NewAuth(session session, pwCost int) *Auth {
-	return &Auth{
-		ses:    session,
-		pwCost: pwCost,
+func NewAuth(session session, options ...Option) *Auth {
+	a := Auth{
+		ses:                  session,
+		hasher:               NewArgon2id(),
+		fallbackHashers:      []Hasher{NewBcrypt(bcrypt.DefaultCost)},
+		resetTimeout:         time.Hour,
+		verifyTimeout:        24 * time.Hour,
+		emailFreeAttempts:    3,
+		ipFreeAttempts:       20,
+		loginBaseDelay:       time.Second,
+		loginMaxDelay:        15 * time.Minute,
+		lockoutThreshold:     10,
+		lockoutDuration:      time.Hour,
+		totpIssuer:           "Bookstore",
+		challengeTimeout:     5 * time.Minute,
+		accessTokenTTL:       5 * time.Minute,
+		impersonationTimeout: time.Hour,
+	}
+	for _, option := range options {
+		a = option(a)
 	}
+	return &a
 }
 
 func (a *Auth) Hash(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), a.pwCost)
-	return string(hash), err
+	return a.hasher.Hash(password)
 }
 
+// Validate checks the password against the hash, using whichever hasher recognizes it
 func (a *Auth) Validate(hash, password string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	if err == bcrypt.ErrMismatchedHashAndPassword {
-		return false, nil
-	} else if err != nil {
-		return false, err
+	hasher := a.identify(hash)
+	if hasher == nil {
+		return false, ErrUnknownHash
 	}
-	return true, nil
+	return hasher.Verify(hash, password)
+}
+
+// NeedsRehash reports whether the hash was made with another algorithm or outdated parameters
+// it should be re-hashed the next time the password is known, e.g. after logging in
+func (a *Auth) NeedsRehash(hash string) bool {
+	return !a.hasher.Identify(hash) || a.hasher.Outdated(hash)
 }
 
+// GetSession fetches the session of the token, rejecting it if it has expired
+// using a session slides its idle timeout forward
 func (a *Auth) GetSession(ctx context.Context, token string) (bookstore.Session, error) {
-	return a.ses.GetSession(ctx, token)
+	tokenHash := hashToken(token)
+	ses, err := a.ses.GetSession(ctx, tokenHash)
+	if err != nil {
+		return bookstore.Session{}, err
+	}
+
+	now := time.Now()
+	if a.expired(ses.Meta, now) {
+		//the sweeper would get to it eventually, but there is no reason to keep it around
+		_ = a.ses.DeleteSession(ctx, tokenHash)
+		return bookstore.Session{}, bookstore.ErrInvalidSession
+	}
+
+	//we only renew once in a while, so not every request results in a write
+	if now.Sub(ses.Meta.LastSeenAt) >= a.renewInterval() {
+		err = a.ses.TouchSession(ctx, tokenHash, now)
+		if err != nil {
+			return bookstore.Session{}, err
+		}
+		ses.Meta.LastSeenAt = now
+	}
+	return ses, nil
 }
 
-func (a *Auth) CreateSession(ctx context.Context, account bookstore.Account) (string, error) {
+// CreateSession creates a new session for the account and returns its token along with the session
+// suspended accounts are rejected, which covers every way of logging in
+// only the digest of the token is stored, so the token can't be recovered from the store afterwards
+// ip and userAgent describe the client logging in, they are only kept for listing sessions
+// the token doubles as the refresh token of access tokens, see Auth.RefreshSession
+func (a *Auth) CreateSession(ctx context.Context, account bookstore.Account, ip string, userAgent string) (string, bookstore.Session, error) {
+	now := time.Now()
+	if account.Suspended(now) {
+		return "", bookstore.Session{}, bookstore.NewAccountSuspendedError(account.Suspension)
+	}
 	sessionToken := randstr.Base62(32)
-	err := a.ses.StoreSession(ctx, sessionToken, account)
+	meta := bookstore.SessionMeta{
+		ID:         uuid.New(),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		IP:         ip,
+		UserAgent:  userAgent,
+	}
+	if a.absoluteTimeout > 0 {
+		expires := now.Add(a.absoluteTimeout)
+		meta.ExpiresAt = &expires
+	}
+
+	err := a.ses.StoreSession(ctx, hashToken(sessionToken), account, meta)
 	if err != nil {
-		return "", err
+		return "", bookstore.Session{}, err
 	}
-	return sessionToken, err
+	return sessionToken, bookstore.Session{Account: account, Meta: meta}, nil
 }
 
 func (a *Auth) DeleteSession(ctx context.Context, token string) error {
-	return a.ses.DeleteSession(ctx, token)
+	return a.ses.DeleteSession(ctx, hashToken(token))
 }
 
 func (a *Auth) DeleteSessionFor(ctx context.Context, user uuid.UUID) error {
 	return a.ses.DeleteSessionsFor(ctx, user)
 }
 
+// ListSessions lists the sessions of the account, leaving out the expired ones
+func (a *Auth) ListSessions(ctx context.Context, user uuid.UUID) ([]bookstore.SessionMeta, error) {
+	sessions, err := a.ses.ListSessions(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	list := make([]bookstore.SessionMeta, 0, len(sessions))
+	for _, meta := range sessions {
+		if !a.expired(meta, now) {
+			list = append(list, meta)
+		}
+	}
+	return list, nil
+}
+
+// RevokeSession deletes a single session of the account using the session's ID
+func (a *Auth) RevokeSession(ctx context.Context, user uuid.UUID, sessionID uuid.UUID) error {
+	return a.ses.DeleteSessionByID(ctx, user, sessionID)
+}
+
+// CreateAPIKey creates a new api key for the account, returning the plaintext key along with the stored key
+// like session tokens, only the digest of the key is stored, so the plaintext can't be shown again
+func (a *Auth) CreateAPIKey(ctx context.Context, account bookstore.Account, name string, scope bookstore.Scope, expiresAt *time.Time) (string, bookstore.APIKey, error) {
+	plain := apiKeyPrefix + randstr.Base62(40)
+	key := bookstore.APIKey{
+		ID:        uuid.New(),
+		AccountID: account.ID,
+		Name:      name,
+		Scope:     scope,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	err := a.ses.StoreAPIKey(ctx, hashToken(plain), account, key)
+	if err != nil {
+		return "", bookstore.APIKey{}, err
+	}
+	return plain, key, nil
+}
+
+// GetAPIKeySession fetches the account of the api key, rejecting it if it has expired
+// the returned session has no Meta, instead Session.APIKey is set
+func (a *Auth) GetAPIKeySession(ctx context.Context, plain string) (bookstore.Session, error) {
+	account, key, err := a.ses.GetAPIKey(ctx, hashToken(plain))
+	if err != nil {
+		return bookstore.Session{}, err
+	}
+
+	now := time.Now()
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return bookstore.Session{}, bookstore.ErrInvalidAPIKey
+	}
+
+	//same as sessions, the last used time is only updated once in a while
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= time.Minute {
+		err = a.ses.TouchAPIKey(ctx, key.ID, now)
+		if err != nil {
+			return bookstore.Session{}, err
+		}
+		key.LastUsedAt = &now
+	}
+	return bookstore.Session{Account: account, APIKey: &key}, nil
+}
+
+// ListAPIKeys lists the api keys of the account, including expired ones
+func (a *Auth) ListAPIKeys(ctx context.Context, user uuid.UUID) ([]bookstore.APIKey, error) {
+	return a.ses.ListAPIKeys(ctx, user)
+}
+
+// RevokeAPIKey deletes an api key of the account using the key's ID
+func (a *Auth) RevokeAPIKey(ctx context.Context, user uuid.UUID, keyID uuid.UUID) error {
+	return a.ses.DeleteAPIKey(ctx, user, keyID)
+}
+
+// CreatePasswordReset creates a single use password reset token for the account
+// requesting a new token invalidates the previous one
+func (a *Auth) CreatePasswordReset(ctx context.Context, account bookstore.Account) (string, error) {
+	token := randstr.Base62(32)
+	err := a.ses.StorePasswordReset(ctx, hashToken(token), account.ID, time.Now().Add(a.resetTimeout))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumePasswordReset uses up the reset token and returns the account it was created for
+// the token is gone afterwards, even if it turned out to be expired
+func (a *Auth) ConsumePasswordReset(ctx context.Context, token string) (uuid.UUID, error) {
+	accountID, expiresAt, err := a.ses.ConsumePasswordReset(ctx, hashToken(token))
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	if !time.Now().Before(expiresAt) {
+		return uuid.UUID{}, bookstore.ErrInvalidResetToken
+	}
+	return accountID, nil
+}
+
+// CreateEmailVerification creates a single use token verifying the current email of the account
+// requesting a new token invalidates the previous one
+func (a *Auth) CreateEmailVerification(ctx context.Context, account bookstore.Account) (string, error) {
+	token := randstr.Base62(32)
+	err := a.ses.StoreEmailVerification(ctx, hashToken(token), account.ID, account.Email, time.Now().Add(a.verifyTimeout))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeEmailVerification uses up the verification token and returns the account and email it was created for
+// the caller should check the account still uses that email
+func (a *Auth) ConsumeEmailVerification(ctx context.Context, token string) (uuid.UUID, string, error) {
+	accountID, email, expiresAt, err := a.ses.ConsumeEmailVerification(ctx, hashToken(token))
+	if err != nil {
+		return uuid.UUID{}, "", err
+	}
+	if !time.Now().Before(expiresAt) {
+		return uuid.UUID{}, "", bookstore.ErrInvalidVerificationToken
+	}
+	return accountID, email, nil
+}
+
+// Sweep removes every expired session, password reset and email verification token, login challenge and pending OpenID Connect login,
+// along with old failed logins
+func (a *Auth) Sweep(ctx context.Context) error {
+	now := time.Now()
+	var idleBefore time.Time
+	if a.idleTimeout > 0 {
+		idleBefore = now.Add(-a.idleTimeout)
+	}
+	err := a.ses.DeleteExpiredSessions(ctx, now, idleBefore)
+	if err != nil {
+		return err
+	}
+	err = a.ses.DeleteExpiredPasswordResets(ctx, now)
+	if err != nil {
+		return err
+	}
+	err = a.ses.DeleteExpiredEmailVerifications(ctx, now)
+	if err != nil {
+		return err
+	}
+	err = a.ses.DeleteExpiredLoginChallenges(ctx, now)
+	if err != nil {
+		return err
+	}
+	err = a.ses.DeleteExpiredOIDCStates(ctx, now)
+	if err != nil {
+		return err
+	}
+	err = a.ses.DeleteExpiredLoginThrottles(ctx, now, now.Add(-loginFailureWindow))
+	if err != nil {
+		return err
+	}
+	return a.ses.DeleteLoginAttemptsBefore(ctx, now.Add(-loginAttemptRetention))
+}
+
+// RunSweeper periodically calls Sweep until the context is cancelled
+// errors are handed to onErr, as there is no one else to return them to
+func (a *Auth) RunSweeper(ctx context.Context, interval time.Duration, onErr func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.Sweep(ctx); err != nil && onErr != nil {
+				onErr(err)
+			}
+		}
+	}
+}
+
+// identify finds the hasher that made the hash, or nil if none of them did
+func (a *Auth) identify(hash string) Hasher {
+	if a.hasher.Identify(hash) {
+		return a.hasher
+	}
+	for _, hasher := range a.fallbackHashers {
+		if hasher.Identify(hash) {
+			return hasher
+		}
+	}
+	return nil
+}
+
+// hashToken returns the digest the session is stored under
+// tokens are random and long enough that a plain unsalted hash is sufficient
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// expired checks the session against both the absolute and idle timeout
+func (a *Auth) expired(meta bookstore.SessionMeta, now time.Time) bool {
+	if meta.ExpiresAt != nil && !now.Before(*meta.ExpiresAt) {
+		return true
+	}
+	if a.idleTimeout > 0 && now.Sub(meta.LastSeenAt) >= a.idleTimeout {
+		return true
+	}
+	return false
+}
+
+// renewInterval is how often last_seen_at gets updated
+// it's at most a minute, but never long enough to let an active session idle out
+func (a *Auth) renewInterval() time.Duration {
+	interval := time.Minute
+	if a.idleTimeout > 0 && a.idleTimeout/2 < interval {
+		interval = a.idleTimeout / 2
+	}
+	return interval
+}
+
+// session stores sessions, api keys, password reset and email verification tokens by the digest of their token, see hashToken
+// it also keeps track of failed logins, the two-factor secrets of accounts, pending OpenID Connect logins and invites
 type session interface {
-	StoreSession(ctx context.Context, token string, account bookstore.Account) error
-	GetSession(ctx context.Context, token string) (bookstore.Session, error)
-	DeleteSession(ctx context.Context, token string) error
+	StoreSession(ctx context.Context, tokenHash string, account bookstore.Account, meta bookstore.SessionMeta) error
+	GetSession(ctx context.Context, tokenHash string) (bookstore.Session, error)
+	TouchSession(ctx context.Context, tokenHash string, lastSeen time.Time) error
+	RotateSession(ctx context.Context, tokenHash string, newTokenHash string, lastSeen time.Time) error
+	DeleteRotatedSession(ctx context.Context, tokenHash string) (bool, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
 	DeleteSessionsFor(ctx context.Context, accountID uuid.UUID) error
+	ListSessions(ctx context.Context, accountID uuid.UUID) ([]bookstore.SessionMeta, error)
+	DeleteSessionByID(ctx context.Context, accountID uuid.UUID, sessionID uuid.UUID) error
+	DeleteExpiredSessions(ctx context.Context, now time.Time, idleBefore time.Time) error
+	StoreAPIKey(ctx context.Context, keyHash string, account bookstore.Account, key bookstore.APIKey) error
+	GetAPIKey(ctx context.Context, keyHash string) (bookstore.Account, bookstore.APIKey, error)
+	TouchAPIKey(ctx context.Context, keyID uuid.UUID, lastUsed time.Time) error
+	ListAPIKeys(ctx context.Context, accountID uuid.UUID) ([]bookstore.APIKey, error)
+	DeleteAPIKey(ctx context.Context, accountID uuid.UUID, keyID uuid.UUID) error
+	StorePasswordReset(ctx context.Context, tokenHash string, accountID uuid.UUID, expiresAt time.Time) error
+	ConsumePasswordReset(ctx context.Context, tokenHash string) (uuid.UUID, time.Time, error)
+	DeleteExpiredPasswordResets(ctx context.Context, now time.Time) error
+	StoreEmailVerification(ctx context.Context, tokenHash string, accountID uuid.UUID, email string, expiresAt time.Time) error
+	ConsumeEmailVerification(ctx context.Context, tokenHash string) (uuid.UUID, string, time.Time, error)
+	DeleteExpiredEmailVerifications(ctx context.Context, now time.Time) error
+	IncrementLoginFailures(ctx context.Context, key string, now time.Time, resetBefore time.Time) (int, error)
+	BlockLogin(ctx context.Context, key string, until time.Time) error
+	GetLoginBlock(ctx context.Context, key string) (time.Time, error)
+	DeleteLoginThrottle(ctx context.Context, key string) error
+	DeleteExpiredLoginThrottles(ctx context.Context, now time.Time, before time.Time) error
+	StoreLoginAttempt(ctx context.Context, attempt bookstore.LoginAttempt) error
+	ListLoginAttempts(ctx context.Context, email string, limit int) ([]bookstore.LoginAttempt, error)
+	DeleteLoginAttempts(ctx context.Context, email string) error
+	DeleteLoginAttemptsBefore(ctx context.Context, before time.Time) error
+	StoreTOTP(ctx context.Context, totp bookstore.TOTP) error
+	GetTOTP(ctx context.Context, accountID uuid.UUID) (bookstore.TOTP, error)
+	EnableTOTP(ctx context.Context, accountID uuid.UUID, enabledAt time.Time) error
+	UseTOTPStep(ctx context.Context, accountID uuid.UUID, step int64) error
+	DeleteTOTP(ctx context.Context, accountID uuid.UUID) error
+	StoreRecoveryCodes(ctx context.Context, accountID uuid.UUID, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, accountID uuid.UUID, codeHash string) error
+	CountRecoveryCodes(ctx context.Context, accountID uuid.UUID) (int, error)
+	StoreLoginChallenge(ctx context.Context, tokenHash string, accountID uuid.UUID, expiresAt time.Time) error
+	GetLoginChallenge(ctx context.Context, tokenHash string) (uuid.UUID, time.Time, error)
+	DeleteLoginChallenge(ctx context.Context, tokenHash string) error
+	DeleteExpiredLoginChallenges(ctx context.Context, now time.Time) error
+	StoreOIDCState(ctx context.Context, stateHash string, state bookstore.OIDCState) error
+	ConsumeOIDCState(ctx context.Context, stateHash string) (bookstore.OIDCState, error)
+	DeleteExpiredOIDCStates(ctx context.Context, now time.Time) error
+	StoreInvite(ctx context.Context, codeHash string, invite bookstore.Invite) error
+	ListInvites(ctx context.Context) ([]bookstore.Invite, error)
+	DeleteInvite(ctx context.Context, inviteID uuid.UUID) error
+	UseInvite(ctx context.Context, codeHash string, email string, now time.Time) (bookstore.Invite, error)
+	ReleaseInvite(ctx context.Context, inviteID uuid.UUID) error
 }
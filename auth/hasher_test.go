@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheapArgon2id keeps the tests from spending their time hashing
+var cheapArgon2id = Argon2id{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2id(t *testing.T) {
+	hash, err := cheapArgon2id.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") || !cheapArgon2id.Identify(hash) {
+		t.Errorf("got hash %q, want a PHC string holding the parameters", hash)
+	}
+	if other, _ := cheapArgon2id.Hash("secret"); other == hash {
+		t.Error("hashing the same password twice gave the same hash, want them salted")
+	}
+
+	for password, want := range map[string]bool{"secret": true, "Secret": false, "": false} {
+		if ok, err := cheapArgon2id.Verify(hash, password); err != nil || ok != want {
+			t.Errorf("verifying %q: got %v with error %v, want %v", password, ok, err, want)
+		}
+	}
+	//the parameters come from the hash, so changing them doesn't break existing hashes
+	if ok, err := NewArgon2id().Verify(hash, "secret"); err != nil || !ok {
+		t.Errorf("verifying with other parameters: got %v with error %v, want it verified", ok, err)
+	}
+	if cheapArgon2id.Outdated(hash) || !NewArgon2id().Outdated(hash) {
+		t.Error("want the hash outdated only for different parameters")
+	}
+	if _, err := cheapArgon2id.Verify("$argon2id$v=19$m=64$salt", "secret"); err == nil {
+		t.Error("verifying a malformed hash didn't fail")
+	}
+}
+
+func TestValidateAndRehash(t *testing.T) {
+	a := NewAuth(nil, WithHasher(cheapArgon2id), WithFallbackHashers(NewBcrypt(bcrypt.MinCost)))
+	legacy, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := a.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//hashes of the fallback hashers keep working, but get flagged to be replaced
+	if ok, err := a.Validate(string(legacy), "secret"); err != nil || !ok {
+		t.Errorf("validating a bcrypt hash: got %v with error %v, want it valid", ok, err)
+	}
+	if ok, err := a.Validate(string(legacy), "wrong"); err != nil || ok {
+		t.Errorf("validating a bcrypt hash with the wrong password: got %v with error %v, want it invalid", ok, err)
+	}
+	if !a.NeedsRehash(string(legacy)) {
+		t.Error("a bcrypt hash is not flagged for rehashing")
+	}
+	if ok, err := a.Validate(current, "secret"); err != nil || !ok {
+		t.Errorf("validating an argon2id hash: got %v with error %v, want it valid", ok, err)
+	}
+	if a.NeedsRehash(current) {
+		t.Error("a current hash is flagged for rehashing")
+	}
+	//so are hashes of the same algorithm made with other parameters
+	if outdated, _ := NewArgon2id().Hash("secret"); !a.NeedsRehash(outdated) {
+		t.Error("an argon2id hash with other parameters is not flagged for rehashing")
+	}
+
+	if _, err := a.Validate("plaintext", "plaintext"); !errors.Is(err, ErrUnknownHash) {
+		t.Errorf("validating an unknown hash: got %v, want ErrUnknownHash", err)
+	}
+}
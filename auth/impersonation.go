@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thanhpk/randstr"
+	"github.com/thunder33345/bookstore"
+)
+
+// Impersonate creates a session for the account on behalf of the impersonator, returning its token
+// the session is marked with the impersonator, and expires after the impersonation timeout regardless of activity
+func (a *Auth) Impersonate(ctx context.Context, account bookstore.Account, impersonator uuid.UUID, ip string, userAgent string) (string, bookstore.Session, error) {
+	now := time.Now()
+	if account.Suspended(now) {
+		return "", bookstore.Session{}, bookstore.NewAccountSuspendedError(account.Suspension)
+	}
+	sessionToken := randstr.Base62(32)
+	expires := now.Add(a.impersonationTimeout)
+	meta := bookstore.SessionMeta{
+		ID:             uuid.New(),
+		CreatedAt:      now,
+		LastSeenAt:     now,
+		ExpiresAt:      &expires,
+		IP:             ip,
+		UserAgent:      userAgent,
+		ImpersonatorID: &impersonator,
+	}
+
+	err := a.ses.StoreSession(ctx, hashToken(sessionToken), account, meta)
+	if err != nil {
+		return "", bookstore.Session{}, err
+	}
+	return sessionToken, bookstore.Session{Account: account, Meta: meta}, nil
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thanhpk/randstr"
+	"github.com/thunder33345/bookstore"
+)
+
+// CreateInvite creates an invite using the email, max uses, expiry and creator of the given invite, returning its code
+// like api keys, only the digest of the code is stored, so it can't be shown again
+func (a *Auth) CreateInvite(ctx context.Context, invite bookstore.Invite) (string, bookstore.Invite, error) {
+	code := randstr.Base62(24)
+	invite.ID = uuid.New()
+	invite.Uses = 0
+	invite.CreatedAt = time.Now()
+	err := a.ses.StoreInvite(ctx, hashToken(code), invite)
+	if err != nil {
+		return "", bookstore.Invite{}, err
+	}
+	return code, invite, nil
+}
+
+// ListInvites lists every invite, including expired and used up ones
+func (a *Auth) ListInvites(ctx context.Context) ([]bookstore.Invite, error) {
+	return a.ses.ListInvites(ctx)
+}
+
+// RevokeInvite deletes an invite using its ID
+func (a *Auth) RevokeInvite(ctx context.Context, inviteID uuid.UUID) error {
+	return a.ses.DeleteInvite(ctx, inviteID)
+}
+
+// UseInvite uses up one use of the invite for signing up with the email
+// it fails with bookstore.ErrInvalidInvite if the invite is unknown, expired, used up or meant for another email
+func (a *Auth) UseInvite(ctx context.Context, code string, email string) (bookstore.Invite, error) {
+	return a.ses.UseInvite(ctx, hashToken(code), email, time.Now())
+}
+
+// ReleaseInvite gives back the use of an invite, for when signing up failed after using it
+func (a *Auth) ReleaseInvite(ctx context.Context, inviteID uuid.UUID) error {
+	return a.ses.ReleaseInvite(ctx, inviteID)
+}
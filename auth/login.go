@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+const (
+	//loginFailureWindow is how long failed logins are remembered after the last one
+	loginFailureWindow = 24 * time.Hour
+	//loginAttemptRetention is how long failed logins are kept around for admins to look at
+	loginAttemptRetention = 30 * 24 * time.Hour
+)
+
+// CheckLogin rejects logging in with a LoginThrottledError while either the email or the IP is blocked
+// it should be called before checking the password, so blocked attempts don't get to guess it
+func (a *Auth) CheckLogin(ctx context.Context, email string, ip string) error {
+	now := time.Now()
+	var until time.Time
+	for _, key := range loginKeys(email, ip) {
+		blocked, err := a.ses.GetLoginBlock(ctx, key)
+		if err != nil {
+			return err
+		}
+		if now.Before(blocked) && blocked.After(until) {
+			until = blocked
+		}
+	}
+	if !until.IsZero() {
+		return bookstore.NewLoginThrottledError(until)
+	}
+	return nil
+}
+
+// LoginFailed records a failed login, blocking further attempts with an exponential backoff
+// the email gets locked out once it reaches the lockout threshold, the IP only ever backs off
+// since it may be shared by many people
+func (a *Auth) LoginFailed(ctx context.Context, email string, ip string, userAgent string) error {
+	now := time.Now()
+	err := a.ses.StoreLoginAttempt(ctx, bookstore.LoginAttempt{
+		ID:        uuid.New(),
+		Email:     strings.ToLower(email),
+		IP:        ip,
+		UserAgent: userAgent,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range loginKeys(email, ip) {
+		failures, err := a.ses.IncrementLoginFailures(ctx, key, now, now.Add(-loginFailureWindow))
+		if err != nil {
+			return err
+		}
+		var delay time.Duration
+		if strings.HasPrefix(key, "email:") {
+			delay = a.backoff(failures, a.emailFreeAttempts)
+			if a.lockoutThreshold > 0 && failures >= a.lockoutThreshold && delay < a.lockoutDuration {
+				delay = a.lockoutDuration
+			}
+		} else {
+			delay = a.backoff(failures, a.ipFreeAttempts)
+		}
+		if delay <= 0 {
+			continue
+		}
+		err = a.ses.BlockLogin(ctx, key, now.Add(delay))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoginSucceeded forgets the failed logins of the email
+// the IP is left alone, otherwise logging into an account of your own would reset it
+func (a *Auth) LoginSucceeded(ctx context.Context, email string) error {
+	return a.ses.DeleteLoginThrottle(ctx, emailKey(email))
+}
+
+// UnlockLogin lifts the lockout of the email, along with its failed logins
+func (a *Auth) UnlockLogin(ctx context.Context, email string) error {
+	return a.ses.DeleteLoginThrottle(ctx, emailKey(email))
+}
+
+// ForgetLogins removes the failed logins and the throttling of the email, for when the account using it is gone
+func (a *Auth) ForgetLogins(ctx context.Context, email string) error {
+	if err := a.ses.DeleteLoginThrottle(ctx, emailKey(email)); err != nil {
+		return err
+	}
+	return a.ses.DeleteLoginAttempts(ctx, strings.ToLower(email))
+}
+
+// ListLoginAttempts lists the latest failed logins using the email, newest first
+func (a *Auth) ListLoginAttempts(ctx context.Context, email string, limit int) ([]bookstore.LoginAttempt, error) {
+	return a.ses.ListLoginAttempts(ctx, strings.ToLower(email), limit)
+}
+
+// backoff is how long to block after the given number of failures
+// the first few failures are free, after that the delay doubles with every failure up to loginMaxDelay
+func (a *Auth) backoff(failures int, free int) time.Duration {
+	over := failures - free
+	if over <= 0 || a.loginBaseDelay <= 0 {
+		return 0
+	}
+	delay := a.loginBaseDelay
+	for i := 1; i < over && delay < a.loginMaxDelay; i++ {
+		delay *= 2
+	}
+	if a.loginMaxDelay > 0 && delay > a.loginMaxDelay {
+		delay = a.loginMaxDelay
+	}
+	return delay
+}
+
+// emailKey is the throttle key of the email, emails are compared case-insensitively
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+// loginKeys are the throttle keys a login counts against
+func loginKeys(email string, ip string) []string {
+	keys := []string{emailKey(email)}
+	if ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+	return keys
+}
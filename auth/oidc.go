@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/thanhpk/randstr"
+	"github.com/thunder33345/bookstore"
+)
+
+// oidcStateTimeout is how long the user has to log in at the identity provider
+const oidcStateTimeout = 10 * time.Minute
+
+// CreateOIDCState starts an OpenID Connect login with the provider
+// it returns the state to send along, which identifies the pending login once the provider redirects back
+func (a *Auth) CreateOIDCState(ctx context.Context, provider string) (string, bookstore.OIDCState, error) {
+	state := randstr.Base62(32)
+	pending := bookstore.OIDCState{
+		Provider:     provider,
+		Nonce:        randstr.Base62(32),
+		CodeVerifier: randstr.Base62(64),
+		ExpiresAt:    time.Now().Add(oidcStateTimeout),
+	}
+	err := a.ses.StoreOIDCState(ctx, hashToken(state), pending)
+	if err != nil {
+		return "", bookstore.OIDCState{}, err
+	}
+	return state, pending, nil
+}
+
+// ConsumeOIDCState uses up the state and returns the pending login it belongs to
+func (a *Auth) ConsumeOIDCState(ctx context.Context, state string) (bookstore.OIDCState, error) {
+	pending, err := a.ses.ConsumeOIDCState(ctx, hashToken(state))
+	if err != nil {
+		return bookstore.OIDCState{}, err
+	}
+	if !time.Now().Before(pending.ExpiresAt) {
+		return bookstore.OIDCState{}, bookstore.ErrInvalidOIDCState
+	}
+	return pending, nil
+}
@@ -0,0 +1,122 @@
+package auth
+
+import "time"
+
+// Option is a callable that modifies the Auth's parameter
+type Option func(a Auth) Auth
+
+// WithAbsoluteTimeout sets how long a session lasts since it was created, regardless of activity
+// 0 disables it
+func WithAbsoluteTimeout(timeout time.Duration) Option {
+	return func(a Auth) Auth {
+		a.absoluteTimeout = timeout
+		return a
+	}
+}
+
+// WithIdleTimeout sets how long a session lasts without being used
+// 0 disables it
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(a Auth) Auth {
+		a.idleTimeout = timeout
+		return a
+	}
+}
+
+// WithPasswordResetTimeout sets how long a password reset token stays valid, defaults to an hour
+func WithPasswordResetTimeout(timeout time.Duration) Option {
+	return func(a Auth) Auth {
+		a.resetTimeout = timeout
+		return a
+	}
+}
+
+// WithEmailVerificationTimeout sets how long an email verification token stays valid, defaults to a day
+func WithEmailVerificationTimeout(timeout time.Duration) Option {
+	return func(a Auth) Auth {
+		a.verifyTimeout = timeout
+		return a
+	}
+}
+
+// WithLoginBackoff sets how long logging in is blocked after a failure, doubling with every further failure up to maxDelay
+// 0 baseDelay disables backing off
+func WithLoginBackoff(baseDelay time.Duration, maxDelay time.Duration) Option {
+	return func(a Auth) Auth {
+		a.loginBaseDelay = baseDelay
+		a.loginMaxDelay = maxDelay
+		return a
+	}
+}
+
+// WithLoginFreeAttempts sets how many logins can fail for an email and for an IP before backing off
+func WithLoginFreeAttempts(perEmail int, perIP int) Option {
+	return func(a Auth) Auth {
+		a.emailFreeAttempts = perEmail
+		a.ipFreeAttempts = perIP
+		return a
+	}
+}
+
+// WithLockout sets how many failed logins lock out an email, and for how long
+// 0 threshold disables it
+func WithLockout(threshold int, duration time.Duration) Option {
+	return func(a Auth) Auth {
+		a.lockoutThreshold = threshold
+		a.lockoutDuration = duration
+		return a
+	}
+}
+
+// WithTOTPIssuer sets the name authenticator apps show next to the code, defaults to Bookstore
+func WithTOTPIssuer(issuer string) Option {
+	return func(a Auth) Auth {
+		a.totpIssuer = issuer
+		return a
+	}
+}
+
+// WithImpersonationTimeout sets how long impersonation sessions last regardless of activity, defaults to 1 hour
+func WithImpersonationTimeout(timeout time.Duration) Option {
+	return func(a Auth) Auth {
+		a.impersonationTimeout = timeout
+		return a
+	}
+}
+
+// WithLoginChallengeTimeout sets how long there is to enter the two-factor code after the password, defaults to 5 minutes
+func WithLoginChallengeTimeout(timeout time.Duration) Option {
+	return func(a Auth) Auth {
+		a.challengeTimeout = timeout
+		return a
+	}
+}
+
+// WithHasher sets the hasher used for new passwords, defaults to argon2id
+// the previous hasher is kept around to verify existing hashes, until they get re-hashed
+func WithHasher(hasher Hasher) Option {
+	return func(a Auth) Auth {
+		a.fallbackHashers = append([]Hasher{a.hasher}, a.fallbackHashers...)
+		a.hasher = hasher
+		return a
+	}
+}
+
+// WithFallbackHashers replaces the hashers used to verify hashes made by other algorithms, defaults to bcrypt
+func WithFallbackHashers(hashers ...Hasher) Option {
+	return func(a Auth) Auth {
+		a.fallbackHashers = hashers
+		return a
+	}
+}
+
+// WithAccessTokens enables signed access tokens lasting ttl, which are verified without looking up the session
+// the first key signs new tokens, the others are only used to verify existing ones, so keys can be rotated by prepending a new one
+// and removing the old one after ttl has passed
+func WithAccessTokens(ttl time.Duration, keys ...SigningKey) Option {
+	return func(a Auth) Auth {
+		a.accessTokenTTL = ttl
+		a.signingKeys = append([]SigningKey(nil), keys...)
+		return a
+	}
+}
@@ -2,6 +2,11 @@ package session
 
 import (
 	"context"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/puzpuzpuz/xsync"
@@ -9,37 +14,202 @@ import (
 )
 
 type Memory struct {
-	ses *xsync.MapOf[string, bookstore.Session]
+	ses    *xsync.MapOf[string, *entry]
+	keys   *xsync.MapOf[string, *keyEntry]
+	resets *xsync.MapOf[string, resetEntry]
+	verify *xsync.MapOf[string, verifyEntry]
+	//throttles is keyed by what is being throttled, e.g. the email or the IP
+	throttles *xsync.MapOf[string, *throttleEntry]
+	//attemptsMu guards attempts, which are the failed logins in the order they were recorded
+	attemptsMu sync.Mutex
+	attempts   []bookstore.LoginAttempt
+	//totps and recovery are keyed by the account ID
+	totps      *xsync.MapOf[string, *totpEntry]
+	recovery   *xsync.MapOf[string, *recoveryEntry]
+	challenges *xsync.MapOf[string, challengeEntry]
+	oidc       *xsync.MapOf[string, bookstore.OIDCState]
+	invites    *xsync.MapOf[string, *inviteEntry]
+}
+
+// entry is a stored session
+// lastSeen is kept separately, so touching a session can't race with it being deleted
+type entry struct {
+	session  bookstore.Session
+	lastSeen atomic.Int64
+	//rotated are the digests of every token the session was rotated away from, it's replaced instead of appended to
+	rotated []string
+}
+
+// keyEntry is a stored api key, same as entry, lastUsed is kept separately
+// lastUsed is 0 if the key has never been used
+type keyEntry struct {
+	account  bookstore.Account
+	key      bookstore.APIKey
+	lastUsed atomic.Int64
+}
+
+// resetEntry is a stored password reset token
+type resetEntry struct {
+	accountID uuid.UUID
+	expiresAt time.Time
+}
+
+// throttleEntry is the failed login counter of a key
+// it has its own lock, as incrementing has to read and write the counter
+type throttleEntry struct {
+	mu           sync.Mutex
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// verifyEntry is a stored email verification token
+type verifyEntry struct {
+	accountID uuid.UUID
+	email     string
+	expiresAt time.Time
+}
+
+// totpEntry is a stored TOTP secret
+// it has its own lock, as accepting a code has to read and write the last step
+type totpEntry struct {
+	mu   sync.Mutex
+	totp bookstore.TOTP
+}
+
+// recoveryEntry holds the digests of the unused recovery codes of an account
+type recoveryEntry struct {
+	mu    sync.Mutex
+	codes map[string]struct{}
+}
+
+// inviteEntry is a stored invite
+// it has its own lock, as using it has to read and write the uses
+type inviteEntry struct {
+	mu     sync.Mutex
+	invite bookstore.Invite
+}
+
+// challengeEntry is a stored login challenge
+type challengeEntry struct {
+	accountID uuid.UUID
+	expiresAt time.Time
 }
 
 func NewMemory() *Memory {
-	sm := xsync.NewMapOf[bookstore.Session]()
+	sm := xsync.NewMapOf[*entry]()
+	km := xsync.NewMapOf[*keyEntry]()
+	rm := xsync.NewMapOf[resetEntry]()
+	vm := xsync.NewMapOf[verifyEntry]()
+	tm := xsync.NewMapOf[*throttleEntry]()
 	return &Memory{
-		ses: sm,
+		ses:        sm,
+		keys:       km,
+		resets:     rm,
+		verify:     vm,
+		throttles:  tm,
+		totps:      xsync.NewMapOf[*totpEntry](),
+		recovery:   xsync.NewMapOf[*recoveryEntry](),
+		challenges: xsync.NewMapOf[challengeEntry](),
+		oidc:       xsync.NewMapOf[bookstore.OIDCState](),
+		invites:    xsync.NewMapOf[*inviteEntry](),
 	}
 }
 
-func (a *Memory) StoreSession(_ context.Context, token string, account bookstore.Account) error {
-	a.ses.Store(token, bookstore.Session{Account: account})
+func (a *Memory) StoreSession(_ context.Context, tokenHash string, account bookstore.Account, meta bookstore.SessionMeta) error {
+	e := &entry{session: bookstore.Session{Account: account, Meta: meta}}
+	e.lastSeen.Store(meta.LastSeenAt.UnixNano())
+	a.ses.Store(tokenHash, e)
 	return nil
 }
 
-func (a *Memory) GetSession(_ context.Context, token string) (bookstore.Session, error) {
-	ses, found := a.ses.Load(token)
+func (a *Memory) GetSession(_ context.Context, tokenHash string) (bookstore.Session, error) {
+	e, found := a.ses.Load(tokenHash)
 	if !found {
 		return bookstore.Session{}, bookstore.ErrInvalidSession
 	}
-	return ses, nil
+	return e.load(), nil
+}
+
+func (a *Memory) TouchSession(_ context.Context, tokenHash string, lastSeen time.Time) error {
+	if e, found := a.ses.Load(tokenHash); found {
+		e.lastSeen.Store(lastSeen.UnixNano())
+	}
+	return nil
+}
+
+// RotateSession moves the session to the new token, keeping the old one around to detect it being reused
+// only one of multiple concurrent rotations using the same token succeeds, as the old entry can only be taken out once
+func (a *Memory) RotateSession(_ context.Context, tokenHash string, newTokenHash string, lastSeen time.Time) error {
+	old, found := a.ses.LoadAndDelete(tokenHash)
+	if !found {
+		return bookstore.ErrInvalidSession
+	}
+	rotated := make([]string, len(old.rotated), len(old.rotated)+1)
+	copy(rotated, old.rotated)
+	e := &entry{session: old.session, rotated: append(rotated, tokenHash)}
+	e.lastSeen.Store(lastSeen.UnixNano())
+	a.ses.Store(newTokenHash, e)
+	return nil
+}
+
+// DeleteRotatedSession deletes the session any of its earlier tokens belonged to, reporting whether there was one
+func (a *Memory) DeleteRotatedSession(_ context.Context, tokenHash string) (bool, error) {
+	found := false
+	a.ses.Range(func(key string, e *entry) bool {
+		for _, rotated := range e.rotated {
+			if rotated == tokenHash {
+				a.ses.Delete(key)
+				found = true
+				return false
+			}
+		}
+		return true
+	})
+	return found, nil
+}
+
+func (a *Memory) DeleteSession(_ context.Context, tokenHash string) error {
+	a.ses.Delete(tokenHash)
+	return nil
+}
+
+// ListSessions lists every session of the account, oldest first
+func (a *Memory) ListSessions(_ context.Context, accountID uuid.UUID) ([]bookstore.SessionMeta, error) {
+	var list []bookstore.SessionMeta
+	a.ses.Range(func(_ string, e *entry) bool {
+		if e.session.ID == accountID {
+			list = append(list, e.load().Meta)
+		}
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list, nil
 }
 
-func (a *Memory) DeleteSession(_ context.Context, token string) error {
-	a.ses.Delete(token)
+func (a *Memory) DeleteSessionByID(_ context.Context, accountID uuid.UUID, sessionID uuid.UUID) error {
+	found := false
+	a.ses.Range(func(key string, e *entry) bool {
+		if e.session.ID == accountID && e.session.Meta.ID == sessionID {
+			a.ses.Delete(key)
+			found = true
+			return false
+		}
+		return true
+	})
+	if !found {
+		return bookstore.NewNoResultError("session", nil)
+	}
 	return nil
 }
 
+// DeleteSessionsFor deletes every session of the account, along with the impersonations made by it
 func (a *Memory) DeleteSessionsFor(_ context.Context, accountID uuid.UUID) error {
-	a.ses.Range(func(key string, s bookstore.Session) bool {
-		if s.ID == accountID {
+	a.ses.Range(func(key string, e *entry) bool {
+		impersonator := e.session.Meta.ImpersonatorID
+		if e.session.ID == accountID || (impersonator != nil && *impersonator == accountID) {
 			a.ses.Delete(key)
 		}
 		//return true to keep iterating through the whole session
@@ -47,3 +217,461 @@ func (a *Memory) DeleteSessionsFor(_ context.Context, accountID uuid.UUID) error
 	})
 	return nil
 }
+
+func (a *Memory) DeleteExpiredSessions(_ context.Context, now time.Time, idleBefore time.Time) error {
+	a.ses.Range(func(key string, e *entry) bool {
+		meta := e.load().Meta
+		expired := meta.ExpiresAt != nil && !now.Before(*meta.ExpiresAt)
+		idle := !idleBefore.IsZero() && meta.LastSeenAt.Before(idleBefore)
+		if expired || idle {
+			a.ses.Delete(key)
+		}
+		return true
+	})
+	return nil
+}
+
+func (a *Memory) StoreAPIKey(_ context.Context, keyHash string, account bookstore.Account, key bookstore.APIKey) error {
+	key.AccountID = account.ID
+	e := &keyEntry{account: account, key: key}
+	if key.LastUsedAt != nil {
+		e.lastUsed.Store(key.LastUsedAt.UnixNano())
+	}
+	a.keys.Store(keyHash, e)
+	return nil
+}
+
+func (a *Memory) GetAPIKey(_ context.Context, keyHash string) (bookstore.Account, bookstore.APIKey, error) {
+	e, found := a.keys.Load(keyHash)
+	if !found {
+		return bookstore.Account{}, bookstore.APIKey{}, bookstore.ErrInvalidAPIKey
+	}
+	return e.account, e.load(), nil
+}
+
+func (a *Memory) TouchAPIKey(_ context.Context, keyID uuid.UUID, lastUsed time.Time) error {
+	a.keys.Range(func(_ string, e *keyEntry) bool {
+		if e.key.ID == keyID {
+			e.lastUsed.Store(lastUsed.UnixNano())
+			return false
+		}
+		return true
+	})
+	return nil
+}
+
+// ListAPIKeys lists every key of the account, oldest first
+func (a *Memory) ListAPIKeys(_ context.Context, accountID uuid.UUID) ([]bookstore.APIKey, error) {
+	var list []bookstore.APIKey
+	a.keys.Range(func(_ string, e *keyEntry) bool {
+		if e.key.AccountID == accountID {
+			list = append(list, e.load())
+		}
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+func (a *Memory) DeleteAPIKey(_ context.Context, accountID uuid.UUID, keyID uuid.UUID) error {
+	found := false
+	a.keys.Range(func(key string, e *keyEntry) bool {
+		if e.key.AccountID == accountID && e.key.ID == keyID {
+			a.keys.Delete(key)
+			found = true
+			return false
+		}
+		return true
+	})
+	if !found {
+		return bookstore.NewNoResultError("api_key", nil)
+	}
+	return nil
+}
+
+// StorePasswordReset stores the reset token, replacing any earlier token of the account
+func (a *Memory) StorePasswordReset(_ context.Context, tokenHash string, accountID uuid.UUID, expiresAt time.Time) error {
+	a.resets.Range(func(key string, e resetEntry) bool {
+		if e.accountID == accountID {
+			a.resets.Delete(key)
+		}
+		return true
+	})
+	a.resets.Store(tokenHash, resetEntry{accountID: accountID, expiresAt: expiresAt})
+	return nil
+}
+
+// ConsumePasswordReset deletes the reset token, LoadAndDelete ensures only one caller gets it
+func (a *Memory) ConsumePasswordReset(_ context.Context, tokenHash string) (uuid.UUID, time.Time, error) {
+	e, found := a.resets.LoadAndDelete(tokenHash)
+	if !found {
+		return uuid.UUID{}, time.Time{}, bookstore.ErrInvalidResetToken
+	}
+	return e.accountID, e.expiresAt, nil
+}
+
+func (a *Memory) DeleteExpiredPasswordResets(_ context.Context, now time.Time) error {
+	a.resets.Range(func(key string, e resetEntry) bool {
+		if !now.Before(e.expiresAt) {
+			a.resets.Delete(key)
+		}
+		return true
+	})
+	return nil
+}
+
+// StoreEmailVerification stores the verification token, replacing any earlier token of the account
+func (a *Memory) StoreEmailVerification(_ context.Context, tokenHash string, accountID uuid.UUID, email string, expiresAt time.Time) error {
+	a.verify.Range(func(key string, e verifyEntry) bool {
+		if e.accountID == accountID {
+			a.verify.Delete(key)
+		}
+		return true
+	})
+	a.verify.Store(tokenHash, verifyEntry{accountID: accountID, email: email, expiresAt: expiresAt})
+	return nil
+}
+
+func (a *Memory) ConsumeEmailVerification(_ context.Context, tokenHash string) (uuid.UUID, string, time.Time, error) {
+	e, found := a.verify.LoadAndDelete(tokenHash)
+	if !found {
+		return uuid.UUID{}, "", time.Time{}, bookstore.ErrInvalidVerificationToken
+	}
+	return e.accountID, e.email, e.expiresAt, nil
+}
+
+func (a *Memory) DeleteExpiredEmailVerifications(_ context.Context, now time.Time) error {
+	a.verify.Range(func(key string, e verifyEntry) bool {
+		if !now.Before(e.expiresAt) {
+			a.verify.Delete(key)
+		}
+		return true
+	})
+	return nil
+}
+
+func (a *Memory) IncrementLoginFailures(_ context.Context, key string, now time.Time, resetBefore time.Time) (int, error) {
+	e, _ := a.throttles.LoadOrStore(key, &throttleEntry{})
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.lastFailure.Before(resetBefore) {
+		e.failures = 0
+	}
+	e.failures++
+	e.lastFailure = now
+	return e.failures, nil
+}
+
+func (a *Memory) BlockLogin(_ context.Context, key string, until time.Time) error {
+	if e, found := a.throttles.Load(key); found {
+		e.mu.Lock()
+		e.blockedUntil = until
+		e.mu.Unlock()
+	}
+	return nil
+}
+
+func (a *Memory) GetLoginBlock(_ context.Context, key string) (time.Time, error) {
+	e, found := a.throttles.Load(key)
+	if !found {
+		return time.Time{}, nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.blockedUntil, nil
+}
+
+func (a *Memory) DeleteLoginThrottle(_ context.Context, key string) error {
+	a.throttles.Delete(key)
+	return nil
+}
+
+func (a *Memory) DeleteExpiredLoginThrottles(_ context.Context, now time.Time, before time.Time) error {
+	a.throttles.Range(func(key string, e *throttleEntry) bool {
+		e.mu.Lock()
+		expired := e.lastFailure.Before(before) && !now.Before(e.blockedUntil)
+		e.mu.Unlock()
+		if expired {
+			a.throttles.Delete(key)
+		}
+		return true
+	})
+	return nil
+}
+
+func (a *Memory) StoreLoginAttempt(_ context.Context, attempt bookstore.LoginAttempt) error {
+	a.attemptsMu.Lock()
+	defer a.attemptsMu.Unlock()
+	a.attempts = append(a.attempts, attempt)
+	return nil
+}
+
+// ListLoginAttempts lists the latest failed logins using the email, newest first
+func (a *Memory) ListLoginAttempts(_ context.Context, email string, limit int) ([]bookstore.LoginAttempt, error) {
+	a.attemptsMu.Lock()
+	defer a.attemptsMu.Unlock()
+	list := make([]bookstore.LoginAttempt, 0, limit)
+	//attempts are appended in order, so walking backwards gives the newest first
+	for i := len(a.attempts) - 1; i >= 0 && len(list) < limit; i-- {
+		if a.attempts[i].Email == email {
+			list = append(list, a.attempts[i])
+		}
+	}
+	return list, nil
+}
+
+// DeleteLoginAttempts removes every failed login using the email
+func (a *Memory) DeleteLoginAttempts(_ context.Context, email string) error {
+	a.attemptsMu.Lock()
+	defer a.attemptsMu.Unlock()
+	kept := a.attempts[:0]
+	for _, attempt := range a.attempts {
+		if attempt.Email != email {
+			kept = append(kept, attempt)
+		}
+	}
+	a.attempts = kept
+	return nil
+}
+
+func (a *Memory) DeleteLoginAttemptsBefore(_ context.Context, before time.Time) error {
+	a.attemptsMu.Lock()
+	defer a.attemptsMu.Unlock()
+	kept := a.attempts[:0]
+	for _, attempt := range a.attempts {
+		if !attempt.CreatedAt.Before(before) {
+			kept = append(kept, attempt)
+		}
+	}
+	a.attempts = kept
+	return nil
+}
+
+// StoreTOTP stores the secret of the account, replacing any previous one
+// the secret starts out disabled, regardless of TOTP.EnabledAt
+func (a *Memory) StoreTOTP(_ context.Context, totp bookstore.TOTP) error {
+	totp.EnabledAt = nil
+	totp.LastStep = 0
+	a.totps.Store(totp.AccountID.String(), &totpEntry{totp: totp})
+	return nil
+}
+
+func (a *Memory) GetTOTP(_ context.Context, accountID uuid.UUID) (bookstore.TOTP, error) {
+	e, found := a.totps.Load(accountID.String())
+	if !found {
+		return bookstore.TOTP{}, bookstore.NewNoResultError("account_totp", nil)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.totp, nil
+}
+
+func (a *Memory) EnableTOTP(_ context.Context, accountID uuid.UUID, enabledAt time.Time) error {
+	e, found := a.totps.Load(accountID.String())
+	if !found {
+		return bookstore.NewNoResultError("account_totp", nil)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.totp.EnabledAt = &enabledAt
+	return nil
+}
+
+// UseTOTPStep records the time step of an accepted code, failing if the step was already used
+func (a *Memory) UseTOTPStep(_ context.Context, accountID uuid.UUID, step int64) error {
+	e, found := a.totps.Load(accountID.String())
+	if !found {
+		return bookstore.ErrInvalidTwoFactorCode
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.totp.LastStep >= step {
+		return bookstore.ErrInvalidTwoFactorCode
+	}
+	e.totp.LastStep = step
+	return nil
+}
+
+func (a *Memory) DeleteTOTP(_ context.Context, accountID uuid.UUID) error {
+	a.totps.Delete(accountID.String())
+	a.recovery.Delete(accountID.String())
+	return nil
+}
+
+// StoreRecoveryCodes stores the digests of the recovery codes, replacing any previous codes of the account
+func (a *Memory) StoreRecoveryCodes(_ context.Context, accountID uuid.UUID, codeHashes []string) error {
+	codes := make(map[string]struct{}, len(codeHashes))
+	for _, codeHash := range codeHashes {
+		codes[codeHash] = struct{}{}
+	}
+	a.recovery.Store(accountID.String(), &recoveryEntry{codes: codes})
+	return nil
+}
+
+func (a *Memory) UseRecoveryCode(_ context.Context, accountID uuid.UUID, codeHash string) error {
+	e, found := a.recovery.Load(accountID.String())
+	if !found {
+		return bookstore.ErrInvalidTwoFactorCode
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.codes[codeHash]; !ok {
+		return bookstore.ErrInvalidTwoFactorCode
+	}
+	delete(e.codes, codeHash)
+	return nil
+}
+
+func (a *Memory) CountRecoveryCodes(_ context.Context, accountID uuid.UUID) (int, error) {
+	e, found := a.recovery.Load(accountID.String())
+	if !found {
+		return 0, nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.codes), nil
+}
+
+func (a *Memory) StoreLoginChallenge(_ context.Context, tokenHash string, accountID uuid.UUID, expiresAt time.Time) error {
+	a.challenges.Store(tokenHash, challengeEntry{accountID: accountID, expiresAt: expiresAt})
+	return nil
+}
+
+func (a *Memory) GetLoginChallenge(_ context.Context, tokenHash string) (uuid.UUID, time.Time, error) {
+	e, found := a.challenges.Load(tokenHash)
+	if !found {
+		return uuid.UUID{}, time.Time{}, bookstore.ErrInvalidLoginChallenge
+	}
+	return e.accountID, e.expiresAt, nil
+}
+
+// DeleteLoginChallenge deletes the login challenge, LoadAndDelete ensures only one caller can exchange it
+func (a *Memory) DeleteLoginChallenge(_ context.Context, tokenHash string) error {
+	if _, found := a.challenges.LoadAndDelete(tokenHash); !found {
+		return bookstore.ErrInvalidLoginChallenge
+	}
+	return nil
+}
+
+func (a *Memory) DeleteExpiredLoginChallenges(_ context.Context, now time.Time) error {
+	a.challenges.Range(func(key string, e challengeEntry) bool {
+		if !now.Before(e.expiresAt) {
+			a.challenges.Delete(key)
+		}
+		return true
+	})
+	return nil
+}
+
+func (a *Memory) StoreOIDCState(_ context.Context, stateHash string, state bookstore.OIDCState) error {
+	a.oidc.Store(stateHash, state)
+	return nil
+}
+
+// ConsumeOIDCState deletes the pending login, LoadAndDelete ensures only one caller gets it
+func (a *Memory) ConsumeOIDCState(_ context.Context, stateHash string) (bookstore.OIDCState, error) {
+	state, found := a.oidc.LoadAndDelete(stateHash)
+	if !found {
+		return bookstore.OIDCState{}, bookstore.ErrInvalidOIDCState
+	}
+	return state, nil
+}
+
+func (a *Memory) DeleteExpiredOIDCStates(_ context.Context, now time.Time) error {
+	a.oidc.Range(func(key string, state bookstore.OIDCState) bool {
+		if !now.Before(state.ExpiresAt) {
+			a.oidc.Delete(key)
+		}
+		return true
+	})
+	return nil
+}
+
+func (a *Memory) StoreInvite(_ context.Context, codeHash string, invite bookstore.Invite) error {
+	a.invites.Store(codeHash, &inviteEntry{invite: invite})
+	return nil
+}
+
+// ListInvites lists every invite, oldest first
+func (a *Memory) ListInvites(_ context.Context) ([]bookstore.Invite, error) {
+	var list []bookstore.Invite
+	a.invites.Range(func(_ string, e *inviteEntry) bool {
+		e.mu.Lock()
+		list = append(list, e.invite)
+		e.mu.Unlock()
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+func (a *Memory) DeleteInvite(_ context.Context, inviteID uuid.UUID) error {
+	found := false
+	a.invites.Range(func(key string, e *inviteEntry) bool {
+		if e.invite.ID == inviteID {
+			a.invites.Delete(key)
+			found = true
+			return false
+		}
+		return true
+	})
+	if !found {
+		return bookstore.NewNoResultError("invite", nil)
+	}
+	return nil
+}
+
+// UseInvite counts a use of the invite, as long as it's still valid for the email
+func (a *Memory) UseInvite(_ context.Context, codeHash string, email string, now time.Time) (bookstore.Invite, error) {
+	e, found := a.invites.Load(codeHash)
+	if !found {
+		return bookstore.Invite{}, bookstore.ErrInvalidInvite
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch {
+	case e.invite.MaxUses != 0 && e.invite.Uses >= e.invite.MaxUses,
+		e.invite.ExpiresAt != nil && !now.Before(*e.invite.ExpiresAt),
+		e.invite.Email != "" && !strings.EqualFold(e.invite.Email, email):
+		return bookstore.Invite{}, bookstore.ErrInvalidInvite
+	}
+	e.invite.Uses++
+	return e.invite, nil
+}
+
+// ReleaseInvite gives back a use of the invite, for when signing up failed after using it
+func (a *Memory) ReleaseInvite(_ context.Context, inviteID uuid.UUID) error {
+	a.invites.Range(func(_ string, e *inviteEntry) bool {
+		if e.invite.ID != inviteID {
+			return true
+		}
+		e.mu.Lock()
+		if e.invite.Uses > 0 {
+			e.invite.Uses--
+		}
+		e.mu.Unlock()
+		return false
+	})
+	return nil
+}
+
+// load returns a copy of the session with its current last seen time
+func (e *entry) load() bookstore.Session {
+	ses := e.session
+	ses.Meta.LastSeenAt = time.Unix(0, e.lastSeen.Load())
+	return ses
+}
+
+// load returns a copy of the key with its current last used time
+func (e *keyEntry) load() bookstore.APIKey {
+	key := e.key
+	if lastUsed := e.lastUsed.Load(); lastUsed != 0 {
+		t := time.Unix(0, lastUsed)
+		key.LastUsedAt = &t
+	}
+	return key
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thanhpk/randstr"
+	"github.com/thunder33345/bookstore"
+)
+
+const (
+	//totpPeriod is how long each code is valid for, in seconds
+	totpPeriod = 30
+	totpDigits = 6
+	//totpModulus truncates the code to totpDigits digits
+	totpModulus = 1_000_000
+	//totpSkew is how many periods before and after the current one are still accepted, to make up for clock drift
+	totpSkew = 1
+	//recoveryCodeCount is how many recovery codes are handed out at a time
+	recoveryCodeCount = 10
+)
+
+// totpEncoding is how secrets are encoded, authenticator apps expect unpadded base32
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnrollTOTP generates a new TOTP secret for the account, returning it along with an otpauth:// URI for authenticator apps
+// the secret only takes effect after a code is confirmed with ConfirmTOTP, enrolling again replaces an unconfirmed secret
+func (a *Auth) EnrollTOTP(ctx context.Context, account bookstore.Account) (string, string, error) {
+	existing, err := a.ses.GetTOTP(ctx, account.ID)
+	var noResErr *bookstore.NoResultError
+	if err != nil && !errors.As(err, &noResErr) {
+		return "", "", err
+	}
+	if err == nil && existing.EnabledAt != nil {
+		return "", "", bookstore.ErrTwoFactorAlreadyEnabled
+	}
+
+	secret := totpEncoding.EncodeToString(randstr.Bytes(20))
+	err = a.ses.StoreTOTP(ctx, bookstore.TOTP{
+		AccountID: account.ID,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return secret, a.totpURI(account.Email, secret), nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the code matches the enrolled secret
+// it returns the recovery codes, which can be used in place of a code when the authenticator is lost
+func (a *Auth) ConfirmTOTP(ctx context.Context, accountID uuid.UUID, code string) ([]string, error) {
+	totp, err := a.getTOTP(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if totp.EnabledAt != nil {
+		return nil, bookstore.ErrTwoFactorAlreadyEnabled
+	}
+	err = a.verifyTOTP(ctx, totp, code)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := a.storeRecoveryCodes(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	err = a.ses.EnableTOTP(ctx, accountID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// TwoFactorStatus returns whether two-factor authentication is enabled, and how many recovery codes are left
+func (a *Auth) TwoFactorStatus(ctx context.Context, accountID uuid.UUID) (bool, int, error) {
+	totp, err := a.ses.GetTOTP(ctx, accountID)
+	var noResErr *bookstore.NoResultError
+	if errors.As(err, &noResErr) {
+		return false, 0, nil
+	} else if err != nil {
+		return false, 0, err
+	}
+	if totp.EnabledAt == nil {
+		return false, 0, nil
+	}
+	remaining, err := a.ses.CountRecoveryCodes(ctx, accountID)
+	if err != nil {
+		return false, 0, err
+	}
+	return true, remaining, nil
+}
+
+// VerifyTwoFactor checks the code against the enabled secret of the account
+// the code can be either a one-time code or a recovery code, either way it can only be used once
+func (a *Auth) VerifyTwoFactor(ctx context.Context, accountID uuid.UUID, code string) error {
+	totp, err := a.getTOTP(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if totp.EnabledAt == nil {
+		return bookstore.ErrTwoFactorNotEnrolled
+	}
+
+	normalized := normalizeCode(code)
+	if len(normalized) == totpDigits {
+		return a.verifyTOTP(ctx, totp, normalized)
+	}
+	return a.ses.UseRecoveryCode(ctx, accountID, hashToken(normalized))
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the account, invalidating the previous ones
+func (a *Auth) RegenerateRecoveryCodes(ctx context.Context, accountID uuid.UUID) ([]string, error) {
+	return a.storeRecoveryCodes(ctx, accountID)
+}
+
+// DisableTwoFactor removes the secret and recovery codes of the account, whether or not it was confirmed
+func (a *Auth) DisableTwoFactor(ctx context.Context, accountID uuid.UUID) error {
+	return a.ses.DeleteTOTP(ctx, accountID)
+}
+
+// CreateLoginChallenge creates a short-lived challenge, which is exchanged for a session after passing two-factor authentication
+// it's handed out in place of a session once the password checks out
+func (a *Auth) CreateLoginChallenge(ctx context.Context, account bookstore.Account) (string, time.Time, error) {
+	token := randstr.Base62(32)
+	expiresAt := time.Now().Add(a.challengeTimeout)
+	err := a.ses.StoreLoginChallenge(ctx, hashToken(token), account.ID, expiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// GetLoginChallenge returns the account the challenge was created for, rejecting it if it has expired
+func (a *Auth) GetLoginChallenge(ctx context.Context, token string) (uuid.UUID, error) {
+	accountID, expiresAt, err := a.ses.GetLoginChallenge(ctx, hashToken(token))
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	if !time.Now().Before(expiresAt) {
+		return uuid.UUID{}, bookstore.ErrInvalidLoginChallenge
+	}
+	return accountID, nil
+}
+
+// DeleteLoginChallenge uses up the challenge, failing if someone else already did
+func (a *Auth) DeleteLoginChallenge(ctx context.Context, token string) error {
+	return a.ses.DeleteLoginChallenge(ctx, hashToken(token))
+}
+
+// getTOTP fetches the secret of the account, turning a missing secret into bookstore.ErrTwoFactorNotEnrolled
+func (a *Auth) getTOTP(ctx context.Context, accountID uuid.UUID) (bookstore.TOTP, error) {
+	totp, err := a.ses.GetTOTP(ctx, accountID)
+	var noResErr *bookstore.NoResultError
+	if errors.As(err, &noResErr) {
+		return bookstore.TOTP{}, bookstore.ErrTwoFactorNotEnrolled
+	}
+	return totp, err
+}
+
+// verifyTOTP checks the code against the current time step and its neighbours
+// the matching step is recorded, so the same code can't be replayed
+func (a *Auth) verifyTOTP(ctx context.Context, totp bookstore.TOTP, code string) error {
+	code = normalizeCode(code)
+	key, err := totpEncoding.DecodeString(totp.Secret)
+	if err != nil {
+		return fmt.Errorf("decoding totp secret: %w", err)
+	}
+	current := time.Now().Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return a.ses.UseTOTPStep(ctx, totp.AccountID, step)
+		}
+	}
+	return bookstore.ErrInvalidTwoFactorCode
+}
+
+// storeRecoveryCodes generates new recovery codes for the account, only their digests are stored
+func (a *Auth) storeRecoveryCodes(ctx context.Context, accountID uuid.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code := randstr.Hex(10)
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashToken(code)
+	}
+	err := a.ses.StoreRecoveryCodes(ctx, accountID, hashes)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// totpURI builds the otpauth:// URI authenticator apps use to import the secret, usually through a QR code
+func (a *Auth) totpURI(email string, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", a.totpIssuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + a.totpIssuer + ":" + email,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// totpCode computes the code of the time step as specified by RFC 4226
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulus)
+}
+
+// normalizeCode strips the formatting users tend to type along with codes
+// recovery codes are handed out as xxxxx-xxxxx, but are stored without the dash
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/mail"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thanhpk/randstr"
+	"github.com/thunder33345/bookstore"
+	passwordvalidator "github.com/wagslane/go-password-validator"
+)
+
+// minPasswordEntropy matches the default of the server, so passwords set here would be accepted there too
+const minPasswordEntropy = 65
+
+// createUser creates an account, which is granted the role if one is given
+// the email is marked as verified, since whoever runs the command vouches for it
+func createUser(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("create-user", flag.ContinueOnError)
+	email := fs.String("email", "", "email of the account")
+	name := fs.String("name", "", "name of the account")
+	role := fs.String("role", "", "role to grant, e.g. administrator")
+	passwordStdin := fs.Bool("password-stdin", false, "read the password from stdin instead of generating one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *email == "" || *name == "" {
+		return errors.New("-email and -name are required")
+	}
+	if _, err := mail.ParseAddress(*email); err != nil {
+		return fmt.Errorf("invalid email: %w", err)
+	}
+
+	password, generated, err := app.readPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+	hash, err := app.auth.Hash(password)
+	if err != nil {
+		return err
+	}
+	account, err := app.db.CreateAccount(ctx, bookstore.Account{Name: *name, Email: *email, PasswordHash: hash})
+	if err != nil {
+		return err
+	}
+	if err = app.db.MarkEmailVerified(ctx, account.ID, account.Email, time.Now()); err != nil {
+		return err
+	}
+	if *role != "" {
+		if err = app.db.AddAccountRole(ctx, account.ID, *role); err != nil {
+			return fmt.Errorf("account %s was created, but granting the role failed: %w", account.ID, err)
+		}
+	}
+	fmt.Fprintf(app.out, "Created account %s(%s)\n", account.ID, account.Email)
+	if generated {
+		fmt.Fprintf(app.out, "Generated password: %s\n", password)
+	}
+	return nil
+}
+
+// listUsers prints every account along with its roles
+func listUsers(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("list-users", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(app.out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tEMAIL\tNAME\tROLES\tSTATUS")
+	now := time.Now()
+	after := uuid.Nil
+	for {
+		accounts, err := app.db.ListAccounts(ctx, 100, after)
+		if err != nil {
+			return err
+		}
+		if len(accounts) == 0 {
+			break
+		}
+		for _, account := range accounts {
+			roles, err := app.db.ListAccountRoles(ctx, account.ID)
+			if err != nil {
+				return err
+			}
+			names := make([]string, 0, len(roles))
+			for _, role := range roles {
+				names = append(names, role.Name)
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", account.ID, account.Email, account.Name,
+				strings.Join(names, ","), accountStatus(account, now))
+		}
+		after = accounts[len(accounts)-1].ID
+	}
+	return w.Flush()
+}
+
+// promote grants the role to the user, the administrator role by default
+func promote(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("promote", flag.ContinueOnError)
+	role := fs.String("role", "administrator", "role to grant")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	account, err := app.findAccount(ctx, fs.Args())
+	if err != nil {
+		return err
+	}
+	if err = app.db.AddAccountRole(ctx, account.ID, *role); err != nil {
+		return err
+	}
+	fmt.Fprintf(app.out, "Granted %s to %s(%s)\n", *role, account.ID, account.Email)
+	return nil
+}
+
+// demote removes the role from the user, the administrator role by default
+func demote(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("demote", flag.ContinueOnError)
+	role := fs.String("role", "administrator", "role to remove")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	account, err := app.findAccount(ctx, fs.Args())
+	if err != nil {
+		return err
+	}
+	if err = app.db.RemoveAccountRole(ctx, account.ID, *role); err != nil {
+		return err
+	}
+	fmt.Fprintf(app.out, "Removed %s from %s(%s)\n", *role, account.ID, account.Email)
+	return nil
+}
+
+// resetPassword sets a new password for the user, logging them out everywhere
+func resetPassword(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	passwordStdin := fs.Bool("password-stdin", false, "read the password from stdin instead of generating one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	account, err := app.findAccount(ctx, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	password, generated, err := app.readPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+	account.PasswordHash, err = app.auth.Hash(password)
+	if err != nil {
+		return err
+	}
+	if err = app.db.UpdateAccount(ctx, account); err != nil {
+		return err
+	}
+	if err = app.auth.DeleteSessionFor(ctx, account.ID); err != nil {
+		return err
+	}
+	fmt.Fprintf(app.out, "Reset the password of %s(%s)\n", account.ID, account.Email)
+	if generated {
+		fmt.Fprintf(app.out, "Generated password: %s\n", password)
+	}
+	return nil
+}
+
+// revokeSessions logs the user out everywhere, api keys are left alone
+func revokeSessions(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("revoke-sessions", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	account, err := app.findAccount(ctx, fs.Args())
+	if err != nil {
+		return err
+	}
+	if err = app.auth.DeleteSessionFor(ctx, account.ID); err != nil {
+		return err
+	}
+	fmt.Fprintf(app.out, "Revoked the sessions of %s(%s)\n", account.ID, account.Email)
+	return nil
+}
+
+// findAccount looks up the account named by the only argument, which is either its ID or email
+func (a *app) findAccount(ctx context.Context, args []string) (bookstore.Account, error) {
+	if len(args) != 1 {
+		return bookstore.Account{}, errors.New("expected the ID or email of the user")
+	}
+	if id, err := uuid.Parse(args[0]); err == nil {
+		return a.db.GetAccount(ctx, id)
+	}
+	return a.db.GetAccountByEmail(ctx, args[0])
+}
+
+// readPassword reads the first line of stdin as the password, or generates one, which has to be shown to the user
+// passwords are never taken as flags, since those end up in the shell history and process list
+func (a *app) readPassword(fromStdin bool) (string, bool, error) {
+	if !fromStdin {
+		return randstr.Base62(24), true, nil
+	}
+	line, err := bufio.NewReader(a.in).ReadString('\n')
+	if err != nil && line == "" {
+		return "", false, fmt.Errorf("reading password from stdin: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if err = passwordvalidator.Validate(password, minPasswordEntropy); err != nil {
+		return "", false, err
+	}
+	return password, false, nil
+}
+
+// accountStatus summarizes whether the account can be used
+func accountStatus(account bookstore.Account, now time.Time) string {
+	switch {
+	case account.AnonymizedAt != nil:
+		return "anonymized"
+	case account.Suspended(now):
+		return "suspended"
+	case account.EmailVerifiedAt == nil:
+		return "unverified"
+	}
+	return "active"
+}
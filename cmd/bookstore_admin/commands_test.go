@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/thunder33345/bookstore"
+)
+
+// testPassword passes the password entropy check
+const testPassword = "correct-horse-battery-staple-42"
+
+// newTestApp opens a fresh sqlite db the way main does, the output of the commands is collected into the returned buffer
+func newTestApp(t *testing.T) (*app, *bytes.Buffer) {
+	t.Helper()
+	db, authService, err := openStorage("sqlite://" + filepath.Join(t.TempDir(), "bookstore.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Init(); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	return &app{db: db, auth: authService, in: strings.NewReader(""), out: out}, out
+}
+
+// run runs the command, with stdin as the input
+func (a *app) run(t *testing.T, stdin string, name string, args ...string) error {
+	t.Helper()
+	a.in = strings.NewReader(stdin)
+	return commands[name].run(context.Background(), a, args)
+}
+
+// account looks the account up by its email, failing the test if it doesn't exist
+func (a *app) account(t *testing.T, email string) bookstore.Account {
+	t.Helper()
+	account, err := a.db.GetAccountByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account
+}
+
+// roleNames returns the names of the roles of the account
+func (a *app) roleNames(t *testing.T, account bookstore.Account) []string {
+	t.Helper()
+	roles, err := a.db.ListAccountRoles(context.Background(), account.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
+
+func TestOpenStorage(t *testing.T) {
+	for _, connStr := range []string{"", "memory://"} {
+		if _, _, err := openStorage(connStr); err == nil {
+			t.Errorf("opening %q: want the in memory store refused", connStr)
+		}
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	a, out := newTestApp(t)
+
+	if err := a.run(t, "", "create-user", "-email", "admin@example.com"); err == nil {
+		t.Error("creating a user without a name: want it refused")
+	}
+	if err := a.run(t, "", "create-user", "-email", "not-an-email", "-name", "Admin"); err == nil {
+		t.Error("creating a user with an invalid email: want it refused")
+	}
+	if err := a.run(t, "password\n", "create-user", "-password-stdin", "-email", "admin@example.com", "-name", "Admin"); err == nil {
+		t.Error("creating a user with a weak password: want it refused")
+	}
+
+	err := a.run(t, testPassword+"\n", "create-user", "-password-stdin", "-role", bookstore.RoleAdministrator,
+		"-email", "admin@example.com", "-name", "Admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := a.account(t, "admin@example.com")
+	if ok, err := a.auth.Validate(admin.PasswordHash, testPassword); err != nil || !ok {
+		t.Errorf("validating the password read from stdin: got %v with error %v, want it valid", ok, err)
+	}
+	if admin.EmailVerifiedAt == nil {
+		t.Error("the email of the created account is not verified")
+	}
+	if roles := a.roleNames(t, admin); len(roles) != 1 || roles[0] != bookstore.RoleAdministrator {
+		t.Errorf("got roles %v, want the administrator role", roles)
+	}
+	if strings.Contains(out.String(), testPassword) {
+		t.Error("the password read from stdin was printed")
+	}
+
+	//without -password-stdin one is generated, and shown as it can't be found out otherwise
+	out.Reset()
+	if err = a.run(t, "", "create-user", "-email", "reader@example.com", "-name", "Reader"); err != nil {
+		t.Fatal(err)
+	}
+	generated := regexp.MustCompile(`Generated password: (\S+)`).FindStringSubmatch(out.String())
+	if generated == nil {
+		t.Fatalf("got output %q, want the generated password", out.String())
+	}
+	if ok, err := a.auth.Validate(a.account(t, "reader@example.com").PasswordHash, generated[1]); err != nil || !ok {
+		t.Errorf("validating the generated password: got %v with error %v, want it valid", ok, err)
+	}
+
+	if err = a.run(t, "", "create-user", "-email", "reader@example.com", "-name", "Reader"); err == nil {
+		t.Error("creating a user with a taken email: want it refused")
+	}
+	err = a.run(t, "", "create-user", "-role", "made-up", "-email", "other@example.com", "-name", "Other")
+	if err == nil || !strings.Contains(err.Error(), "was created") {
+		t.Errorf("granting an unknown role: got %v, want the account created without it", err)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	a, out := newTestApp(t)
+	if err := a.run(t, "", "create-user", "-email", "reader@example.com", "-name", "Reader"); err != nil {
+		t.Fatal(err)
+	}
+	reader := a.account(t, "reader@example.com")
+
+	//users are found by either their email or ID
+	if err := a.run(t, "", "promote", "reader@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.run(t, "", "promote", "-role", "editor", reader.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if roles := strings.Join(a.roleNames(t, reader), ","); roles != "administrator,editor" {
+		t.Errorf("got roles %s, want administrator and editor", roles)
+	}
+	out.Reset()
+	if err := a.run(t, "", "list-users"); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 ||
+		!regexp.MustCompile(reader.ID.String()+`\s+reader@example.com\s+Reader\s+administrator,editor\s+active`).MatchString(lines[1]) {
+		t.Errorf("got listing %q, want the header and the reader with their roles", out.String())
+	}
+
+	if err := a.run(t, "", "demote", "reader@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if roles := strings.Join(a.roleNames(t, reader), ","); roles != "editor" {
+		t.Errorf("got roles %s after demoting, want only editor", roles)
+	}
+	for _, args := range [][]string{{}, {"a@example.com", "b@example.com"}, {"nobody@example.com"}} {
+		if err := a.run(t, "", "promote", args...); err == nil {
+			t.Errorf("promoting %v: want it refused", args)
+		}
+	}
+}
+
+func TestResetPasswordAndRevokeSessions(t *testing.T) {
+	a, _ := newTestApp(t)
+	ctx := context.Background()
+	if err := a.run(t, "", "create-user", "-email", "reader@example.com", "-name", "Reader"); err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := a.auth.CreateSession(ctx, a.account(t, "reader@example.com"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = a.run(t, testPassword+"\n", "reset-password", "-password-stdin", "reader@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := a.auth.Validate(a.account(t, "reader@example.com").PasswordHash, testPassword); err != nil || !ok {
+		t.Errorf("validating the new password: got %v with error %v, want it valid", ok, err)
+	}
+	if _, err = a.auth.GetSession(ctx, token); err == nil {
+		t.Error("the session outlived resetting the password")
+	}
+
+	token, _, err = a.auth.CreateSession(ctx, a.account(t, "reader@example.com"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.run(t, "", "revoke-sessions", "reader@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.auth.GetSession(ctx, token); err == nil {
+		t.Error("the session outlived revoking the sessions")
+	}
+}
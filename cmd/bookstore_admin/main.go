@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/auth"
+	"github.com/thunder33345/bookstore/db/psql"
+	"github.com/thunder33345/bookstore/db/sqlite"
+)
+
+// storage is everything the commands need out of a storage backend
+type storage interface {
+	Init() error
+	CreateAccount(ctx context.Context, account bookstore.Account) (bookstore.Account, error)
+	GetAccount(ctx context.Context, accountID uuid.UUID) (bookstore.Account, error)
+	GetAccountByEmail(ctx context.Context, email string) (bookstore.Account, error)
+	ListAccounts(ctx context.Context, limit int, after uuid.UUID) ([]bookstore.Account, error)
+	UpdateAccount(ctx context.Context, account bookstore.Account) error
+	MarkEmailVerified(ctx context.Context, accountID uuid.UUID, email string, verifiedAt time.Time) error
+	ListAccountRoles(ctx context.Context, accountID uuid.UUID) ([]bookstore.Role, error)
+	AddAccountRole(ctx context.Context, accountID uuid.UUID, role string) error
+	RemoveAccountRole(ctx context.Context, accountID uuid.UUID, role string) error
+}
+
+// command is a subcommand, it gets the arguments following its name
+type command struct {
+	usage string
+	run   func(ctx context.Context, app *app, args []string) error
+}
+
+var commands = map[string]command{
+	"create-user":     {usage: "[-role role] [-password-stdin] -email email -name name", run: createUser},
+	"list-users":      {usage: "", run: listUsers},
+	"promote":         {usage: "[-role role] <user>", run: promote},
+	"demote":          {usage: "[-role role] <user>", run: demote},
+	"reset-password":  {usage: "[-password-stdin] <user>", run: resetPassword},
+	"revoke-sessions": {usage: "<user>", run: revokeSessions},
+}
+
+// app is what the commands work with
+type app struct {
+	db   storage
+	auth *auth.Auth
+	//in is where passwords are read from and out is where results are printed, stdin and stdout outside of tests
+	in  io.Reader
+	out io.Writer
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error loading .env file: %v\n", err)
+	}
+	db, authService, err := openStorage(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening db: %v\n", err)
+		os.Exit(1)
+	}
+	if err = db.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing db: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = cmd.run(context.Background(), &app{db: db, auth: authService, in: os.Stdin, out: os.Stdout}, os.Args[2:])
+	if err == flag.ErrHelp {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: bookstore_admin <command> [flags]\n\nCommands:\n")
+	for _, name := range []string{"create-user", "list-users", "promote", "demote", "reset-password", "revoke-sessions"} {
+		fmt.Fprintf(os.Stderr, "  %s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\n<user> is either the ID or the email of the account\n")
+}
+
+// openStorage connects to the same db as bookstore_server, using DATABASE_URL
+// the in memory store is rejected, as nothing done to it would outlive the command
+func openStorage(connStr string) (storage, *auth.Auth, error) {
+	switch {
+	case connStr == "", strings.HasPrefix(connStr, "memory://"):
+		return nil, nil, fmt.Errorf("ENV DATABASE_URL should point to a psql or sqlite db, the in memory store isn't shared with the server")
+	case strings.HasPrefix(connStr, "sqlite://"), strings.HasPrefix(connStr, "sqlite3://"):
+		_, dsn, _ := strings.Cut(connStr, "://")
+		db, err := sqlite.New(dsn)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, auth.NewAuth(db), nil
+	default:
+		db, err := psql.New(connStr)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, auth.NewAuth(db), nil
+	}
+}
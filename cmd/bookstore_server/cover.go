@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/cover"
+	"github.com/thunder33345/bookstore/cover/fs"
+	"github.com/thunder33345/bookstore/cover/s3"
+)
+
+// coverStore is what rest.Handler expects out of a cover store, which both fs.Store and s3.Store are
+type coverStore interface {
+	StoreCover(ctx context.Context, isbn string, img io.ReadSeeker) error
+	RemoveCover(ctx context.Context, isbn string) error
+	GetCoverURL(ctx context.Context, isbn string) (string, error)
+	ResolveCoverURL(ctx context.Context, book bookstore.Book) (string, error)
+	ResolveCoverVariantURLs(ctx context.Context, book bookstore.Book) (map[string]string, error)
+}
+
+// openCoverStore picks where covers are stored from COVER_STORE, fs(the default) or s3
+// fs keeps them in ./data/covers and serves them itself through the returned handler mounted on /covers/
+// s3 keeps them in a bucket configured through COVER_S3_* envs, which serves them instead, so there's no handler
+func openCoverStore(db storage, processor *cover.Processor) (coverStore, http.HandlerFunc, error) {
+	switch backend := strings.ToLower(envDefault("COVER_STORE", "fs")); backend {
+	case "fs":
+		store, err := fs.NewStore("./data/covers", os.Getenv("URL")+"/covers/", db, processor)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.HandleCoverRequest, nil
+	case "s3":
+		pathStyle, err := envBool("COVER_S3_PATH_STYLE", false)
+		if err != nil {
+			return nil, nil, err
+		}
+		presignExpiry, err := envDuration("COVER_S3_PRESIGN_EXPIRY", 24*time.Hour)
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg := s3.Config{
+			Endpoint:        os.Getenv("COVER_S3_ENDPOINT"),
+			Region:          os.Getenv("COVER_S3_REGION"),
+			Bucket:          os.Getenv("COVER_S3_BUCKET"),
+			AccessKeyID:     os.Getenv("COVER_S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("COVER_S3_SECRET_ACCESS_KEY"),
+			PathStyle:       pathStyle,
+			Prefix:          os.Getenv("COVER_S3_PREFIX"),
+			PublicURL:       os.Getenv("COVER_S3_PUBLIC_URL"),
+			PresignExpiry:   presignExpiry,
+		}
+		if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+			return nil, nil, fmt.Errorf("ENV COVER_S3_ENDPOINT, COVER_S3_BUCKET, COVER_S3_ACCESS_KEY_ID and COVER_S3_SECRET_ACCESS_KEY are required when using s3")
+		}
+		store, err := s3.NewStore(cfg, db, processor, &http.Client{Timeout: time.Minute})
+		if err != nil {
+			return nil, nil, fmt.Errorf("setting up s3 cover store: %w", err)
+		}
+		fmt.Printf("Storing covers in bucket %s at %s\n", cfg.Bucket, cfg.Endpoint)
+		return store, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("parsing ENV COVER_STORE: unknown store %q, should be fs or s3", backend)
+	}
+}
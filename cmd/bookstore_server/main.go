@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,13 +19,17 @@ import (
 	"github.com/go-chi/render"
 	"github.com/joho/godotenv"
 	"github.com/thunder33345/bookstore/auth"
-	"github.com/thunder33345/bookstore/cover/fs"
-	"github.com/thunder33345/bookstore/db/psql"
+	"github.com/thunder33345/bookstore/cover"
+	//only decodes AVIF when built with the avif tag
+	_ "github.com/thunder33345/bookstore/cover/avif"
+	//only encodes WebP when built with the webp tag
+	_ "github.com/thunder33345/bookstore/cover/webp"
 	"github.com/thunder33345/bookstore/http/rest"
+	"github.com/thunder33345/bookstore/mail"
 )
 
 var routes = flag.Bool("routes", false, "Generate router documentation")
-var debugRoutes = flag.Bool("debug-routes", false, "Mount unprotected debug route")
+var debugRoutes = flag.Bool("debug-routes", false, "Mount unprotected debug route, for development only")
 var debugIgnoreInvalidISBN = flag.Bool("debug-isbn", false, "Disable ISBN validation")
 
 func main() {
@@ -33,11 +40,6 @@ func main() {
 		fmt.Printf("Continuing anyways...\n")
 	}
 
-	if os.Getenv("DATABASE_URL") == "" {
-		fmt.Printf("ENV DATABASE_URL missing\nShould be the connection string used to connect to psql DB.\n")
-		return
-	}
-
 	if os.Getenv("URL") == "" {
 		fmt.Printf("ENV URL missing\nShould be the canonical URL.\n")
 		return
@@ -48,7 +50,7 @@ func main() {
 	}
 
 	fmt.Printf("Initilizing db\n")
-	db, err := psql.New(os.Getenv("DATABASE_URL"))
+	db, err := openStorage(os.Getenv("DATABASE_URL"))
 	if err != nil {
 		panic(err)
 	}
@@ -58,16 +60,103 @@ func main() {
 	}
 
 	fmt.Printf("Initilizing auth service\n")
-	authService := auth.NewAuth(db, 10)
+	absoluteTimeout, err := envDuration("SESSION_ABSOLUTE_TIMEOUT", 30*24*time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	idleTimeout, err := envDuration("SESSION_IDLE_TIMEOUT", 7*24*time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	resetTimeout, err := envDuration("PASSWORD_RESET_TIMEOUT", time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	verifyTimeout, err := envDuration("VERIFY_EMAIL_TIMEOUT", 24*time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	lockoutThreshold, err := envInt("LOGIN_LOCKOUT_THRESHOLD", 10)
+	if err != nil {
+		panic(err)
+	}
+	lockoutDuration, err := envDuration("LOGIN_LOCKOUT_DURATION", time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	impersonationTimeout, err := envDuration("IMPERSONATION_TIMEOUT", time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	accessTokenOptions, err := openAccessTokens()
+	if err != nil {
+		panic(err)
+	}
+	authService := auth.NewAuth(db, append([]auth.Option{auth.WithAbsoluteTimeout(absoluteTimeout), auth.WithIdleTimeout(idleTimeout),
+		auth.WithPasswordResetTimeout(resetTimeout), auth.WithEmailVerificationTimeout(verifyTimeout),
+		auth.WithLockout(lockoutThreshold, lockoutDuration), auth.WithTOTPIssuer(envDefault("TOTP_ISSUER", "Bookstore")),
+		auth.WithImpersonationTimeout(impersonationTimeout)},
+		accessTokenOptions...)...)
+
+	fmt.Printf("Initilizing mailer\n")
+	mailer, err := openMailer()
+	if err != nil {
+		panic(err)
+	}
 
 	fmt.Printf("Initilizing cover store\n")
-	coverService, err := fs.NewStore("./data/covers", os.Getenv("URL")+"/covers/", db)
+	coverVariants, err := openCoverVariants()
+	if err != nil {
+		panic(err)
+	}
+	coverFormatOptions, err := openCoverFormats()
+	if err != nil {
+		panic(err)
+	}
+	coverLimits, err := openCoverLimits()
+	if err != nil {
+		panic(err)
+	}
+	coverProcessor, err := cover.NewProcessor(
+		append([]cover.Option{cover.WithVariants(coverVariants...), cover.WithLimits(coverLimits)}, coverFormatOptions...)...)
+	if err != nil {
+		panic(err)
+	}
+	coverService, coverHandler, err := openCoverStore(db, coverProcessor)
 	if err != nil {
 		panic(err)
 	}
 
 	fmt.Printf("Initilizing REST handler\n")
-	restService := rest.NewHandler(db, coverService, authService, rest.WithIgnoreInvalidISBN(*debugIgnoreInvalidISBN))
+	requireVerified, err := envBool("REQUIRE_VERIFIED_EMAIL", false)
+	if err != nil {
+		panic(err)
+	}
+	oidcOptions, err := openOIDCProviders()
+	if err != nil {
+		panic(err)
+	}
+	cookieOptions, err := openSessionCookie(absoluteTimeout)
+	if err != nil {
+		panic(err)
+	}
+	registrationOptions, err := openRegistration()
+	if err != nil {
+		panic(err)
+	}
+	restOptions := append([]rest.Option{rest.WithIgnoreInvalidISBN(*debugIgnoreInvalidISBN),
+		rest.WithMailer(mailer), rest.WithRequireVerifiedEmail(requireVerified),
+		rest.WithMaxCoverUpload(coverProcessor.MaxBytes()),
+		rest.WithPasswordResetURL(envURL("PASSWORD_RESET_URL", "/reset-password")),
+		rest.WithVerifyEmailURL(envURL("VERIFY_EMAIL_URL", "/verify-email")),
+		rest.WithErrorHandler(func(err error) {
+			fmt.Printf("Error in background task: %v\n", err)
+		}),
+		rest.WithImpersonationLog(func(req rest.ImpersonatedRequest) {
+			fmt.Printf("Impersonated request: %s %s by %s as %s(session=%s request=%s ip=%s)\n",
+				req.Method, req.Path, req.ImpersonatorID, req.AccountID, req.SessionID, req.RequestID, req.IP)
+		})}, append(append(oidcOptions, cookieOptions...), registrationOptions...)...)
+	restService := rest.NewHandler(db, coverService, authService, restOptions...)
 
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
@@ -87,8 +176,10 @@ func main() {
 
 		if *debugRoutes {
 			//intentionally exposes the user management endpoint without any auth middleware
+			//anything granting privileges or undoing the protections of accounts is left out, those need an admin session
 			r.Route("/debug/users", func(r chi.Router) {
 				fmt.Printf("Mounting unprotected debug router: /api/v1/debug/users\n")
+				fmt.Printf("Anyone can manage users through it, use bookstore_admin to manage users in production\n")
 				r.With(restService.PaginationLimitMiddleware, restService.PaginationUUIDMiddleware).Get("/", restService.ListUsers)
 				r.Post("/", restService.CreateUser)
 				r.With(rest.UUIDCtx).Route("/{uuid}", func(r chi.Router) {
@@ -97,14 +188,24 @@ func main() {
 					r.Delete("/", restService.DeleteUser)
 					r.Post("/password", restService.UpdateUserPassword)
 					r.Delete("/password", restService.DeleteUserSessions)
-					r.Delete("/sessions", restService.DeleteUserSessions)
+					r.Route("/sessions", func(r chi.Router) {
+						r.Get("/", restService.ListUserSessions)
+						r.Delete("/", restService.DeleteUserSessions)
+						r.With(rest.SessionIDCtx).Delete("/{sessionID}", restService.RevokeUserSession)
+					})
+					r.With(restService.PaginationLimitMiddleware).Get("/login-attempts", restService.ListUserLoginAttempts)
+					r.Get("/roles", restService.ListUserRoles)
 				})
 			})
 		}
 	})
 
-	//mount the cover handler
-	r.Get("/covers/{image}", coverService.HandleCoverRequest)
+	//mount the cover handler, chi doesn't route HEAD to GET handlers by itself
+	//there's none when covers are served by the bucket
+	if coverHandler != nil {
+		r.Get("/covers/{image}", coverHandler)
+		r.Head("/covers/{image}", coverHandler)
+	}
 
 	fmt.Printf("Initilizing server\n")
 	server := &http.Server{Addr: os.Getenv("LISTEN"), Handler: r}
@@ -118,6 +219,11 @@ func main() {
 		return
 	}
 
+	//clean up expired sessions in the background, so they don't pile up in the store
+	go authService.RunSweeper(serverCtx, 10*time.Minute, func(err error) {
+		fmt.Printf("Error sweeping sessions: %v\n", err)
+	})
+
 	fmt.Printf("Listening for request on %s\n", server.Addr)
 	err = server.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
@@ -128,6 +234,265 @@ func main() {
 	fmt.Printf("Server Exited\n")
 }
 
+// openMailer creates an SMTP mailer when SMTP_ADDR is set
+// otherwise emails are written to ./data/outbox, which is good enough for development
+func openMailer() (mail.Mailer, error) {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		fmt.Printf("ENV SMTP_ADDR missing, writing emails to ./data/outbox\n")
+		return mail.NewOutbox("./data/outbox")
+	}
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		return nil, fmt.Errorf("ENV MAIL_FROM is required when using SMTP")
+	}
+	return mail.NewSMTP(addr, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+}
+
+// openAccessTokens enables access tokens when ACCESS_TOKEN_KEYS lists the signing keys
+// keys are written as id:secret separated by commas, the secret is base64 encoded and at least 32 bytes
+// the first key signs new tokens, the others are kept to verify tokens signed before rotating keys
+func openAccessTokens() ([]auth.Option, error) {
+	value := os.Getenv("ACCESS_TOKEN_KEYS")
+	if value == "" {
+		return nil, nil
+	}
+	ttl, err := envDuration("ACCESS_TOKEN_TTL", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	var keys []auth.SigningKey
+	for _, entry := range strings.Split(value, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("parsing ENV ACCESS_TOKEN_KEYS: %q should be id:secret", entry)
+		}
+		secret, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("parsing ENV ACCESS_TOKEN_KEYS: decoding secret of key %s: %w", id, err)
+		}
+		if len(secret) < 32 {
+			return nil, fmt.Errorf("parsing ENV ACCESS_TOKEN_KEYS: secret of key %s is shorter than 32 bytes", id)
+		}
+		keys = append(keys, auth.SigningKey{ID: id, Secret: secret})
+	}
+	return []auth.Option{auth.WithAccessTokens(ttl, keys...)}, nil
+}
+
+// openSessionCookie enables session cookies when SESSION_COOKIE names the cookie
+// the cookie lasts as long as the session could, as it's useless past that
+func openSessionCookie(maxAge time.Duration) ([]rest.Option, error) {
+	name := os.Getenv("SESSION_COOKIE")
+	if name == "" {
+		return nil, nil
+	}
+	secure, err := envBool("SESSION_COOKIE_SECURE", true)
+	if err != nil {
+		return nil, err
+	}
+	var sameSite http.SameSite
+	switch value := strings.ToLower(envDefault("SESSION_COOKIE_SAMESITE", "lax")); value {
+	case "lax":
+		sameSite = http.SameSiteLaxMode
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("parsing ENV SESSION_COOKIE_SAMESITE: unknown mode %q, should be lax, strict or none", value)
+	}
+	return []rest.Option{rest.WithSessionCookie(name, maxAge, secure, sameSite)}, nil
+}
+
+// openCoverVariants reads the sizes covers are scaled down to from COVER_SIZES, falling back to cover.DefaultVariants
+// sizes are written as name=WIDTHxHEIGHT separated by commas, e.g. thumb=160x240
+func openCoverVariants() ([]cover.Variant, error) {
+	value := os.Getenv("COVER_SIZES")
+	if value == "" {
+		return cover.DefaultVariants, nil
+	}
+	var variants []cover.Variant
+	for _, entry := range strings.Split(value, ",") {
+		name, size, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" || strings.ContainsAny(name, "/.") {
+			return nil, fmt.Errorf("parsing ENV COVER_SIZES: %q should be name=WIDTHxHEIGHT", entry)
+		}
+		width, height, err := parseSize(size)
+		if err != nil || width == 0 || height == 0 {
+			return nil, fmt.Errorf("parsing ENV COVER_SIZES: invalid size of %s", name)
+		}
+		variants = append(variants, cover.Variant{Name: name, MaxWidth: width, MaxHeight: height})
+	}
+	return variants, nil
+}
+
+// openCoverLimits reads the bounds uploaded covers have to fall within
+// COVER_MIN_SIZE and COVER_MAX_SIZE are written as WIDTHxHEIGHT, the aspect ratios are the width divided by the height
+// COVER_MAX_BYTES bounds the size of the uploaded file
+func openCoverLimits() (cover.Limits, error) {
+	limits := cover.DefaultLimits
+	var err error
+	if value := os.Getenv("COVER_MIN_SIZE"); value != "" {
+		if limits.MinWidth, limits.MinHeight, err = parseSize(value); err != nil {
+			return cover.Limits{}, fmt.Errorf("parsing ENV COVER_MIN_SIZE: %w", err)
+		}
+	}
+	if value := os.Getenv("COVER_MAX_SIZE"); value != "" {
+		if limits.MaxWidth, limits.MaxHeight, err = parseSize(value); err != nil {
+			return cover.Limits{}, fmt.Errorf("parsing ENV COVER_MAX_SIZE: %w", err)
+		}
+	}
+	if limits.MinAspectRatio, err = envFloat("COVER_MIN_ASPECT_RATIO", 0); err != nil {
+		return cover.Limits{}, err
+	}
+	if limits.MaxAspectRatio, err = envFloat("COVER_MAX_ASPECT_RATIO", 0); err != nil {
+		return cover.Limits{}, err
+	}
+	maxBytes, err := envInt("COVER_MAX_BYTES", int(limits.MaxBytes))
+	if err != nil {
+		return cover.Limits{}, err
+	}
+	limits.MaxBytes = int64(maxBytes)
+	return limits, nil
+}
+
+// parseSize parses a size written as WIDTHxHEIGHT, e.g. 160x240
+func parseSize(size string) (int, int, error) {
+	width, height, ok := strings.Cut(size, "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q should be WIDTHxHEIGHT", size)
+	}
+	w, err := strconv.Atoi(width)
+	if err != nil || w < 0 {
+		return 0, 0, fmt.Errorf("invalid width %q", width)
+	}
+	h, err := strconv.Atoi(height)
+	if err != nil || h < 0 {
+		return 0, 0, fmt.Errorf("invalid height %q", height)
+	}
+	return w, h, nil
+}
+
+// openCoverFormats reads the format covers are converted to from COVER_STORAGE_FORMAT,
+// and the formats they are also served in from COVER_ALTERNATE_FORMATS, formats are named like jpeg or png
+// only formats with an encoder work for either, which WebP and AVIF don't have, so they are refused
+func openCoverFormats() ([]cover.Option, error) {
+	var options []cover.Option
+	if name := os.Getenv("COVER_STORAGE_FORMAT"); name != "" {
+		format, ok := cover.LookupFormat(name)
+		if !ok {
+			return nil, fmt.Errorf("parsing ENV COVER_STORAGE_FORMAT: unknown format %q", name)
+		}
+		options = append(options, cover.WithStorageFormat(format))
+	}
+	var alternates []cover.Format
+	for _, name := range strings.Split(os.Getenv("COVER_ALTERNATE_FORMATS"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		format, ok := cover.LookupFormat(name)
+		if !ok {
+			return nil, fmt.Errorf("parsing ENV COVER_ALTERNATE_FORMATS: unknown format %q", name)
+		}
+		alternates = append(alternates, format)
+	}
+	if len(alternates) > 0 {
+		options = append(options, cover.WithAlternateFormats(alternates...))
+	}
+	return options, nil
+}
+
+// openRegistration reads the registration policy from REGISTRATION, and the allowed email domains from REGISTRATION_EMAIL_DOMAINS
+func openRegistration() ([]rest.Option, error) {
+	policy := rest.RegistrationPolicy(strings.ToLower(envDefault("REGISTRATION", string(rest.RegistrationOpen))))
+	switch policy {
+	case rest.RegistrationOpen, rest.RegistrationInviteOnly, rest.RegistrationClosed:
+	default:
+		return nil, fmt.Errorf("parsing ENV REGISTRATION: unknown policy %q, should be open, invite-only or closed", policy)
+	}
+	options := []rest.Option{rest.WithRegistration(policy)}
+
+	var domains []string
+	for _, domain := range strings.Split(os.Getenv("REGISTRATION_EMAIL_DOMAINS"), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	if len(domains) > 0 {
+		options = append(options, rest.WithAllowedEmailDomains(domains...))
+	}
+	return options, nil
+}
+
+// envURL returns the env as is, falling back to path on the canonical URL
+// this is used for the pages linked in emails, which are usually served by the frontend
+func envURL(key string, path string) string {
+	if u := os.Getenv(key); u != "" {
+		return u
+	}
+	return os.Getenv("URL") + path
+}
+
+// envDefault returns the env, falling back if it's unset
+func envDefault(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// envInt parses the env as an int, returning fallback if it's unset
+func envInt(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("parsing ENV %s: %w", key, err)
+	}
+	return i, nil
+}
+
+// envBool parses the env as a bool, returning fallback if it's unset
+func envBool(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("parsing ENV %s: %w", key, err)
+	}
+	return b, nil
+}
+
+// envFloat parses the env as a float, returning fallback if it's unset
+func envFloat(key string, fallback float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing ENV %s: %w", key, err)
+	}
+	return f, nil
+}
+
+// envDuration parses the env as a duration(e.g. 720h), returning fallback if it's unset
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("parsing ENV %s: %w", key, err)
+	}
+	return d, nil
+}
+
 func gracefulShutdown(server *http.Server) context.Context {
 	//some context and signals for graceful shutdown
 	serverCtx, serverStopCtx := context.WithCancel(context.Background())
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/thunder33345/bookstore/http/rest"
+	"github.com/thunder33345/bookstore/oidc"
+)
+
+// openOIDCProviders sets up the identity providers listed in OIDC_PROVIDERS, each configured through OIDC_<NAME>_* envs
+func openOIDCProviders() ([]rest.Option, error) {
+	var options []rest.Option
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		cfg := oidc.Config{
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  envURL(prefix+"REDIRECT_URL", "/api/v1/account/oidc/"+name+"/callback"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+			GroupsClaim:  os.Getenv(prefix + "GROUPS_CLAIM"),
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("ENV %sISSUER and %sCLIENT_ID are required", prefix, prefix)
+		}
+		provision, err := envBool(prefix+"PROVISION", false)
+		if err != nil {
+			return nil, err
+		}
+		groupRoles, err := parseGroupRoles(os.Getenv(prefix + "GROUP_ROLES"))
+		if err != nil {
+			return nil, fmt.Errorf("parsing ENV %sGROUP_ROLES: %w", prefix, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		provider, err := oidc.NewProvider(ctx, cfg, nil)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("setting up oidc provider %s: %w", name, err)
+		}
+		fmt.Printf("Mounting OIDC provider %s on /api/v1/account/oidc/%s\n", name, name)
+		options = append(options, rest.WithOIDCProvider(name, provider, provision, groupRoles))
+	}
+	return options, nil
+}
+
+// parseGroupRoles parses a list of group=role pairs separated by commas
+func parseGroupRoles(value string) (map[string]string, error) {
+	groupRoles := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(pair, "=")
+		if !ok || group == "" || role == "" {
+			return nil, fmt.Errorf("%q is not a group=role pair", pair)
+		}
+		groupRoles[group] = role
+	}
+	return groupRoles, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/db/memory"
+	"github.com/thunder33345/bookstore/db/psql"
+	"github.com/thunder33345/bookstore/db/sqlite"
+)
+
+// storage is everything the server needs out of a storage backend
+// it is the union of what rest.Handler, auth.Auth and the cover stores each expect
+type storage interface {
+	Init() error
+	CreateGenre(ctx context.Context, genre bookstore.Genre) (bookstore.Genre, error)
+	GetGenre(ctx context.Context, genreID uuid.UUID) (bookstore.Genre, error)
+	ListGenres(ctx context.Context, limit int, after uuid.UUID) ([]bookstore.Genre, error)
+	UpdateGenre(ctx context.Context, genre bookstore.Genre) error
+	DeleteGenre(ctx context.Context, genreID uuid.UUID) error
+	CreateAuthor(ctx context.Context, author bookstore.Author) (bookstore.Author, error)
+	GetAuthor(ctx context.Context, authorID uuid.UUID) (bookstore.Author, error)
+	ListAuthors(ctx context.Context, limit int, after uuid.UUID) ([]bookstore.Author, error)
+	UpdateAuthor(ctx context.Context, author bookstore.Author) error
+	DeleteAuthor(ctx context.Context, authorID uuid.UUID) error
+	CreateBook(ctx context.Context, book bookstore.Book) (bookstore.Book, error)
+	GetBook(ctx context.Context, bookID string) (bookstore.Book, error)
+	ListBooks(ctx context.Context, limit int, after string, genresId []uuid.UUID, authorsId []uuid.UUID, searchTitle string) ([]bookstore.Book, error)
+	UpdateBook(ctx context.Context, book bookstore.Book) error
+	DeleteBook(ctx context.Context, bookID string) error
+	CreateAccount(ctx context.Context, account bookstore.Account) (bookstore.Account, error)
+	GetAccount(ctx context.Context, accountID uuid.UUID) (bookstore.Account, error)
+	GetAccountByEmail(ctx context.Context, email string) (bookstore.Account, error)
+	GetAccountByIdentity(ctx context.Context, provider string, subject string) (bookstore.Account, error)
+	CreateIdentity(ctx context.Context, identity bookstore.Identity) error
+	ListIdentities(ctx context.Context, accountID uuid.UUID) ([]bookstore.Identity, error)
+	ListAccounts(ctx context.Context, limit int, after uuid.UUID) ([]bookstore.Account, error)
+	UpdateAccount(ctx context.Context, account bookstore.Account) error
+	SafeUpdateAccount(ctx context.Context, account bookstore.Account) error
+	MarkEmailVerified(ctx context.Context, accountID uuid.UUID, email string, verifiedAt time.Time) error
+	SuspendAccount(ctx context.Context, accountID uuid.UUID, suspension bookstore.Suspension) error
+	ReinstateAccount(ctx context.Context, accountID uuid.UUID) error
+	AnonymizeAccount(ctx context.Context, account bookstore.Account) error
+	DeleteAccount(ctx context.Context, accountID uuid.UUID) error
+	ListRoles(ctx context.Context) ([]bookstore.Role, error)
+	ListAccountRoles(ctx context.Context, accountID uuid.UUID) ([]bookstore.Role, error)
+	GetAccountPermissions(ctx context.Context, accountID uuid.UUID) ([]bookstore.Permission, error)
+	AddAccountRole(ctx context.Context, accountID uuid.UUID, role string) error
+	RemoveAccountRole(ctx context.Context, accountID uuid.UUID, role string) error
+
+	UpsertCoverData(ctx context.Context, cover bookstore.CoverData) (bookstore.CoverData, error)
+	GetCoverData(ctx context.Context, isbn string) (bookstore.CoverData, error)
+	DeleteCoverData(ctx context.Context, isbn string) error
+
+	StoreSession(ctx context.Context, tokenHash string, account bookstore.Account, meta bookstore.SessionMeta) error
+	GetSession(ctx context.Context, tokenHash string) (bookstore.Session, error)
+	TouchSession(ctx context.Context, tokenHash string, lastSeen time.Time) error
+	RotateSession(ctx context.Context, tokenHash string, newTokenHash string, lastSeen time.Time) error
+	DeleteRotatedSession(ctx context.Context, tokenHash string) (bool, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+	DeleteSessionsFor(ctx context.Context, accountID uuid.UUID) error
+	ListSessions(ctx context.Context, accountID uuid.UUID) ([]bookstore.SessionMeta, error)
+	DeleteSessionByID(ctx context.Context, accountID uuid.UUID, sessionID uuid.UUID) error
+	DeleteExpiredSessions(ctx context.Context, now time.Time, idleBefore time.Time) error
+	StoreAPIKey(ctx context.Context, keyHash string, account bookstore.Account, key bookstore.APIKey) error
+	GetAPIKey(ctx context.Context, keyHash string) (bookstore.Account, bookstore.APIKey, error)
+	TouchAPIKey(ctx context.Context, keyID uuid.UUID, lastUsed time.Time) error
+	ListAPIKeys(ctx context.Context, accountID uuid.UUID) ([]bookstore.APIKey, error)
+	DeleteAPIKey(ctx context.Context, accountID uuid.UUID, keyID uuid.UUID) error
+	StorePasswordReset(ctx context.Context, tokenHash string, accountID uuid.UUID, expiresAt time.Time) error
+	ConsumePasswordReset(ctx context.Context, tokenHash string) (uuid.UUID, time.Time, error)
+	DeleteExpiredPasswordResets(ctx context.Context, now time.Time) error
+	StoreEmailVerification(ctx context.Context, tokenHash string, accountID uuid.UUID, email string, expiresAt time.Time) error
+	ConsumeEmailVerification(ctx context.Context, tokenHash string) (uuid.UUID, string, time.Time, error)
+	DeleteExpiredEmailVerifications(ctx context.Context, now time.Time) error
+	IncrementLoginFailures(ctx context.Context, key string, now time.Time, resetBefore time.Time) (int, error)
+	BlockLogin(ctx context.Context, key string, until time.Time) error
+	GetLoginBlock(ctx context.Context, key string) (time.Time, error)
+	DeleteLoginThrottle(ctx context.Context, key string) error
+	DeleteExpiredLoginThrottles(ctx context.Context, now time.Time, before time.Time) error
+	StoreLoginAttempt(ctx context.Context, attempt bookstore.LoginAttempt) error
+	ListLoginAttempts(ctx context.Context, email string, limit int) ([]bookstore.LoginAttempt, error)
+	DeleteLoginAttempts(ctx context.Context, email string) error
+	DeleteLoginAttemptsBefore(ctx context.Context, before time.Time) error
+	StoreTOTP(ctx context.Context, totp bookstore.TOTP) error
+	GetTOTP(ctx context.Context, accountID uuid.UUID) (bookstore.TOTP, error)
+	EnableTOTP(ctx context.Context, accountID uuid.UUID, enabledAt time.Time) error
+	UseTOTPStep(ctx context.Context, accountID uuid.UUID, step int64) error
+	DeleteTOTP(ctx context.Context, accountID uuid.UUID) error
+	StoreRecoveryCodes(ctx context.Context, accountID uuid.UUID, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, accountID uuid.UUID, codeHash string) error
+	CountRecoveryCodes(ctx context.Context, accountID uuid.UUID) (int, error)
+	StoreLoginChallenge(ctx context.Context, tokenHash string, accountID uuid.UUID, expiresAt time.Time) error
+	GetLoginChallenge(ctx context.Context, tokenHash string) (uuid.UUID, time.Time, error)
+	DeleteLoginChallenge(ctx context.Context, tokenHash string) error
+	DeleteExpiredLoginChallenges(ctx context.Context, now time.Time) error
+	StoreOIDCState(ctx context.Context, stateHash string, state bookstore.OIDCState) error
+	ConsumeOIDCState(ctx context.Context, stateHash string) (bookstore.OIDCState, error)
+	DeleteExpiredOIDCStates(ctx context.Context, now time.Time) error
+	StoreInvite(ctx context.Context, codeHash string, invite bookstore.Invite) error
+	ListInvites(ctx context.Context) ([]bookstore.Invite, error)
+	DeleteInvite(ctx context.Context, inviteID uuid.UUID) error
+	UseInvite(ctx context.Context, codeHash string, email string, now time.Time) (bookstore.Invite, error)
+	ReleaseInvite(ctx context.Context, inviteID uuid.UUID) error
+}
+
+// openStorage picks the storage backend using the scheme of the connection string
+// sqlite:// (or sqlite3://) is followed by a go-sqlite3 DSN, usually just the path to the file
+// memory:// uses the in memory store, which needs no setup but loses everything on exit
+// it has to be asked for explicitly, so a missing DATABASE_URL doesn't silently throw away everything written
+// anything else is handed to psql as is, which accepts both URLs and key=value connection strings
+func openStorage(connStr string) (storage, error) {
+	switch {
+	case connStr == "":
+		return nil, fmt.Errorf("ENV DATABASE_URL missing, set it to memory:// to use the in memory store")
+	case strings.HasPrefix(connStr, "memory://"):
+		fmt.Printf("Using in memory store\nNothing will be persisted.\n")
+		return memory.New(), nil
+	case strings.HasPrefix(connStr, "sqlite://"), strings.HasPrefix(connStr, "sqlite3://"):
+		_, dsn, _ := strings.Cut(connStr, "://")
+		db, err := sqlite.New(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	default:
+		db, err := psql.New(connStr)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+}
@@ -0,0 +1,103 @@
+//go:build avif && cgo
+
+package avif
+
+/*
+#cgo pkg-config: libheif
+#include <stdlib.h>
+#include <libheif/heif.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"unsafe"
+)
+
+func init() {
+	C.heif_init(nil)
+	//the major brand is avif for still images and avis for image sequences, of which the primary image is decoded
+	image.RegisterFormat("avif", "????ftypavif", Decode, DecodeConfig)
+	image.RegisterFormat("avif", "????ftypavis", Decode, DecodeConfig)
+}
+
+// Decode reads the primary image of the AVIF file
+func Decode(r io.Reader) (image.Image, error) {
+	ctx, handle, err := open(r)
+	if err != nil {
+		return nil, err
+	}
+	defer C.heif_context_free(ctx)
+	defer C.heif_image_handle_release(handle)
+
+	var img *C.struct_heif_image
+	if err = heifError(C.heif_decode_image(handle, &img, C.heif_colorspace_RGB, C.heif_chroma_interleaved_RGBA, nil)); err != nil {
+		return nil, err
+	}
+	defer C.heif_image_release(img)
+
+	var stride C.int
+	plane := C.heif_image_get_plane_readonly(img, C.heif_channel_interleaved, &stride)
+	if plane == nil {
+		return nil, errors.New("avif: decoded image has no pixels")
+	}
+	width, height := int(C.heif_image_handle_get_width(handle)), int(C.heif_image_handle_get_height(handle))
+	pixels := unsafe.Slice((*byte)(unsafe.Pointer(plane)), int(stride)*height)
+	//the pixels belong to libheif, so they are copied out before the image is released
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		copy(dst.Pix[y*dst.Stride:y*dst.Stride+width*4], pixels[y*int(stride):])
+	}
+	return dst, nil
+}
+
+// DecodeConfig reads the size of the primary image of the AVIF file, without decoding it
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	ctx, handle, err := open(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer C.heif_context_free(ctx)
+	defer C.heif_image_handle_release(handle)
+
+	return image.Config{
+		ColorModel: color.NRGBAModel,
+		Width:      int(C.heif_image_handle_get_width(handle)),
+		Height:     int(C.heif_image_handle_get_height(handle)),
+	}, nil
+}
+
+// open parses the file, returning it along with its primary image, which both need to be released by the caller
+func open(r io.Reader) (*C.struct_heif_context, *C.struct_heif_image_handle, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil, errors.New("avif: empty file")
+	}
+	ctx := C.heif_context_alloc()
+	//libheif copies the file, so it doesn't hold on to Go memory
+	err = heifError(C.heif_context_read_from_memory(ctx, unsafe.Pointer(&data[0]), C.size_t(len(data)), nil))
+	if err != nil {
+		C.heif_context_free(ctx)
+		return nil, nil, err
+	}
+	var handle *C.struct_heif_image_handle
+	if err = heifError(C.heif_context_get_primary_image_handle(ctx, &handle)); err != nil {
+		C.heif_context_free(ctx)
+		return nil, nil, err
+	}
+	return ctx, handle, nil
+}
+
+// heifError converts the error returned by libheif, nil is returned when it succeeded
+func heifError(err C.struct_heif_error) error {
+	if err.code == C.heif_error_Ok {
+		return nil
+	}
+	return errors.New("avif: " + C.GoString(err.message))
+}
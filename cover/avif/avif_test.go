@@ -0,0 +1,80 @@
+//go:build avif && cgo
+
+package avif_test
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/thunder33345/bookstore/cover"
+	_ "github.com/thunder33345/bookstore/cover/avif"
+)
+
+func TestDecode(t *testing.T) {
+	data, err := os.ReadFile("testdata/cover.avif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "avif" || config.Width != 64 || config.Height != 96 {
+		t.Fatalf("got %s of %dx%d, want avif of 64x96", format, config.Width, config.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the file is a lossy encoding of a gradient, so only roughly the colors it was made of come back
+	r, g, b, a := img.At(40, 60).RGBA()
+	if far(r>>8, 160) || far(g>>8, 120) || far(b>>8, 128) || a>>8 != 255 {
+		t.Errorf("got pixel %d,%d,%d,%d, want about 160,120,128,255", r>>8, g>>8, b>>8, a>>8)
+	}
+}
+
+// far reports whether the channel is off by more than the compression could explain
+func far(got uint32, want uint32) bool {
+	return got+12 < want || got > want+12
+}
+
+func TestProcess(t *testing.T) {
+	data, err := os.ReadFile("testdata/cover.avif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//without an encoder AVIF is converted, as its metadata can only be removed by re-encoding it
+	processor, err := cover.NewProcessor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, renditions, err := processor.Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ContentType != cover.JPEG.ContentType {
+		t.Fatalf("stored as %s, want the opaque cover converted to image/jpeg", stored.ContentType)
+	}
+	if _, err = jpeg.Decode(bytes.NewReader(renditions[0].Data)); err != nil {
+		t.Errorf("converted cover isn't a JPEG: %v", err)
+	}
+
+	processor, err = cover.NewProcessor(cover.WithStorageFormat(cover.PNG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, renditions, err = processor.Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ContentType != cover.PNG.ContentType {
+		t.Fatalf("stored as %s, want image/png", stored.ContentType)
+	}
+	if _, err = png.Decode(bytes.NewReader(renditions[0].Data)); err != nil {
+		t.Errorf("converted cover isn't a PNG: %v", err)
+	}
+}
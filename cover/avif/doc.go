@@ -0,0 +1,4 @@
+// Package avif registers an AVIF decoder with the image package, which is what lets covers be uploaded in AVIF
+// the decoder uses libheif through cgo, so it's only built with the avif tag(go build -tags avif), which needs the
+// libheif headers and library installed, importing the package without the tag does nothing
+package avif
@@ -0,0 +1,292 @@
+// Package cover validates uploaded book covers and converts them into the files the cover stores keep
+package cover
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/thunder33345/bookstore"
+)
+
+// CacheControl lets covers be cached for a year without revalidating, as a new cover gets a new file name
+const CacheControl = "public, max-age=31536000, immutable"
+
+// Processor validates uploaded covers and turns them into renditions, which are the files stored for a cover
+// it's shared by the cover stores, which only differ in where the renditions are kept
+type Processor struct {
+	//variants are the sizes generated from every uploaded cover
+	variants []Variant
+	//formats are the formats accepted for uploads
+	formats []Format
+	//storageFormat is what uploads are converted to, they are stored as is when nil
+	storageFormat *Format
+	//alternateFormats are the formats covers are also converted to, picked by the Accept header
+	alternateFormats []Format
+	//limits are the bounds uploaded covers have to fall within
+	limits Limits
+}
+
+// NewProcessor creates a new processor, using DefaultVariants, DefaultFormats and DefaultLimits unless set by options
+func NewProcessor(options ...Option) (*Processor, error) {
+	p := Processor{
+		variants: DefaultVariants,
+		formats:  DefaultFormats,
+		limits:   DefaultLimits,
+	}
+	for _, option := range options {
+		p = option(p)
+	}
+	if p.storageFormat != nil && p.storageFormat.Encode == nil {
+		return nil, fmt.Errorf("storage format %s has no encoder", p.storageFormat.ContentType)
+	}
+	for _, f := range p.alternateFormats {
+		if f.Encode == nil {
+			return nil, fmt.Errorf("alternate format %s has no encoder", f.ContentType)
+		}
+	}
+	return &p, nil
+}
+
+// Rendition is one of the files stored for a cover
+type Rendition struct {
+	//Variant is the name of the variant, empty for the cover itself
+	Variant string
+	Format  Format
+	Data    []byte
+}
+
+// Read reads the upload into memory, the whole file is needed to strip its metadata
+// it stops reading past Limits.MaxBytes, rejecting the upload with bookstore.InvalidImageError
+func (p *Processor) Read(r io.Reader) ([]byte, error) {
+	if p.limits.MaxBytes <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, p.limits.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > p.limits.MaxBytes {
+		return nil, p.limits.fileTooLarge()
+	}
+	return data, nil
+}
+
+// MaxBytes returns the largest file accepted for uploads, 0 if there's no limit
+func (p *Processor) MaxBytes() int64 {
+	return p.limits.MaxBytes
+}
+
+// Process validates the upload and returns the format the cover is stored in, along with every rendition of it
+// the first rendition is the cover in the storage format, followed by its alternate formats and then its variants
+// uploads are fully decoded and checked against the limits, invalid ones are rejected with bookstore.InvalidImageError
+// EXIF, XMP and other metadata is stripped, with the EXIF orientation applied to the image itself
+// uploads which need re-encoding for that in a format without an encoder are converted to JPEG, or PNG if they have transparency
+func (p *Processor) Process(data []byte) (Format, []Rendition, error) {
+	if p.limits.MaxBytes > 0 && int64(len(data)) > p.limits.MaxBytes {
+		return Format{}, nil, p.limits.fileTooLarge()
+	}
+	//we detect and enforce the image types first
+	head := data
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	format, ok := p.format(sniff(head))
+	if !ok {
+		return Format{}, nil, bookstore.NewInvalidImageError(bookstore.ImageUnsupportedFormat, sniff(head)+" isn't accepted")
+	}
+	stripped, orientation, strippable, err := stripMetadata(format.ContentType, data)
+	if err != nil {
+		return Format{}, nil, bookstore.NewInvalidImageError(bookstore.ImageCorrupt, err.Error())
+	}
+
+	//the size is checked before decoding, so huge images are rejected before they are allocated
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return Format{}, nil, bookstore.NewInvalidImageError(bookstore.ImageUnsupportedFormat, "no decoder available for "+format.ContentType)
+	}
+	if err != nil {
+		return Format{}, nil, bookstore.NewInvalidImageError(bookstore.ImageCorrupt, err.Error())
+	}
+	width, height := config.Width, config.Height
+	if orientation >= 5 {
+		width, height = height, width
+	}
+	if err = p.limits.check(width, height); err != nil {
+		return Format{}, nil, err
+	}
+
+	//decoding the whole image rejects files which only start like an image, e.g. truncated ones
+	//the variants are scaled from the decoded image as well
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Format{}, nil, bookstore.NewInvalidImageError(bookstore.ImageCorrupt, err.Error())
+	}
+	decoded = orient(decoded, orientation)
+
+	stored := format
+	if p.storageFormat != nil {
+		stored = *p.storageFormat
+	}
+	//the upload is stored as is when possible, re-encoding it from the pixels otherwise drops the metadata as well
+	reencode := stored.ContentType != format.ContentType || orientation > 1 || !strippable
+	if reencode && stored.Encode == nil {
+		//formats which can't be re-encoded are converted instead, e.g. AVIF, whose metadata can't be stripped in place
+		stored = fallbackFormat(decoded)
+	}
+	cover := stripped
+	if reencode {
+		if cover, err = encode(stored, decoded); err != nil {
+			return Format{}, nil, fmt.Errorf("converting to %s: %w", stored.ContentType, err)
+		}
+	}
+
+	renditions, err := p.renditions(stored, cover, decoded)
+	if err != nil {
+		return Format{}, nil, err
+	}
+	return stored, renditions, nil
+}
+
+// renditions converts the cover to the alternate formats, and scales every variant down in all formats
+// variants share the data of the cover when it's small enough, formats without an encoder have their scaled variants
+// written in a fallback format instead, see VariantFormats
+func (p *Processor) renditions(stored Format, cover []byte, decoded image.Image) ([]Rendition, error) {
+	formats := p.RenditionFormats(stored)
+	originals := []Rendition{{Format: stored, Data: cover}}
+	for _, f := range formats[1:] {
+		data, err := encode(f, decoded)
+		if err != nil {
+			return nil, fmt.Errorf("converting to %s: %w", f.ContentType, err)
+		}
+		originals = append(originals, Rendition{Format: f, Data: data})
+	}
+
+	renditions := originals
+	var rgba *image.RGBA
+	for _, v := range p.variants {
+		width, height, scale := v.fit(decoded.Bounds())
+		if !scale {
+			for _, original := range originals {
+				renditions = append(renditions, Rendition{Variant: v.Name, Format: original.Format, Data: original.Data})
+			}
+			continue
+		}
+		//converted once and only when needed, as it's a copy of the full sized image
+		if rgba == nil {
+			rgba = toRGBA(decoded)
+		}
+		scaled := resize(rgba, width, height)
+		written := make(map[string]bool, len(formats))
+		for _, f := range formats {
+			if f.Encode == nil {
+				f = fallbackFormat(scaled)
+			}
+			//the fallback may be one of the alternate formats already
+			if written[f.ContentType] {
+				continue
+			}
+			written[f.ContentType] = true
+			data, err := encode(f, scaled)
+			if err != nil {
+				return nil, fmt.Errorf("creating %s variant in %s: %w", v.Name, f.ContentType, err)
+			}
+			renditions = append(renditions, Rendition{Variant: v.Name, Format: f, Data: data})
+		}
+	}
+	return renditions, nil
+}
+
+// fallbackFormat is what images are written in when their format has no encoder
+// PNG keeps the transparency of images having any, JPEG is smaller for the rest
+func fallbackFormat(img image.Image) Format {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return JPEG
+	}
+	return PNG
+}
+
+// encode writes the image in the format into memory
+func encode(f Format, img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := f.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Variants returns the sizes generated from every uploaded cover
+func (p *Processor) Variants() []Variant {
+	return p.variants
+}
+
+// Variant finds the configured variant by its name
+func (p *Processor) Variant(name string) (Variant, bool) {
+	for _, v := range p.variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// AlternateFormats returns the formats covers are also converted to
+func (p *Processor) AlternateFormats() []Format {
+	return p.alternateFormats
+}
+
+// format finds the accepted format by its content type
+func (p *Processor) format(contentType string) (Format, bool) {
+	for _, f := range p.formats {
+		if f.ContentType == contentType {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// FormatByExt finds the format of a stored file by its extension
+// alternate and fallback formats are included, as they don't need to be accepted for uploads
+func (p *Processor) FormatByExt(ext string) (Format, bool) {
+	for _, formats := range [][]Format{p.formats, p.alternateFormats, {JPEG, PNG}} {
+		for _, f := range formats {
+			if f.Ext == ext {
+				return f, true
+			}
+		}
+	}
+	return Format{}, false
+}
+
+// RenditionFormats are the formats the cover and its variants are written in, the stored format comes first
+func (p *Processor) RenditionFormats(stored Format) []Format {
+	formats := []Format{stored}
+	for _, f := range p.alternateFormats {
+		if f.ContentType != stored.ContentType {
+			formats = append(formats, f)
+		}
+	}
+	return formats
+}
+
+// VariantFormats are the formats the scaled variants of a cover may be written in, the stored format comes first
+// formats without an encoder are replaced by both fallbacks, as which one is used depends on the transparency of the cover
+func (p *Processor) VariantFormats(stored Format) []Format {
+	var formats []Format
+	seen := make(map[string]bool)
+	for _, f := range p.RenditionFormats(stored) {
+		candidates := []Format{f}
+		if f.Encode == nil {
+			candidates = []Format{JPEG, PNG}
+		}
+		for _, c := range candidates {
+			if !seen[c.ContentType] {
+				seen[c.ContentType] = true
+				formats = append(formats, c)
+			}
+		}
+	}
+	return formats
+}
@@ -0,0 +1,94 @@
+package cover
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"strings"
+
+	//registers the WebP decoder with the image package, the encoder is in cover/webp
+	_ "golang.org/x/image/webp"
+)
+
+// Format is an image format covers are accepted, stored or served in
+// decoding goes through the image package, WebP is decoded by golang.org/x/image/webp while AVIF is only accepted
+// once a decoder is registered with image.RegisterFormat, e.g. by building with the avif tag, see cover/avif
+// neither can be encoded unless an encoder is registered with RegisterEncoder, e.g. WebP by building with the webp tag
+// see cover/webp, until then they can't be stored or served as a conversion, only kept as uploaded
+// their scaled variants are written as JPEG instead, or PNG for images with transparency
+type Format struct {
+	ContentType string
+	//Ext is the extension of the files in the format, including the dot
+	Ext string
+	//Encode writes the image in the format, it's nil for formats which can only be decoded
+	Encode func(w io.Writer, img image.Image) error
+}
+
+var (
+	JPEG = Format{ContentType: "image/jpeg", Ext: ".jpeg", Encode: func(w io.Writer, img image.Image) error {
+		return jpeg.Encode(w, flatten(img), &jpeg.Options{Quality: jpegQuality})
+	}}
+	PNG = Format{ContentType: "image/png", Ext: ".png", Encode: png.Encode}
+	GIF = Format{ContentType: "image/gif", Ext: ".gif", Encode: func(w io.Writer, img image.Image) error {
+		return gif.Encode(w, img, nil)
+	}}
+	WebP = Format{ContentType: "image/webp", Ext: ".webp"}
+	AVIF = Format{ContentType: "image/avif", Ext: ".avif"}
+)
+
+// DefaultFormats are the formats accepted unless WithFormats is used
+var DefaultFormats = []Format{JPEG, PNG, GIF, WebP, AVIF}
+
+// RegisterEncoder sets the encoder of the format with the content type, in its variable as well as DefaultFormats
+// it's meant to be called from init, as formats are copied into processors and options when they are created
+func RegisterEncoder(contentType string, encode func(w io.Writer, img image.Image) error) {
+	for _, f := range []*Format{&JPEG, &PNG, &GIF, &WebP, &AVIF} {
+		if f.ContentType == contentType {
+			f.Encode = encode
+		}
+	}
+	for i := range DefaultFormats {
+		if DefaultFormats[i].ContentType == contentType {
+			DefaultFormats[i].Encode = encode
+		}
+	}
+}
+
+// jpegQuality is the quality covers are encoded at, uploads which don't need converting are stored untouched
+const jpegQuality = 85
+
+// LookupFormat finds the format in DefaultFormats by its name, which is the subtype of its content type(e.g. webp)
+func LookupFormat(name string) (Format, bool) {
+	for _, f := range DefaultFormats {
+		if f.ContentType == "image/"+strings.ToLower(name) {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// sniff detects the content type from the start of the file
+// http.DetectContentType doesn't know AVIF, which is an ISOBMFF(like MP4) file with its own brand
+func sniff(head []byte) string {
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" && (string(head[8:12]) == "avif" || string(head[8:12]) == "avis") {
+		return AVIF.ContentType
+	}
+	return http.DetectContentType(head)
+}
+
+// flatten draws the image over white if it has transparency, as JPEG has none and would show it as black
+func flatten(img image.Image) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
@@ -5,14 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"github.com/thanhpk/randstr"
 	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/cover"
 	"github.com/thunder33345/bookstore/http/rest"
 )
 
@@ -26,12 +30,14 @@ type Store struct {
 	mountPoint string
 	//db allows image store to update book's cover metadata
 	db dbStore
+	//processor validates uploads and converts them into the files stored for each cover
+	processor *cover.Processor
 }
 
 // NewStore creates a new image store
 // webMount should describe where Store.HandleCoverRequest is mounted, this is necessary for generating canonical URL
 // it should start with HTTP(s)://
-func NewStore(fileDir string, webMount string, db dbStore) (*Store, error) {
+func NewStore(fileDir string, webMount string, db dbStore, processor *cover.Processor) (*Store, error) {
 	fileDir, err := filepath.Abs(fileDir)
 	if err != nil {
 		return nil, err
@@ -40,41 +46,40 @@ func NewStore(fileDir string, webMount string, db dbStore) (*Store, error) {
 		storeDir:   fileDir,
 		mountPoint: webMount,
 		db:         db,
+		processor:  processor,
 	}, nil
 }
 
-// StoreCover stores the cover file system
+// StoreCover stores the cover file system, along with every rendition of it(see cover.Processor.Process)
+// invalid uploads are rejected with bookstore.InvalidImageError
 func (s *Store) StoreCover(ctx context.Context, isbn string, img io.ReadSeeker) error {
-	//we detect and enforce the image types first
-	fileType, err := detectType(img)
+	data, err := s.processor.Read(img)
 	if err != nil {
 		return err
 	}
-
-	ext, err := typeToExt(fileType)
+	stored, renditions, err := s.processor.Process(data)
 	if err != nil {
 		return err
 	}
 
 	//a random padding helps with bypassing caching
-	resourceName := isbn + "_" + randstr.Hex(4) + ext
-
-	//remove old covers before creating a new one, if any
-	err = s.removeCoverFile(ctx, isbn)
-	if err != nil {
-		return err
-	}
+	//the random suffix makes every upload a new URL, which is what allows covers to be cached as immutable
+	base := isbn + "_" + randstr.Hex(8)
+	resourceName := base + stored.Ext
 
-	//we create the img file, stored inside storeDir
-	dst, err := os.Create(s.getPath(resourceName))
+	//the old cover is only removed once the new one is in place, so a failed upload leaves it untouched
+	old, err := s.coverFile(ctx, isbn)
 	if err != nil {
 		return err
 	}
-	defer dst.Close()
 
-	_, err = io.Copy(dst, img)
-	if err != nil {
-		return err
+	//we create the img files, stored inside storeDir
+	for _, r := range renditions {
+		err = s.writeFile(cover.RenditionFile(base, r.Variant, r.Format.Ext), r.Data)
+		if err != nil {
+			_ = s.removeFiles(resourceName)
+			return err
+		}
 	}
 
 	//finally we update the stored resource into our db
@@ -82,10 +87,28 @@ func (s *Store) StoreCover(ctx context.Context, isbn string, img io.ReadSeeker)
 		ISBN:      isbn,
 		CoverFile: resourceName,
 	})
-	return err
+	if err != nil {
+		_ = s.removeFiles(resourceName)
+		return err
+	}
+	if old != "" {
+		//failing here only leaves the old files behind, the new cover is already in use
+		_ = s.removeFiles(old)
+	}
+	return nil
+}
+
+// writeFile creates the file inside storeDir, which is removed again if write fails
+func (s *Store) writeFile(name string, data []byte) error {
+	err := os.WriteFile(s.getPath(name), data, 0o644)
+	if err != nil {
+		_ = os.Remove(s.getPath(name))
+		return err
+	}
+	return nil
 }
 
-// RemoveCover remove the stored cover file from disk and db
+// RemoveCover remove the stored cover file along with its variants from disk and db
 func (s *Store) RemoveCover(ctx context.Context, isbn string) error {
 	err := s.removeCoverFile(ctx, isbn)
 	if err != nil {
@@ -102,18 +125,43 @@ func (s *Store) RemoveCover(ctx context.Context, isbn string) error {
 // removeCoverFile is an unexported helper to remove the file without touching db
 // note that the db entry should be updated after calling this
 func (s *Store) removeCoverFile(ctx context.Context, isbn string) error {
-	cover, err := s.db.GetCoverData(ctx, isbn)
+	coverFile, err := s.coverFile(ctx, isbn)
+	if err != nil || coverFile == "" {
+		return err
+	}
+	return s.removeFiles(coverFile)
+}
+
+// coverFile returns the file name of the current cover, empty string is returned when there is no cover
+func (s *Store) coverFile(ctx context.Context, isbn string) (string, error) {
+	data, err := s.db.GetCoverData(ctx, isbn)
 	if err != nil {
 		if isNoResultError(err) {
-			return nil
+			return "", nil
 		}
-		return err
+		return "", err
 	}
+	return data.CoverFile, nil
+}
 
-	err = os.Remove(s.getPath(cover.CoverFile))
-	//we allow removing from the db if the file no longer exist on disk
-	if err != nil && !os.IsNotExist(err) {
-		return err
+// removeFiles removes the cover file and the files of its variants and alternate formats
+// they are matched by name, so variants and formats which are no longer configured are removed too
+func (s *Store) removeFiles(coverFile string) error {
+	base := strings.TrimSuffix(coverFile, filepath.Ext(coverFile))
+	var files []string
+	for _, pattern := range []string{base + ".*", base + "_*"} {
+		matches, err := filepath.Glob(s.getPath(pattern))
+		if err != nil {
+			return err
+		}
+		files = append(files, matches...)
+	}
+	for _, path := range append(files, s.getPath(coverFile)) {
+		err := os.Remove(path)
+		//we allow removing from the db if the file no longer exist on disk
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
 	}
 	return nil
 }
@@ -138,15 +186,43 @@ func (s *Store) ResolveCoverURL(_ context.Context, book bookstore.Book) (string,
 	return s.mountPoint + *book.CoverData, nil
 }
 
+// ResolveCoverVariantURLs returns the URL of every variant of the cover by its name, nil is returned when there is no cover
+func (s *Store) ResolveCoverVariantURLs(_ context.Context, book bookstore.Book) (map[string]string, error) {
+	if book.CoverData == nil || *book.CoverData == "" {
+		return nil, nil
+	}
+	urls := make(map[string]string, len(s.processor.Variants()))
+	for _, v := range s.processor.Variants() {
+		urls[v.Name] = s.mountPoint + *book.CoverData + "?size=" + v.Name
+	}
+	return urls, nil
+}
+
 // HandleCoverRequest is a http handler mounted to match ResolveCover to display the cover file
 // it expects the {image} param to be available from chi
+// variants are served either by their own file name, or by the cover's file name with ?size= set to the variant
+// the original is served for covers uploaded before the variant was added
+// when there are alternate formats, the one served is picked using the Accept header
+// files are served with http.ServeContent, which handles HEAD, Range and conditional requests
 func (s *Store) HandleCoverRequest(w http.ResponseWriter, r *http.Request) {
 	fileName := chi.URLParam(r, "image")
 	if fileName == "" {
 		_ = render.Render(w, r, rest.ErrInvalidRequest(fmt.Errorf("no file name provided")))
 		return
 	}
+	size := r.URL.Query().Get("size")
+	if size != "" {
+		if _, ok := s.processor.Variant(size); !ok {
+			_ = render.Render(w, r, rest.ErrInvalidRequest(fmt.Errorf("unknown size %q", size)))
+			return
+		}
+	}
 
+	fileName, format, ok := s.negotiate(fileName, size, r.Header.Get("Accept"))
+	if !ok {
+		_ = render.Render(w, r, rest.ErrNotFound)
+		return
+	}
 	file, err := os.Open(s.getPath(fileName))
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -157,75 +233,112 @@ func (s *Store) HandleCoverRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer file.Close()
-
-	//we get the content type necessary for browsers to display it properly via file extension
-	typ, err := extToType(fileName)
+	info, err := file.Stat()
 	if err != nil {
-		_ = render.Render(w, r, rest.ErrInvalidRequest(fmt.Errorf("failed getting file type")))
+		_ = render.Render(w, r, rest.ErrInvalidRequest(fmt.Errorf("failed reading file: %w", err)))
 		return
 	}
-	w.Header().Set("Content-Type", typ)
-	w.WriteHeader(http.StatusOK)
-	_, _ = io.Copy(w, file)
-}
 
-// getPath is a helper to join create path prefixed with storeDir
-func (s *Store) getPath(cover string) string {
-	return filepath.Join(s.storeDir, cover)
+	if len(s.processor.AlternateFormats()) > 0 {
+		w.Header().Set("Vary", "Accept")
+	}
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("ETag", etag(fileName, info))
+	w.Header().Set("Cache-Control", cover.CacheControl)
+	http.ServeContent(w, r, fileName, info.ModTime(), file)
 }
 
-// dbStore is a minimal interface of psql.Store
-type dbStore interface {
-	UpsertCoverData(ctx context.Context, cover bookstore.CoverData) (bookstore.CoverData, error)
-	GetCoverData(ctx context.Context, isbn string) (bookstore.CoverData, error)
-	DeleteCoverData(ctx context.Context, isbn string) error
+// etag is the strong entity tag of the file being served
+// the file name tells apart the sizes and formats served on the same URL, the modification time and size guard
+// against a file name being reused for another upload
+func etag(fileName string, info os.FileInfo) string {
+	return fmt.Sprintf(`"%s-%x-%x"`, fileName, info.ModTime().UnixNano(), info.Size())
 }
 
-func detectType(file io.ReadSeeker) (string, error) {
-	//we create a buffer to detect img type
-	//512 bytes because that's at most of what http.DetectContentType considers
-	buff := make([]byte, 512)
-	_, err := file.Read(buff)
-	if err != nil {
-		return "", err
+// negotiate picks the file to serve out of the requested file in the size, and its alternate formats which exist
+// the format the Accept header prefers the most wins, the requested format wins ties and is served if none are accepted
+// the size is ignored if there are no files in it, which is the case for covers uploaded before the variant was added
+// scaled variants of formats without an encoder only exist in a fallback format, which is served for them instead
+func (s *Store) negotiate(fileName string, size string, accept string) (string, cover.Format, bool) {
+	requested, ok := s.processor.FormatByExt(filepath.Ext(fileName))
+	if !ok {
+		return "", cover.Format{}, false
 	}
+	base := strings.TrimSuffix(fileName, requested.Ext)
 
-	fileType := http.DetectContentType(buff)
-
-	//we seek back to the start before copying
-	_, err = file.Seek(0, io.SeekStart)
-	if err != nil {
-		return "", err
+	for _, variant := range []string{size, ""} {
+		formats := s.processor.RenditionFormats(requested)
+		if variant != "" {
+			formats = s.processor.VariantFormats(requested)
+		}
+		var best string
+		var bestFormat cover.Format
+		bestQuality := -1.0
+		for _, f := range formats {
+			name := cover.RenditionFile(base, variant, f.Ext)
+			if _, err := os.Stat(s.getPath(name)); err != nil {
+				continue
+			}
+			if q := acceptQuality(accept, f.ContentType); q > bestQuality {
+				best, bestFormat, bestQuality = name, f, q
+			}
+		}
+		if best != "" {
+			return best, bestFormat, true
+		}
 	}
-	return fileType, nil
+	return "", cover.Format{}, false
 }
 
-// typeToExt convert filetype into an extension
-func typeToExt(filetype string) (string, error) {
-	switch filetype {
-	case "image/jpeg":
-		return ".jpeg", nil
-	case "image/png":
-		return ".png", nil
-	default:
-		return "", bookstore.ErrInvalidFileType
-	}
+// getPath is a helper to join create path prefixed with storeDir
+func (s *Store) getPath(file string) string {
+	return filepath.Join(s.storeDir, file)
 }
 
-// extToType convert file extension back into content type
-func extToType(filename string) (string, error) {
-	ext := filepath.Ext(filename)
-	switch ext {
-	case ".jpeg":
-		return "image/jpeg", nil
-	case ".png":
-		return "image/png", nil
-	default:
-		return "", fmt.Errorf("unknown file extension")
-	}
+// dbStore is a minimal interface of psql.Store
+type dbStore interface {
+	UpsertCoverData(ctx context.Context, cover bookstore.CoverData) (bookstore.CoverData, error)
+	GetCoverData(ctx context.Context, isbn string) (bookstore.CoverData, error)
+	DeleteCoverData(ctx context.Context, isbn string) error
 }
 
 func isNoResultError(err error) bool {
 	var noRes *bookstore.NoResultError
 	return errors.As(err, &noRes)
 }
+
+// acceptQuality returns how much the Accept header prefers the content type, 0 if it isn't accepted at all
+// the most specific media range matching the content type decides, as in RFC 9110
+// everything is accepted when there's no Accept header
+func acceptQuality(accept string, contentType string) float64 {
+	if strings.TrimSpace(accept) == "" {
+		return 1
+	}
+	typ, _, _ := strings.Cut(contentType, "/")
+	quality, specificity := 0.0, 0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		var matched int
+		switch mediaType {
+		case contentType:
+			matched = 3
+		case typ + "/*":
+			matched = 2
+		case "*/*":
+			matched = 1
+		default:
+			continue
+		}
+		if matched <= specificity {
+			continue
+		}
+		specificity, quality = matched, 1
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			quality = q
+		}
+	}
+	return quality
+}
@@ -0,0 +1,297 @@
+package cover
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+)
+
+// errMalformed is used when walking the structure of the file fails, which the decoder should have caught already
+var errMalformed = errors.New("malformed image structure")
+
+// stripMetadata removes EXIF, XMP and other text metadata from the file without re-encoding it, returning the EXIF
+// orientation(1 if there's none) so it can be applied to the pixels instead
+// ok is false for formats it doesn't know, which need to be re-encoded to lose their metadata
+func stripMetadata(contentType string, data []byte) (stripped []byte, orientation int, ok bool, err error) {
+	switch contentType {
+	case JPEG.ContentType:
+		stripped, orientation, err = stripJPEG(data)
+	case PNG.ContentType:
+		stripped, orientation, err = stripPNG(data)
+	case GIF.ContentType:
+		stripped, err = stripGIF(data)
+		orientation = 1
+	case WebP.ContentType:
+		stripped, orientation, err = stripWebP(data)
+	default:
+		return nil, 1, false, nil
+	}
+	return stripped, orientation, err == nil, err
+}
+
+// stripJPEG drops the APP1(EXIF and XMP), APP13(IPTC) and comment segments, which come before the image data
+// APP0(JFIF), APP2(ICC profile) and APP14(Adobe) are kept, as they change how the image is decoded
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, errMalformed
+	}
+	out := append(make([]byte, 0, len(data)), data[:2]...)
+	orientation := 1
+	for i := 2; ; {
+		if i+1 >= len(data) || data[i] != 0xFF {
+			return nil, 0, errMalformed
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			//fill byte, the marker follows
+			i++
+			continue
+		case marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			//markers without a length
+			out = append(out, data[i:i+2]...)
+			i += 2
+			continue
+		case marker == 0xDA || marker == 0xD9:
+			//the start of scan is followed by the entropy coded image data, metadata only comes before it
+			return append(out, data[i:]...), orientation, nil
+		}
+		if i+4 > len(data) {
+			return nil, 0, errMalformed
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) || end < i+4 {
+			return nil, 0, errMalformed
+		}
+		switch marker {
+		case 0xE1:
+			if payload := data[i+4 : end]; bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+				orientation = exifOrientation(payload[6:])
+			}
+		case 0xED, 0xFE:
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+}
+
+// pngMetadataChunks are the chunks dropped from PNG files
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+// stripPNG drops the EXIF, text and modification time chunks
+func stripPNG(data []byte) ([]byte, int, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, 0, errMalformed
+	}
+	out := append(make([]byte, 0, len(data)), signature...)
+	orientation := 1
+	for i := len(signature); i < len(data); {
+		if i+8 > len(data) {
+			return nil, 0, errMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, 0, errMalformed
+		}
+		typ := string(data[i+4 : i+8])
+		if typ == "eXIf" {
+			orientation = exifOrientation(data[i+8 : i+8+length])
+		}
+		if !pngMetadataChunks[typ] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+		if typ == "IEND" {
+			break
+		}
+	}
+	return out, orientation, nil
+}
+
+// stripGIF drops the comment extensions and XMP application extensions, GIF has no EXIF
+func stripGIF(data []byte) ([]byte, error) {
+	//header(6) and logical screen descriptor(7), followed by the global color table if there's one
+	if len(data) < 13 {
+		return nil, errMalformed
+	}
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << ((flags & 0x07) + 1)
+	}
+	if i > len(data) {
+		return nil, errMalformed
+	}
+	out := append(make([]byte, 0, len(data)), data[:i]...)
+	for i < len(data) {
+		start := i
+		switch data[i] {
+		case 0x3B:
+			//trailer
+			return append(out, data[i]), nil
+		case 0x21:
+			if i+2 > len(data) {
+				return nil, errMalformed
+			}
+			label := data[i+1]
+			//the application identifier is the first sub block
+			xmp := label == 0xFF && bytes.HasPrefix(data[i+2:], []byte("\x0bXMP DataXMP"))
+			end, err := skipSubBlocks(data, i+2)
+			if err != nil {
+				return nil, err
+			}
+			if label != 0xFE && !xmp {
+				out = append(out, data[start:end]...)
+			}
+			i = end
+		case 0x2C:
+			//image descriptor(10) and its local color table, followed by the LZW code size and the image data
+			if i+10 > len(data) {
+				return nil, errMalformed
+			}
+			end := i + 10
+			if flags := data[i+9]; flags&0x80 != 0 {
+				end += 3 << ((flags & 0x07) + 1)
+			}
+			end, err := skipSubBlocks(data, end+1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, data[start:end]...)
+			i = end
+		default:
+			return nil, errMalformed
+		}
+	}
+	return nil, errMalformed
+}
+
+// skipSubBlocks returns where the data sub blocks starting at i end, including the terminating empty block
+func skipSubBlocks(data []byte, i int) (int, error) {
+	for {
+		if i >= len(data) {
+			return 0, errMalformed
+		}
+		size := int(data[i])
+		i += 1 + size
+		if size == 0 {
+			return i, nil
+		}
+	}
+}
+
+// stripWebP drops the EXIF and XMP chunks, clearing their flags in the extended header
+func stripWebP(data []byte) ([]byte, int, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, 0, errMalformed
+	}
+	out := append(make([]byte, 0, len(data)), data[:12]...)
+	orientation := 1
+	vp8x := -1
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, 0, errMalformed
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		//chunks are padded to an even size
+		end := i + 8 + size + size%2
+		if size < 0 || end > len(data) {
+			return nil, 0, errMalformed
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF":
+			exif := data[i+8 : i+8+size]
+			orientation = exifOrientation(bytes.TrimPrefix(exif, []byte("Exif\x00\x00")))
+		case "XMP ":
+		case "VP8X":
+			vp8x = len(out)
+			out = append(out, data[i:end]...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	if vp8x >= 0 && vp8x+8 < len(out) {
+		//the flags are the first byte of the chunk's data, EXIF is bit 3 and XMP is bit 2
+		out[vp8x+8] &^= 0x08 | 0x04
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, orientation, nil
+}
+
+// exifOrientation reads the orientation tag(1 to 8) from EXIF data, which is a TIFF header followed by IFD0
+// 1 is returned if it's missing or invalid, which leaves the image as is
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		//orientation is a SHORT, which is stored in the first 2 bytes of the value
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient applies the EXIF orientation to the image, so it's shown upright without the EXIF data
+// orientations 5 to 8 swap the width and height
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	src := toRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:sy*src.Stride+sx*4+4])
+		}
+	}
+	return dst
+}
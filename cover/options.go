@@ -0,0 +1,48 @@
+package cover
+
+// Option is a callable that modifies the Processor's parameter
+type Option func(p Processor) Processor
+
+// WithVariants sets the sizes derived from every uploaded cover, replacing the defaults(DefaultVariants)
+// covers uploaded before a variant was added don't have it
+func WithVariants(variants ...Variant) Option {
+	return func(p Processor) Processor {
+		p.variants = variants
+		return p
+	}
+}
+
+// WithFormats sets the formats covers are accepted in, replacing the defaults(DefaultFormats)
+// this is also how an encoder is provided for a format which has none, e.g. to convert covers to WebP
+func WithFormats(formats ...Format) Option {
+	return func(p Processor) Processor {
+		p.formats = formats
+		return p
+	}
+}
+
+// WithStorageFormat converts every uploaded cover to the format, which needs to have an encoder
+// covers are stored in the format they were uploaded in by default
+func WithStorageFormat(format Format) Option {
+	return func(p Processor) Processor {
+		p.storageFormat = &format
+		return p
+	}
+}
+
+// WithAlternateFormats also converts uploaded covers(and their variants) to the formats, which need to have an encoder
+// the store serving the cover picks between the stored format and these, e.g. using the Accept header of the request
+func WithAlternateFormats(formats ...Format) Option {
+	return func(p Processor) Processor {
+		p.alternateFormats = formats
+		return p
+	}
+}
+
+// WithLimits sets the bounds uploaded covers have to fall within, replacing the defaults(DefaultLimits)
+func WithLimits(limits Limits) Option {
+	return func(p Processor) Processor {
+		p.limits = limits
+		return p
+	}
+}
@@ -0,0 +1,132 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/thunder33345/bookstore/cover"
+)
+
+// bucketURL is the URL of the bucket, which is either in the path or in the host depending on Config.PathStyle
+func (s *Store) bucketURL() url.URL {
+	u := *s.endpoint
+	if s.cfg.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.cfg.Bucket
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/"
+	}
+	u.RawPath = escapePath(u.Path)
+	return u
+}
+
+// objectURL is the URL of the object in the bucket
+func (s *Store) objectURL(key string) url.URL {
+	u := s.bucketURL()
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	u.RawPath = escapePath(u.Path)
+	return u
+}
+
+// putObject uploads the object, which is cached by clients as immutable like the files of fs.Store
+func (s *Store) putObject(ctx context.Context, key string, contentType string, data []byte) error {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set("Cache-Control", cover.CacheControl)
+	resp, err := s.do(ctx, http.MethodPut, s.objectURL(key), header, data)
+	if err != nil {
+		return fmt.Errorf("uploading %s: %w", key, err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// deleteObject deletes the object, deleting an object which doesn't exist succeeds
+func (s *Store) deleteObject(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.objectURL(key), nil, nil)
+	if err != nil {
+		return fmt.Errorf("deleting %s: %w", key, err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// listObjects returns the key of every object starting with the prefix, following the continuation tokens of ListObjectsV2
+func (s *Store) listObjects(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		u := s.bucketURL()
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u.RawQuery = canonicalQuery(query)
+		resp, err := s.do(ctx, http.MethodGet, u, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s: %w", prefix, err)
+		}
+		var result struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("listing %s: decoding response: %w", prefix, err)
+		}
+		for _, c := range result.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do signs and sends the request, a response which isn't 2xx is returned as an error
+func (s *Store) do(ctx context.Context, method string, u url.URL, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+	s.signer.sign(req, hashPayload(body), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// responseError reads the error S3 responds with, which is an XML document with a code and a message
+func responseError(resp *http.Response) error {
+	var s3Err struct {
+		Code    string
+		Message string
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(data, &s3Err) != nil || s3Err.Code == "" {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return fmt.Errorf("unexpected status %d: %s: %s", resp.StatusCode, s3Err.Code, s3Err.Message)
+}
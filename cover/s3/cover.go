@@ -0,0 +1,255 @@
+// Package s3 stores book covers in an S3-compatible object storage bucket, such as AWS S3, MinIO or Cloudflare R2
+// which allows running more than one server, unlike cover/fs, the covers are served by the bucket instead of the server
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/thanhpk/randstr"
+	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/cover"
+)
+
+// Config is where the covers are stored, and how they are linked to
+type Config struct {
+	//Endpoint is the URL of the service, e.g. https://s3.eu-west-1.amazonaws.com, or http://localhost:9000 for MinIO
+	Endpoint string
+	//Region is signed along with the requests, defaults to us-east-1 which most S3-compatible services accept
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	//PathStyle puts the bucket in the path(endpoint/bucket/key) instead of the host(bucket.endpoint/key)
+	//MinIO and most other self-hosted services need it
+	PathStyle bool
+	//Prefix is put in front of the file names to make up the object keys, e.g. covers/
+	Prefix string
+	//PublicURL is where the objects are publicly readable, e.g. a CDN in front of the bucket
+	//the object key is appended to it, URLs are presigned instead when it's empty
+	PublicURL string
+	//PresignExpiry is how long presigned URLs are valid for, defaults to 24 hours, S3 allows at most 7 days
+	PresignExpiry time.Duration
+}
+
+// Store acts as an image store
+// images are stored as objects in a bucket, and the db maintains the filename
+// the covers are linked to directly, either through the public URL or presigned URLs of the objects
+type Store struct {
+	cfg      Config
+	endpoint *url.URL
+	signer   signer
+	client   *http.Client
+	//db allows image store to update book's cover metadata
+	db dbStore
+	//processor validates uploads and converts them into the files stored for each cover
+	processor *cover.Processor
+}
+
+// NewStore creates a new image store, nothing is sent to the bucket until a cover is stored
+// client is used for every request made to the bucket, http.DefaultClient is used when nil
+// the processor can't have alternate formats, as they are picked using the Accept header which URLs to objects can't do
+func NewStore(cfg Config, db dbStore, processor *cover.Processor, client *http.Client) (*Store, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("endpoint and bucket are required")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parsing endpoint: %w", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("endpoint %q should start with http(s)://", cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.PresignExpiry == 0 {
+		cfg.PresignExpiry = 24 * time.Hour
+	}
+	if cfg.PresignExpiry < time.Second || cfg.PresignExpiry > maxPresignExpiry {
+		return nil, fmt.Errorf("presign expiry %s should be between 1s and %s", cfg.PresignExpiry, maxPresignExpiry)
+	}
+	if len(processor.AlternateFormats()) > 0 {
+		return nil, errors.New("alternate formats aren't supported, covers are linked to without Accept header negotiation")
+	}
+	return &Store{
+		cfg:       cfg,
+		endpoint:  endpoint,
+		signer:    signer{accessKeyID: cfg.AccessKeyID, secretAccessKey: cfg.SecretAccessKey, region: cfg.Region},
+		client:    client,
+		db:        db,
+		processor: processor,
+	}, nil
+}
+
+// StoreCover uploads the cover to the bucket, along with every rendition of it(see cover.Processor.Process)
+// invalid uploads are rejected with bookstore.InvalidImageError
+func (s *Store) StoreCover(ctx context.Context, isbn string, img io.ReadSeeker) error {
+	data, err := s.processor.Read(img)
+	if err != nil {
+		return err
+	}
+	stored, renditions, err := s.processor.Process(data)
+	if err != nil {
+		return err
+	}
+
+	//the random suffix makes every upload a new URL, which is what allows covers to be cached as immutable
+	base := isbn + "_" + randstr.Hex(8)
+	resourceName := base + stored.Ext
+
+	//the old cover is only removed once the new one is in place, so a failed upload leaves it untouched
+	old, err := s.coverFile(ctx, isbn)
+	if err != nil {
+		return err
+	}
+
+	//every object is keyed using the extension of the stored format, so the URL of a variant can be worked out from the
+	//cover file alone, variants scaled in a fallback format(see cover.Processor.VariantFormats) are told apart by their Content-Type
+	for _, r := range renditions {
+		err = s.putObject(ctx, s.cfg.Prefix+cover.RenditionFile(base, r.Variant, stored.Ext), r.Format.ContentType, r.Data)
+		if err != nil {
+			_ = s.removeObjects(ctx, resourceName)
+			return err
+		}
+	}
+
+	//finally we update the stored resource into our db
+	_, err = s.db.UpsertCoverData(ctx, bookstore.CoverData{
+		ISBN:      isbn,
+		CoverFile: resourceName,
+	})
+	if err != nil {
+		_ = s.removeObjects(ctx, resourceName)
+		return err
+	}
+	if old != "" {
+		//failing here only leaves the old objects behind, the new cover is already in use
+		_ = s.removeObjects(ctx, old)
+	}
+	return nil
+}
+
+// RemoveCover remove the stored cover object along with its variants from the bucket and db
+func (s *Store) RemoveCover(ctx context.Context, isbn string) error {
+	err := s.removeCoverFile(ctx, isbn)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.DeleteCoverData(ctx, isbn)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// removeCoverFile is an unexported helper to remove the objects without touching db
+// note that the db entry should be updated after calling this
+func (s *Store) removeCoverFile(ctx context.Context, isbn string) error {
+	coverFile, err := s.coverFile(ctx, isbn)
+	if err != nil || coverFile == "" {
+		return err
+	}
+	return s.removeObjects(ctx, coverFile)
+}
+
+// coverFile returns the file name of the current cover, empty string is returned when there is no cover
+func (s *Store) coverFile(ctx context.Context, isbn string) (string, error) {
+	data, err := s.db.GetCoverData(ctx, isbn)
+	if err != nil {
+		if isNoResultError(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return data.CoverFile, nil
+}
+
+// removeObjects removes the cover object and the objects of its variants
+// they are listed by name, so variants which are no longer configured are removed too
+func (s *Store) removeObjects(ctx context.Context, coverFile string) error {
+	base := s.cfg.Prefix + strings.TrimSuffix(coverFile, path.Ext(coverFile))
+	keys, err := s.listObjects(ctx, base)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if rest := strings.TrimPrefix(key, base); !strings.HasPrefix(rest, ".") && !strings.HasPrefix(rest, "_") {
+			continue
+		}
+		if err = s.deleteObject(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCoverURL returns the cover URL if available, empty string is returned when there is no cover
+func (s *Store) GetCoverURL(ctx context.Context, isbn string) (string, error) {
+	data, err := s.db.GetCoverData(ctx, isbn)
+	if err != nil {
+		if isNoResultError(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return s.fileURL(data.CoverFile), nil
+}
+
+// ResolveCoverURL returns the cover URL from book data if available, empty string is returned when there is no cover
+func (s *Store) ResolveCoverURL(_ context.Context, book bookstore.Book) (string, error) {
+	if book.CoverData == nil || *book.CoverData == "" {
+		return "", nil
+	}
+	return s.fileURL(*book.CoverData), nil
+}
+
+// ResolveCoverVariantURLs returns the URL of every variant of the cover by its name, nil is returned when there is no cover
+// unlike fs.Store, there's nothing to fall back to the original, so covers uploaded before a variant was added lack it
+func (s *Store) ResolveCoverVariantURLs(_ context.Context, book bookstore.Book) (map[string]string, error) {
+	if book.CoverData == nil || *book.CoverData == "" {
+		return nil, nil
+	}
+	ext := path.Ext(*book.CoverData)
+	base := strings.TrimSuffix(*book.CoverData, ext)
+	urls := make(map[string]string, len(s.processor.Variants()))
+	for _, v := range s.processor.Variants() {
+		urls[v.Name] = s.fileURL(cover.RenditionFile(base, v.Name, ext))
+	}
+	return urls, nil
+}
+
+// fileURL links to the object of the file, through the public URL if there's one, otherwise by presigning it
+// presigned URLs are signed at the start of a window half as long as the expiry, so the URL stays the same and can be
+// cached within it, while still being valid for at least half of the expiry
+func (s *Store) fileURL(file string) string {
+	key := s.cfg.Prefix + file
+	if s.cfg.PublicURL != "" {
+		return strings.TrimSuffix(s.cfg.PublicURL, "/") + "/" + escapePath(key)
+	}
+	signedAt := time.Now().Truncate(s.cfg.PresignExpiry / 2)
+	return s.signer.presign(http.MethodGet, s.objectURL(key), s.cfg.PresignExpiry, signedAt)
+}
+
+// dbStore is a minimal interface of psql.Store
+type dbStore interface {
+	UpsertCoverData(ctx context.Context, cover bookstore.CoverData) (bookstore.CoverData, error)
+	GetCoverData(ctx context.Context, isbn string) (bookstore.CoverData, error)
+	DeleteCoverData(ctx context.Context, isbn string) error
+}
+
+func isNoResultError(err error) bool {
+	var noRes *bookstore.NoResultError
+	return errors.As(err, &noRes)
+}
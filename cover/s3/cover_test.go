@@ -0,0 +1,314 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/cover"
+)
+
+// testISBN is the book the covers of the tests belong to
+const testISBN = "9780000000002"
+
+// coverDB keeps the cover data in memory, failing upserts while failUpsert is set
+type coverDB struct {
+	mu         sync.Mutex
+	covers     map[string]bookstore.CoverData
+	failUpsert bool
+}
+
+func (db *coverDB) UpsertCoverData(_ context.Context, data bookstore.CoverData) (bookstore.CoverData, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.failUpsert {
+		return bookstore.CoverData{}, errors.New("upsert failed")
+	}
+	db.covers[data.ISBN] = data
+	return data, nil
+}
+
+func (db *coverDB) GetCoverData(_ context.Context, isbn string) (bookstore.CoverData, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	data, ok := db.covers[isbn]
+	if !ok {
+		return bookstore.CoverData{}, bookstore.NewNoResultError("cover.isbn", nil)
+	}
+	return data, nil
+}
+
+func (db *coverDB) DeleteCoverData(_ context.Context, isbn string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.covers, isbn)
+	return nil
+}
+
+// testStore is a Store with the objects it stores kept in a fake bucket
+type testStore struct {
+	*Store
+	t      *testing.T
+	bucket *fakeBucket
+	server *httptest.Server
+	db     *coverDB
+}
+
+// newTestStore creates a Store for an empty fake bucket, cfg is filled in with the endpoint and credentials of it
+func newTestStore(t *testing.T, cfg Config) *testStore {
+	t.Helper()
+	bucket := newFakeBucket("covers", "access", "secret", "")
+	server := httptest.NewServer(bucket)
+	t.Cleanup(server.Close)
+
+	cfg.Endpoint, cfg.Bucket, cfg.PathStyle = server.URL, "covers", true
+	if cfg.AccessKeyID == "" {
+		cfg.AccessKeyID, cfg.SecretAccessKey = "access", "secret"
+	}
+	processor, err := cover.NewProcessor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &coverDB{covers: make(map[string]bookstore.CoverData)}
+	store, err := NewStore(cfg, db, processor, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testStore{Store: store, t: t, bucket: bucket, server: server, db: db}
+}
+
+// get requests the URL, which is relative to the bucket when it doesn't start with http
+func (s *testStore) get(url string, header ...string) *http.Response {
+	s.t.Helper()
+	if !strings.HasPrefix(url, "http") {
+		url = s.server.URL + url
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := s.server.Client().Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+// testPNG encodes a gradient of the size as PNG
+func testPNG(t *testing.T, width int, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// coverKeys returns the keys of the cover file and the files of its variants, sorted
+func coverKeys(prefix string, coverFile string) []string {
+	base := prefix + strings.TrimSuffix(coverFile, ".png")
+	keys := []string{base + ".png"}
+	for _, v := range cover.DefaultVariants {
+		keys = append(keys, cover.RenditionFile(base, v.Name, ".png"))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestStoreCover(t *testing.T) {
+	s := newTestStore(t, Config{Prefix: "covers/", PublicURL: "/covers/"})
+	ctx := context.Background()
+
+	if err := s.StoreCover(ctx, testISBN, bytes.NewReader([]byte("not an image"))); !errors.Is(err, bookstore.ErrInvalidFileType) {
+		t.Fatalf("storing a non-image: got %v, want an invalid image error", err)
+	}
+	if err := s.StoreCover(ctx, testISBN, bytes.NewReader(testPNG(t, 400, 600))); err != nil {
+		t.Fatal(err)
+	}
+	first := s.db.covers[testISBN].CoverFile
+	if got, want := fmt.Sprint(s.bucket.keys()), fmt.Sprint(coverKeys("covers/", first)); got != want {
+		t.Fatalf("got objects %s, want %s", got, want)
+	}
+
+	coverURL, err := s.GetCoverURL(ctx, testISBN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coverURL != "/covers/covers/"+first {
+		t.Fatalf("got cover URL %q, want it under the public URL", coverURL)
+	}
+	//the public URL is where the bucket is served from, which is the root of the fake
+	resp := s.get(coverURL)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("got status %d with Content-Type %q, want the cover", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != cover.CacheControl {
+		t.Errorf("got Cache-Control %q, want %q", cc, cover.CacheControl)
+	}
+
+	//replacing uploads the new cover before removing the old one
+	if err = s.StoreCover(ctx, testISBN, bytes.NewReader(testPNG(t, 200, 300))); err != nil {
+		t.Fatal(err)
+	}
+	second := s.db.covers[testISBN].CoverFile
+	if second == first {
+		t.Fatal("replacing kept the file name of the cover")
+	}
+	if got, want := fmt.Sprint(s.bucket.keys()), fmt.Sprint(coverKeys("covers/", second)); got != want {
+		t.Fatalf("after replacing got objects %s, want %s", got, want)
+	}
+
+	//a failed replacement leaves the current cover untouched, and cleans up after itself
+	s.db.failUpsert = true
+	if err = s.StoreCover(ctx, testISBN, bytes.NewReader(testPNG(t, 200, 300))); err == nil {
+		t.Fatal("replacing succeeded without storing the cover data")
+	}
+	s.db.failUpsert = false
+	if got, want := fmt.Sprint(s.bucket.keys()), fmt.Sprint(coverKeys("covers/", second)); got != want {
+		t.Fatalf("after a failed replacement got objects %s, want %s", got, want)
+	}
+
+	if err = s.RemoveCover(ctx, testISBN); err != nil {
+		t.Fatal(err)
+	}
+	if keys := s.bucket.keys(); len(keys) != 0 {
+		t.Errorf("got objects %v after removing the cover, want none", keys)
+	}
+	if coverURL, err = s.GetCoverURL(ctx, testISBN); err != nil || coverURL != "" {
+		t.Errorf("got cover URL %q with error %v after removing the cover, want none", coverURL, err)
+	}
+}
+
+func TestCoverVariantURLs(t *testing.T) {
+	s := newTestStore(t, Config{})
+	ctx := context.Background()
+	if err := s.StoreCover(ctx, testISBN, bytes.NewReader(testPNG(t, 400, 600))); err != nil {
+		t.Fatal(err)
+	}
+	coverFile := s.db.covers[testISBN].CoverFile
+	book := bookstore.Book{ISBN: testISBN, CoverData: &coverFile}
+
+	urls, err := s.ResolveCoverVariantURLs(ctx, book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != len(cover.DefaultVariants) {
+		t.Fatalf("got variant URLs %v, want one for each of %d variants", urls, len(cover.DefaultVariants))
+	}
+	//without a public URL the objects are linked to with presigned URLs
+	thumb := s.get(urls["thumb"])
+	if thumb.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d for the thumb, want %d", thumb.StatusCode, http.StatusOK)
+	}
+	config, _, err := image.DecodeConfig(thumb.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Width != 160 || config.Height != 240 {
+		t.Errorf("got thumb of %dx%d, want 160x240", config.Width, config.Height)
+	}
+	if tampered := s.get(strings.Replace(urls["thumb"], "_thumb", "_large", 1)); tampered.StatusCode != http.StatusForbidden {
+		t.Errorf("got status %d for a URL signed for another object, want %d", tampered.StatusCode, http.StatusForbidden)
+	}
+
+	if urls, err = s.ResolveCoverVariantURLs(ctx, bookstore.Book{ISBN: testISBN}); err != nil || urls != nil {
+		t.Errorf("got variant URLs %v with error %v for a book without a cover, want none", urls, err)
+	}
+}
+
+func TestCoverConditionalGet(t *testing.T) {
+	s := newTestStore(t, Config{})
+	ctx := context.Background()
+	if err := s.StoreCover(ctx, testISBN, bytes.NewReader(testPNG(t, 400, 600))); err != nil {
+		t.Fatal(err)
+	}
+	coverURL, err := s.GetCoverURL(ctx, testISBN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := s.get(coverURL)
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("got status %d with ETag %q, want the cover with an ETag", resp.StatusCode, etag)
+	}
+	if resp = s.get(coverURL, "If-None-Match", etag); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("got status %d for a matching ETag, want %d", resp.StatusCode, http.StatusNotModified)
+	}
+	if resp = s.get(coverURL, "Range", "bytes=0-7"); resp.StatusCode != http.StatusPartialContent {
+		t.Errorf("got status %d for a range, want %d", resp.StatusCode, http.StatusPartialContent)
+	}
+	//presigning the same URL within the window keeps it cacheable
+	if again, _ := s.GetCoverURL(ctx, testISBN); again != coverURL {
+		t.Errorf("got presigned URL %q, then %q, want it to stay the same", coverURL, again)
+	}
+}
+
+func TestStoreCoverWrongCredentials(t *testing.T) {
+	s := newTestStore(t, Config{AccessKeyID: "access", SecretAccessKey: "wrong"})
+	if err := s.StoreCover(context.Background(), testISBN, bytes.NewReader(testPNG(t, 400, 600))); err == nil {
+		t.Fatal("stored the cover with the wrong credentials")
+	}
+	if keys := s.bucket.keys(); len(keys) != 0 {
+		t.Errorf("got objects %v, want none", keys)
+	}
+	if _, ok := s.db.covers[testISBN]; ok {
+		t.Error("stored the cover data without the cover")
+	}
+}
+
+func TestCoverVariantFallback(t *testing.T) {
+	if cover.WebP.Encode != nil {
+		t.Skip("WebP variants are written as WebP")
+	}
+	s := newTestStore(t, Config{})
+	ctx := context.Background()
+	webp, err := os.ReadFile("testdata/cover.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.StoreCover(ctx, testISBN, bytes.NewReader(webp)); err != nil {
+		t.Fatal(err)
+	}
+	coverFile := s.db.covers[testISBN].CoverFile
+	urls, err := s.ResolveCoverVariantURLs(ctx, bookstore.Book{ISBN: testISBN, CoverData: &coverFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the variants are linked to by the extension of the cover, which is fine as the Content-Type tells what they are
+	thumb := s.get(urls["thumb"])
+	if thumb.StatusCode != http.StatusOK || thumb.Header.Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("got status %d with Content-Type %q for the thumb, want it scaled into JPEG",
+			thumb.StatusCode, thumb.Header.Get("Content-Type"))
+	}
+	config, format, err := image.DecodeConfig(thumb.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || config.Width != 160 || config.Height != 106 {
+		t.Errorf("got thumb of %dx%d %s, want 160x106 jpeg", config.Width, config.Height, format)
+	}
+}
@@ -0,0 +1,247 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxClockSkew is how far the time of a signed request can be from the clock of the bucket, like S3 does
+const maxClockSkew = 15 * time.Minute
+
+// fakeBucket is an in-process stand-in for a bucket of an S3-compatible service, which the tests run Store against
+// it's served path style with httptest.NewServer, with Config.Endpoint set to its URL and Config.PathStyle set
+// only what Store uses is implemented: PutObject, GetObject, HeadObject, DeleteObject and ListObjectsV2
+// requests are verified with the same signing code Store uses, so it catches wrong credentials and requests altered on
+// the way, but not mistakes in the signing itself
+// objects are publicly readable, like a bucket behind Config.PublicURL, so reading them needs no signature
+type fakeBucket struct {
+	bucket string
+	signer signer
+
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+// fakeObject is an object kept by fakeBucket
+type fakeObject struct {
+	data        []byte
+	contentType string
+	//cacheControl is sent back as is, like S3 does with the metadata of the object
+	cacheControl string
+	modTime      time.Time
+}
+
+// newFakeBucket creates an empty bucket, which accepts requests signed with the credentials for the region
+func newFakeBucket(bucket string, accessKeyID string, secretAccessKey string, region string) *fakeBucket {
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &fakeBucket{
+		bucket:  bucket,
+		signer:  signer{accessKeyID: accessKeyID, secretAccessKey: secretAccessKey, region: region},
+		objects: make(map[string]fakeObject),
+	}
+}
+
+// keys returns the key of every object in the bucket, sorted
+func (f *fakeBucket) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.keysLocked()
+}
+
+// ServeHTTP handles the requests to the bucket
+func (f *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		writeFakeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	signed := r.Header.Get("Authorization") != "" || r.URL.Query().Has("X-Amz-Signature")
+	if signed {
+		if err := f.verify(r); err != nil {
+			writeFakeError(w, http.StatusForbidden, "SignatureDoesNotMatch", err.Error())
+			return
+		}
+	} else if r.Method != http.MethodGet && r.Method != http.MethodHead || key == "" {
+		writeFakeError(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+		return
+	}
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, r)
+	case key == "":
+		writeFakeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource")
+	case r.Method == http.MethodPut:
+		f.put(w, r, key)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		f.get(w, r, key)
+	case r.Method == http.MethodDelete:
+		f.mu.Lock()
+		delete(f.objects, key)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource")
+	}
+}
+
+// put stores the object, checking the body against the signed hash of it
+func (f *fakeBucket) put(w http.ResponseWriter, r *http.Request, key string) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeFakeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if hash := r.Header.Get("X-Amz-Content-Sha256"); hash != unsignedPayload && hash != hashPayload(data) {
+		writeFakeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed")
+		return
+	}
+	f.mu.Lock()
+	f.objects[key] = fakeObject{
+		data:         data,
+		contentType:  r.Header.Get("Content-Type"),
+		cacheControl: r.Header.Get("Cache-Control"),
+		modTime:      time.Now(),
+	}
+	f.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+// get serves the object with http.ServeContent, which handles HEAD, Range and conditional requests like S3 does
+func (f *fakeBucket) get(w http.ResponseWriter, r *http.Request, key string) {
+	f.mu.Lock()
+	object, ok := f.objects[key]
+	f.mu.Unlock()
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	if object.contentType != "" {
+		w.Header().Set("Content-Type", object.contentType)
+	}
+	if object.cacheControl != "" {
+		w.Header().Set("Cache-Control", object.cacheControl)
+	}
+	w.Header().Set("ETag", `"`+hashPayload(object.data)[:32]+`"`)
+	http.ServeContent(w, r, key, object.modTime, bytes.NewReader(object.data))
+}
+
+// list lists the objects starting with the prefix, in one page
+func (f *fakeBucket) list(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("list-type") != "2" {
+		writeFakeError(w, http.StatusNotImplemented, "NotImplemented", "Only ListObjectsV2 is implemented")
+		return
+	}
+	prefix := r.URL.Query().Get("prefix")
+	type content struct {
+		Key  string
+		Size int
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		IsTruncated bool
+		Contents    []content
+	}{Name: f.bucket, Prefix: prefix}
+	f.mu.Lock()
+	for _, key := range f.keysLocked() {
+		if strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, content{Key: key, Size: len(f.objects[key].data)})
+		}
+	}
+	f.mu.Unlock()
+	result.KeyCount = len(result.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+// keysLocked is keys for when mu is already held
+func (f *fakeBucket) keysLocked() []string {
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// verify checks the signature of the request, which is either in the Authorization header or in the query(presigned)
+func (f *fakeBucket) verify(r *http.Request) error {
+	query := r.URL.Query()
+	var credential, signedHeaders, signature, date, payloadHash string
+	expires := maxClockSkew
+	if query.Has("X-Amz-Signature") {
+		credential, signedHeaders = query.Get("X-Amz-Credential"), query.Get("X-Amz-SignedHeaders")
+		signature, date, payloadHash = query.Get("X-Amz-Signature"), query.Get("X-Amz-Date"), unsignedPayload
+		seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+		if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > maxPresignExpiry {
+			return errors.New("invalid X-Amz-Expires")
+		}
+		expires = time.Duration(seconds) * time.Second
+		query.Del("X-Amz-Signature")
+	} else {
+		auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), signAlgorithm+" ")
+		if !ok {
+			return errors.New("unsupported authorization type")
+		}
+		for _, part := range strings.Split(auth, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch name {
+			case "Credential":
+				credential = value
+			case "SignedHeaders":
+				signedHeaders = value
+			case "Signature":
+				signature = value
+			}
+		}
+		date, payloadHash = r.Header.Get("X-Amz-Date"), r.Header.Get("X-Amz-Content-Sha256")
+	}
+
+	signedAt, err := time.Parse(amzDateFormat, date)
+	if err != nil {
+		return errors.New("invalid X-Amz-Date")
+	}
+	now := time.Now()
+	if signedAt.After(now.Add(maxClockSkew)) || now.After(signedAt.Add(expires)) {
+		return errors.New("request has expired")
+	}
+	if credential != f.signer.accessKeyID+"/"+f.signer.scope(signedAt) {
+		return errors.New("invalid credential")
+	}
+	headers := strings.Split(signedHeaders, ";")
+	if !sort.StringsAreSorted(headers) {
+		return errors.New("signed headers aren't sorted")
+	}
+	canonical := canonicalRequest(r.Method, r.URL.Path, query, r.Header, r.Host, headers, payloadHash)
+	if !hmac.Equal([]byte(signature), []byte(f.signer.signature(canonical, signedAt))) {
+		return errors.New("the request signature we calculated does not match the signature you provided")
+	}
+	return nil
+}
+
+// writeFakeError responds with an error in the format S3 uses
+func writeFakeError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: message})
+}
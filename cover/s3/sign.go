@@ -0,0 +1,153 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signAlgorithm = "AWS4-HMAC-SHA256"
+	//unsignedPayload is used instead of the hash of the body for presigned URLs, whose body isn't known
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+	//maxPresignExpiry is the longest S3 accepts presigned URLs for
+	maxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// signer signs requests with AWS Signature Version 4, which S3 and the S3-compatible services accept
+type signer struct {
+	accessKeyID     string
+	secretAccessKey string
+	region          string
+}
+
+// sign adds the Authorization header to the request, along with the X-Amz-Date and X-Amz-Content-Sha256 headers it covers
+// every header set on the request at this point is signed, the ones added later by http.Transport aren't
+func (s signer) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := []string{"host"}
+	for name := range req.Header {
+		headers = append(headers, strings.ToLower(name))
+	}
+	sort.Strings(headers)
+
+	canonical := canonicalRequest(req.Method, req.URL.Path, req.URL.Query(), req.Header, req.URL.Host, headers, payloadHash)
+	signature := s.signature(canonical, now)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signAlgorithm, s.accessKeyID, s.scope(now), strings.Join(headers, ";"), signature))
+}
+
+// presign returns the URL with the signature in its query, which allows anyone with it to make the request until it expires
+func (s signer) presign(method string, u url.URL, expires time.Duration, now time.Time) string {
+	now = now.UTC()
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", signAlgorithm)
+	query.Set("X-Amz-Credential", s.accessKeyID+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(amzDateFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonical := canonicalRequest(method, u.Path, query, nil, u.Host, []string{"host"}, unsignedPayload)
+	query.Set("X-Amz-Signature", s.signature(canonical, now))
+	u.RawQuery = canonicalQuery(query)
+	return u.String()
+}
+
+// signature signs the canonical request, with a key derived from the secret for the day, region and service
+func (s signer) signature(canonical string, now time.Time) string {
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := signAlgorithm + "\n" + now.Format(amzDateFormat) + "\n" + s.scope(now) + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// scope is what the signing key is limited to
+func (s signer) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+// canonicalRequest is the request in the form it's signed in, headers are the lowercase names of the signed headers, sorted
+func canonicalRequest(method string, path string, query url.Values, header http.Header, host string, headers []string,
+	payloadHash string) string {
+	if path == "" {
+		path = "/"
+	}
+	var b strings.Builder
+	b.WriteString(method + "\n" + escapePath(path) + "\n" + canonicalQuery(query) + "\n")
+	for _, name := range headers {
+		value := host
+		if name != "host" {
+			value = strings.Join(header.Values(name), ",")
+		}
+		b.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	b.WriteString("\n" + strings.Join(headers, ";") + "\n" + payloadHash)
+	return b.String()
+}
+
+// canonicalQuery encodes the query sorted by key, which url.Values.Encode also does, but with spaces as %20 instead of +
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, escape(key, false)+"="+escape(value, false))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// escapePath encodes the path the way it's signed, which is also how it's sent
+func escapePath(path string) string {
+	return escape(path, true)
+}
+
+// escape percent encodes everything but the unreserved characters of RFC 3986, and slashes when keepSlash is set
+func escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// hashPayload is the hex encoded SHA-256 of the body, which is signed along with the request
+func hashPayload(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,51 @@
+package cover
+
+import (
+	"fmt"
+
+	"github.com/thunder33345/bookstore"
+)
+
+// Limits are the bounds uploaded covers have to fall within, 0 leaves a bound unset
+// they apply to the cover as shown, after the EXIF orientation is applied
+type Limits struct {
+	MinWidth  int
+	MinHeight int
+	MaxWidth  int
+	MaxHeight int
+	//MinAspectRatio and MaxAspectRatio bound the width divided by the height, a 2:3 book cover is 0.67
+	MinAspectRatio float64
+	MaxAspectRatio float64
+	//MaxBytes bounds the size of the uploaded file, which is read into memory whole
+	MaxBytes int64
+}
+
+// DefaultLimits are used unless WithLimits is used, the maximums keep reading and decoding from using too much memory
+var DefaultLimits = Limits{MaxWidth: 10000, MaxHeight: 10000, MaxBytes: 10 << 20}
+
+// fileTooLarge is the error for files above MaxBytes
+func (l Limits) fileTooLarge() error {
+	return bookstore.NewInvalidImageError(bookstore.ImageTooLarge, fmt.Sprintf("file is larger than the maximum of %d bytes", l.MaxBytes))
+}
+
+// check returns an InvalidImageError if the size falls outside the limits
+func (l Limits) check(width int, height int) error {
+	if (l.MinWidth > 0 && width < l.MinWidth) || (l.MinHeight > 0 && height < l.MinHeight) {
+		return bookstore.NewInvalidImageError(bookstore.ImageTooSmall,
+			fmt.Sprintf("%dx%d is smaller than the minimum of %dx%d", width, height, l.MinWidth, l.MinHeight))
+	}
+	if (l.MaxWidth > 0 && width > l.MaxWidth) || (l.MaxHeight > 0 && height > l.MaxHeight) {
+		return bookstore.NewInvalidImageError(bookstore.ImageTooLarge,
+			fmt.Sprintf("%dx%d is larger than the maximum of %dx%d", width, height, l.MaxWidth, l.MaxHeight))
+	}
+	ratio := float64(width) / float64(height)
+	if l.MinAspectRatio > 0 && ratio < l.MinAspectRatio {
+		return bookstore.NewInvalidImageError(bookstore.ImageAspectRatio,
+			fmt.Sprintf("aspect ratio %.2f is below the minimum of %.2f", ratio, l.MinAspectRatio))
+	}
+	if l.MaxAspectRatio > 0 && ratio > l.MaxAspectRatio {
+		return bookstore.NewInvalidImageError(bookstore.ImageAspectRatio,
+			fmt.Sprintf("aspect ratio %.2f is above the maximum of %.2f", ratio, l.MaxAspectRatio))
+	}
+	return nil
+}
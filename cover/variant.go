@@ -0,0 +1,92 @@
+package cover
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Variant is a size derived from the uploaded cover, which is scaled down to fit within MaxWidth x MaxHeight
+// covers already fitting within it are kept as is, they are never scaled up
+type Variant struct {
+	//Name identifies the variant, both in ?size= and as the suffix of the file name
+	Name      string
+	MaxWidth  int
+	MaxHeight int
+}
+
+// DefaultVariants are the sizes generated unless WithVariants is used, sized for the usual 2:3 book cover
+var DefaultVariants = []Variant{
+	{Name: "thumb", MaxWidth: 160, MaxHeight: 240},
+	{Name: "medium", MaxWidth: 400, MaxHeight: 600},
+	{Name: "large", MaxWidth: 800, MaxHeight: 1200},
+}
+
+// RenditionFile names the file of the cover in the size and format, base is the cover file without its extension
+// the variants are named after the cover, with the variant name before the extension
+func RenditionFile(base string, variant string, ext string) string {
+	if variant == "" {
+		return base + ext
+	}
+	return base + "_" + variant + ext
+}
+
+// fit returns the size the image is scaled to so it fits within the variant, keeping its aspect ratio
+// ok is false if the image already fits
+func (v Variant) fit(bounds image.Rectangle) (width int, height int, ok bool) {
+	width, height = bounds.Dx(), bounds.Dy()
+	if width <= v.MaxWidth && height <= v.MaxHeight {
+		return width, height, false
+	}
+	//the side that overflows the most decides the scale
+	if width*v.MaxHeight > height*v.MaxWidth {
+		return v.MaxWidth, maxInt(1, height*v.MaxWidth/width), true
+	}
+	return maxInt(1, width*v.MaxHeight/height), v.MaxHeight, true
+}
+
+// toRGBA converts the image so its pixels can be read directly, instead of through image.Image.At
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// resize scales src down to width x height using a box filter, where each pixel is the average of the pixels it covers
+// the pixels are premultiplied, so transparent pixels don't bleed their color into the result
+func resize(src *image.RGBA, width int, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, maxInt((y+1)*sh/height, y*sh/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, maxInt((x+1)*sw/width, x*sw/width+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4 : y*dst.Stride+x*4+4]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,4 @@
+// Package webp registers a WebP encoder for cover.WebP, which is what lets covers be stored and served in WebP
+// the encoder uses libwebp through cgo, so it's only built with the webp tag(go build -tags webp), which needs the
+// libwebp headers and library installed, importing the package without the tag does nothing
+package webp
@@ -0,0 +1,50 @@
+//go:build webp && cgo
+
+package webp
+
+/*
+#cgo pkg-config: libwebp
+#include <webp/encode.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"unsafe"
+
+	"github.com/thunder33345/bookstore/cover"
+)
+
+// quality is the quality covers are encoded at, from 0 to 100, it's about as lossy as the JPEG quality of the covers
+const quality = 80
+
+func init() {
+	cover.RegisterEncoder(cover.WebP.ContentType, Encode)
+}
+
+// Encode writes the image as a lossy WebP, keeping its transparency
+func Encode(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	if b.Empty() {
+		return errors.New("webp: empty image")
+	}
+	//libwebp takes non-premultiplied RGBA, which the image is converted into unless it already is
+	rgba, ok := img.(*image.NRGBA)
+	if !ok || rgba.Rect.Min != (image.Point{}) {
+		rgba = image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	}
+
+	var output *C.uint8_t
+	size := C.WebPEncodeRGBA((*C.uint8_t)(unsafe.Pointer(&rgba.Pix[0])), C.int(b.Dx()), C.int(b.Dy()),
+		C.int(rgba.Stride), C.float(quality), &output)
+	if size == 0 {
+		return errors.New("webp: encoding failed")
+	}
+	defer C.WebPFree(unsafe.Pointer(output))
+	_, err := w.Write(unsafe.Slice((*byte)(unsafe.Pointer(output)), int(size)))
+	return err
+}
@@ -0,0 +1,98 @@
+//go:build webp && cgo
+
+package webp_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/thunder33345/bookstore/cover"
+	"github.com/thunder33345/bookstore/cover/webp"
+	xwebp "golang.org/x/image/webp"
+)
+
+// gradient draws a gradient of the size, transparent along the left edge
+func gradient(width int, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+		img.Set(0, y, color.NRGBA{})
+	}
+	return img
+}
+
+// far reports whether the channel is off by more than the compression could explain
+func far(got uint32, want uint32) bool {
+	return got+12 < want || got > want+12
+}
+
+func TestEncode(t *testing.T) {
+	var buf bytes.Buffer
+	//the image starts away from the origin, as the sub images cut out of others do
+	img := gradient(200, 300).SubImage(image.Rect(10, 20, 170, 260))
+	if err := webp.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := xwebp.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := decoded.Bounds().Size(); size != image.Pt(160, 240) {
+		t.Fatalf("got %v, want 160x240", size)
+	}
+	r, g, b, a := decoded.At(100, 100).RGBA()
+	if far(r>>8, 110) || far(g>>8, 120) || far(b>>8, 128) || a>>8 != 255 {
+		t.Errorf("got pixel %d,%d,%d,%d, want about 110,120,128,255", r>>8, g>>8, b>>8, a>>8)
+	}
+
+	buf.Reset()
+	if err = webp.Encode(&buf, gradient(64, 96)); err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err = xwebp.Decode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a = decoded.At(0, 50).RGBA(); a != 0 {
+		t.Errorf("got alpha %d on the left edge, want it kept transparent", a>>8)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	if cover.WebP.Encode == nil {
+		t.Fatal("importing the package didn't register the encoder")
+	}
+	//covers are kept as uploaded, and converted to WebP for the clients taking it
+	processor, err := cover.NewProcessor(cover.WithAlternateFormats(cover.WebP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var upload bytes.Buffer
+	if err = cover.PNG.Encode(&upload, gradient(400, 600)); err != nil {
+		t.Fatal(err)
+	}
+	stored, renditions, err := processor.Process(upload.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ContentType != cover.PNG.ContentType {
+		t.Fatalf("stored as %s, want image/png", stored.ContentType)
+	}
+	var webps int
+	for _, r := range renditions {
+		if r.Format.ContentType != cover.WebP.ContentType {
+			continue
+		}
+		webps++
+		if _, err = xwebp.DecodeConfig(bytes.NewReader(r.Data)); err != nil {
+			t.Errorf("%q rendition in WebP doesn't decode: %v", r.Variant, err)
+		}
+	}
+	//the cover itself, and each variant whether it's scaled down or not
+	if webps != 1+len(cover.DefaultVariants) {
+		t.Errorf("got %d renditions in WebP, want %d", webps, 1+len(cover.DefaultVariants))
+	}
+}
@@ -0,0 +1,275 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// CreateAccount creates an account using provided model
+// note that ID, CreatedAt, UpdatedAt are all ignored
+// returns the created account when successful
+func (s *Store) CreateAccount(_ context.Context, account bookstore.Account) (bookstore.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := checkAccount(account, true); err != nil {
+		return bookstore.Account{}, fmt.Errorf("creating account.name=%s: %w", account.Name, err)
+	}
+	if s.emailTaken(account.Email, uuid.Nil) {
+		return bookstore.Account{}, fmt.Errorf("creating account.name=%s: %w", account.Name, bookstore.NewDuplicateError("account.email", nil))
+	}
+
+	now := s.now()
+	created := bookstore.Account{
+		ID:           uuid.New(),
+		Name:         account.Name,
+		Email:        account.Email,
+		PasswordHash: account.PasswordHash,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	s.accounts[created.ID] = created
+	return created, nil
+}
+
+// GetAccount fetches an account using its ID
+func (s *Store) GetAccount(_ context.Context, accountID uuid.UUID) (bookstore.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account, ok := s.accounts[accountID]
+	if !ok {
+		return bookstore.Account{}, fmt.Errorf("selecting account.id=%v: %w", accountID, bookstore.NewNoResultError("account.id", nil))
+	}
+	return account, nil
+}
+
+// GetAccountByEmail fetches an account using its email
+func (s *Store) GetAccountByEmail(_ context.Context, email string) (bookstore.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, account := range s.accounts {
+		if account.Email == email {
+			return account, nil
+		}
+	}
+	return bookstore.Account{}, fmt.Errorf("selecting account.email=%v: %w", email, bookstore.NewNoResultError("account.email", nil))
+}
+
+// ListAccounts returns a list of accounts
+// to paginate, use the last received Account.ID to paginate
+func (s *Store) ListAccounts(_ context.Context, limit int, after uuid.UUID) ([]bookstore.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var cursor time.Time
+	if after != uuid.Nil {
+		account, ok := s.accounts[after]
+		if !ok {
+			return nil, fmt.Errorf("listing accounts limit=%v after=%s: %w", limit, after, bookstore.NewNonExistentIDError("account", nil))
+		}
+		cursor = account.CreatedAt
+	}
+
+	accounts := make([]bookstore.Account, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		accounts = append(accounts, account)
+	}
+	return paginate(accounts, limit, func(a bookstore.Account) time.Time { return a.CreatedAt }, cursor), nil
+}
+
+// UpdateAccount updates the provided account using its ID
+// note that CreatedAt, UpdatedAt cannot be set, roles are managed with AddAccountRole and RemoveAccountRole
+// changing the email clears EmailVerifiedAt, use MarkEmailVerified once the new email is confirmed
+func (s *Store) UpdateAccount(_ context.Context, account bookstore.Account) error {
+	return s.updateAccount(account)
+}
+
+// SafeUpdateAccount updates the provided account using its ID
+// note that CreatedAt, UpdatedAt cannot be set, changing the email clears EmailVerifiedAt
+func (s *Store) SafeUpdateAccount(_ context.Context, account bookstore.Account) error {
+	return s.updateAccount(account)
+}
+
+// updateAccount is the shared implementation of UpdateAccount and SafeUpdateAccount
+// password hash is only updated when provided
+func (s *Store) updateAccount(account bookstore.Account) error {
+	if account.ID == uuid.Nil {
+		return bookstore.ErrMissingID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := checkAccount(account, false); err != nil {
+		return fmt.Errorf("updating account: %w", err)
+	}
+	stored, ok := s.accounts[account.ID]
+	if !ok {
+		return fmt.Errorf("updating account=%v: %w", account.ID, bookstore.NewNoResultError("account", nil))
+	}
+	if s.emailTaken(account.Email, account.ID) {
+		return fmt.Errorf("updating account: %w", bookstore.NewDuplicateError("account.email", nil))
+	}
+
+	if stored.Email != account.Email {
+		stored.EmailVerifiedAt = nil
+	}
+	stored.Name = account.Name
+	stored.Email = account.Email
+	if account.PasswordHash != "" {
+		stored.PasswordHash = account.PasswordHash
+	}
+	stored.UpdatedAt = s.now()
+	s.accounts[account.ID] = stored
+	return nil
+}
+
+// MarkEmailVerified marks the email of the account as verified
+// it fails with a NoResultError if the account no longer uses that email
+func (s *Store) MarkEmailVerified(_ context.Context, accountID uuid.UUID, email string, verifiedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.accounts[accountID]
+	if !ok || stored.Email != email {
+		return fmt.Errorf("updating account=%v: %w", accountID, bookstore.NewNoResultError("account.email", nil))
+	}
+	stored.EmailVerifiedAt = &verifiedAt
+	s.accounts[accountID] = stored
+	return nil
+}
+
+// SuspendAccount sets the suspension of the account, replacing the previous one if it was already suspended
+func (s *Store) SuspendAccount(_ context.Context, accountID uuid.UUID, suspension bookstore.Suspension) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[accountID]
+	if !ok {
+		return fmt.Errorf("updating account=%v: %w", accountID, bookstore.NewNoResultError("account", nil))
+	}
+	account.Suspension = suspension
+	s.accounts[accountID] = account
+	return nil
+}
+
+// ReinstateAccount lifts the suspension of the account
+func (s *Store) ReinstateAccount(_ context.Context, accountID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[accountID]
+	if !ok {
+		return fmt.Errorf("updating account=%v: %w", accountID, bookstore.NewNoResultError("account", nil))
+	}
+	account.Suspension = bookstore.Suspension{}
+	s.accounts[accountID] = account
+	return nil
+}
+
+// AnonymizeAccount replaces the name, email and password hash of the account, marking it anonymized at AnonymizedAt
+// everything else tied to the account is deleted, but the account itself is kept, so references to it stay intact
+func (s *Store) AnonymizeAccount(_ context.Context, account bookstore.Account) error {
+	if account.ID == uuid.Nil {
+		return bookstore.ErrMissingID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.accounts[account.ID]
+	if !ok {
+		return fmt.Errorf("anonymizing account=%v: %w", account.ID, bookstore.NewNoResultError("account", nil))
+	}
+	if s.emailTaken(account.Email, account.ID) {
+		return fmt.Errorf("anonymizing account: %w", bookstore.NewDuplicateError("account.email", nil))
+	}
+	stored.Name = account.Name
+	stored.Email = account.Email
+	stored.PasswordHash = account.PasswordHash
+	stored.EmailVerifiedAt = nil
+	stored.AnonymizedAt = account.AnonymizedAt
+	stored.UpdatedAt = s.now()
+	s.accounts[account.ID] = stored
+
+	delete(s.accountRoles, account.ID)
+	s.deleteSessionsFor(account.ID)
+	s.deleteAPIKeysFor(account.ID)
+	s.deletePasswordResetsFor(account.ID)
+	s.deleteEmailVerificationsFor(account.ID)
+	s.deleteTwoFactorFor(account.ID)
+	for key, identity := range s.identities {
+		if identity.AccountID == account.ID {
+			delete(s.identities, key)
+		}
+	}
+	return nil
+}
+
+// DeleteAccount deletes the specified account using its ID
+// sessions, roles and api keys belonging to the account are removed along with it
+func (s *Store) DeleteAccount(_ context.Context, accountID uuid.UUID) error {
+	if accountID == uuid.Nil {
+		return fmt.Errorf("missing account id")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[accountID]; !ok {
+		return fmt.Errorf("deleting account=%v: %w", accountID, bookstore.NewNoResultError("account", nil))
+	}
+	delete(s.accounts, accountID)
+	delete(s.accountRoles, accountID)
+	s.deleteSessionsFor(accountID)
+	s.deleteAPIKeysFor(accountID)
+	s.deletePasswordResetsFor(accountID)
+	s.deleteEmailVerificationsFor(accountID)
+	s.deleteTwoFactorFor(accountID)
+	for key, identity := range s.identities {
+		if identity.AccountID == accountID {
+			delete(s.identities, key)
+		}
+	}
+	//same as ON DELETE SET NULL, suspensions and invites made by the account are kept
+	for id, account := range s.accounts {
+		if account.SuspendedBy != nil && *account.SuspendedBy == accountID {
+			account.SuspendedBy = nil
+			s.accounts[id] = account
+		}
+	}
+	for codeHash, invite := range s.invites {
+		if invite.CreatedBy != nil && *invite.CreatedBy == accountID {
+			invite.CreatedBy = nil
+			s.invites[codeHash] = invite
+		}
+	}
+	return nil
+}
+
+// checkAccount enforces the same constraints psql has on the account table
+// password is only required when creating, as updates may omit it
+func checkAccount(account bookstore.Account, requirePassword bool) error {
+	switch {
+	case account.Name == "":
+		return errCheckViolation("account.name")
+	case account.Email == "":
+		return errCheckViolation("account.email")
+	case requirePassword && account.PasswordHash == "":
+		return errCheckViolation("account.password_hash")
+	}
+	return nil
+}
+
+// emailTaken checks if another account already uses the email, ignoring the account with the given ID
+func (s *Store) emailTaken(email string, ignore uuid.UUID) bool {
+	for id, account := range s.accounts {
+		if id != ignore && account.Email == email {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// StoreAPIKey stores the key of the account under the digest of its plaintext
+func (s *Store) StoreAPIKey(_ context.Context, keyHash string, account bookstore.Account, key bookstore.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key.Name == "" {
+		return fmt.Errorf("creating api_key: %w", errCheckViolation("api_key.name"))
+	}
+	if _, ok := s.apiKeys[keyHash]; ok {
+		return fmt.Errorf("creating api_key.name=%s: %w", key.Name, bookstore.NewDuplicateError("api_key", nil))
+	}
+	if _, ok := s.accounts[account.ID]; !ok {
+		return fmt.Errorf("creating api_key.name=%s: %w", key.Name, bookstore.NewNoResultError("account.id", nil))
+	}
+	key.AccountID = account.ID
+	s.apiKeys[keyHash] = key
+	return nil
+}
+
+// GetAPIKey fetches the key and the account it belongs to using the digest of the key
+func (s *Store) GetAPIKey(_ context.Context, keyHash string) (bookstore.Account, bookstore.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.apiKeys[keyHash]
+	if !ok {
+		return bookstore.Account{}, bookstore.APIKey{}, fmt.Errorf("selecting api_key.key_hash: %w", bookstore.ErrInvalidAPIKey)
+	}
+	account, ok := s.accounts[key.AccountID]
+	if !ok {
+		return bookstore.Account{}, bookstore.APIKey{}, fmt.Errorf("selecting api_key.key_hash: %w", bookstore.ErrInvalidAPIKey)
+	}
+	return account, key, nil
+}
+
+// TouchAPIKey updates when the key was last used
+func (s *Store) TouchAPIKey(_ context.Context, keyID uuid.UUID, lastUsed time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for keyHash, key := range s.apiKeys {
+		if key.ID == keyID {
+			key.LastUsedAt = &lastUsed
+			s.apiKeys[keyHash] = key
+			break
+		}
+	}
+	return nil
+}
+
+// ListAPIKeys lists every key of the account, oldest first
+func (s *Store) ListAPIKeys(_ context.Context, accountID uuid.UUID) ([]bookstore.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var list []bookstore.APIKey
+	for _, key := range s.apiKeys {
+		if key.AccountID == accountID {
+			list = append(list, key)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+// DeleteAPIKey deletes a key of the account using its ID
+func (s *Store) DeleteAPIKey(_ context.Context, accountID uuid.UUID, keyID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for keyHash, key := range s.apiKeys {
+		if key.AccountID == accountID && key.ID == keyID {
+			delete(s.apiKeys, keyHash)
+			return nil
+		}
+	}
+	return fmt.Errorf("deleting api_key.id=%v: %w", keyID, bookstore.NewNoResultError("api_key", nil))
+}
+
+// deleteAPIKeysFor removes every key of the account
+// callers must hold the write lock
+func (s *Store) deleteAPIKeysFor(accountID uuid.UUID) {
+	for keyHash, key := range s.apiKeys {
+		if key.AccountID == accountID {
+			delete(s.apiKeys, keyHash)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// CreateAuthor creates an author using provided model
+// note that ID, CreatedAt, UpdatedAt are all ignored
+// returns the created author when successful
+func (s *Store) CreateAuthor(_ context.Context, author bookstore.Author) (bookstore.Author, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if author.Name == "" {
+		return bookstore.Author{}, fmt.Errorf("creating author.name=%s: %w", author.Name, errCheckViolation("author.name"))
+	}
+	if s.authorNameTaken(author.Name, uuid.Nil) {
+		return bookstore.Author{}, fmt.Errorf("creating author.name=%s: %w", author.Name, bookstore.NewDuplicateError("author.name", nil))
+	}
+
+	now := s.now()
+	created := bookstore.Author{
+		ID:        uuid.New(),
+		Name:      author.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.authors[created.ID] = created
+	return created, nil
+}
+
+// GetAuthor fetches an author using its ID
+func (s *Store) GetAuthor(_ context.Context, authorID uuid.UUID) (bookstore.Author, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	author, ok := s.authors[authorID]
+	if !ok {
+		return bookstore.Author{}, fmt.Errorf("selecting author.id=%v: %w", authorID, bookstore.NewNoResultError("author.id", nil))
+	}
+	return author, nil
+}
+
+// ListAuthors returns a list of authors
+// to paginate, use the last Author.ID you received
+func (s *Store) ListAuthors(_ context.Context, limit int, after uuid.UUID) ([]bookstore.Author, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var cursor time.Time
+	if after != uuid.Nil {
+		author, ok := s.authors[after]
+		if !ok {
+			return nil, fmt.Errorf("listing author with limit=%v after=%s: %w", limit, after, bookstore.NewNonExistentIDError("author", nil))
+		}
+		cursor = author.CreatedAt
+	}
+
+	authors := make([]bookstore.Author, 0, len(s.authors))
+	for _, author := range s.authors {
+		authors = append(authors, author)
+	}
+	return paginate(authors, limit, func(a bookstore.Author) time.Time { return a.CreatedAt }, cursor), nil
+}
+
+// UpdateAuthor updates the provided author using its ID
+// note that CreatedAt, UpdatedAt cannot be set
+func (s *Store) UpdateAuthor(_ context.Context, author bookstore.Author) error {
+	if author.ID == uuid.Nil {
+		return fmt.Errorf("updating author: %w", bookstore.ErrMissingID)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if author.Name == "" {
+		return fmt.Errorf("updating author: %w", errCheckViolation("author.name"))
+	}
+	stored, ok := s.authors[author.ID]
+	if !ok {
+		return fmt.Errorf("updating author=%v: %w", author.ID, bookstore.NewNoResultError("author", nil))
+	}
+	if s.authorNameTaken(author.Name, author.ID) {
+		return fmt.Errorf("updating author: %w", bookstore.NewDuplicateError("author.name", nil))
+	}
+
+	stored.Name = author.Name
+	stored.UpdatedAt = s.now()
+	s.authors[author.ID] = stored
+	return nil
+}
+
+// DeleteAuthor deletes the specified author using its ID
+func (s *Store) DeleteAuthor(_ context.Context, authorID uuid.UUID) error {
+	if authorID == uuid.Nil {
+		return fmt.Errorf("missing author id")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.authors[authorID]; !ok {
+		return fmt.Errorf("deleting author=%v: %w", authorID, bookstore.NewNoResultError("author", nil))
+	}
+	//books restrict deleting the author they belong to
+	for _, book := range s.books {
+		if book.AuthorID == authorID {
+			return fmt.Errorf("deleting author.id=%v: %w", authorID, bookstore.NewDependedError("author", nil))
+		}
+	}
+	delete(s.authors, authorID)
+	return nil
+}
+
+// authorNameTaken checks if another author already uses the name, ignoring the author with the given ID
+func (s *Store) authorNameTaken(name string, ignore uuid.UUID) bool {
+	for id, author := range s.authors {
+		if id != ignore && author.Name == name {
+			return true
+		}
+	}
+	return false
+}
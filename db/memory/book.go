@@ -0,0 +1,191 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/db/trgm"
+)
+
+// CreateBook creates a book using provided model
+// note that CreatedAt, UpdatedAt are ignored
+// returns the created book when successful
+func (s *Store) CreateBook(_ context.Context, book bookstore.Book) (bookstore.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkBook(book); err != nil {
+		return bookstore.Book{}, fmt.Errorf("creating book: %w", err)
+	}
+	if _, ok := s.books[book.ISBN]; ok {
+		return bookstore.Book{}, fmt.Errorf("creating book: %w", bookstore.NewDuplicateError("book.isbn", nil))
+	}
+
+	now := s.now()
+	created := bookstore.Book{
+		ISBN:        book.ISBN,
+		Title:       book.Title,
+		AuthorID:    book.AuthorID,
+		GenreID:     book.GenreID,
+		PublishYear: book.PublishYear,
+		Fiction:     book.Fiction,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	s.books[created.ISBN] = created
+	return created, nil
+}
+
+// GetBook fetches a book using its ID
+func (s *Store) GetBook(_ context.Context, bookID string) (bookstore.Book, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	book, ok := s.books[bookID]
+	if !ok {
+		return bookstore.Book{}, fmt.Errorf("selecting book.isbn=%v: %w", bookID, bookstore.NewNoResultError("book.isbn", nil))
+	}
+	return s.withCover(book), nil
+}
+
+// ListBooks returns a list of books
+// to paginate, use the last Book.ISBN you received
+// you can filter using a list of genre and author ids
+// it will return if a book matches one of the provided authors and genres
+// leaving it blank will omit filtering
+// searchTitle performs fuzzy searching on the title of the book
+func (s *Store) ListBooks(_ context.Context, limit int, after string, genresId []uuid.UUID, authorsId []uuid.UUID, searchTitle string) ([]bookstore.Book, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var cursor time.Time
+	if after != "" {
+		book, ok := s.books[after]
+		if !ok {
+			return nil, fmt.Errorf("selecting book limit=%v after=%s genres=%v authors=%v: %w",
+				limit, after, genresId, authorsId, bookstore.NewNonExistentIDError("book", nil))
+		}
+		cursor = book.CreatedAt
+	}
+
+	similarity := make(map[string]float64)
+	books := make([]bookstore.Book, 0, len(s.books))
+	for _, book := range s.books {
+		if len(genresId) > 0 && !containsUUID(genresId, book.GenreID) {
+			continue
+		}
+		if len(authorsId) > 0 && !containsUUID(authorsId, book.AuthorID) {
+			continue
+		}
+		if searchTitle != "" {
+			sim := trgm.Similarity(book.Title, searchTitle)
+			if sim <= trgm.Threshold {
+				continue
+			}
+			similarity[book.ISBN] = sim
+		}
+		books = append(books, s.withCover(book))
+	}
+
+	if searchTitle == "" {
+		return paginate(books, limit, func(b bookstore.Book) time.Time { return b.CreatedAt }, cursor), nil
+	}
+
+	//when searching, the best matches comes first instead
+	books = paginate(books, len(books), func(b bookstore.Book) time.Time { return b.CreatedAt }, cursor)
+	sort.SliceStable(books, func(i, j int) bool {
+		return similarity[books[i].ISBN] > similarity[books[j].ISBN]
+	})
+	if len(books) > limit {
+		books = books[:limit]
+	}
+	return books, nil
+}
+
+// UpdateBook updates the provided book using its ID
+// note that UpdatedAt cannot be set
+func (s *Store) UpdateBook(_ context.Context, book bookstore.Book) error {
+	if book.ISBN == "" {
+		return bookstore.ErrMissingID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkBook(book); err != nil {
+		return fmt.Errorf("error updating book: %w", err)
+	}
+	stored, ok := s.books[book.ISBN]
+	if !ok {
+		return fmt.Errorf("updating book=%s: %w", book.ISBN, bookstore.NewNoResultError("book", nil))
+	}
+
+	stored.Title = book.Title
+	stored.PublishYear = book.PublishYear
+	stored.Fiction = book.Fiction
+	stored.AuthorID = book.AuthorID
+	stored.GenreID = book.GenreID
+	if !book.CreatedAt.IsZero() {
+		stored.CreatedAt = book.CreatedAt
+	}
+	stored.UpdatedAt = s.now()
+	s.books[book.ISBN] = stored
+	return nil
+}
+
+// DeleteBook deletes the specified book using its ID
+// the cover data of the book is removed along with it
+func (s *Store) DeleteBook(_ context.Context, bookID string) error {
+	if bookID == "" {
+		return fmt.Errorf("missing book id")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.books[bookID]; !ok {
+		return fmt.Errorf("deleting book=%v: %w", bookID, bookstore.NewNoResultError("book", nil))
+	}
+	delete(s.books, bookID)
+	delete(s.covers, bookID)
+	return nil
+}
+
+// checkBook enforces the same constraints psql has on the book table
+func (s *Store) checkBook(book bookstore.Book) error {
+	switch {
+	case book.ISBN == "":
+		return errCheckViolation("book.isbn")
+	case book.Title == "":
+		return errCheckViolation("book.title")
+	case book.PublishYear <= 0:
+		return errCheckViolation("book.publish_year")
+	}
+	if _, ok := s.authors[book.AuthorID]; !ok {
+		return bookstore.NewInvalidDependencyError("author", nil)
+	}
+	if _, ok := s.genres[book.GenreID]; !ok {
+		return bookstore.NewInvalidDependencyError("genre", nil)
+	}
+	return nil
+}
+
+// withCover fills in the book's cover file, similar to joining cover_data
+func (s *Store) withCover(book bookstore.Book) bookstore.Book {
+	if cover, ok := s.covers[book.ISBN]; ok {
+		file := cover.CoverFile
+		book.CoverData = &file
+	}
+	return book
+}
+
+func containsUUID(list []uuid.UUID, id uuid.UUID) bool {
+	for _, v := range list {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/thunder33345/bookstore"
+)
+
+func (s *Store) UpsertCoverData(_ context.Context, cover bookstore.CoverData) (bookstore.CoverData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.books[cover.ISBN]; !ok {
+		return bookstore.CoverData{}, fmt.Errorf("creating cover.isbn=%s: %w", cover.ISBN, bookstore.NewNoResultError("book.isbn", nil))
+	}
+
+	now := s.now()
+	stored, ok := s.covers[cover.ISBN]
+	if !ok {
+		stored = bookstore.CoverData{ISBN: cover.ISBN, CreatedAt: now}
+	}
+	stored.CoverFile = cover.CoverFile
+	stored.UpdatedAt = now
+	s.covers[cover.ISBN] = stored
+	return stored, nil
+}
+
+func (s *Store) GetCoverData(_ context.Context, isbn string) (bookstore.CoverData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cover, ok := s.covers[isbn]
+	if !ok {
+		return bookstore.CoverData{}, fmt.Errorf("selecting cover.isbn=%v: %w", isbn, bookstore.NewNoResultError("cover.isbn", nil))
+	}
+	return cover, nil
+}
+
+func (s *Store) DeleteCoverData(_ context.Context, isbn string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.covers, isbn)
+	return nil
+}
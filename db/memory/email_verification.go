@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// emailVerification is a stored email verification token
+type emailVerification struct {
+	accountID uuid.UUID
+	email     string
+	expiresAt time.Time
+}
+
+// StoreEmailVerification stores a verification token of the account under its digest
+// any earlier token of the account is removed, so only the link sent to the latest email works
+func (s *Store) StoreEmailVerification(_ context.Context, tokenHash string, accountID uuid.UUID, email string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[accountID]; !ok {
+		return fmt.Errorf("creating email_verification.account_id=%v: %w", accountID, bookstore.NewNoResultError("account.id", nil))
+	}
+	s.deleteEmailVerificationsFor(accountID)
+	s.emailVerifications[tokenHash] = emailVerification{accountID: accountID, email: email, expiresAt: expiresAt}
+	return nil
+}
+
+// ConsumeEmailVerification deletes the verification token and returns who it belongs to, the email it was sent to and when it expires
+func (s *Store) ConsumeEmailVerification(_ context.Context, tokenHash string) (uuid.UUID, string, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	verification, ok := s.emailVerifications[tokenHash]
+	if !ok {
+		return uuid.UUID{}, "", time.Time{}, fmt.Errorf("deleting email_verification.token_hash: %w", bookstore.ErrInvalidVerificationToken)
+	}
+	delete(s.emailVerifications, tokenHash)
+	return verification.accountID, verification.email, verification.expiresAt, nil
+}
+
+// DeleteExpiredEmailVerifications removes verification tokens past their expiry
+func (s *Store) DeleteExpiredEmailVerifications(_ context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenHash, verification := range s.emailVerifications {
+		if !now.Before(verification.expiresAt) {
+			delete(s.emailVerifications, tokenHash)
+		}
+	}
+	return nil
+}
+
+// deleteEmailVerificationsFor removes every verification token of the account
+// callers must hold the write lock
+func (s *Store) deleteEmailVerificationsFor(accountID uuid.UUID) {
+	for tokenHash, verification := range s.emailVerifications {
+		if verification.accountID == accountID {
+			delete(s.emailVerifications, tokenHash)
+		}
+	}
+}
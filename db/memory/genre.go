@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// CreateGenre creates a genre using provided model
+// note that ID, CreatedAt, UpdatedAt are all ignored
+// returns the created genre when successful
+func (s *Store) CreateGenre(_ context.Context, genre bookstore.Genre) (bookstore.Genre, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if genre.Name == "" {
+		return bookstore.Genre{}, fmt.Errorf("creating genre.name=%s: %w", genre.Name, errCheckViolation("genre.name"))
+	}
+	if s.genreNameTaken(genre.Name, uuid.Nil) {
+		return bookstore.Genre{}, fmt.Errorf("creating genre.name=%s: %w", genre.Name, bookstore.NewDuplicateError("genre.name", nil))
+	}
+
+	now := s.now()
+	created := bookstore.Genre{
+		ID:        uuid.New(),
+		Name:      genre.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.genres[created.ID] = created
+	return created, nil
+}
+
+// GetGenre fetches a genre using its ID
+func (s *Store) GetGenre(_ context.Context, genreID uuid.UUID) (bookstore.Genre, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	genre, ok := s.genres[genreID]
+	if !ok {
+		return bookstore.Genre{}, fmt.Errorf("selecting genre.id=%v: %w", genreID, bookstore.NewNoResultError("genre.id", nil))
+	}
+	return genre, nil
+}
+
+// ListGenres returns a list of genres
+// to paginate, use the last Genre.ID you received
+func (s *Store) ListGenres(_ context.Context, limit int, after uuid.UUID) ([]bookstore.Genre, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var cursor time.Time
+	if after != uuid.Nil {
+		genre, ok := s.genres[after]
+		if !ok {
+			return nil, fmt.Errorf("listing genre with limit=%v after=%s: %w", limit, after, bookstore.NewNonExistentIDError("genre", nil))
+		}
+		cursor = genre.CreatedAt
+	}
+
+	genres := make([]bookstore.Genre, 0, len(s.genres))
+	for _, genre := range s.genres {
+		genres = append(genres, genre)
+	}
+	return paginate(genres, limit, func(g bookstore.Genre) time.Time { return g.CreatedAt }, cursor), nil
+}
+
+// UpdateGenre updates the provided genre using its ID
+// note that CreatedAt, UpdatedAt cannot be set
+func (s *Store) UpdateGenre(_ context.Context, genre bookstore.Genre) error {
+	if genre.ID == uuid.Nil {
+		return fmt.Errorf("updating genre: %w", bookstore.ErrMissingID)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if genre.Name == "" {
+		return fmt.Errorf("updating genre: %w", errCheckViolation("genre.name"))
+	}
+	stored, ok := s.genres[genre.ID]
+	if !ok {
+		return fmt.Errorf("updating genre=%v: %w", genre.ID, bookstore.NewNoResultError("genre", nil))
+	}
+	if s.genreNameTaken(genre.Name, genre.ID) {
+		return fmt.Errorf("updating genre: %w", bookstore.NewDuplicateError("genre.name", nil))
+	}
+
+	stored.Name = genre.Name
+	stored.UpdatedAt = s.now()
+	s.genres[genre.ID] = stored
+	return nil
+}
+
+// DeleteGenre deletes the specified genre using its ID
+func (s *Store) DeleteGenre(_ context.Context, genreID uuid.UUID) error {
+	if genreID == uuid.Nil {
+		return fmt.Errorf("missing genre id")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.genres[genreID]; !ok {
+		return fmt.Errorf("deleting genre=%v: %w", genreID, bookstore.NewNoResultError("genre", nil))
+	}
+	//books restrict deleting the genre they belong to
+	for _, book := range s.books {
+		if book.GenreID == genreID {
+			return fmt.Errorf("deleting genre.id=%v: %w", genreID, bookstore.NewDependedError("genre", nil))
+		}
+	}
+	delete(s.genres, genreID)
+	return nil
+}
+
+// genreNameTaken checks if another genre already uses the name, ignoring the genre with the given ID
+func (s *Store) genreNameTaken(name string, ignore uuid.UUID) bool {
+	for id, genre := range s.genres {
+		if id != ignore && genre.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// identityKey is the key of an identity, the subject is only unique per provider
+type identityKey struct {
+	provider string
+	subject  string
+}
+
+// CreateIdentity links the account to a user of an external identity provider
+func (s *Store) CreateIdentity(_ context.Context, identity bookstore.Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case identity.Provider == "":
+		return fmt.Errorf("creating account_identity.account_id=%v: %w", identity.AccountID, errCheckViolation("account_identity.provider"))
+	case identity.Subject == "":
+		return fmt.Errorf("creating account_identity.account_id=%v: %w", identity.AccountID, errCheckViolation("account_identity.subject"))
+	}
+	if _, ok := s.accounts[identity.AccountID]; !ok {
+		return fmt.Errorf("creating account_identity.account_id=%v: %w", identity.AccountID, bookstore.NewNoResultError("account.id", nil))
+	}
+	key := identityKey{provider: identity.Provider, subject: identity.Subject}
+	if _, ok := s.identities[key]; ok {
+		return fmt.Errorf("creating account_identity.account_id=%v: %w", identity.AccountID, bookstore.NewDuplicateError("account_identity", nil))
+	}
+	identity.CreatedAt = s.now()
+	s.identities[key] = identity
+	return nil
+}
+
+// ListIdentities lists the identity provider users linked to the account, oldest first
+func (s *Store) ListIdentities(_ context.Context, accountID uuid.UUID) ([]bookstore.Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var list []bookstore.Identity
+	for _, identity := range s.identities {
+		if identity.AccountID == accountID {
+			list = append(list, identity)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+// GetAccountByIdentity fetches the account linked to the user of the identity provider
+func (s *Store) GetAccountByIdentity(_ context.Context, provider string, subject string) (bookstore.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identity, ok := s.identities[identityKey{provider: provider, subject: subject}]
+	if !ok {
+		return bookstore.Account{}, fmt.Errorf("selecting account_identity.provider=%v: %w", provider, bookstore.NewNoResultError("account_identity", nil))
+	}
+	return s.accounts[identity.AccountID], nil
+}
+
+// StoreOIDCState stores a pending OpenID Connect login under the digest of its state
+func (s *Store) StoreOIDCState(_ context.Context, stateHash string, state bookstore.OIDCState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.oidcStates[stateHash]; ok {
+		return fmt.Errorf("creating oidc_state.provider=%v: %w", state.Provider, bookstore.NewDuplicateError("oidc_state", nil))
+	}
+	s.oidcStates[stateHash] = state
+	return nil
+}
+
+// ConsumeOIDCState deletes the pending login and returns it, so each state can only be used once
+func (s *Store) ConsumeOIDCState(_ context.Context, stateHash string) (bookstore.OIDCState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.oidcStates[stateHash]
+	if !ok {
+		return bookstore.OIDCState{}, fmt.Errorf("deleting oidc_state.state_hash: %w", bookstore.ErrInvalidOIDCState)
+	}
+	delete(s.oidcStates, stateHash)
+	return state, nil
+}
+
+// DeleteExpiredOIDCStates removes pending logins past their expiry
+func (s *Store) DeleteExpiredOIDCStates(_ context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for stateHash, state := range s.oidcStates {
+		if !now.Before(state.ExpiresAt) {
+			delete(s.oidcStates, stateHash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// StoreInvite stores the invite under the digest of its code
+func (s *Store) StoreInvite(_ context.Context, codeHash string, invite bookstore.Invite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.invites[codeHash]; ok {
+		return fmt.Errorf("creating invite: %w", bookstore.NewDuplicateError("invite", nil))
+	}
+	if invite.MaxUses < 0 {
+		return fmt.Errorf("creating invite: max_uses can't be negative")
+	}
+	s.invites[codeHash] = invite
+	return nil
+}
+
+// ListInvites lists every invite, oldest first
+func (s *Store) ListInvites(_ context.Context) ([]bookstore.Invite, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]bookstore.Invite, 0, len(s.invites))
+	for _, invite := range s.invites {
+		list = append(list, invite)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+// DeleteInvite deletes an invite using its ID
+func (s *Store) DeleteInvite(_ context.Context, inviteID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for codeHash, invite := range s.invites {
+		if invite.ID == inviteID {
+			delete(s.invites, codeHash)
+			return nil
+		}
+	}
+	return fmt.Errorf("deleting invite.id=%v: %w", inviteID, bookstore.NewNoResultError("invite", nil))
+}
+
+// UseInvite counts a use of the invite, as long as it's still valid for the email
+func (s *Store) UseInvite(_ context.Context, codeHash string, email string, now time.Time) (bookstore.Invite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invite, ok := s.invites[codeHash]
+	switch {
+	case !ok,
+		invite.MaxUses != 0 && invite.Uses >= invite.MaxUses,
+		invite.ExpiresAt != nil && !now.Before(*invite.ExpiresAt),
+		invite.Email != "" && !strings.EqualFold(invite.Email, email):
+		return bookstore.Invite{}, fmt.Errorf("updating invite.uses: %w", bookstore.ErrInvalidInvite)
+	}
+	invite.Uses++
+	s.invites[codeHash] = invite
+	return invite, nil
+}
+
+// ReleaseInvite gives back a use of the invite, for when signing up failed after using it
+func (s *Store) ReleaseInvite(_ context.Context, inviteID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for codeHash, invite := range s.invites {
+		if invite.ID == inviteID && invite.Uses > 0 {
+			invite.Uses--
+			s.invites[codeHash] = invite
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/thunder33345/bookstore"
+)
+
+// loginThrottle is the failed login counter of a key
+type loginThrottle struct {
+	failures      int
+	lastFailureAt time.Time
+	blockedUntil  time.Time
+}
+
+// IncrementLoginFailures counts a failed login against the key and returns the number of failures so far
+// the count starts over when the previous failure happened before resetBefore
+func (s *Store) IncrementLoginFailures(_ context.Context, key string, now time.Time, resetBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	throttle, ok := s.loginThrottles[key]
+	if !ok || throttle.lastFailureAt.Before(resetBefore) {
+		throttle.failures = 0
+	}
+	throttle.failures++
+	throttle.lastFailureAt = now
+	s.loginThrottles[key] = throttle
+	return throttle.failures, nil
+}
+
+// BlockLogin blocks logging in with the key until the given time
+func (s *Store) BlockLogin(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if throttle, ok := s.loginThrottles[key]; ok {
+		throttle.blockedUntil = until
+		s.loginThrottles[key] = throttle
+	}
+	return nil
+}
+
+// GetLoginBlock returns until when logging in with the key is blocked, a zero time if it isn't
+func (s *Store) GetLoginBlock(_ context.Context, key string) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.loginThrottles[key].blockedUntil, nil
+}
+
+// DeleteLoginThrottle forgets the failures of the key, lifting any block
+func (s *Store) DeleteLoginThrottle(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.loginThrottles, key)
+	return nil
+}
+
+// DeleteExpiredLoginThrottles removes keys that are no longer blocked and last failed before the given time
+func (s *Store) DeleteExpiredLoginThrottles(_ context.Context, now time.Time, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, throttle := range s.loginThrottles {
+		if throttle.lastFailureAt.Before(before) && !now.Before(throttle.blockedUntil) {
+			delete(s.loginThrottles, key)
+		}
+	}
+	return nil
+}
+
+// StoreLoginAttempt records a failed login
+func (s *Store) StoreLoginAttempt(_ context.Context, attempt bookstore.LoginAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loginAttempts = append(s.loginAttempts, attempt)
+	return nil
+}
+
+// ListLoginAttempts lists the latest failed logins using the email, newest first
+func (s *Store) ListLoginAttempts(_ context.Context, email string, limit int) ([]bookstore.LoginAttempt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]bookstore.LoginAttempt, 0, limit)
+	for _, attempt := range s.loginAttempts {
+		if attempt.Email == email {
+			list = append(list, attempt)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+// DeleteLoginAttempts removes every failed login using the email
+func (s *Store) DeleteLoginAttempts(_ context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.loginAttempts[:0]
+	for _, attempt := range s.loginAttempts {
+		if attempt.Email != email {
+			kept = append(kept, attempt)
+		}
+	}
+	s.loginAttempts = kept
+	return nil
+}
+
+// DeleteLoginAttemptsBefore removes failed logins recorded before the given time
+func (s *Store) DeleteLoginAttemptsBefore(_ context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.loginAttempts[:0]
+	for _, attempt := range s.loginAttempts {
+		if !attempt.CreatedAt.Before(before) {
+			kept = append(kept, attempt)
+		}
+	}
+	s.loginAttempts = kept
+	return nil
+}
@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// passwordReset is a stored password reset token
+type passwordReset struct {
+	accountID uuid.UUID
+	expiresAt time.Time
+}
+
+// StorePasswordReset stores a reset token of the account under its digest
+// any earlier token of the account is removed, so only the latest requested one works
+func (s *Store) StorePasswordReset(_ context.Context, tokenHash string, accountID uuid.UUID, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[accountID]; !ok {
+		return fmt.Errorf("creating password_reset.account_id=%v: %w", accountID, bookstore.NewNoResultError("account.id", nil))
+	}
+	s.deletePasswordResetsFor(accountID)
+	s.passwordResets[tokenHash] = passwordReset{accountID: accountID, expiresAt: expiresAt}
+	return nil
+}
+
+// ConsumePasswordReset deletes the reset token and returns who it belongs to and when it expires
+func (s *Store) ConsumePasswordReset(_ context.Context, tokenHash string) (uuid.UUID, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reset, ok := s.passwordResets[tokenHash]
+	if !ok {
+		return uuid.UUID{}, time.Time{}, fmt.Errorf("deleting password_reset.token_hash: %w", bookstore.ErrInvalidResetToken)
+	}
+	delete(s.passwordResets, tokenHash)
+	return reset.accountID, reset.expiresAt, nil
+}
+
+// DeleteExpiredPasswordResets removes reset tokens past their expiry
+func (s *Store) DeleteExpiredPasswordResets(_ context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenHash, reset := range s.passwordResets {
+		if !now.Before(reset.expiresAt) {
+			delete(s.passwordResets, tokenHash)
+		}
+	}
+	return nil
+}
+
+// deletePasswordResetsFor removes every reset token of the account
+// callers must hold the write lock
+func (s *Store) deletePasswordResetsFor(accountID uuid.UUID) {
+	for tokenHash, reset := range s.passwordResets {
+		if reset.accountID == accountID {
+			delete(s.passwordResets, tokenHash)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// builtinRoles are the roles psql seeds in its migrations
+func builtinRoles() []bookstore.Role {
+	return []bookstore.Role{
+		{
+			Name:        bookstore.RoleAdministrator,
+			Description: "Built-in role holding every permission",
+			Permissions: []bookstore.Permission{
+				bookstore.PermissionCatalogWrite,
+				bookstore.PermissionCoversWrite,
+				bookstore.PermissionRolesWrite,
+				bookstore.PermissionUsersImpersonate,
+				bookstore.PermissionUsersRead,
+				bookstore.PermissionUsersWrite,
+			},
+		},
+		{
+			Name:        "editor",
+			Description: "Manages the catalog and book covers",
+			Permissions: []bookstore.Permission{bookstore.PermissionCatalogWrite, bookstore.PermissionCoversWrite},
+		},
+		{
+			Name:        "support",
+			Description: "Views accounts and their sessions, and impersonates them",
+			Permissions: []bookstore.Permission{bookstore.PermissionUsersRead, bookstore.PermissionUsersImpersonate},
+		},
+	}
+}
+
+// ListRoles returns every role along with their permissions
+func (s *Store) ListRoles(_ context.Context) ([]bookstore.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	roles := make([]bookstore.Role, 0, len(s.roles))
+	for _, role := range s.roles {
+		roles = append(roles, role)
+	}
+	sortRoles(roles)
+	return roles, nil
+}
+
+// ListAccountRoles returns the roles assigned to the account along with their permissions
+func (s *Store) ListAccountRoles(_ context.Context, accountID uuid.UUID) ([]bookstore.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	roles := make([]bookstore.Role, 0, len(s.accountRoles[accountID]))
+	for name := range s.accountRoles[accountID] {
+		roles = append(roles, s.roles[name])
+	}
+	sortRoles(roles)
+	return roles, nil
+}
+
+// GetAccountPermissions returns every permission granted by the roles of the account
+func (s *Store) GetAccountPermissions(_ context.Context, accountID uuid.UUID) ([]bookstore.Permission, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[bookstore.Permission]struct{})
+	var perms []bookstore.Permission
+	for name := range s.accountRoles[accountID] {
+		for _, perm := range s.roles[name].Permissions {
+			if _, ok := seen[perm]; !ok {
+				seen[perm] = struct{}{}
+				perms = append(perms, perm)
+			}
+		}
+	}
+	sort.Slice(perms, func(i, j int) bool {
+		return perms[i] < perms[j]
+	})
+	return perms, nil
+}
+
+// AddAccountRole assigns the role to the account
+// assigning a role the account already has does nothing
+func (s *Store) AddAccountRole(_ context.Context, accountID uuid.UUID, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[accountID]; !ok {
+		return fmt.Errorf("assigning role=%s to account.id=%v: %w", role, accountID, bookstore.NewNoResultError("account.id", nil))
+	}
+	if _, ok := s.roles[role]; !ok {
+		return fmt.Errorf("assigning role=%s to account.id=%v: %w", role, accountID, bookstore.NewNoResultError("role", nil))
+	}
+	if s.accountRoles[accountID] == nil {
+		s.accountRoles[accountID] = make(map[string]struct{})
+	}
+	s.accountRoles[accountID][role] = struct{}{}
+	return nil
+}
+
+// RemoveAccountRole removes the role from the account
+func (s *Store) RemoveAccountRole(_ context.Context, accountID uuid.UUID, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accountRoles[accountID][role]; !ok {
+		return fmt.Errorf("removing role=%s from account.id=%v: %w", role, accountID, bookstore.NewNoResultError("account_role", nil))
+	}
+	delete(s.accountRoles[accountID], role)
+	return nil
+}
+
+// sortRoles sorts roles by their name, same as psql orders them
+func sortRoles(roles []bookstore.Role) {
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+}
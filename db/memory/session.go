@@ -0,0 +1,170 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// session is a stored session, it refers to the account by ID so changes to the account are reflected
+type session struct {
+	accountID uuid.UUID
+	meta      bookstore.SessionMeta
+	//rotated are the digests of every token the session was rotated away from
+	rotated []string
+}
+
+func (s *Store) StoreSession(_ context.Context, tokenHash string, account bookstore.Account, meta bookstore.SessionMeta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[tokenHash]; ok {
+		return bookstore.NewDuplicateError("session.token_hash", nil)
+	}
+	if _, ok := s.accounts[account.ID]; !ok {
+		return fmt.Errorf("storing session: %w", bookstore.NewNoResultError("account.id", nil))
+	}
+	s.sessions[tokenHash] = session{accountID: account.ID, meta: meta}
+	return nil
+}
+
+// GetSession returns the session using the current account data, same as joining the account table
+func (s *Store) GetSession(_ context.Context, tokenHash string) (bookstore.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ses, ok := s.sessions[tokenHash]
+	if !ok {
+		return bookstore.Session{}, fmt.Errorf("selecting session.token_hash: %w", bookstore.ErrInvalidSession)
+	}
+	account, ok := s.accounts[ses.accountID]
+	if !ok {
+		return bookstore.Session{}, fmt.Errorf("selecting session.token_hash: %w", bookstore.ErrInvalidSession)
+	}
+	return bookstore.Session{Account: account, Meta: ses.meta}, nil
+}
+
+// TouchSession updates when the session was last used
+func (s *Store) TouchSession(_ context.Context, tokenHash string, lastSeen time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ses, ok := s.sessions[tokenHash]; ok {
+		ses.meta.LastSeenAt = lastSeen
+		s.sessions[tokenHash] = ses
+	}
+	return nil
+}
+
+// RotateSession replaces the token of the session, keeping the old one around to detect it being reused
+func (s *Store) RotateSession(_ context.Context, tokenHash string, newTokenHash string, lastSeen time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ses, ok := s.sessions[tokenHash]
+	if !ok {
+		return fmt.Errorf("updating session.token_hash: %w", bookstore.ErrInvalidSession)
+	}
+	if _, ok := s.sessions[newTokenHash]; ok {
+		return fmt.Errorf("updating session.token_hash: %w", bookstore.NewDuplicateError("session.token_hash", nil))
+	}
+	delete(s.sessions, tokenHash)
+	ses.rotated = append(ses.rotated, tokenHash)
+	ses.meta.LastSeenAt = lastSeen
+	s.sessions[newTokenHash] = ses
+	return nil
+}
+
+// DeleteRotatedSession deletes the session any of its earlier tokens belonged to, reporting whether there was one
+func (s *Store) DeleteRotatedSession(_ context.Context, tokenHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, ses := range s.sessions {
+		for _, rotated := range ses.rotated {
+			if rotated == tokenHash {
+				delete(s.sessions, hash)
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) DeleteSession(_ context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, tokenHash)
+	return nil
+}
+
+// ListSessions lists every session of the account, oldest first
+func (s *Store) ListSessions(_ context.Context, accountID uuid.UUID) ([]bookstore.SessionMeta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var list []bookstore.SessionMeta
+	for _, ses := range s.sessions {
+		if ses.accountID == accountID {
+			list = append(list, ses.meta)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+// DeleteSessionByID deletes a single session of the account using its ID
+func (s *Store) DeleteSessionByID(_ context.Context, accountID uuid.UUID, sessionID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenHash, ses := range s.sessions {
+		if ses.accountID == accountID && ses.meta.ID == sessionID {
+			delete(s.sessions, tokenHash)
+			return nil
+		}
+	}
+	return fmt.Errorf("deleting session.id=%v: %w", sessionID, bookstore.NewNoResultError("session", nil))
+}
+
+func (s *Store) DeleteSessionsFor(_ context.Context, accountID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteSessionsFor(accountID)
+	return nil
+}
+
+// DeleteExpiredSessions removes sessions past their expiry, or last used before idleBefore
+// a zero idleBefore only removes sessions past their expiry
+func (s *Store) DeleteExpiredSessions(_ context.Context, now time.Time, idleBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenHash, ses := range s.sessions {
+		expired := ses.meta.ExpiresAt != nil && !now.Before(*ses.meta.ExpiresAt)
+		idle := !idleBefore.IsZero() && ses.meta.LastSeenAt.Before(idleBefore)
+		if expired || idle {
+			delete(s.sessions, tokenHash)
+		}
+	}
+	return nil
+}
+
+// deleteSessionsFor removes every session of the account, along with the impersonations made by it
+// callers must hold the write lock
+func (s *Store) deleteSessionsFor(accountID uuid.UUID) {
+	for tokenHash, ses := range s.sessions {
+		impersonator := ses.meta.ImpersonatorID
+		if ses.accountID == accountID || (impersonator != nil && *impersonator == accountID) {
+			delete(s.sessions, tokenHash)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// Store is an in memory implementation of the bookstore store
+// it mirrors the behaviour of psql.Store, but nothing is persisted across restarts
+// this is mostly useful for demos and running the REST layer without a database
+type Store struct {
+	mu       sync.RWMutex
+	genres   map[uuid.UUID]bookstore.Genre
+	authors  map[uuid.UUID]bookstore.Author
+	books    map[string]bookstore.Book
+	covers   map[string]bookstore.CoverData
+	accounts map[uuid.UUID]bookstore.Account
+	//sessions is keyed by the digest of the session token
+	sessions map[string]session
+	//roles is keyed by the role name
+	roles map[string]bookstore.Role
+	//accountRoles holds the names of the roles assigned to each account
+	accountRoles map[uuid.UUID]map[string]struct{}
+	//apiKeys is keyed by the digest of the key
+	apiKeys map[string]bookstore.APIKey
+	//passwordResets is keyed by the digest of the reset token
+	passwordResets map[string]passwordReset
+	//emailVerifications is keyed by the digest of the verification token
+	emailVerifications map[string]emailVerification
+	//loginThrottles is keyed by what is being throttled, e.g. the email or the IP
+	loginThrottles map[string]loginThrottle
+	//loginAttempts are the failed logins, in the order they were recorded
+	loginAttempts []bookstore.LoginAttempt
+	//totps holds the TOTP secret of each account
+	totps map[uuid.UUID]bookstore.TOTP
+	//recoveryCodes holds the digests of the unused recovery codes of each account
+	recoveryCodes map[uuid.UUID]map[string]struct{}
+	//loginChallenges is keyed by the digest of the challenge token
+	loginChallenges map[string]loginChallenge
+	//identities links the users of identity providers to accounts
+	identities map[identityKey]bookstore.Identity
+	//oidcStates is keyed by the digest of the state
+	oidcStates map[string]bookstore.OIDCState
+	//invites is keyed by the digest of the invite code
+	invites map[string]bookstore.Invite
+	//lastTime is the last handed out timestamp, see Store.now
+	lastTime time.Time
+}
+
+// New creates a new empty store
+func New() *Store {
+	s := &Store{
+		genres:             make(map[uuid.UUID]bookstore.Genre),
+		authors:            make(map[uuid.UUID]bookstore.Author),
+		books:              make(map[string]bookstore.Book),
+		covers:             make(map[string]bookstore.CoverData),
+		accounts:           make(map[uuid.UUID]bookstore.Account),
+		sessions:           make(map[string]session),
+		roles:              make(map[string]bookstore.Role),
+		accountRoles:       make(map[uuid.UUID]map[string]struct{}),
+		apiKeys:            make(map[string]bookstore.APIKey),
+		passwordResets:     make(map[string]passwordReset),
+		emailVerifications: make(map[string]emailVerification),
+		loginThrottles:     make(map[string]loginThrottle),
+		totps:              make(map[uuid.UUID]bookstore.TOTP),
+		recoveryCodes:      make(map[uuid.UUID]map[string]struct{}),
+		loginChallenges:    make(map[string]loginChallenge),
+		identities:         make(map[identityKey]bookstore.Identity),
+		oidcStates:         make(map[string]bookstore.OIDCState),
+		invites:            make(map[string]bookstore.Invite),
+	}
+	for _, role := range builtinRoles() {
+		s.roles[role.Name] = role
+	}
+	return s
+}
+
+// Init exists to satisfy the same surface as psql.Store, there is nothing to initialize
+func (s *Store) Init() error {
+	return nil
+}
+
+// now returns a timestamp that is strictly after the previously returned one
+// psql has unique indexes on created_at for paging, this keeps the same guarantee
+// callers must hold the write lock
+func (s *Store) now() time.Time {
+	t := time.Now()
+	if !t.After(s.lastTime) {
+		t = s.lastTime.Add(time.Microsecond)
+	}
+	s.lastTime = t
+	return t
+}
+
+// paginate orders items by their creation time and returns up to limit items created after the cursor
+// a zero cursor starts from the beginning
+func paginate[T any](items []T, limit int, createdAt func(T) time.Time, cursor time.Time) []T {
+	sort.Slice(items, func(i, j int) bool {
+		return createdAt(items[i]).Before(createdAt(items[j]))
+	})
+
+	list := make([]T, 0, limit)
+	for _, item := range items {
+		if len(list) >= limit {
+			break
+		}
+		if !cursor.IsZero() && !createdAt(item).After(cursor) {
+			continue
+		}
+		list = append(list, item)
+	}
+	return list
+}
+
+// errCheckViolation mimics the check constraints psql has on required text columns
+func errCheckViolation(column string) error {
+	return fmt.Errorf("value violates check constraint on %s", column)
+}
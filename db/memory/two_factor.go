@@ -0,0 +1,187 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// loginChallenge is a stored login challenge
+type loginChallenge struct {
+	accountID uuid.UUID
+	expiresAt time.Time
+}
+
+// StoreTOTP stores the secret of the account, replacing any previous one
+// the secret starts out disabled, regardless of TOTP.EnabledAt
+func (s *Store) StoreTOTP(_ context.Context, totp bookstore.TOTP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[totp.AccountID]; !ok {
+		return fmt.Errorf("creating account_totp.account_id=%v: %w", totp.AccountID, bookstore.NewNoResultError("account.id", nil))
+	}
+	if totp.Secret == "" {
+		return fmt.Errorf("creating account_totp.account_id=%v: %w", totp.AccountID, errCheckViolation("account_totp.secret"))
+	}
+	totp.EnabledAt = nil
+	totp.LastStep = 0
+	s.totps[totp.AccountID] = totp
+	return nil
+}
+
+// GetTOTP fetches the secret of the account
+func (s *Store) GetTOTP(_ context.Context, accountID uuid.UUID) (bookstore.TOTP, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	totp, ok := s.totps[accountID]
+	if !ok {
+		return bookstore.TOTP{}, fmt.Errorf("selecting account_totp.account_id=%v: %w", accountID, bookstore.NewNoResultError("account_totp", nil))
+	}
+	return totp, nil
+}
+
+// EnableTOTP marks the secret of the account as confirmed
+func (s *Store) EnableTOTP(_ context.Context, accountID uuid.UUID, enabledAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totps[accountID]
+	if !ok {
+		return fmt.Errorf("updating account_totp.account_id=%v: %w", accountID, bookstore.NewNoResultError("account_totp", nil))
+	}
+	totp.EnabledAt = &enabledAt
+	s.totps[accountID] = totp
+	return nil
+}
+
+// UseTOTPStep records the time step of an accepted code
+// it fails with bookstore.ErrInvalidTwoFactorCode if the step isn't newer than the last one, meaning the code was already used
+func (s *Store) UseTOTPStep(_ context.Context, accountID uuid.UUID, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totps[accountID]
+	if !ok || totp.LastStep >= step {
+		return fmt.Errorf("updating account_totp.account_id=%v: %w", accountID, bookstore.ErrInvalidTwoFactorCode)
+	}
+	totp.LastStep = step
+	s.totps[accountID] = totp
+	return nil
+}
+
+// DeleteTOTP removes the secret and the recovery codes of the account
+func (s *Store) DeleteTOTP(_ context.Context, accountID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.totps, accountID)
+	delete(s.recoveryCodes, accountID)
+	return nil
+}
+
+// StoreRecoveryCodes stores the digests of the recovery codes of the account, replacing any previous codes
+func (s *Store) StoreRecoveryCodes(_ context.Context, accountID uuid.UUID, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[accountID]; !ok {
+		return fmt.Errorf("creating recovery_code.account_id=%v: %w", accountID, bookstore.NewNoResultError("account.id", nil))
+	}
+	codes := make(map[string]struct{}, len(codeHashes))
+	for _, codeHash := range codeHashes {
+		codes[codeHash] = struct{}{}
+	}
+	s.recoveryCodes[accountID] = codes
+	return nil
+}
+
+// UseRecoveryCode deletes the recovery code of the account
+// it fails with bookstore.ErrInvalidTwoFactorCode if the account has no such code
+func (s *Store) UseRecoveryCode(_ context.Context, accountID uuid.UUID, codeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.recoveryCodes[accountID][codeHash]; !ok {
+		return fmt.Errorf("deleting recovery_code.account_id=%v: %w", accountID, bookstore.ErrInvalidTwoFactorCode)
+	}
+	delete(s.recoveryCodes[accountID], codeHash)
+	return nil
+}
+
+// CountRecoveryCodes counts the unused recovery codes of the account
+func (s *Store) CountRecoveryCodes(_ context.Context, accountID uuid.UUID) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.recoveryCodes[accountID]), nil
+}
+
+// StoreLoginChallenge stores a login challenge of the account under its digest
+func (s *Store) StoreLoginChallenge(_ context.Context, tokenHash string, accountID uuid.UUID, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[accountID]; !ok {
+		return fmt.Errorf("creating login_challenge.account_id=%v: %w", accountID, bookstore.NewNoResultError("account.id", nil))
+	}
+	if _, ok := s.loginChallenges[tokenHash]; ok {
+		return fmt.Errorf("creating login_challenge.account_id=%v: %w", accountID, bookstore.NewDuplicateError("login_challenge.token_hash", nil))
+	}
+	s.loginChallenges[tokenHash] = loginChallenge{accountID: accountID, expiresAt: expiresAt}
+	return nil
+}
+
+// GetLoginChallenge returns who the login challenge belongs to and when it expires
+func (s *Store) GetLoginChallenge(_ context.Context, tokenHash string) (uuid.UUID, time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	challenge, ok := s.loginChallenges[tokenHash]
+	if !ok {
+		return uuid.UUID{}, time.Time{}, fmt.Errorf("selecting login_challenge.token_hash: %w", bookstore.ErrInvalidLoginChallenge)
+	}
+	return challenge.accountID, challenge.expiresAt, nil
+}
+
+// DeleteLoginChallenge deletes the login challenge
+// it fails with bookstore.ErrInvalidLoginChallenge if it was already deleted, so a challenge can only be exchanged once
+func (s *Store) DeleteLoginChallenge(_ context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.loginChallenges[tokenHash]; !ok {
+		return fmt.Errorf("deleting login_challenge.token_hash: %w", bookstore.ErrInvalidLoginChallenge)
+	}
+	delete(s.loginChallenges, tokenHash)
+	return nil
+}
+
+// DeleteExpiredLoginChallenges removes login challenges past their expiry
+func (s *Store) DeleteExpiredLoginChallenges(_ context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenHash, challenge := range s.loginChallenges {
+		if !now.Before(challenge.expiresAt) {
+			delete(s.loginChallenges, tokenHash)
+		}
+	}
+	return nil
+}
+
+// deleteTwoFactorFor removes the secret, recovery codes and login challenges of the account
+// callers must hold the write lock
+func (s *Store) deleteTwoFactorFor(accountID uuid.UUID) {
+	delete(s.totps, accountID)
+	delete(s.recoveryCodes, accountID)
+	for tokenHash, challenge := range s.loginChallenges {
+		if challenge.accountID == accountID {
+			delete(s.loginChallenges, tokenHash)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/thunder33345/bookstore"
@@ -14,8 +15,8 @@ import (
 // note that ID, CreatedAt, UpdatedAt are all ignored
 // returns the created account when successful
 func (s *Store) CreateAccount(ctx context.Context, account bookstore.Account) (bookstore.Account, error) {
-	row := s.db.QueryRowxContext(ctx, `INSERT INTO account(name,email,password_hash,is_admin) VALUES ($1,$2,$3,$4) RETURNING *`,
-		account.Name, account.Email, account.PasswordHash, account.Admin)
+	row := s.db.QueryRowxContext(ctx, `INSERT INTO account(name,email,password_hash) VALUES ($1,$2,$3) RETURNING *`,
+		account.Name, account.Email, account.PasswordHash)
 	if err := row.Err(); err != nil {
 		err = enrichPQError(err, "account.email")
 		return bookstore.Account{}, fmt.Errorf("creating account.name=%s: %w", account.Name, err)
@@ -77,7 +78,8 @@ func (s *Store) ListAccounts(ctx context.Context, limit int, after uuid.UUID) ([
 }
 
 // UpdateAccount updates the provided account using its ID
-// note that CreatedAt, UpdatedAt cannot be set
+// note that CreatedAt, UpdatedAt cannot be set, roles are managed with AddAccountRole and RemoveAccountRole
+// changing the email clears EmailVerifiedAt, use MarkEmailVerified once the new email is confirmed
 func (s *Store) UpdateAccount(ctx context.Context, account bookstore.Account) error {
 	if account.ID == uuid.Nil {
 		return bookstore.ErrMissingID
@@ -86,11 +88,11 @@ func (s *Store) UpdateAccount(ctx context.Context, account bookstore.Account) er
 	var err error
 	if account.PasswordHash == "" {
 		//if password hash is empty, we don't update it
-		res, err = s.db.ExecContext(ctx, `UPDATE account SET name = $1,email = $2,is_admin = $3  WHERE id = $4`,
-			account.Name, account.Email, account.Admin, account.ID)
+		res, err = s.db.ExecContext(ctx, `UPDATE account SET name = $1,email = $2,email_verified_at = CASE WHEN email = $2 THEN email_verified_at END WHERE id = $3`,
+			account.Name, account.Email, account.ID)
 	} else {
-		res, err = s.db.ExecContext(ctx, `UPDATE account SET name = $1,email = $2,password_hash = $3,is_admin = $4  WHERE id = $5`,
-			account.Name, account.Email, account.PasswordHash, account.Admin, account.ID)
+		res, err = s.db.ExecContext(ctx, `UPDATE account SET name = $1,email = $2,email_verified_at = CASE WHEN email = $2 THEN email_verified_at END,password_hash = $3 WHERE id = $4`,
+			account.Name, account.Email, account.PasswordHash, account.ID)
 	}
 
 	if err != nil {
@@ -105,7 +107,7 @@ func (s *Store) UpdateAccount(ctx context.Context, account bookstore.Account) er
 }
 
 // SafeUpdateAccount updates the provided account using its ID
-// note that CreatedAt, UpdatedAt, admin cannot be set
+// note that CreatedAt, UpdatedAt cannot be set, changing the email clears EmailVerifiedAt
 func (s *Store) SafeUpdateAccount(ctx context.Context, account bookstore.Account) error {
 	if account.ID == uuid.Nil {
 		return bookstore.ErrMissingID
@@ -114,10 +116,10 @@ func (s *Store) SafeUpdateAccount(ctx context.Context, account bookstore.Account
 	var err error
 	if account.PasswordHash == "" {
 		//if password hash is empty, we don't update it
-		res, err = s.db.ExecContext(ctx, `UPDATE account SET name = $1,email = $2  WHERE id = $3`,
+		res, err = s.db.ExecContext(ctx, `UPDATE account SET name = $1,email = $2,email_verified_at = CASE WHEN email = $2 THEN email_verified_at END WHERE id = $3`,
 			account.Name, account.Email, account.ID)
 	} else {
-		res, err = s.db.ExecContext(ctx, `UPDATE account SET name = $1,email = $2,password_hash = $3  WHERE id = $5`,
+		res, err = s.db.ExecContext(ctx, `UPDATE account SET name = $1,email = $2,email_verified_at = CASE WHEN email = $2 THEN email_verified_at END,password_hash = $3 WHERE id = $4`,
 			account.Name, account.Email, account.PasswordHash, account.ID)
 	}
 
@@ -132,6 +134,78 @@ func (s *Store) SafeUpdateAccount(ctx context.Context, account bookstore.Account
 	return nil
 }
 
+// MarkEmailVerified marks the email of the account as verified
+// it fails with a NoResultError if the account no longer uses that email
+func (s *Store) MarkEmailVerified(ctx context.Context, accountID uuid.UUID, email string, verifiedAt time.Time) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE account SET email_verified_at = $1 WHERE id = $2 AND email = $3`,
+		verifiedAt, accountID, email)
+	if err != nil {
+		return fmt.Errorf("updating account.email_verified_at: %w", err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("account.email", err))
+	if err != nil {
+		return fmt.Errorf("updating account=%v: %w", accountID, err)
+	}
+	return nil
+}
+
+// SuspendAccount sets the suspension of the account, replacing the previous one if it was already suspended
+func (s *Store) SuspendAccount(ctx context.Context, accountID uuid.UUID, suspension bookstore.Suspension) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE account SET suspended_at = $1,suspended_until = $2,suspended_by = $3,suspend_reason = $4 WHERE id = $5`,
+		suspension.SuspendedAt, suspension.SuspendedUntil, suspension.SuspendedBy, suspension.SuspendReason, accountID)
+	if err != nil {
+		return fmt.Errorf("updating account.suspended_at: %w", err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("account", err))
+	if err != nil {
+		return fmt.Errorf("updating account=%v: %w", accountID, err)
+	}
+	return nil
+}
+
+// ReinstateAccount lifts the suspension of the account
+func (s *Store) ReinstateAccount(ctx context.Context, accountID uuid.UUID) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE account SET suspended_at = NULL,suspended_until = NULL,suspended_by = NULL,suspend_reason = '' WHERE id = $1`,
+		accountID)
+	if err != nil {
+		return fmt.Errorf("updating account.suspended_at: %w", err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("account", err))
+	if err != nil {
+		return fmt.Errorf("updating account=%v: %w", accountID, err)
+	}
+	return nil
+}
+
+// AnonymizeAccount replaces the name, email and password hash of the account, marking it anonymized at AnonymizedAt
+// everything else tied to the account is deleted, but the account itself is kept, so references to it stay intact
+func (s *Store) AnonymizeAccount(ctx context.Context, account bookstore.Account) error {
+	if account.ID == uuid.Nil {
+		return bookstore.ErrMissingID
+	}
+	res, err := s.db.ExecContext(ctx, `WITH
+			sessions AS (DELETE FROM session WHERE account_id = $1 OR impersonator_id = $1),
+			api_keys AS (DELETE FROM api_key WHERE account_id = $1),
+			resets AS (DELETE FROM password_reset WHERE account_id = $1),
+			verifications AS (DELETE FROM email_verification WHERE account_id = $1),
+			totp AS (DELETE FROM account_totp WHERE account_id = $1),
+			recovery_codes AS (DELETE FROM recovery_code WHERE account_id = $1),
+			challenges AS (DELETE FROM login_challenge WHERE account_id = $1),
+			identities AS (DELETE FROM account_identity WHERE account_id = $1),
+			roles AS (DELETE FROM account_role WHERE account_id = $1)
+		UPDATE account SET name = $2,email = $3,password_hash = $4,email_verified_at = NULL,anonymized_at = $5 WHERE id = $1`,
+		account.ID, account.Name, account.Email, account.PasswordHash, account.AnonymizedAt)
+	if err != nil {
+		err = enrichPQError(err, "account")
+		return fmt.Errorf("anonymizing account.id=%v: %w", account.ID, err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("account", err))
+	if err != nil {
+		return fmt.Errorf("anonymizing account=%v: %w", account.ID, err)
+	}
+	return nil
+}
+
 // DeleteAccount deletes the specified account using its ID
 func (s *Store) DeleteAccount(ctx context.Context, accountID uuid.UUID) error {
 	if accountID == uuid.Nil {
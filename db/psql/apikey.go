@@ -0,0 +1,79 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// StoreAPIKey stores the key of the account under the digest of its plaintext
+func (s *Store) StoreAPIKey(ctx context.Context, keyHash string, account bookstore.Account, key bookstore.APIKey) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO api_key(id,key_hash,account_id,name,scope,expires_at,created_at) VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+		key.ID, keyHash, account.ID, key.Name, key.Scope, key.ExpiresAt, key.CreatedAt)
+	if err != nil {
+		err = enrichPQError(err, "api_key")
+		return fmt.Errorf("creating api_key.name=%s: %w", key.Name, err)
+	}
+	return nil
+}
+
+// GetAPIKey fetches the key and the account it belongs to using the digest of the key
+func (s *Store) GetAPIKey(ctx context.Context, keyHash string) (bookstore.Account, bookstore.APIKey, error) {
+	var row struct {
+		bookstore.Account
+		Key bookstore.APIKey `db:"key"`
+	}
+	query :=
+		`SELECT a.*, k.id AS "key.id", k.account_id AS "key.account_id", k.name AS "key.name", k.scope AS "key.scope",
+			k.expires_at AS "key.expires_at", k.last_used_at AS "key.last_used_at", k.created_at AS "key.created_at"
+			FROM account a
+			INNER JOIN api_key k
+			ON k.account_id = a.id
+			WHERE k.key_hash = $1;`
+	err := s.db.GetContext(ctx, &row, query, keyHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = bookstore.ErrInvalidAPIKey
+		}
+		return bookstore.Account{}, bookstore.APIKey{}, fmt.Errorf("selecting api_key.key_hash: %w", err)
+	}
+	return row.Account, row.Key, nil
+}
+
+// TouchAPIKey updates when the key was last used
+func (s *Store) TouchAPIKey(ctx context.Context, keyID uuid.UUID, lastUsed time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE api_key SET last_used_at = $1 WHERE id = $2`, lastUsed, keyID)
+	if err != nil {
+		return fmt.Errorf("updating api_key.last_used_at: %w", err)
+	}
+	return nil
+}
+
+// ListAPIKeys lists every key of the account, oldest first
+func (s *Store) ListAPIKeys(ctx context.Context, accountID uuid.UUID) ([]bookstore.APIKey, error) {
+	var list []bookstore.APIKey
+	err := s.db.SelectContext(ctx, &list, `SELECT id, account_id, name, scope, expires_at, last_used_at, created_at
+		FROM api_key WHERE account_id = $1 ORDER BY created_at`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("listing api_key.account_id=%v: %w", accountID, err)
+	}
+	return list, nil
+}
+
+// DeleteAPIKey deletes a key of the account using its ID
+func (s *Store) DeleteAPIKey(ctx context.Context, accountID uuid.UUID, keyID uuid.UUID) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM api_key WHERE account_id = $1 AND id = $2`, accountID, keyID)
+	if err != nil {
+		return fmt.Errorf("deleting api_key.id=%v: %w", keyID, err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("api_key", err))
+	if err != nil {
+		return fmt.Errorf("deleting api_key.id=%v: %w", keyID, err)
+	}
+	return nil
+}
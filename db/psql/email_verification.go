@@ -0,0 +1,51 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// StoreEmailVerification stores a verification token of the account under its digest
+// any earlier token of the account is removed, so only the link sent to the latest email works
+func (s *Store) StoreEmailVerification(ctx context.Context, tokenHash string, accountID uuid.UUID, email string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `WITH removed AS (DELETE FROM email_verification WHERE account_id = $2)
+		INSERT INTO email_verification(token_hash,account_id,email,expires_at) VALUES ($1,$2,$3,$4)`, tokenHash, accountID, email, expiresAt)
+	if err != nil {
+		err = enrichPQError(err, "email_verification")
+		return fmt.Errorf("creating email_verification.account_id=%v: %w", accountID, err)
+	}
+	return nil
+}
+
+// ConsumeEmailVerification deletes the verification token and returns who it belongs to, the email it was sent to and when it expires
+// deleting it in the same statement ensures a token can only be used once
+func (s *Store) ConsumeEmailVerification(ctx context.Context, tokenHash string) (uuid.UUID, string, time.Time, error) {
+	var row struct {
+		AccountID uuid.UUID `db:"account_id"`
+		Email     string    `db:"email"`
+		ExpiresAt time.Time `db:"expires_at"`
+	}
+	err := s.db.GetContext(ctx, &row, `DELETE FROM email_verification WHERE token_hash = $1 RETURNING account_id, email, expires_at`, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = bookstore.ErrInvalidVerificationToken
+		}
+		return uuid.UUID{}, "", time.Time{}, fmt.Errorf("deleting email_verification.token_hash: %w", err)
+	}
+	return row.AccountID, row.Email, row.ExpiresAt, nil
+}
+
+// DeleteExpiredEmailVerifications removes verification tokens past their expiry
+func (s *Store) DeleteExpiredEmailVerifications(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM email_verification WHERE expires_at <= $1`, now)
+	if err != nil {
+		return fmt.Errorf("deleting expired email_verification: %w", err)
+	}
+	return nil
+}
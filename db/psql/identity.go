@@ -0,0 +1,82 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// CreateIdentity links the account to a user of an external identity provider
+func (s *Store) CreateIdentity(ctx context.Context, identity bookstore.Identity) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO account_identity(provider,subject,account_id) VALUES ($1,$2,$3)`,
+		identity.Provider, identity.Subject, identity.AccountID)
+	if err != nil {
+		err = enrichPQError(err, "account_identity")
+		return fmt.Errorf("creating account_identity.account_id=%v: %w", identity.AccountID, err)
+	}
+	return nil
+}
+
+// ListIdentities lists the identity provider users linked to the account, oldest first
+func (s *Store) ListIdentities(ctx context.Context, accountID uuid.UUID) ([]bookstore.Identity, error) {
+	var list []bookstore.Identity
+	err := s.db.SelectContext(ctx, &list, `SELECT provider, subject, account_id, created_at FROM account_identity
+		WHERE account_id = $1 ORDER BY created_at`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("listing account_identity.account_id=%v: %w", accountID, err)
+	}
+	return list, nil
+}
+
+// GetAccountByIdentity fetches the account linked to the user of the identity provider
+func (s *Store) GetAccountByIdentity(ctx context.Context, provider string, subject string) (bookstore.Account, error) {
+	var account bookstore.Account
+	err := s.db.GetContext(ctx, &account, `SELECT account.* FROM account
+		INNER JOIN account_identity ON account.id = account_identity.account_id
+		WHERE account_identity.provider = $1 AND account_identity.subject = $2`, provider, subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = bookstore.NewNoResultError("account_identity", err)
+		}
+		return bookstore.Account{}, fmt.Errorf("selecting account_identity.provider=%v: %w", provider, err)
+	}
+	return account, nil
+}
+
+// StoreOIDCState stores a pending OpenID Connect login under the digest of its state
+func (s *Store) StoreOIDCState(ctx context.Context, stateHash string, state bookstore.OIDCState) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO oidc_state(state_hash,provider,nonce,code_verifier,expires_at) VALUES ($1,$2,$3,$4,$5)`,
+		stateHash, state.Provider, state.Nonce, state.CodeVerifier, state.ExpiresAt)
+	if err != nil {
+		err = enrichPQError(err, "oidc_state")
+		return fmt.Errorf("creating oidc_state.provider=%v: %w", state.Provider, err)
+	}
+	return nil
+}
+
+// ConsumeOIDCState deletes the pending login and returns it, so each state can only be used once
+func (s *Store) ConsumeOIDCState(ctx context.Context, stateHash string) (bookstore.OIDCState, error) {
+	var state bookstore.OIDCState
+	err := s.db.GetContext(ctx, &state, `DELETE FROM oidc_state WHERE state_hash = $1 RETURNING provider, nonce, code_verifier, expires_at`, stateHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = bookstore.ErrInvalidOIDCState
+		}
+		return bookstore.OIDCState{}, fmt.Errorf("deleting oidc_state.state_hash: %w", err)
+	}
+	return state, nil
+}
+
+// DeleteExpiredOIDCStates removes pending logins past their expiry
+func (s *Store) DeleteExpiredOIDCStates(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM oidc_state WHERE expires_at <= $1`, now)
+	if err != nil {
+		return fmt.Errorf("deleting expired oidc_state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thunder33345/bookstore"
+)
+
+// IncrementLoginFailures counts a failed login against the key and returns the number of failures so far
+// the count starts over when the previous failure happened before resetBefore
+// this happens in a single statement, so concurrent logins across replicas are all counted
+func (s *Store) IncrementLoginFailures(ctx context.Context, key string, now time.Time, resetBefore time.Time) (int, error) {
+	var failures int
+	err := s.db.GetContext(ctx, &failures, `INSERT INTO login_throttle(key,failures,last_failure_at) VALUES ($1,1,$2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_throttle.last_failure_at < $3 THEN 1 ELSE login_throttle.failures + 1 END,
+			last_failure_at = $2
+		RETURNING failures`, key, now, resetBefore)
+	if err != nil {
+		return 0, fmt.Errorf("updating login_throttle.failures: %w", err)
+	}
+	return failures, nil
+}
+
+// BlockLogin blocks logging in with the key until the given time
+func (s *Store) BlockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE login_throttle SET blocked_until = $1 WHERE key = $2`, until, key)
+	if err != nil {
+		return fmt.Errorf("updating login_throttle.blocked_until: %w", err)
+	}
+	return nil
+}
+
+// GetLoginBlock returns until when logging in with the key is blocked, a zero time if it isn't
+func (s *Store) GetLoginBlock(ctx context.Context, key string) (time.Time, error) {
+	var until sql.NullTime
+	err := s.db.GetContext(ctx, &until, `SELECT blocked_until FROM login_throttle WHERE key = $1`, key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("selecting login_throttle.blocked_until: %w", err)
+	}
+	return until.Time, nil
+}
+
+// DeleteLoginThrottle forgets the failures of the key, lifting any block
+func (s *Store) DeleteLoginThrottle(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM login_throttle WHERE key = $1`, key)
+	if err != nil {
+		return fmt.Errorf("deleting login_throttle.key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredLoginThrottles removes keys that are no longer blocked and last failed before the given time
+func (s *Store) DeleteExpiredLoginThrottles(ctx context.Context, now time.Time, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM login_throttle WHERE last_failure_at < $2 AND (blocked_until IS NULL OR blocked_until <= $1)`, now, before)
+	if err != nil {
+		return fmt.Errorf("deleting expired login_throttle: %w", err)
+	}
+	return nil
+}
+
+// StoreLoginAttempt records a failed login
+func (s *Store) StoreLoginAttempt(ctx context.Context, attempt bookstore.LoginAttempt) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO login_attempt(id,email,ip,user_agent,created_at) VALUES ($1,$2,$3,$4,$5)`,
+		attempt.ID, attempt.Email, attempt.IP, attempt.UserAgent, attempt.CreatedAt)
+	if err != nil {
+		err = enrichPQError(err, "login_attempt")
+		return fmt.Errorf("creating login_attempt.email=%s: %w", attempt.Email, err)
+	}
+	return nil
+}
+
+// ListLoginAttempts lists the latest failed logins using the email, newest first
+func (s *Store) ListLoginAttempts(ctx context.Context, email string, limit int) ([]bookstore.LoginAttempt, error) {
+	list := make([]bookstore.LoginAttempt, 0, limit)
+	err := s.db.SelectContext(ctx, &list, `SELECT * FROM login_attempt WHERE email = $1 ORDER BY created_at DESC LIMIT $2`, email, limit)
+	if err != nil {
+		return nil, fmt.Errorf("listing login_attempt.email=%s: %w", email, err)
+	}
+	return list, nil
+}
+
+// DeleteLoginAttempts removes every failed login using the email
+func (s *Store) DeleteLoginAttempts(ctx context.Context, email string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM login_attempt WHERE email = $1`, email)
+	if err != nil {
+		return fmt.Errorf("deleting login_attempt.email=%s: %w", email, err)
+	}
+	return nil
+}
+
+// DeleteLoginAttemptsBefore removes failed logins recorded before the given time
+func (s *Store) DeleteLoginAttemptsBefore(ctx context.Context, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM login_attempt WHERE created_at < $1`, before)
+	if err != nil {
+		return fmt.Errorf("deleting expired login_attempt: %w", err)
+	}
+	return nil
+}
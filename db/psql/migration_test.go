@@ -0,0 +1,95 @@
+package psql
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/thanhpk/randstr"
+	"github.com/thunder33345/bookstore/auth"
+)
+
+// testDatabaseEnv names the environment variable holding the connection string of a database the tests can write to
+// the tests are skipped when it's not set, as they need a running postgres with pg_trgm available
+const testDatabaseEnv = "BOOKSTORE_TEST_DATABASE_URL"
+
+// newTestStore creates a store using a schema of its own, which is dropped along with the test
+// the migrations are not applied, so the test can pick the version it starts at
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	connStr := os.Getenv(testDatabaseEnv)
+	if connStr == "" {
+		t.Skipf("%s is not set", testDatabaseEnv)
+	}
+	admin, err := New(connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = admin.sqlDb.Close() })
+	schema := "test_" + strings.ToLower(randstr.Hex(8))
+	if _, err = admin.db.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _, _ = admin.db.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	//extensions stay in public, so it's kept on the search path after the schema
+	searchPath := schema + ",public"
+	if u, err := url.Parse(connStr); err == nil && u.Scheme != "" {
+		q := u.Query()
+		q.Set("search_path", searchPath)
+		u.RawQuery = q.Encode()
+		connStr = u.String()
+	} else {
+		connStr += fmt.Sprintf(" search_path='%s'", searchPath)
+	}
+	s, err := New(connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.sqlDb.Close() })
+	return s
+}
+
+func TestSessionTokenDigestMigration(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	m, err := s.migration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//sessions kept their plaintext token up to 000004
+	if err = m.Migrate(4); err != nil {
+		t.Fatal(err)
+	}
+	var accountID string
+	err = s.db.GetContext(ctx, &accountID, `INSERT INTO account(name,email,password_hash) VALUES ('Reader','reader@example.com','hash') RETURNING id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := randstr.Base62(32)
+	if _, err = s.db.ExecContext(ctx, `INSERT INTO session(token,account_id) VALUES ($1,$2)`, token, accountID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	//the token keeps working, as the digest the migration stores is the one auth looks it up by
+	ses, err := auth.NewAuth(s).GetSession(ctx, token)
+	if err != nil {
+		t.Fatalf("using the token from before the migration: %v", err)
+	}
+	if ses.Account.ID.String() != accountID {
+		t.Errorf("got the session of account %s, want %s", ses.Account.ID, accountID)
+	}
+	var stored string
+	if err = s.db.GetContext(ctx, &stored, `SELECT token_hash FROM session`); err != nil {
+		t.Fatal(err)
+	}
+	if stored == token {
+		t.Error("the plaintext token is still stored")
+	}
+}
@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP INDEX IF EXISTS index_session_last_seen_at;
+DROP INDEX IF EXISTS index_session_expires_at;
+
+ALTER TABLE session
+    ALTER COLUMN created_at DROP NOT NULL,
+    DROP COLUMN expires_at,
+    DROP COLUMN last_seen_at;
+
+COMMIT;
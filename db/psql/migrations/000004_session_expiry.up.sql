@@ -0,0 +1,19 @@
+BEGIN;
+
+-- existing sessions are treated as just seen, and never expire on their own
+ALTER TABLE session
+    ADD COLUMN last_seen_at timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN expires_at   timestamptz;
+
+UPDATE session
+SET created_at = now()
+WHERE created_at IS NULL;
+
+ALTER TABLE session
+    ALTER COLUMN created_at SET NOT NULL;
+
+-- indexes for sweeping expired sessions
+CREATE INDEX index_session_expires_at ON session USING btree (expires_at);
+CREATE INDEX index_session_last_seen_at ON session USING btree (last_seen_at);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+-- the digests can't be turned back into tokens, so every session is invalidated
+DELETE FROM session;
+
+ALTER TABLE session
+    RENAME COLUMN token_hash TO token;
+
+COMMIT;
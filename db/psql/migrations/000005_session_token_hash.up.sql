@@ -0,0 +1,10 @@
+BEGIN;
+
+-- only a digest of the token is kept, existing tokens are converted so nobody gets logged out
+ALTER TABLE session
+    RENAME COLUMN token TO token_hash;
+
+UPDATE session
+SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+
+COMMIT;
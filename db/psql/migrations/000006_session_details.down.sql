@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP INDEX IF EXISTS index_session_account_id;
+DROP INDEX IF EXISTS index_session_id;
+
+ALTER TABLE session
+    DROP COLUMN user_agent,
+    DROP COLUMN ip,
+    DROP COLUMN id;
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+-- id is an opaque handle to the session, so it can be listed and revoked without exposing the token digest
+ALTER TABLE session
+    ADD COLUMN id         uuid NOT NULL DEFAULT uuid_generate_v4(),
+    ADD COLUMN ip         text NOT NULL DEFAULT '',
+    ADD COLUMN user_agent text NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX index_session_id ON session USING btree (id);
+CREATE INDEX index_session_account_id ON session USING btree (account_id);
+
+COMMIT;
@@ -0,0 +1,15 @@
+BEGIN;
+
+ALTER TABLE account
+    ADD COLUMN is_admin boolean DEFAULT false;
+
+-- only administrators map back to admins, every other role is lost
+UPDATE account
+SET is_admin = true
+WHERE id IN (SELECT account_id FROM account_role WHERE role = 'administrator');
+
+DROP TABLE IF EXISTS account_role;
+DROP TABLE IF EXISTS role_permission;
+DROP TABLE IF EXISTS role;
+
+COMMIT;
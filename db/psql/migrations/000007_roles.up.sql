@@ -0,0 +1,51 @@
+BEGIN;
+
+CREATE TABLE role
+(
+    name        text NOT NULL PRIMARY KEY CHECK (name <> ''),
+    description text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE role_permission
+(
+    role       text NOT NULL,
+    permission text NOT NULL CHECK (permission <> ''),
+    PRIMARY KEY (role, permission),
+    CONSTRAINT fk_role FOREIGN KEY (role) REFERENCES role (name) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE account_role
+(
+    account_id uuid NOT NULL,
+    role       text NOT NULL,
+    PRIMARY KEY (account_id, role),
+    CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE,
+    CONSTRAINT fk_role FOREIGN KEY (role) REFERENCES role (name) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+-- built-in roles, more can be added directly in the db
+INSERT INTO role(name, description)
+VALUES ('administrator', 'Built-in role holding every permission'),
+       ('editor', 'Manages the catalog and book covers'),
+       ('support', 'Views accounts and their sessions');
+
+INSERT INTO role_permission(role, permission)
+VALUES ('administrator', 'catalog:write'),
+       ('administrator', 'covers:write'),
+       ('administrator', 'users:read'),
+       ('administrator', 'users:write'),
+       ('administrator', 'roles:write'),
+       ('editor', 'catalog:write'),
+       ('editor', 'covers:write'),
+       ('support', 'users:read');
+
+-- existing admins become administrators
+INSERT INTO account_role(account_id, role)
+SELECT id, 'administrator'
+FROM account
+WHERE is_admin;
+
+ALTER TABLE account
+    DROP COLUMN is_admin;
+
+COMMIT;
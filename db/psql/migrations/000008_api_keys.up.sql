@@ -0,0 +1,18 @@
+BEGIN;
+
+-- like sessions, only a digest of the key is kept
+CREATE TABLE api_key
+(
+    id           uuid        NOT NULL PRIMARY KEY,
+    key_hash     text        NOT NULL UNIQUE,
+    account_id   uuid        NOT NULL,
+    name         text        NOT NULL CHECK (name <> ''),
+    scope        text        NOT NULL DEFAULT '',
+    expires_at   timestamptz,
+    last_used_at timestamptz,
+    created_at   timestamptz NOT NULL,
+    CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE
+);
+CREATE INDEX index_api_key_account_id ON api_key USING btree (account_id);
+
+COMMIT;
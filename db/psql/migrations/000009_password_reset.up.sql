@@ -0,0 +1,14 @@
+BEGIN;
+
+-- like sessions, only a digest of the token is kept
+CREATE TABLE password_reset
+(
+    token_hash text        NOT NULL PRIMARY KEY,
+    account_id uuid        NOT NULL,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE
+);
+CREATE INDEX index_password_reset_account_id ON password_reset USING btree (account_id);
+
+COMMIT;
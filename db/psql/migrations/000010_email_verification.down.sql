@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE IF EXISTS email_verification;
+ALTER TABLE account
+    DROP COLUMN IF EXISTS email_verified_at;
+
+COMMIT;
@@ -0,0 +1,21 @@
+BEGIN;
+
+ALTER TABLE account
+    ADD COLUMN email_verified_at timestamptz;
+-- accounts created before verification existed had no way to verify, so they are trusted as is
+UPDATE account
+SET email_verified_at = created_at;
+
+-- the token is bound to the email it was sent to, so it can't verify an address it wasn't sent to
+CREATE TABLE email_verification
+(
+    token_hash text        NOT NULL PRIMARY KEY,
+    account_id uuid        NOT NULL,
+    email      text        NOT NULL,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE
+);
+CREATE INDEX index_email_verification_account_id ON email_verification USING btree (account_id);
+
+COMMIT;
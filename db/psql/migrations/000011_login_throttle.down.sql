@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS login_attempt;
+DROP TABLE IF EXISTS login_throttle;
+
+COMMIT;
@@ -0,0 +1,24 @@
+BEGIN;
+
+-- failed login counters, keyed by what is being throttled e.g. the email or the IP
+CREATE TABLE login_throttle
+(
+    key             text        NOT NULL PRIMARY KEY,
+    failures        integer     NOT NULL,
+    last_failure_at timestamptz NOT NULL,
+    blocked_until   timestamptz
+);
+
+-- the email is kept as is, failed logins aren't necessarily for an existing account
+CREATE TABLE login_attempt
+(
+    id         uuid        NOT NULL PRIMARY KEY,
+    email      text        NOT NULL,
+    ip         text        NOT NULL DEFAULT '',
+    user_agent text        NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL
+);
+CREATE INDEX index_login_attempt_email ON login_attempt USING btree (email, created_at);
+CREATE INDEX index_login_attempt_created_at ON login_attempt USING btree (created_at);
+
+COMMIT;
@@ -0,0 +1,34 @@
+BEGIN;
+
+-- the secret has to be kept as is, as it's needed to generate the expected codes
+CREATE TABLE account_totp
+(
+    account_id uuid        NOT NULL PRIMARY KEY,
+    secret     text        NOT NULL CHECK (secret <> ''),
+    enabled_at timestamptz,
+    last_step  bigint      NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL,
+    CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE
+);
+
+-- like sessions, only a digest of the codes is kept
+CREATE TABLE recovery_code
+(
+    account_id uuid NOT NULL,
+    code_hash  text NOT NULL,
+    PRIMARY KEY (account_id, code_hash),
+    CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE
+);
+
+-- issued after the password is checked, exchanged for a session along with a two-factor code
+CREATE TABLE login_challenge
+(
+    token_hash text        NOT NULL PRIMARY KEY,
+    account_id uuid        NOT NULL,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE
+);
+CREATE INDEX index_login_challenge_account_id ON login_challenge USING btree (account_id);
+
+COMMIT;
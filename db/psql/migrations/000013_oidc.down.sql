@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS oidc_state;
+DROP TABLE IF EXISTS account_identity;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE session
+    DROP COLUMN previous_token_hash;
+
+COMMIT;
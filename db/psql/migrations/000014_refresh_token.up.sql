@@ -0,0 +1,7 @@
+BEGIN;
+
+-- the token a session had before its latest refresh, so reusing it can be detected
+ALTER TABLE session
+    ADD COLUMN previous_token_hash text UNIQUE;
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE account
+    DROP CONSTRAINT fk_suspended_by,
+    DROP COLUMN suspend_reason,
+    DROP COLUMN suspended_by,
+    DROP COLUMN suspended_until,
+    DROP COLUMN suspended_at;
+
+COMMIT;
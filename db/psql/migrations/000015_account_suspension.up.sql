@@ -0,0 +1,11 @@
+BEGIN;
+
+-- suspended accounts are kept around, unlike deleting them
+ALTER TABLE account
+    ADD COLUMN suspended_at    timestamptz,
+    ADD COLUMN suspended_until timestamptz,
+    ADD COLUMN suspended_by    uuid,
+    ADD COLUMN suspend_reason  text NOT NULL DEFAULT '',
+    ADD CONSTRAINT fk_suspended_by FOREIGN KEY (suspended_by) REFERENCES account (id) ON DELETE SET NULL;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE account
+    DROP COLUMN anonymized_at;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+-- anonymized accounts are kept so references to them stay intact, only their personal data is erased
+ALTER TABLE account
+    ADD COLUMN anonymized_at timestamptz;
+
+COMMIT;
@@ -0,0 +1,19 @@
+BEGIN;
+
+UPDATE role
+SET description = 'Views accounts and their sessions'
+WHERE name = 'support';
+
+DELETE
+FROM role_permission
+WHERE permission = 'users:impersonate';
+
+DELETE
+FROM session
+WHERE impersonator_id IS NOT NULL;
+
+ALTER TABLE session
+    DROP CONSTRAINT fk_impersonator,
+    DROP COLUMN impersonator_id;
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+-- impersonation sessions are issued to admins acting as the account, they die along with the admin
+ALTER TABLE session
+    ADD COLUMN impersonator_id uuid,
+    ADD CONSTRAINT fk_impersonator FOREIGN KEY (impersonator_id) REFERENCES account (id) ON DELETE CASCADE;
+
+INSERT INTO role_permission(role, permission)
+VALUES ('administrator', 'users:impersonate'),
+       ('support', 'users:impersonate');
+
+UPDATE role
+SET description = 'Views accounts and their sessions, and impersonates them'
+WHERE name = 'support';
+
+COMMIT;
@@ -0,0 +1,15 @@
+BEGIN;
+
+ALTER TABLE session
+    ADD COLUMN previous_token_hash text UNIQUE;
+
+UPDATE session
+SET previous_token_hash = latest.token_hash
+FROM (SELECT DISTINCT ON (session_id) session_id, token_hash
+      FROM session_rotated_token
+      ORDER BY session_id, rotated_at DESC) latest
+WHERE session.id = latest.session_id;
+
+DROP TABLE session_rotated_token;
+
+COMMIT;
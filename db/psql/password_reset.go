@@ -0,0 +1,50 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// StorePasswordReset stores a reset token of the account under its digest
+// any earlier token of the account is removed, so only the latest requested one works
+func (s *Store) StorePasswordReset(ctx context.Context, tokenHash string, accountID uuid.UUID, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `WITH removed AS (DELETE FROM password_reset WHERE account_id = $2)
+		INSERT INTO password_reset(token_hash,account_id,expires_at) VALUES ($1,$2,$3)`, tokenHash, accountID, expiresAt)
+	if err != nil {
+		err = enrichPQError(err, "password_reset")
+		return fmt.Errorf("creating password_reset.account_id=%v: %w", accountID, err)
+	}
+	return nil
+}
+
+// ConsumePasswordReset deletes the reset token and returns who it belongs to and when it expires
+// deleting it in the same statement ensures a token can only be used once
+func (s *Store) ConsumePasswordReset(ctx context.Context, tokenHash string) (uuid.UUID, time.Time, error) {
+	var row struct {
+		AccountID uuid.UUID `db:"account_id"`
+		ExpiresAt time.Time `db:"expires_at"`
+	}
+	err := s.db.GetContext(ctx, &row, `DELETE FROM password_reset WHERE token_hash = $1 RETURNING account_id, expires_at`, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = bookstore.ErrInvalidResetToken
+		}
+		return uuid.UUID{}, time.Time{}, fmt.Errorf("deleting password_reset.token_hash: %w", err)
+	}
+	return row.AccountID, row.ExpiresAt, nil
+}
+
+// DeleteExpiredPasswordResets removes reset tokens past their expiry
+func (s *Store) DeleteExpiredPasswordResets(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM password_reset WHERE expires_at <= $1`, now)
+	if err != nil {
+		return fmt.Errorf("deleting expired password_reset: %w", err)
+	}
+	return nil
+}
@@ -5,49 +5,132 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/thunder33345/bookstore"
 )
 
-func (s *Store) StoreSession(ctx context.Context, token string, account bookstore.Account) error {
-	_, err := s.db.ExecContext(ctx, `INSERT INTO session(token,account_id) VALUES ($1,$2)`, token, account.ID)
+func (s *Store) StoreSession(ctx context.Context, tokenHash string, account bookstore.Account, meta bookstore.SessionMeta) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO session(token_hash,id,account_id,created_at,last_seen_at,expires_at,ip,user_agent,impersonator_id) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
+		tokenHash, meta.ID, account.ID, meta.CreatedAt, meta.LastSeenAt, meta.ExpiresAt, meta.IP, meta.UserAgent, meta.ImpersonatorID)
 	if err != nil {
-		err = enrichPQError(err, "session.token")
+		err = enrichPQError(err, "session.token_hash")
 		return err
 	}
 	return nil
 }
 
-func (s *Store) GetSession(ctx context.Context, token string) (bookstore.Session, error) {
-	var account bookstore.Account
+func (s *Store) GetSession(ctx context.Context, tokenHash string) (bookstore.Session, error) {
+	var ses bookstore.Session
 	query :=
-		`SELECT a.* FROM account a
+		`SELECT a.*, s.id AS "session.id", s.created_at AS "session.created_at", s.last_seen_at AS "session.last_seen_at",
+			s.expires_at AS "session.expires_at", s.ip AS "session.ip", s.user_agent AS "session.user_agent",
+			s.impersonator_id AS "session.impersonator_id"
+			FROM account a
 			INNER JOIN session s
   			ON s.account_id = a.id
-			WHERE s.token = $1;`
-	err := s.db.GetContext(ctx, &account, query, token)
+			WHERE s.token_hash = $1;`
+	err := s.db.GetContext(ctx, &ses, query, tokenHash)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			err = bookstore.ErrInvalidSession
 		}
-		return bookstore.Session{}, fmt.Errorf("selecting session.token: %w", err)
+		return bookstore.Session{}, fmt.Errorf("selecting session.token_hash: %w", err)
 	}
-	return bookstore.Session{Account: account}, nil
+	return ses, nil
 }
 
-func (s *Store) DeleteSession(ctx context.Context, token string) error {
-	_, err := s.db.ExecContext(ctx, `DELETE FROM session WHERE token = $1`, token)
+// TouchSession updates when the session was last used
+func (s *Store) TouchSession(ctx context.Context, tokenHash string, lastSeen time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE session SET last_seen_at = $1 WHERE token_hash = $2`, lastSeen, tokenHash)
 	if err != nil {
-		return fmt.Errorf("deleting session.token: %w", err)
+		return fmt.Errorf("updating session.last_seen_at: %w", err)
+	}
+	return nil
+}
+
+// RotateSession replaces the token of the session, keeping the old one around to detect it being reused
+func (s *Store) RotateSession(ctx context.Context, tokenHash string, newTokenHash string, lastSeen time.Time) error {
+	res, err := s.db.ExecContext(ctx, `WITH rotated AS (UPDATE session SET token_hash = $1, last_seen_at = $2 WHERE token_hash = $3 RETURNING id)
+		INSERT INTO session_rotated_token(token_hash,session_id,rotated_at) SELECT $3, id, $2 FROM rotated`,
+		newTokenHash, lastSeen, tokenHash)
+	if err != nil {
+		return fmt.Errorf("updating session.token_hash: %w", enrichPQError(err, "session.token_hash"))
+	}
+	err = checkAffectedRows(res, bookstore.ErrInvalidSession)
+	if err != nil {
+		return fmt.Errorf("updating session.token_hash: %w", err)
+	}
+	return nil
+}
+
+// DeleteRotatedSession deletes the session any of its earlier tokens belonged to, reporting whether there was one
+// the tokens it was rotated away from are deleted along with it
+func (s *Store) DeleteRotatedSession(ctx context.Context, tokenHash string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM session WHERE id = (SELECT session_id FROM session_rotated_token WHERE token_hash = $1)`, tokenHash)
+	if err != nil {
+		return false, fmt.Errorf("deleting session_rotated_token.token_hash: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("deleting session_rotated_token.token_hash: %w", err)
+	}
+	return affected > 0, nil
+}
+
+func (s *Store) DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM session WHERE token_hash = $1`, tokenHash)
+	if err != nil {
+		return fmt.Errorf("deleting session.token_hash: %w", err)
+	}
+	return nil
+}
+
+// ListSessions lists every session of the account, oldest first
+func (s *Store) ListSessions(ctx context.Context, accountID uuid.UUID) ([]bookstore.SessionMeta, error) {
+	var list []bookstore.SessionMeta
+	err := s.db.SelectContext(ctx, &list, `SELECT id, created_at, last_seen_at, expires_at, ip, user_agent, impersonator_id
+		FROM session WHERE account_id = $1 ORDER BY created_at`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("listing session.account_id=%v: %w", accountID, err)
+	}
+	return list, nil
+}
+
+// DeleteSessionByID deletes a single session of the account using its ID
+func (s *Store) DeleteSessionByID(ctx context.Context, accountID uuid.UUID, sessionID uuid.UUID) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM session WHERE account_id = $1 AND id = $2`, accountID, sessionID)
+	if err != nil {
+		return fmt.Errorf("deleting session.id=%v: %w", sessionID, err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("session", err))
+	if err != nil {
+		return fmt.Errorf("deleting session.id=%v: %w", sessionID, err)
 	}
 	return nil
 }
 
+// DeleteSessionsFor deletes every session of the account, along with the impersonations made by it
 func (s *Store) DeleteSessionsFor(ctx context.Context, accountID uuid.UUID) error {
-	_, err := s.db.ExecContext(ctx, `DELETE FROM session WHERE account_id = $1`, accountID)
+	_, err := s.db.ExecContext(ctx, `DELETE FROM session WHERE account_id = $1 OR impersonator_id = $1`, accountID)
 	if err != nil {
 		return fmt.Errorf("deleting session.token: %w", err)
 	}
 	return nil
 }
+
+// DeleteExpiredSessions removes sessions past their expiry, or last used before idleBefore
+// a zero idleBefore only removes sessions past their expiry
+func (s *Store) DeleteExpiredSessions(ctx context.Context, now time.Time, idleBefore time.Time) error {
+	var err error
+	if idleBefore.IsZero() {
+		_, err = s.db.ExecContext(ctx, `DELETE FROM session WHERE expires_at <= $1`, now)
+	} else {
+		_, err = s.db.ExecContext(ctx, `DELETE FROM session WHERE expires_at <= $1 OR last_seen_at < $2`, now, idleBefore)
+	}
+	if err != nil {
+		return fmt.Errorf("deleting expired sessions: %w", err)
+	}
+	return nil
+}
@@ -82,6 +82,20 @@ var migrationFS embed.FS
 
 // migrate attempts to run migrations on the database to sync the database state with application state
 func (s *Store) migrate() error {
+	m, err := s.migration()
+	if err != nil {
+		return err
+	}
+
+	err = m.Up()
+	if err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("error running migration: %w", err)
+	}
+	return nil
+}
+
+// migration creates the migrate instance of the database, using the embedded migrations
+func (s *Store) migration() (*migrate.Migrate, error) {
 	sqlDriver, err := postgres.WithInstance(s.sqlDb, &postgres.Config{
 		MigrationsTable:       "",
 		MigrationsTableQuoted: false,
@@ -92,24 +106,19 @@ func (s *Store) migrate() error {
 		MultiStatementMaxSize: 0,
 	})
 	if err != nil {
-		return fmt.Errorf("error creating psql driver: %w", err)
+		return nil, fmt.Errorf("error creating psql driver: %w", err)
 	}
 
 	srcDriver, err := iofs.New(migrationFS, "migrations")
 	if err != nil {
-		return fmt.Errorf("error creating fs driver: %w", err)
+		return nil, fmt.Errorf("error creating fs driver: %w", err)
 	}
 
 	m, err := migrate.NewWithInstance("iofs", srcDriver, "postgres", sqlDriver)
 	if err != nil {
-		return fmt.Errorf("error creating migration: %w", err)
-	}
-
-	err = m.Up()
-	if err != nil && err != migrate.ErrNoChange {
-		return fmt.Errorf("error running migration: %w", err)
+		return nil, fmt.Errorf("error creating migration: %w", err)
 	}
-	return nil
+	return m, nil
 }
 
 // enrichPQError attempts to adds error type to a pq error
@@ -131,6 +140,10 @@ func enrichPQError(err error, resource string) error {
 			err = bookstore.NewInvalidDependencyError("genre", err)
 		case "fk_isbn":
 			err = bookstore.NewNoResultError("book.isbn", err)
+		case "fk_account":
+			err = bookstore.NewNoResultError("account.id", err)
+		case "fk_role":
+			err = bookstore.NewNoResultError("role", err)
 		}
 	}
 	return err
@@ -0,0 +1,161 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/thunder33345/bookstore"
+)
+
+// StoreTOTP stores the secret of the account, replacing any previous one
+// the secret starts out disabled, regardless of TOTP.EnabledAt
+func (s *Store) StoreTOTP(ctx context.Context, totp bookstore.TOTP) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO account_totp(account_id,secret,created_at) VALUES ($1,$2,$3)
+		ON CONFLICT (account_id) DO UPDATE SET secret = excluded.secret, enabled_at = NULL, last_step = 0, created_at = excluded.created_at`,
+		totp.AccountID, totp.Secret, totp.CreatedAt)
+	if err != nil {
+		err = enrichPQError(err, "account_totp")
+		return fmt.Errorf("creating account_totp.account_id=%v: %w", totp.AccountID, err)
+	}
+	return nil
+}
+
+// GetTOTP fetches the secret of the account
+func (s *Store) GetTOTP(ctx context.Context, accountID uuid.UUID) (bookstore.TOTP, error) {
+	var totp bookstore.TOTP
+	err := s.db.GetContext(ctx, &totp, `SELECT * FROM account_totp WHERE account_id = $1`, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = bookstore.NewNoResultError("account_totp", err)
+		}
+		return bookstore.TOTP{}, fmt.Errorf("selecting account_totp.account_id=%v: %w", accountID, err)
+	}
+	return totp, nil
+}
+
+// EnableTOTP marks the secret of the account as confirmed
+func (s *Store) EnableTOTP(ctx context.Context, accountID uuid.UUID, enabledAt time.Time) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE account_totp SET enabled_at = $1 WHERE account_id = $2`, enabledAt, accountID)
+	if err != nil {
+		return fmt.Errorf("updating account_totp.enabled_at: %w", err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("account_totp", err))
+	if err != nil {
+		return fmt.Errorf("updating account_totp.account_id=%v: %w", accountID, err)
+	}
+	return nil
+}
+
+// UseTOTPStep records the time step of an accepted code
+// it fails with bookstore.ErrInvalidTwoFactorCode if the step isn't newer than the last one, meaning the code was already used
+func (s *Store) UseTOTPStep(ctx context.Context, accountID uuid.UUID, step int64) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE account_totp SET last_step = $1 WHERE account_id = $2 AND last_step < $1`, step, accountID)
+	if err != nil {
+		return fmt.Errorf("updating account_totp.last_step: %w", err)
+	}
+	err = checkAffectedRows(res, bookstore.ErrInvalidTwoFactorCode)
+	if err != nil {
+		return fmt.Errorf("updating account_totp.account_id=%v: %w", accountID, err)
+	}
+	return nil
+}
+
+// DeleteTOTP removes the secret and the recovery codes of the account
+func (s *Store) DeleteTOTP(ctx context.Context, accountID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `WITH removed AS (DELETE FROM recovery_code WHERE account_id = $1)
+		DELETE FROM account_totp WHERE account_id = $1`, accountID)
+	if err != nil {
+		return fmt.Errorf("deleting account_totp.account_id=%v: %w", accountID, err)
+	}
+	return nil
+}
+
+// StoreRecoveryCodes stores the digests of the recovery codes of the account, replacing any previous codes
+func (s *Store) StoreRecoveryCodes(ctx context.Context, accountID uuid.UUID, codeHashes []string) error {
+	_, err := s.db.ExecContext(ctx, `WITH removed AS (DELETE FROM recovery_code WHERE account_id = $1)
+		INSERT INTO recovery_code(account_id,code_hash) SELECT $1, unnest($2::text[])`, accountID, pq.Array(codeHashes))
+	if err != nil {
+		err = enrichPQError(err, "recovery_code")
+		return fmt.Errorf("creating recovery_code.account_id=%v: %w", accountID, err)
+	}
+	return nil
+}
+
+// UseRecoveryCode deletes the recovery code of the account
+// it fails with bookstore.ErrInvalidTwoFactorCode if the account has no such code
+func (s *Store) UseRecoveryCode(ctx context.Context, accountID uuid.UUID, codeHash string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM recovery_code WHERE account_id = $1 AND code_hash = $2`, accountID, codeHash)
+	if err != nil {
+		return fmt.Errorf("deleting recovery_code: %w", err)
+	}
+	err = checkAffectedRows(res, bookstore.ErrInvalidTwoFactorCode)
+	if err != nil {
+		return fmt.Errorf("deleting recovery_code.account_id=%v: %w", accountID, err)
+	}
+	return nil
+}
+
+// CountRecoveryCodes counts the unused recovery codes of the account
+func (s *Store) CountRecoveryCodes(ctx context.Context, accountID uuid.UUID) (int, error) {
+	var count int
+	err := s.db.GetContext(ctx, &count, `SELECT count(*) FROM recovery_code WHERE account_id = $1`, accountID)
+	if err != nil {
+		return 0, fmt.Errorf("counting recovery_code.account_id=%v: %w", accountID, err)
+	}
+	return count, nil
+}
+
+// StoreLoginChallenge stores a login challenge of the account under its digest
+func (s *Store) StoreLoginChallenge(ctx context.Context, tokenHash string, accountID uuid.UUID, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO login_challenge(token_hash,account_id,expires_at) VALUES ($1,$2,$3)`,
+		tokenHash, accountID, expiresAt)
+	if err != nil {
+		err = enrichPQError(err, "login_challenge")
+		return fmt.Errorf("creating login_challenge.account_id=%v: %w", accountID, err)
+	}
+	return nil
+}
+
+// GetLoginChallenge returns who the login challenge belongs to and when it expires
+func (s *Store) GetLoginChallenge(ctx context.Context, tokenHash string) (uuid.UUID, time.Time, error) {
+	var row struct {
+		AccountID uuid.UUID `db:"account_id"`
+		ExpiresAt time.Time `db:"expires_at"`
+	}
+	err := s.db.GetContext(ctx, &row, `SELECT account_id, expires_at FROM login_challenge WHERE token_hash = $1`, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = bookstore.ErrInvalidLoginChallenge
+		}
+		return uuid.UUID{}, time.Time{}, fmt.Errorf("selecting login_challenge.token_hash: %w", err)
+	}
+	return row.AccountID, row.ExpiresAt, nil
+}
+
+// DeleteLoginChallenge deletes the login challenge
+// it fails with bookstore.ErrInvalidLoginChallenge if it was already deleted, so a challenge can only be exchanged once
+func (s *Store) DeleteLoginChallenge(ctx context.Context, tokenHash string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM login_challenge WHERE token_hash = $1`, tokenHash)
+	if err != nil {
+		return fmt.Errorf("deleting login_challenge.token_hash: %w", err)
+	}
+	err = checkAffectedRows(res, bookstore.ErrInvalidLoginChallenge)
+	if err != nil {
+		return fmt.Errorf("deleting login_challenge.token_hash: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredLoginChallenges removes login challenges past their expiry
+func (s *Store) DeleteExpiredLoginChallenges(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM login_challenge WHERE expires_at <= $1`, now)
+	if err != nil {
+		return fmt.Errorf("deleting expired login_challenge: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// CreateAccount creates an account using provided model
+// note that ID, CreatedAt, UpdatedAt are all ignored
+// returns the created account when successful
+func (s *Store) CreateAccount(ctx context.Context, account bookstore.Account) (bookstore.Account, error) {
+	var created bookstore.Account
+	ts := now()
+	err := s.db.GetContext(ctx, &created, `INSERT INTO account(id,name,email,password_hash,created_at,updated_at) VALUES (?,?,?,?,?,?) RETURNING *`,
+		uuid.New(), account.Name, account.Email, account.PasswordHash, ts, ts)
+	if err != nil {
+		err = enrichSQLiteError(err, "account.email")
+		return bookstore.Account{}, fmt.Errorf("creating account.name=%s: %w", account.Name, err)
+	}
+	return created, nil
+}
+
+// GetAccount fetches an account using its ID
+func (s *Store) GetAccount(ctx context.Context, accountID uuid.UUID) (bookstore.Account, error) {
+	var account bookstore.Account
+	err := s.db.GetContext(ctx, &account, `SELECT * FROM account WHERE id = ? LIMIT 1`, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = bookstore.NewNoResultError("account.id", err)
+		}
+		return bookstore.Account{}, fmt.Errorf("selecting account.id=%v: %w", accountID, err)
+	}
+	return account, nil
+}
+
+// GetAccountByEmail fetches an account using its email
+func (s *Store) GetAccountByEmail(ctx context.Context, email string) (bookstore.Account, error) {
+	var account bookstore.Account
+	err := s.db.GetContext(ctx, &account, `SELECT * FROM account WHERE email = ? LIMIT 1`, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = bookstore.NewNoResultError("account.email", err)
+		}
+		return bookstore.Account{}, fmt.Errorf("selecting account.email=%v: %w", email, err)
+	}
+	return account, nil
+}
+
+// ListAccounts returns a list of accounts
+// to paginate, use the last received Account.ID to paginate
+func (s *Store) ListAccounts(ctx context.Context, limit int, after uuid.UUID) ([]bookstore.Account, error) {
+	accounts := make([]bookstore.Account, 0, limit)
+	var err error
+	if after != uuid.Nil {
+		//if after uuid is provided, we look up its created_at and only select accounts created after it
+		var cursor time.Time
+		cursor, err = s.cursorTime(ctx, "account", "id", after, "account")
+		if err != nil {
+			return nil, fmt.Errorf("listing accounts limit=%v after=%s: %w", limit, after, err)
+		}
+		err = s.db.SelectContext(ctx, &accounts, `SELECT * FROM account WHERE created_at > ? ORDER BY created_at LIMIT ?`, cursor, limit)
+	} else {
+		err = s.db.SelectContext(ctx, &accounts, `SELECT * FROM account ORDER BY created_at LIMIT ?`, limit)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("listing accounts limit=%v after=%s: %w", limit, after, err)
+	}
+	return accounts, nil
+}
+
+// UpdateAccount updates the provided account using its ID
+// note that CreatedAt, UpdatedAt cannot be set, roles are managed with AddAccountRole and RemoveAccountRole
+// changing the email clears EmailVerifiedAt, use MarkEmailVerified once the new email is confirmed
+func (s *Store) UpdateAccount(ctx context.Context, account bookstore.Account) error {
+	if account.ID == uuid.Nil {
+		return bookstore.ErrMissingID
+	}
+	var res sql.Result
+	var err error
+	if account.PasswordHash == "" {
+		//if password hash is empty, we don't update it
+		res, err = s.db.ExecContext(ctx, `UPDATE account SET name = ?,email = ?,email_verified_at = CASE WHEN email = ? THEN email_verified_at END,updated_at = ? WHERE id = ?`,
+			account.Name, account.Email, account.Email, now(), account.ID)
+	} else {
+		res, err = s.db.ExecContext(ctx, `UPDATE account SET name = ?,email = ?,email_verified_at = CASE WHEN email = ? THEN email_verified_at END,password_hash = ?,updated_at = ? WHERE id = ?`,
+			account.Name, account.Email, account.Email, account.PasswordHash, now(), account.ID)
+	}
+
+	if err != nil {
+		err = enrichSQLiteError(err, "account.email")
+		return fmt.Errorf("updating account: %w", err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("account", err))
+	if err != nil {
+		return fmt.Errorf("updating account=%v: %w", account.ID, err)
+	}
+	return nil
+}
+
+// SafeUpdateAccount updates the provided account using its ID
+// note that CreatedAt, UpdatedAt cannot be set, changing the email clears EmailVerifiedAt
+func (s *Store) SafeUpdateAccount(ctx context.Context, account bookstore.Account) error {
+	if account.ID == uuid.Nil {
+		return bookstore.ErrMissingID
+	}
+	var res sql.Result
+	var err error
+	if account.PasswordHash == "" {
+		//if password hash is empty, we don't update it
+		res, err = s.db.ExecContext(ctx, `UPDATE account SET name = ?,email = ?,email_verified_at = CASE WHEN email = ? THEN email_verified_at END,updated_at = ? WHERE id = ?`,
+			account.Name, account.Email, account.Email, now(), account.ID)
+	} else {
+		res, err = s.db.ExecContext(ctx, `UPDATE account SET name = ?,email = ?,email_verified_at = CASE WHEN email = ? THEN email_verified_at END,password_hash = ?,updated_at = ? WHERE id = ?`,
+			account.Name, account.Email, account.Email, account.PasswordHash, now(), account.ID)
+	}
+
+	if err != nil {
+		err = enrichSQLiteError(err, "account.email")
+		return fmt.Errorf("updating account: %w", err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("account", err))
+	if err != nil {
+		return fmt.Errorf("updating account=%v: %w", account.ID, err)
+	}
+	return nil
+}
+
+// MarkEmailVerified marks the email of the account as verified
+// it fails with a NoResultError if the account no longer uses that email
+func (s *Store) MarkEmailVerified(ctx context.Context, accountID uuid.UUID, email string, verifiedAt time.Time) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE account SET email_verified_at = ? WHERE id = ? AND email = ?`,
+		verifiedAt.UTC(), accountID, email)
+	if err != nil {
+		return fmt.Errorf("updating account.email_verified_at: %w", err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("account.email", err))
+	if err != nil {
+		return fmt.Errorf("updating account=%v: %w", accountID, err)
+	}
+	return nil
+}
+
+// SuspendAccount sets the suspension of the account, replacing the previous one if it was already suspended
+func (s *Store) SuspendAccount(ctx context.Context, accountID uuid.UUID, suspension bookstore.Suspension) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE account SET suspended_at = ?,suspended_until = ?,suspended_by = ?,suspend_reason = ? WHERE id = ?`,
+		utcPtr(suspension.SuspendedAt), utcPtr(suspension.SuspendedUntil), suspension.SuspendedBy, suspension.SuspendReason, accountID)
+	if err != nil {
+		return fmt.Errorf("updating account.suspended_at: %w", err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("account", err))
+	if err != nil {
+		return fmt.Errorf("updating account=%v: %w", accountID, err)
+	}
+	return nil
+}
+
+// ReinstateAccount lifts the suspension of the account
+func (s *Store) ReinstateAccount(ctx context.Context, accountID uuid.UUID) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE account SET suspended_at = NULL,suspended_until = NULL,suspended_by = NULL,suspend_reason = '' WHERE id = ?`,
+		accountID)
+	if err != nil {
+		return fmt.Errorf("updating account.suspended_at: %w", err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("account", err))
+	if err != nil {
+		return fmt.Errorf("updating account=%v: %w", accountID, err)
+	}
+	return nil
+}
+
+// AnonymizeAccount replaces the name, email and password hash of the account, marking it anonymized at AnonymizedAt
+// everything else tied to the account is deleted, but the account itself is kept, so references to it stay intact
+func (s *Store) AnonymizeAccount(ctx context.Context, account bookstore.Account) error {
+	if account.ID == uuid.Nil {
+		return bookstore.ErrMissingID
+	}
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("anonymizing account.id=%v: %w", account.ID, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE account SET name = ?,email = ?,password_hash = ?,email_verified_at = NULL,anonymized_at = ?,updated_at = ? WHERE id = ?`,
+		account.Name, account.Email, account.PasswordHash, utcPtr(account.AnonymizedAt), now(), account.ID)
+	if err != nil {
+		err = enrichSQLiteError(err, "account")
+		return fmt.Errorf("anonymizing account.id=%v: %w", account.ID, err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("account", err))
+	if err != nil {
+		return fmt.Errorf("anonymizing account=%v: %w", account.ID, err)
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM session WHERE impersonator_id = ?`, account.ID)
+	if err != nil {
+		return fmt.Errorf("anonymizing account.id=%v: deleting session: %w", account.ID, err)
+	}
+	for _, table := range []string{"session", "api_key", "password_reset", "email_verification", "account_totp",
+		"recovery_code", "login_challenge", "account_identity", "account_role"} {
+		_, err = tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE account_id = ?`, account.ID)
+		if err != nil {
+			return fmt.Errorf("anonymizing account.id=%v: deleting %s: %w", account.ID, table, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("anonymizing account.id=%v: %w", account.ID, err)
+	}
+	return nil
+}
+
+// DeleteAccount deletes the specified account using its ID
+func (s *Store) DeleteAccount(ctx context.Context, accountID uuid.UUID) error {
+	if accountID == uuid.Nil {
+		return fmt.Errorf("missing account id")
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM account WHERE id = ?`, accountID)
+	if err != nil {
+		err = enrichDeleteSQLiteError(err, "account")
+		return fmt.Errorf("deleting account.id=%v: %w", accountID, err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("account", err))
+	if err != nil {
+		return fmt.Errorf("deleting account=%v: %w", accountID, err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// CreateAuthor creates a author using provided model
+// note that ID, CreatedAt, UpdatedAt are all ignored
+// returns the created author when successful
+func (s *Store) CreateAuthor(ctx context.Context, author bookstore.Author) (bookstore.Author, error) {
+	var created bookstore.Author
+	ts := now()
+	err := s.db.GetContext(ctx, &created, `INSERT INTO author(id,name,created_at,updated_at) VALUES (?,?,?,?) RETURNING *`,
+		uuid.New(), author.Name, ts, ts)
+	if err != nil {
+		err = enrichSQLiteError(err, "author.name")
+		return bookstore.Author{}, fmt.Errorf("creating author.name=%s: %w", author.Name, err)
+	}
+	return created, nil
+}
+
+// GetAuthor fetches a author using its ID
+func (s *Store) GetAuthor(ctx context.Context, authorID uuid.UUID) (bookstore.Author, error) {
+	var author bookstore.Author
+	err := s.db.GetContext(ctx, &author, `SELECT * FROM author WHERE id = ? LIMIT 1`, authorID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = bookstore.NewNoResultError("author.id", err)
+		}
+		return bookstore.Author{}, fmt.Errorf("selecting author.id=%v: %w", authorID, err)
+	}
+	return author, nil
+}
+
+// ListAuthors returns a list of authors
+// to paginate, use the last Author.ID you received
+func (s *Store) ListAuthors(ctx context.Context, limit int, after uuid.UUID) ([]bookstore.Author, error) {
+	authors := make([]bookstore.Author, 0, limit)
+	var err error
+	if after != uuid.Nil {
+		//if after uuid is provided, we look up its created_at and only select authors created after it
+		var cursor time.Time
+		cursor, err = s.cursorTime(ctx, "author", "id", after, "author")
+		if err != nil {
+			return nil, fmt.Errorf("listing author with limit=%v after=%s: %w", limit, after, err)
+		}
+		err = s.db.SelectContext(ctx, &authors, `SELECT * FROM author WHERE created_at > ? ORDER BY created_at LIMIT ?`, cursor, limit)
+	} else {
+		err = s.db.SelectContext(ctx, &authors, `SELECT * FROM author ORDER BY created_at LIMIT ?`, limit)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("listing author with limit=%v after=%s: %w", limit, after, err)
+	}
+	return authors, nil
+}
+
+// UpdateAuthor updates the provided author using its ID
+// note that CreatedAt, UpdatedAt cannot be set
+func (s *Store) UpdateAuthor(ctx context.Context, author bookstore.Author) error {
+	if author.ID == uuid.Nil {
+		return fmt.Errorf("updating author: %w", bookstore.ErrMissingID)
+	}
+	res, err := s.db.ExecContext(ctx, `UPDATE author SET name = ?, updated_at = ? WHERE id = ?`, author.Name, now(), author.ID)
+	if err != nil {
+		err = enrichSQLiteError(err, "author.name")
+		return fmt.Errorf("updating author: %w", err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("author", err))
+	if err != nil {
+		return fmt.Errorf("updating author=%v: %w", author.ID, err)
+	}
+	return nil
+}
+
+// DeleteAuthor deletes the specified author using its ID
+func (s *Store) DeleteAuthor(ctx context.Context, authorID uuid.UUID) error {
+	if authorID == uuid.Nil {
+		return fmt.Errorf("missing author id")
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM author WHERE id = ?`, authorID)
+	if err != nil {
+		err = enrichDeleteSQLiteError(err, "author")
+		return fmt.Errorf("deleting author.id=%v: %w", authorID, err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("author", err))
+	if err != nil {
+		return fmt.Errorf("deleting author=%v: %w", authorID, err)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/nullism/bqb"
+	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/db/trgm"
+)
+
+// CreateBook creates a book using provided model
+// note that CreatedAt, UpdatedAt are ignored
+// returns the created book when successful
+func (s *Store) CreateBook(ctx context.Context, book bookstore.Book) (bookstore.Book, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return bookstore.Book{}, fmt.Errorf("creating book: %w", err)
+	}
+	defer tx.Rollback()
+
+	var created bookstore.Book
+	ts := now()
+	err = tx.GetContext(ctx, &created,
+		`INSERT INTO book(isbn,title,publish_year,fiction,author_id,genre_id,created_at,updated_at)
+				VALUES (?,?,?,?,?,?,?,?) RETURNING *`, book.ISBN, book.Title, book.PublishYear, book.Fiction, book.AuthorID, book.GenreID, ts, ts)
+	if err != nil {
+		err = enrichSQLiteError(err, "book.isbn")
+		return bookstore.Book{}, fmt.Errorf("creating book: %w", err)
+	}
+
+	err = storeTrigrams(ctx, tx, created.ISBN, created.Title)
+	if err != nil {
+		return bookstore.Book{}, fmt.Errorf("creating book: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return bookstore.Book{}, fmt.Errorf("creating book: %w", err)
+	}
+	return created, nil
+}
+
+// GetBook fetches a book using its ID
+func (s *Store) GetBook(ctx context.Context, bookID string) (bookstore.Book, error) {
+	var book bookstore.Book
+	err := s.db.GetContext(ctx, &book, `SELECT b.*, c.cover_file FROM book b LEFT JOIN cover_data c ON b.isbn = c.isbn WHERE b.isbn = ? LIMIT 1`, bookID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = bookstore.NewNoResultError("book.isbn", err)
+		}
+		return bookstore.Book{}, fmt.Errorf("selecting book.isbn=%v: %w", bookID, err)
+	}
+	return book, nil
+}
+
+// ListBooks returns a list of books
+// to paginate, use the last Book.ISBN you received
+// you can filter using a list of genre and author ids
+// it will return if a book matches one of the provided authors and genres
+// leaving it blank will omit filtering
+// searchTitle performs fuzzy searching on the title of the book, using the trigrams stored in book_trigram
+func (s *Store) ListBooks(ctx context.Context, limit int, after string, genresId []uuid.UUID, authorsId []uuid.UUID, searchTitle string) ([]bookstore.Book, error) {
+	books := make([]bookstore.Book, 0, limit)
+	var err error
+	//using bqb to build more complicated queries
+	//sel is on the beginning simply for readability
+	sel := bqb.New(`SELECT b.*, c.cover_file FROM book b LEFT JOIN cover_data c ON b.isbn = c.isbn`)
+
+	where := bqb.Optional(`WHERE`)
+	if after != "" {
+		//if after isbn is provided, we look up its created_at and only select books created after it
+		cursor, err := s.cursorTime(ctx, "book", "isbn", after, "book")
+		if err != nil {
+			return nil, fmt.Errorf("selecting book limit=%v after=%s genres=%v authors=%v: %w", limit, after, genresId, authorsId, err)
+		}
+		where.And(`b.created_at > ?`, cursor)
+	}
+	if len(genresId) > 0 {
+		where.And(`b.genre_id IN (?)`, genresId)
+	}
+	if len(authorsId) > 0 {
+		where.And(`b.author_id IN (?)`, authorsId)
+	}
+
+	//we set the order to allow overwriting it when searching
+	order := bqb.New(`ORDER BY b.created_at`)
+	if searchTitle != "" {
+		trigrams := trgm.Trigrams(searchTitle)
+		if len(trigrams) == 0 {
+			//nothing can be similar to a search without any trigrams
+			return books, nil
+		}
+		//similarity is the shared trigrams over all unique trigrams of both titles, same as pg_trgm
+		sel.Space(`INNER JOIN (SELECT isbn, CAST(SUM(trigram IN (?)) AS REAL) / (COUNT(*) + ? - SUM(trigram IN (?))) AS similarity
+			FROM book_trigram GROUP BY isbn) t ON t.isbn = b.isbn`, trigrams, len(trigrams), trigrams)
+		where.And(`t.similarity > ?`, trgm.Threshold)
+		order = bqb.New(`ORDER BY t.similarity DESC`)
+	}
+	q := bqb.New(`? ? ? LIMIT ?`, sel, where, order, limit)
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("bqb building query: %w", err)
+	}
+
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sqlx building query: %w", err)
+	}
+	err = s.db.SelectContext(ctx, &books, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("selecting book limit=%v after=%s genres=%v authors=%v: %w", limit, after, genresId, authorsId, err)
+	}
+	return books, nil
+}
+
+// UpdateBook updates the provided book using its ID
+// note that UpdatedAt cannot be set
+func (s *Store) UpdateBook(ctx context.Context, book bookstore.Book) error {
+	if book.ISBN == "" {
+		return bookstore.ErrMissingID
+	}
+
+	//we use query builder to create optional updates book dates
+	//the prefix joins them onto updated_at, which is always set
+	opt := bqb.Optional(",")
+	if !book.CreatedAt.IsZero() {
+		opt.Comma(`created_at = ?`, book.CreatedAt.UTC())
+	}
+	q := bqb.New(`UPDATE book SET title = ?, publish_year = ?, fiction = ?, author_id = ?, genre_id = ?, updated_at = ? ? WHERE isbn = ?`,
+		book.Title, book.PublishYear, book.Fiction, book.AuthorID, book.GenreID, now(), opt, book.ISBN)
+	query, args, err := q.ToSql()
+	if err != nil {
+		return fmt.Errorf("bqb building query: %w", err)
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error updating book: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		err = enrichSQLiteError(err, "book.isbn")
+		return fmt.Errorf("error updating book: %w", err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("book", err))
+	if err != nil {
+		return fmt.Errorf("updating book=%s: %w", book.ISBN, err)
+	}
+
+	//the title might have changed, so the trigrams are rebuilt
+	_, err = tx.ExecContext(ctx, `DELETE FROM book_trigram WHERE isbn = ?`, book.ISBN)
+	if err != nil {
+		return fmt.Errorf("updating book=%s: %w", book.ISBN, err)
+	}
+	err = storeTrigrams(ctx, tx, book.ISBN, book.Title)
+	if err != nil {
+		return fmt.Errorf("updating book=%s: %w", book.ISBN, err)
+	}
+	return tx.Commit()
+}
+
+// DeleteBook deletes the specified book using its ID
+func (s *Store) DeleteBook(ctx context.Context, bookID string) error {
+	if bookID == "" {
+		return fmt.Errorf("missing book id")
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM book WHERE isbn = ?`, bookID)
+	if err != nil {
+		return fmt.Errorf("deleting book=%v: %w", bookID, err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("book", err))
+	if err != nil {
+		return fmt.Errorf("deleting book=%v: %w", bookID, err)
+	}
+	return nil
+}
+
+// storeTrigrams indexes the title of a book into book_trigram for searching
+func storeTrigrams(ctx context.Context, tx *sqlx.Tx, isbn string, title string) error {
+	for _, trigram := range trgm.Trigrams(title) {
+		_, err := tx.ExecContext(ctx, `INSERT INTO book_trigram(isbn,trigram) VALUES (?,?)`, isbn, trigram)
+		if err != nil {
+			return fmt.Errorf("storing trigram: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/thunder33345/bookstore"
+)
+
+func (s *Store) UpsertCoverData(ctx context.Context, cover bookstore.CoverData) (bookstore.CoverData, error) {
+	query :=
+		`INSERT INTO cover_data(isbn,cover_file,created_at,updated_at) VALUES (?,?,?,?)
+            ON CONFLICT(isbn) DO UPDATE SET cover_file = excluded.cover_file, updated_at = excluded.updated_at
+        RETURNING *`
+	var created bookstore.CoverData
+	ts := now()
+	err := s.db.GetContext(ctx, &created, query, cover.ISBN, cover.CoverFile, ts, ts)
+	if err != nil {
+		err = enrichSQLiteError(err, "cover.isbn")
+		return bookstore.CoverData{}, fmt.Errorf("creating cover.isbn=%s: %w", cover.ISBN, err)
+	}
+	return created, nil
+}
+
+func (s *Store) GetCoverData(ctx context.Context, isbn string) (bookstore.CoverData, error) {
+	var cover bookstore.CoverData
+	err := s.db.GetContext(ctx, &cover, `SELECT * FROM cover_data WHERE isbn = ? LIMIT 1`, isbn)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = bookstore.NewNoResultError("cover.isbn", err)
+		}
+		return bookstore.CoverData{}, fmt.Errorf("selecting cover.isbn=%v: %w", isbn, err)
+	}
+	return cover, nil
+}
+
+func (s *Store) DeleteCoverData(ctx context.Context, isbn string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM cover_data WHERE isbn = ?`, isbn)
+	if err != nil {
+		return fmt.Errorf("deleting cover_data.isbn=%v: %w", isbn, err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// CreateGenre creates a genre using provided model
+// note that ID, CreatedAt, UpdatedAt are all ignored
+// returns the created genre when successful
+func (s *Store) CreateGenre(ctx context.Context, genre bookstore.Genre) (bookstore.Genre, error) {
+	var created bookstore.Genre
+	ts := now()
+	err := s.db.GetContext(ctx, &created, `INSERT INTO genre(id,name,created_at,updated_at) VALUES (?,?,?,?) RETURNING *`,
+		uuid.New(), genre.Name, ts, ts)
+	if err != nil {
+		err = enrichSQLiteError(err, "genre.name")
+		return bookstore.Genre{}, fmt.Errorf("creating genre.name=%s: %w", genre.Name, err)
+	}
+	return created, nil
+}
+
+// GetGenre fetches a genre using its ID
+func (s *Store) GetGenre(ctx context.Context, genreID uuid.UUID) (bookstore.Genre, error) {
+	var genre bookstore.Genre
+	err := s.db.GetContext(ctx, &genre, `SELECT * FROM genre WHERE id = ? LIMIT 1`, genreID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = bookstore.NewNoResultError("genre.id", err)
+		}
+		return bookstore.Genre{}, fmt.Errorf("selecting genre.id=%v: %w", genreID, err)
+	}
+	return genre, nil
+}
+
+// ListGenres returns a list of genres
+// to paginate, use the last Genre.ID you received
+func (s *Store) ListGenres(ctx context.Context, limit int, after uuid.UUID) ([]bookstore.Genre, error) {
+	genres := make([]bookstore.Genre, 0, limit)
+	var err error
+	if after != uuid.Nil {
+		//if after uuid is provided, we look up its created_at and only select genres created after it
+		var cursor time.Time
+		cursor, err = s.cursorTime(ctx, "genre", "id", after, "genre")
+		if err != nil {
+			return nil, fmt.Errorf("listing genre with limit=%v after=%s: %w", limit, after, err)
+		}
+		err = s.db.SelectContext(ctx, &genres, `SELECT * FROM genre WHERE created_at > ? ORDER BY created_at LIMIT ?`, cursor, limit)
+	} else {
+		err = s.db.SelectContext(ctx, &genres, `SELECT * FROM genre ORDER BY created_at LIMIT ?`, limit)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("listing genre with limit=%v after=%s: %w", limit, after, err)
+	}
+	return genres, nil
+}
+
+// UpdateGenre updates the provided genre using its ID
+// note that CreatedAt, UpdatedAt cannot be set
+func (s *Store) UpdateGenre(ctx context.Context, genre bookstore.Genre) error {
+	if genre.ID == uuid.Nil {
+		return fmt.Errorf("updating genre: %w", bookstore.ErrMissingID)
+	}
+	res, err := s.db.ExecContext(ctx, `UPDATE genre SET name = ?, updated_at = ? WHERE id = ?`, genre.Name, now(), genre.ID)
+	if err != nil {
+		err = enrichSQLiteError(err, "genre.name")
+		return fmt.Errorf("updating genre: %w", err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("genre", err))
+	if err != nil {
+		return fmt.Errorf("updating genre=%v: %w", genre.ID, err)
+	}
+	return nil
+}
+
+// DeleteGenre deletes the specified genre using its ID
+func (s *Store) DeleteGenre(ctx context.Context, genreID uuid.UUID) error {
+	if genreID == uuid.Nil {
+		return fmt.Errorf("missing genre id")
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM genre WHERE id = ?`, genreID)
+	if err != nil {
+		err = enrichDeleteSQLiteError(err, "genre")
+		return fmt.Errorf("deleting genre.id=%v: %w", genreID, err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("genre", err))
+	if err != nil {
+		return fmt.Errorf("deleting genre=%v: %w", genreID, err)
+	}
+	return nil
+}
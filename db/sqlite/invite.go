@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// StoreInvite stores the invite under the digest of its code
+func (s *Store) StoreInvite(ctx context.Context, codeHash string, invite bookstore.Invite) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO invite(id,code_hash,email,max_uses,uses,expires_at,created_by,created_at) VALUES (?,?,?,?,?,?,?,?)`,
+		invite.ID, codeHash, invite.Email, invite.MaxUses, invite.Uses, utcPtr(invite.ExpiresAt), invite.CreatedBy, invite.CreatedAt.UTC())
+	if err != nil {
+		err = enrichSQLiteError(err, "invite")
+		return fmt.Errorf("creating invite: %w", err)
+	}
+	return nil
+}
+
+// ListInvites lists every invite, oldest first
+func (s *Store) ListInvites(ctx context.Context) ([]bookstore.Invite, error) {
+	var list []bookstore.Invite
+	err := s.db.SelectContext(ctx, &list, `SELECT id, email, max_uses, uses, expires_at, created_by, created_at
+		FROM invite ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("listing invite: %w", err)
+	}
+	return list, nil
+}
+
+// DeleteInvite deletes an invite using its ID
+func (s *Store) DeleteInvite(ctx context.Context, inviteID uuid.UUID) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM invite WHERE id = ?`, inviteID)
+	if err != nil {
+		return fmt.Errorf("deleting invite.id=%v: %w", inviteID, err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("invite", err))
+	if err != nil {
+		return fmt.Errorf("deleting invite.id=%v: %w", inviteID, err)
+	}
+	return nil
+}
+
+// UseInvite counts a use of the invite, as long as it's still valid for the email
+// checking and counting happen in one statement, so concurrent sign ups can't use the invite more than it allows
+func (s *Store) UseInvite(ctx context.Context, codeHash string, email string, now time.Time) (bookstore.Invite, error) {
+	var invite bookstore.Invite
+	err := s.db.GetContext(ctx, &invite, `UPDATE invite SET uses = uses + 1
+		WHERE code_hash = ? AND (max_uses = 0 OR uses < max_uses) AND (expires_at IS NULL OR expires_at > ?)
+		AND (email = '' OR lower(email) = lower(?))
+		RETURNING id, email, max_uses, uses, expires_at, created_by, created_at`, codeHash, now.UTC(), email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = bookstore.ErrInvalidInvite
+		}
+		return bookstore.Invite{}, fmt.Errorf("updating invite.uses: %w", err)
+	}
+	return invite, nil
+}
+
+// ReleaseInvite gives back a use of the invite, for when signing up failed after using it
+func (s *Store) ReleaseInvite(ctx context.Context, inviteID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE invite SET uses = uses - 1 WHERE id = ? AND uses > 0`, inviteID)
+	if err != nil {
+		return fmt.Errorf("updating invite.uses: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS session;
+DROP TABLE IF EXISTS account;
+DROP TABLE IF EXISTS cover_data;
+DROP TABLE IF EXISTS book_trigram;
+DROP TABLE IF EXISTS book;
+DROP TABLE IF EXISTS genre;
+DROP TABLE IF EXISTS author;
@@ -0,0 +1,98 @@
+-- sqlite has no uuid or timestamp generation matching psql, so ids and timestamps are provided by the store
+CREATE TABLE author
+(
+    id         text      NOT NULL PRIMARY KEY,
+    name       text      NOT NULL UNIQUE CHECK (name <> ''),
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+-- Create index for author.created_at, as we will be using that for paging
+CREATE UNIQUE INDEX index_author ON author (created_at ASC);
+
+CREATE TABLE genre
+(
+    id         text      NOT NULL PRIMARY KEY,
+    name       text      NOT NULL UNIQUE CHECK (name <> ''),
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+CREATE UNIQUE INDEX index_genre ON genre (created_at ASC);
+
+CREATE TABLE book
+(
+    isbn         text PRIMARY KEY NOT NULL CHECK (isbn <> ''),
+    title        text             NOT NULL CHECK (title <> ''),
+    publish_year integer          NOT NULL CHECK (publish_year > 0),
+    fiction      boolean          NOT NULL,
+    author_id    text             NOT NULL,
+    genre_id     text             NOT NULL,
+    updated_at   timestamp        NOT NULL,
+    created_at   timestamp        NOT NULL,
+    CONSTRAINT fk_author FOREIGN KEY (author_id) REFERENCES author (id) ON DELETE RESTRICT,
+    CONSTRAINT fk_genre FOREIGN KEY (genre_id) REFERENCES genre (id) ON DELETE RESTRICT
+);
+CREATE UNIQUE INDEX index_book ON book (created_at ASC);
+
+-- sqlite does not report which foreign key failed
+-- these triggers raise the constraint name instead, so the store can tell them apart
+CREATE TRIGGER trigger_book_fk_insert
+    BEFORE INSERT
+    ON book
+BEGIN
+    SELECT RAISE(ABORT, 'fk_author') WHERE NOT EXISTS(SELECT 1 FROM author WHERE id = NEW.author_id);
+    SELECT RAISE(ABORT, 'fk_genre') WHERE NOT EXISTS(SELECT 1 FROM genre WHERE id = NEW.genre_id);
+END;
+
+CREATE TRIGGER trigger_book_fk_update
+    BEFORE UPDATE OF author_id, genre_id
+    ON book
+BEGIN
+    SELECT RAISE(ABORT, 'fk_author') WHERE NOT EXISTS(SELECT 1 FROM author WHERE id = NEW.author_id);
+    SELECT RAISE(ABORT, 'fk_genre') WHERE NOT EXISTS(SELECT 1 FROM genre WHERE id = NEW.genre_id);
+END;
+
+-- book_trigram replaces pg_trgm, it holds the trigrams of every book title for searching
+CREATE TABLE book_trigram
+(
+    isbn    text NOT NULL,
+    trigram text NOT NULL,
+    PRIMARY KEY (isbn, trigram),
+    CONSTRAINT fk_isbn FOREIGN KEY (isbn) REFERENCES book (isbn) ON DELETE CASCADE
+);
+CREATE INDEX index_book_trigram ON book_trigram (trigram);
+
+CREATE TABLE cover_data
+(
+    isbn       text PRIMARY KEY NOT NULL,
+    cover_file text CHECK (cover_file <> ''),
+    updated_at timestamp        NOT NULL,
+    created_at timestamp        NOT NULL,
+    CONSTRAINT fk_isbn FOREIGN KEY (isbn) REFERENCES book (isbn) ON DELETE CASCADE
+);
+
+CREATE TRIGGER trigger_cover_data_fk_insert
+    BEFORE INSERT
+    ON cover_data
+BEGIN
+    SELECT RAISE(ABORT, 'fk_isbn') WHERE NOT EXISTS(SELECT 1 FROM book WHERE isbn = NEW.isbn);
+END;
+
+CREATE TABLE account
+(
+    id            text        NOT NULL PRIMARY KEY,
+    name          text        NOT NULL CHECK (name <> ''),
+    email         text UNIQUE NOT NULL CHECK (email <> ''),
+    password_hash text        NOT NULL CHECK (password_hash <> ''),
+    is_admin      boolean     NOT NULL DEFAULT false,
+    created_at    timestamp   NOT NULL,
+    updated_at    timestamp   NOT NULL
+);
+CREATE UNIQUE INDEX index_account ON account (created_at ASC);
+
+CREATE TABLE session
+(
+    token      text      NOT NULL PRIMARY KEY,
+    account_id text      NOT NULL,
+    created_at timestamp NOT NULL,
+    CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE
+);
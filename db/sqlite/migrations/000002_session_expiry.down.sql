@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS index_session_last_seen_at;
+DROP INDEX IF EXISTS index_session_expires_at;
+
+ALTER TABLE session
+    DROP COLUMN expires_at;
+ALTER TABLE session
+    DROP COLUMN last_seen_at;
@@ -0,0 +1,13 @@
+-- sqlite can't add a column defaulting to the current time, so existing sessions are backfilled instead
+-- existing sessions never expire on their own
+ALTER TABLE session
+    ADD COLUMN last_seen_at timestamp;
+ALTER TABLE session
+    ADD COLUMN expires_at timestamp;
+
+UPDATE session
+SET last_seen_at = created_at;
+
+-- indexes for sweeping expired sessions
+CREATE INDEX index_session_expires_at ON session (expires_at);
+CREATE INDEX index_session_last_seen_at ON session (last_seen_at);
@@ -0,0 +1,5 @@
+-- the digests can't be turned back into tokens, so every session is invalidated
+DELETE FROM session;
+
+ALTER TABLE session
+    RENAME COLUMN token_hash TO token;
@@ -0,0 +1,6 @@
+-- only a digest of the token is kept
+-- sqlite has no sha256, so existing sessions are invalidated instead of converted
+DELETE FROM session;
+
+ALTER TABLE session
+    RENAME COLUMN token TO token_hash;
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS index_session_account_id;
+DROP INDEX IF EXISTS index_session_id;
+
+ALTER TABLE session
+    DROP COLUMN user_agent;
+ALTER TABLE session
+    DROP COLUMN ip;
+ALTER TABLE session
+    DROP COLUMN id;
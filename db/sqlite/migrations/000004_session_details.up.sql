@@ -0,0 +1,14 @@
+-- id is an opaque handle to the session, so it can be listed and revoked without exposing the token digest
+-- existing sessions get a random id, the undashed hex form still parses as an uuid
+ALTER TABLE session
+    ADD COLUMN id text;
+ALTER TABLE session
+    ADD COLUMN ip text NOT NULL DEFAULT '';
+ALTER TABLE session
+    ADD COLUMN user_agent text NOT NULL DEFAULT '';
+
+UPDATE session
+SET id = lower(hex(randomblob(16)));
+
+CREATE UNIQUE INDEX index_session_id ON session (id);
+CREATE INDEX index_session_account_id ON session (account_id);
@@ -0,0 +1,12 @@
+ALTER TABLE account
+    ADD COLUMN is_admin boolean NOT NULL DEFAULT false;
+
+-- only administrators map back to admins, every other role is lost
+UPDATE account
+SET is_admin = true
+WHERE id IN (SELECT account_id FROM account_role WHERE role = 'administrator');
+
+DROP TRIGGER IF EXISTS trigger_account_role_fk_insert;
+DROP TABLE IF EXISTS account_role;
+DROP TABLE IF EXISTS role_permission;
+DROP TABLE IF EXISTS role;
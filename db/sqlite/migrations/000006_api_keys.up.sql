@@ -0,0 +1,14 @@
+-- like sessions, only a digest of the key is kept
+CREATE TABLE api_key
+(
+    id           text      NOT NULL PRIMARY KEY,
+    key_hash     text      NOT NULL UNIQUE,
+    account_id   text      NOT NULL,
+    name         text      NOT NULL CHECK (name <> ''),
+    scope        text      NOT NULL DEFAULT '',
+    expires_at   timestamp,
+    last_used_at timestamp,
+    created_at   timestamp NOT NULL,
+    CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE
+);
+CREATE INDEX index_api_key_account_id ON api_key (account_id);
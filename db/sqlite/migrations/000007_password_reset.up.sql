@@ -0,0 +1,10 @@
+-- like sessions, only a digest of the token is kept
+CREATE TABLE password_reset
+(
+    token_hash text      NOT NULL PRIMARY KEY,
+    account_id text      NOT NULL,
+    expires_at timestamp NOT NULL,
+    created_at timestamp NOT NULL,
+    CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE
+);
+CREATE INDEX index_password_reset_account_id ON password_reset (account_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS email_verification;
+ALTER TABLE account
+    DROP COLUMN email_verified_at;
@@ -0,0 +1,20 @@
+-- failed login counters, keyed by what is being throttled e.g. the email or the IP
+CREATE TABLE login_throttle
+(
+    key             text      NOT NULL PRIMARY KEY,
+    failures        integer   NOT NULL,
+    last_failure_at timestamp NOT NULL,
+    blocked_until   timestamp
+);
+
+-- the email is kept as is, failed logins aren't necessarily for an existing account
+CREATE TABLE login_attempt
+(
+    id         text      NOT NULL PRIMARY KEY,
+    email      text      NOT NULL,
+    ip         text      NOT NULL DEFAULT '',
+    user_agent text      NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL
+);
+CREATE INDEX index_login_attempt_email ON login_attempt (email, created_at);
+CREATE INDEX index_login_attempt_created_at ON login_attempt (created_at);
@@ -0,0 +1,30 @@
+-- the secret has to be kept as is, as it's needed to generate the expected codes
+CREATE TABLE account_totp
+(
+    account_id text      NOT NULL PRIMARY KEY,
+    secret     text      NOT NULL CHECK (secret <> ''),
+    enabled_at timestamp,
+    last_step  integer   NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL,
+    CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE
+);
+
+-- like sessions, only a digest of the codes is kept
+CREATE TABLE recovery_code
+(
+    account_id text NOT NULL,
+    code_hash  text NOT NULL,
+    PRIMARY KEY (account_id, code_hash),
+    CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE
+);
+
+-- issued after the password is checked, exchanged for a session along with a two-factor code
+CREATE TABLE login_challenge
+(
+    token_hash text      NOT NULL PRIMARY KEY,
+    account_id text      NOT NULL,
+    expires_at timestamp NOT NULL,
+    created_at timestamp NOT NULL,
+    CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE
+);
+CREATE INDEX index_login_challenge_account_id ON login_challenge (account_id);
@@ -0,0 +1,22 @@
+-- the subject is the stable ID of the user at the provider, the email may change over time
+CREATE TABLE account_identity
+(
+    provider   text      NOT NULL CHECK (provider <> ''),
+    subject    text      NOT NULL CHECK (subject <> ''),
+    account_id text      NOT NULL,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY (provider, subject),
+    CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE
+);
+CREATE INDEX index_account_identity_account_id ON account_identity (account_id);
+
+-- pending logins, between redirecting to the provider and its callback
+CREATE TABLE oidc_state
+(
+    state_hash    text      NOT NULL PRIMARY KEY,
+    provider      text      NOT NULL,
+    nonce         text      NOT NULL,
+    code_verifier text      NOT NULL,
+    expires_at    timestamp NOT NULL,
+    created_at    timestamp NOT NULL
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS index_session_previous_token_hash;
+ALTER TABLE session
+    DROP COLUMN previous_token_hash;
@@ -0,0 +1,4 @@
+-- the token a session had before its latest refresh, so reusing it can be detected
+ALTER TABLE session
+    ADD COLUMN previous_token_hash text;
+CREATE UNIQUE INDEX index_session_previous_token_hash ON session (previous_token_hash);
@@ -0,0 +1,8 @@
+ALTER TABLE account
+    DROP COLUMN suspend_reason;
+ALTER TABLE account
+    DROP COLUMN suspended_by;
+ALTER TABLE account
+    DROP COLUMN suspended_until;
+ALTER TABLE account
+    DROP COLUMN suspended_at;
@@ -0,0 +1,9 @@
+-- suspended accounts are kept around, unlike deleting them
+ALTER TABLE account
+    ADD COLUMN suspended_at timestamp;
+ALTER TABLE account
+    ADD COLUMN suspended_until timestamp;
+ALTER TABLE account
+    ADD COLUMN suspended_by text REFERENCES account (id) ON DELETE SET NULL;
+ALTER TABLE account
+    ADD COLUMN suspend_reason text NOT NULL DEFAULT '';
@@ -0,0 +1,13 @@
+-- invites allow signing up while registration is invite-only
+CREATE TABLE invite
+(
+    id         text      NOT NULL PRIMARY KEY,
+    code_hash  text      NOT NULL UNIQUE,
+    email      text      NOT NULL DEFAULT '',
+    max_uses   integer   NOT NULL DEFAULT 1 CHECK (max_uses >= 0),
+    uses       integer   NOT NULL DEFAULT 0 CHECK (uses >= 0),
+    expires_at timestamp,
+    created_by text,
+    created_at timestamp NOT NULL,
+    CONSTRAINT fk_created_by FOREIGN KEY (created_by) REFERENCES account (id) ON DELETE SET NULL
+);
@@ -0,0 +1,12 @@
+ALTER TABLE session
+    ADD COLUMN previous_token_hash text;
+CREATE UNIQUE INDEX index_session_previous_token_hash ON session (previous_token_hash);
+
+UPDATE session
+SET previous_token_hash = (SELECT token_hash
+                           FROM session_rotated_token
+                           WHERE session_id = session.id
+                           ORDER BY rotated_at DESC
+                           LIMIT 1);
+
+DROP TABLE session_rotated_token;
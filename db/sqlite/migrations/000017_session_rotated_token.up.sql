@@ -0,0 +1,18 @@
+-- every token a session was refreshed away from, so reusing any of them revokes the session, not only the latest
+CREATE TABLE session_rotated_token
+(
+    token_hash text      NOT NULL PRIMARY KEY,
+    session_id text      NOT NULL,
+    rotated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_session FOREIGN KEY (session_id) REFERENCES session (id) ON DELETE CASCADE
+);
+CREATE INDEX index_session_rotated_token_session_id ON session_rotated_token (session_id);
+
+INSERT INTO session_rotated_token(token_hash, session_id)
+SELECT previous_token_hash, id
+FROM session
+WHERE previous_token_hash IS NOT NULL;
+
+DROP INDEX index_session_previous_token_hash;
+ALTER TABLE session
+    DROP COLUMN previous_token_hash;
@@ -0,0 +1,99 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// rolePermissionRow is a role joined with one of its permissions
+// permission is null if the role has none
+type rolePermissionRow struct {
+	Name        string
+	Description string
+	Permission  sql.NullString
+}
+
+// ListRoles returns every role along with their permissions
+func (s *Store) ListRoles(ctx context.Context) ([]bookstore.Role, error) {
+	var rows []rolePermissionRow
+	err := s.db.SelectContext(ctx, &rows, `SELECT r.name, r.description, p.permission
+		FROM role r
+		LEFT JOIN role_permission p ON p.role = r.name
+		ORDER BY r.name, p.permission`)
+	if err != nil {
+		return nil, fmt.Errorf("listing roles: %w", err)
+	}
+	return groupRoles(rows), nil
+}
+
+// ListAccountRoles returns the roles assigned to the account along with their permissions
+func (s *Store) ListAccountRoles(ctx context.Context, accountID uuid.UUID) ([]bookstore.Role, error) {
+	var rows []rolePermissionRow
+	err := s.db.SelectContext(ctx, &rows, `SELECT r.name, r.description, p.permission
+		FROM account_role a
+		INNER JOIN role r ON r.name = a.role
+		LEFT JOIN role_permission p ON p.role = r.name
+		WHERE a.account_id = ?
+		ORDER BY r.name, p.permission`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("listing account_role.account_id=%v: %w", accountID, err)
+	}
+	return groupRoles(rows), nil
+}
+
+// GetAccountPermissions returns every permission granted by the roles of the account
+func (s *Store) GetAccountPermissions(ctx context.Context, accountID uuid.UUID) ([]bookstore.Permission, error) {
+	var perms []bookstore.Permission
+	err := s.db.SelectContext(ctx, &perms, `SELECT DISTINCT p.permission
+		FROM account_role a
+		INNER JOIN role_permission p ON p.role = a.role
+		WHERE a.account_id = ?
+		ORDER BY p.permission`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("selecting permissions of account.id=%v: %w", accountID, err)
+	}
+	return perms, nil
+}
+
+// AddAccountRole assigns the role to the account
+// assigning a role the account already has does nothing
+func (s *Store) AddAccountRole(ctx context.Context, accountID uuid.UUID, role string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO account_role(account_id,role) VALUES (?,?) ON CONFLICT DO NOTHING`, accountID, role)
+	if err != nil {
+		err = enrichSQLiteError(err, "account_role")
+		return fmt.Errorf("assigning role=%s to account.id=%v: %w", role, accountID, err)
+	}
+	return nil
+}
+
+// RemoveAccountRole removes the role from the account
+func (s *Store) RemoveAccountRole(ctx context.Context, accountID uuid.UUID, role string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM account_role WHERE account_id = ? AND role = ?`, accountID, role)
+	if err != nil {
+		return fmt.Errorf("removing role=%s from account.id=%v: %w", role, accountID, err)
+	}
+	err = checkAffectedRows(res, bookstore.NewNoResultError("account_role", err))
+	if err != nil {
+		return fmt.Errorf("removing role=%s from account.id=%v: %w", role, accountID, err)
+	}
+	return nil
+}
+
+// groupRoles folds rows sorted by role name into roles
+func groupRoles(rows []rolePermissionRow) []bookstore.Role {
+	roles := make([]bookstore.Role, 0, len(rows))
+	for _, row := range rows {
+		if len(roles) == 0 || roles[len(roles)-1].Name != row.Name {
+			roles = append(roles, bookstore.Role{Name: row.Name, Description: row.Description, Permissions: []bookstore.Permission{}})
+		}
+		if row.Permission.Valid {
+			last := &roles[len(roles)-1]
+			last.Permissions = append(last.Permissions, bookstore.Permission(row.Permission.String))
+		}
+	}
+	return roles
+}
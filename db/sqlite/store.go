@@ -0,0 +1,186 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	sqlitedriver "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/thunder33345/bookstore"
+)
+
+type Store struct {
+	db *sqlx.DB
+	//sqlDb is the standard sql.DB instance, used for migration
+	sqlDb *sql.DB
+}
+
+// New creates a new store instance
+// it expects a go-sqlite3 DSN, usually the path to the database file
+// see more at https://github.com/mattn/go-sqlite3#connection-string
+// foreign keys are always enabled, as the store relies on them
+func New(dsn string) (*Store, error) {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	dsn += sep + "_foreign_keys=on&_busy_timeout=5000"
+
+	sqlDb, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	//sqlite only allows a single writer, sharing one connection avoids running into locked database errors
+	//this also keeps :memory: databases from being split across connections
+	sqlDb.SetMaxOpenConns(1)
+
+	//we wrap the sql.db in sqlx, this is what we will normally use
+	db := sqlx.NewDb(sqlDb, "sqlite3")
+
+	return &Store{
+		sqlDb: sqlDb,
+		db:    db,
+	}, nil
+}
+
+// Init initializes store by testing for connectivity and perform migrations
+func (s *Store) Init() error {
+	err := s.db.Ping()
+	if err != nil {
+		return fmt.Errorf("error pinging: %w", err)
+	}
+	err = s.migrate()
+	if err != nil {
+		return fmt.Errorf("error migrating: %w", err)
+	}
+	return nil
+}
+
+// migrationFS stores the sql migrations files via embed
+//
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// migrate attempts to run migrations on the database to sync the database state with application state
+func (s *Store) migrate() error {
+	sqlDriver, err := sqlitedriver.WithInstance(s.sqlDb, &sqlitedriver.Config{})
+	if err != nil {
+		return fmt.Errorf("error creating sqlite driver: %w", err)
+	}
+
+	srcDriver, err := iofs.New(migrationFS, "migrations")
+	if err != nil {
+		return fmt.Errorf("error creating fs driver: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", srcDriver, "sqlite3", sqlDriver)
+	if err != nil {
+		return fmt.Errorf("error creating migration: %w", err)
+	}
+
+	err = m.Up()
+	if err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("error running migration: %w", err)
+	}
+	return nil
+}
+
+// now returns the timestamp used for created_at and updated_at
+// it is always in UTC, so the stored text sorts the same way as the time it represents
+// any other timestamp given to sqlite should be converted to UTC for the same reason
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// utcPtr converts an optional timestamp to UTC, for the same reason as now
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// cursorTime looks up the created_at of the row used as the "after" cursor when paging
+// psql raises an error mid-query for a missing row, sqlite can't so we check it upfront instead
+// table and column are never user provided
+func (s *Store) cursorTime(ctx context.Context, table, column string, id any, resource string) (time.Time, error) {
+	var createdAt time.Time
+	err := s.db.GetContext(ctx, &createdAt, fmt.Sprintf(`SELECT created_at FROM %s WHERE %s = ? LIMIT 1`, table, column), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = bookstore.NewNonExistentIDError(resource, err)
+		}
+		return time.Time{}, err
+	}
+	return createdAt, nil
+}
+
+// enrichSQLiteError attempts to adds error type to a sqlite error
+func enrichSQLiteError(err error, resource string) error {
+	var sqErr sqlite3.Error
+	if !errors.As(err, &sqErr) {
+		//pass through: leave the error untouched if it's not a sqlite error
+		return err
+	}
+
+	switch sqErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		err = bookstore.NewDuplicateError(resource, err)
+	case sqlite3.ErrConstraintTrigger:
+		switch sqErr.Error() { //our triggers raise the name of the foreign key that failed
+		case "fk_author":
+			err = bookstore.NewInvalidDependencyError("author", err)
+		case "fk_genre":
+			err = bookstore.NewInvalidDependencyError("genre", err)
+		case "fk_isbn":
+			err = bookstore.NewNoResultError("book.isbn", err)
+		case "fk_account":
+			err = bookstore.NewNoResultError("account.id", err)
+		case "fk_role":
+			err = bookstore.NewNoResultError("role", err)
+		}
+	}
+	return err
+}
+
+func enrichDeleteSQLiteError(err error, resource string) error {
+	var sqErr sqlite3.Error
+	if !errors.As(err, &sqErr) {
+		//pass through: leave the error untouched if it's not a sqlite error
+		return err
+	}
+
+	switch sqErr.ExtendedCode {
+	//foreign key errors while deleting means something is being depended on
+	//note that sqlite reports ON DELETE RESTRICT failures as a trigger constraint
+	case sqlite3.ErrConstraintForeignKey, sqlite3.ErrConstraintTrigger:
+		err = bookstore.NewDependedError(resource, err)
+	}
+	return err
+}
+
+// checkAffectedRows is a helper function to simplify checking for affected row
+// caller provides the result and noResErr to return, if the affected row is <=0
+func checkAffectedRows(res sql.Result, noResErr error) error {
+	//we try to check affected row
+	rows, err := res.RowsAffected()
+	if err != nil {
+		//this shouldn't happen, but we account for it anyway
+		return fmt.Errorf("error getting affected rows: %w", err)
+	}
+	if rows <= 0 {
+		//if the affected rows is <=0 we return the supplied error
+		return noResErr
+	}
+	//we return nil if everything is ok
+	return nil
+}
@@ -0,0 +1,218 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// newTestStore opens and migrates a fresh database file, which is closed along with the test
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := New(filepath.Join(t.TempDir(), "bookstore.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.sqlDb.Close() })
+	if err = s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// createBooks creates a book for each title under the same author and genre, in the order given
+// the ISBN of each book is its index, so they can be told apart
+func createBooks(t *testing.T, s *Store, titles ...string) []bookstore.Book {
+	t.Helper()
+	ctx := context.Background()
+	author, err := s.CreateAuthor(ctx, bookstore.Author{Name: "Writer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	genre, err := s.CreateGenre(ctx, bookstore.Genre{Name: "Fantasy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	books := make([]bookstore.Book, 0, len(titles))
+	for i, title := range titles {
+		book, err := s.CreateBook(ctx, bookstore.Book{ISBN: string(rune('a' + i)), Title: title, PublishYear: 2000,
+			AuthorID: author.ID, GenreID: genre.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		books = append(books, book)
+	}
+	return books
+}
+
+// titles returns the title of each book
+func titles(books []bookstore.Book) []string {
+	out := make([]string, 0, len(books))
+	for _, b := range books {
+		out = append(out, b.Title)
+	}
+	return out
+}
+
+func TestMigrate(t *testing.T) {
+	s := newTestStore(t)
+	ups, err := fs.Glob(migrationFS, "migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var version int
+	var dirty bool
+	if err = s.db.QueryRow(`SELECT version, dirty FROM schema_migrations`).Scan(&version, &dirty); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(ups) || dirty {
+		t.Errorf("got version %d, dirty %v, want every one of the %d migrations applied", version, dirty, len(ups))
+	}
+	//migrating an up to date database does nothing
+	if err = s.Init(); err != nil {
+		t.Errorf("migrating again: %v", err)
+	}
+	//the default roles are seeded by the migrations
+	roles, err := s.ListRoles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) == 0 || roles[0].Name != bookstore.RoleAdministrator || len(roles[0].Permissions) == 0 {
+		t.Errorf("got roles %+v, want the administrator role with its permissions first", roles)
+	}
+}
+
+func TestSearchTitle(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	books := createBooks(t, s, "The Hobbit", "The Lord of the Rings", "Dune", "Children of Dune")
+
+	found, err := s.ListBooks(ctx, 10, "", nil, nil, "hobit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(titles(found), ","); got != "The Hobbit" {
+		t.Errorf("searching for a misspelt title: got %q, want The Hobbit", got)
+	}
+	//the closest title comes first, not the first one created
+	found, err = s.ListBooks(ctx, 10, "", nil, nil, "Dune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(titles(found), ","); got != "Dune,Children of Dune" {
+		t.Errorf("searching for Dune: got %q, want Dune,Children of Dune", got)
+	}
+	for _, search := range []string{"xyzzy", "!!"} {
+		if found, err = s.ListBooks(ctx, 10, "", nil, nil, search); err != nil || len(found) != 0 {
+			t.Errorf("searching for %q: got %v with error %v, want nothing", search, titles(found), err)
+		}
+	}
+
+	//renaming a book reindexes its title
+	books[0].Title = "Silmarillion"
+	if err = s.UpdateBook(ctx, books[0]); err != nil {
+		t.Fatal(err)
+	}
+	if found, err = s.ListBooks(ctx, 10, "", nil, nil, "hobbit"); err != nil || len(found) != 0 {
+		t.Errorf("searching for the old title: got %v with error %v, want nothing", titles(found), err)
+	}
+	if found, err = s.ListBooks(ctx, 10, "", nil, nil, "silmarilion"); err != nil || len(found) != 1 {
+		t.Errorf("searching for the new title: got %v with error %v, want the renamed book", titles(found), err)
+	}
+}
+
+func TestConstraintErrors(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	book := createBooks(t, s, "The Hobbit")[0]
+
+	var duplicate *bookstore.DuplicateError
+	if _, err := s.CreateAuthor(ctx, bookstore.Author{Name: "Writer"}); !errors.As(err, &duplicate) {
+		t.Errorf("creating an author with a taken name: got %v, want a duplicate error", err)
+	}
+	if _, err := s.CreateBook(ctx, book); !errors.As(err, &duplicate) {
+		t.Errorf("creating a book with a taken ISBN: got %v, want a duplicate error", err)
+	}
+
+	var invalid *bookstore.InvalidDependencyError
+	missing := book
+	missing.ISBN, missing.AuthorID = "z", uuid.New()
+	if _, err := s.CreateBook(ctx, missing); !errors.As(err, &invalid) || !strings.Contains(err.Error(), "author") {
+		t.Errorf("creating a book by an unknown author: got %v, want an invalid author error", err)
+	}
+	missing = book
+	missing.GenreID = uuid.New()
+	if err := s.UpdateBook(ctx, missing); !errors.As(err, &invalid) || !strings.Contains(err.Error(), "genre") {
+		t.Errorf("moving a book into an unknown genre: got %v, want an invalid genre error", err)
+	}
+
+	var depended *bookstore.DependedError
+	if err := s.DeleteAuthor(ctx, book.AuthorID); !errors.As(err, &depended) {
+		t.Errorf("deleting an author with books: got %v, want a depended error", err)
+	}
+	var noResult *bookstore.NoResultError
+	if _, err := s.UpsertCoverData(ctx, bookstore.CoverData{ISBN: "z", CoverFile: "z.png"}); !errors.As(err, &noResult) {
+		t.Errorf("storing the cover of an unknown book: got %v, want a no result error", err)
+	}
+
+	//deleting the book frees the author up
+	if err := s.DeleteBook(ctx, book.ISBN); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteAuthor(ctx, book.AuthorID); err != nil {
+		t.Errorf("deleting an author without books: %v", err)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	names := []string{"A", "B", "C", "D", "E"}
+	for _, name := range names {
+		if _, err := s.CreateAuthor(ctx, bookstore.Author{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//pages follow the order the authors were created in, picking up after the last one received
+	var got []string
+	after := uuid.Nil
+	for {
+		page, err := s.ListAuthors(ctx, 2, after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, a := range page {
+			got = append(got, a.Name)
+		}
+		after = page[len(page)-1].ID
+	}
+	if strings.Join(got, ",") != strings.Join(names, ",") {
+		t.Errorf("got authors %v, want %v", got, names)
+	}
+	var nonExistent *bookstore.NonExistentIDError
+	if _, err := s.ListAuthors(ctx, 2, uuid.New()); !errors.As(err, &nonExistent) {
+		t.Errorf("paging after an unknown author: got %v, want a non-existent id error", err)
+	}
+
+	books := createBooks(t, s, "First", "Second", "Third")
+	page, err := s.ListBooks(ctx, 1, books[0].ISBN, nil, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(titles(page), ","); got != "Second" {
+		t.Errorf("got books %q after the first, want Second", got)
+	}
+	if page, err = s.ListBooks(ctx, 10, books[2].ISBN, nil, nil, ""); err != nil || len(page) != 0 {
+		t.Errorf("got books %v with error %v after the last, want none", titles(page), err)
+	}
+}
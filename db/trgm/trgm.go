@@ -0,0 +1,56 @@
+// Package trgm is a small reimplementation of postgres' pg_trgm similarity
+// it is used by the stores which can't rely on the extension to search book titles
+package trgm
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Threshold is the minimum similarity for a title to be considered a match
+// this mirrors the cutoff psql.Store.ListBooks uses
+const Threshold = 0.1
+
+// Trigrams returns the unique trigrams of s following pg_trgm's rules
+// words are lowercased, split on non-alphanumerics, then padded with two spaces in front and one behind
+func Trigrams(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]struct{})
+	var trigrams []string
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			t := string(padded[i : i+3])
+			if _, ok := seen[t]; ok {
+				continue
+			}
+			seen[t] = struct{}{}
+			trigrams = append(trigrams, t)
+		}
+	}
+	return trigrams
+}
+
+// Similarity returns how similar both strings are, from 0 to 1
+// this is the number of shared trigrams divided by the number of unique trigrams of both strings
+func Similarity(a, b string) float64 {
+	ta, tb := Trigrams(a), Trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	set := make(map[string]struct{}, len(ta))
+	for _, t := range ta {
+		set[t] = struct{}{}
+	}
+	shared := 0
+	for _, t := range tb {
+		if _, ok := set[t]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
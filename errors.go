@@ -3,6 +3,7 @@ package bookstore
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 var ErrMissingID = errors.New("missing id")
@@ -109,6 +110,43 @@ func (e *NonExistentIDError) Unwrap() error {
 
 var ErrInvalidFileType = errors.New("invalid file type provided")
 
+// ImageRejectReason names why an uploaded image was rejected, it's sent to clients as is
+type ImageRejectReason string
+
+const (
+	// ImageUnsupportedFormat is used when the image isn't in an accepted format, or there's no decoder for it
+	ImageUnsupportedFormat ImageRejectReason = "unsupported_format"
+	// ImageCorrupt is used when the image fails to decode, e.g. it's truncated
+	ImageCorrupt ImageRejectReason = "corrupt"
+	// ImageTooSmall is used when the image is smaller than the minimum size
+	ImageTooSmall ImageRejectReason = "too_small"
+	// ImageTooLarge is used when the image is larger than the maximum size
+	ImageTooLarge ImageRejectReason = "too_large"
+	// ImageAspectRatio is used when the image is too wide or too tall
+	ImageAspectRatio ImageRejectReason = "aspect_ratio"
+)
+
+// InvalidImageError is returned when an uploaded image is rejected, it matches ErrInvalidFileType with errors.Is
+type InvalidImageError struct {
+	Reason ImageRejectReason
+	detail string
+}
+
+func NewInvalidImageError(reason ImageRejectReason, detail string) error {
+	return &InvalidImageError{
+		Reason: reason,
+		detail: detail,
+	}
+}
+
+func (e *InvalidImageError) Error() string {
+	return fmt.Sprintf("invalid image(%s): %s", e.Reason, e.detail)
+}
+
+func (e *InvalidImageError) Unwrap() error {
+	return ErrInvalidFileType
+}
+
 // Errors related to session
 
 // ErrMissingSession is used when session token is required but not provided
@@ -123,3 +161,90 @@ var ErrInvalidSession = errors.New("invalid session token provided")
 // ErrMissingSessionData is used when handlers fail to extract session data from context
 // this is considered an internal error, as auth enforcing middlewares shouldn't let it through in the first place
 var ErrMissingSessionData = errors.New("failed to retrieve session data")
+
+// ErrExpiredAccessToken is used when the access token has expired, it should be refreshed using the refresh token
+var ErrExpiredAccessToken = errors.New("expired access token provided")
+
+// ErrRefreshTokenReused is used when a refresh token is used again after it was rotated, which revokes its session
+var ErrRefreshTokenReused = errors.New("refresh token was already used, session revoked")
+
+// ErrAccessTokenRequired is used when a session token is sent as bearer while access tokens are enabled
+// session tokens are refresh tokens then, which are only exchanged on refresh
+var ErrAccessTokenRequired = errors.New("access token required, session tokens are only used to refresh")
+
+// ErrAccessTokensDisabled is used when creating access tokens without any signing key
+var ErrAccessTokensDisabled = errors.New("access tokens are not enabled")
+
+// ErrInvalidCSRFToken is used when a request authenticated with the session cookie is missing the CSRF token, or it doesn't match
+var ErrInvalidCSRFToken = errors.New("missing or invalid CSRF token")
+
+// ErrInvalidAPIKey is used when the API key is unknown or expired
+var ErrInvalidAPIKey = errors.New("invalid api key provided")
+
+// ErrInvalidInvite is used when the invite code is unknown, expired, used up or meant for another email
+var ErrInvalidInvite = errors.New("invalid invite code provided")
+
+// ErrInvalidResetToken is used when the password reset token is unknown, already used or expired
+var ErrInvalidResetToken = errors.New("invalid password reset token provided")
+
+// ErrInvalidVerificationToken is used when the email verification token is unknown, already used or expired
+var ErrInvalidVerificationToken = errors.New("invalid email verification token provided")
+
+// LoginThrottledError is returned when logging in is blocked due to too many failed attempts
+type LoginThrottledError struct {
+	until time.Time
+}
+
+func NewLoginThrottledError(until time.Time) error {
+	return &LoginThrottledError{
+		until: until,
+	}
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, blocked until %s", e.until.Format(time.RFC3339))
+}
+
+// RetryAfter is how long until logging in is allowed again
+func (e *LoginThrottledError) RetryAfter() time.Duration {
+	return time.Until(e.until)
+}
+
+// AccountSuspendedError is returned when a suspended account tries to log in or use its sessions
+type AccountSuspendedError struct {
+	suspension Suspension
+}
+
+func NewAccountSuspendedError(suspension Suspension) error {
+	return &AccountSuspendedError{
+		suspension: suspension,
+	}
+}
+
+func (e *AccountSuspendedError) Error() string {
+	until := "until reinstated"
+	if e.suspension.SuspendedUntil != nil {
+		until = "until " + e.suspension.SuspendedUntil.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("account is suspended %s: %s", until, e.suspension.SuspendReason)
+}
+
+// Errors related to two-factor authentication
+
+// ErrInvalidTwoFactorCode is used when the one-time or recovery code is wrong or was already used
+var ErrInvalidTwoFactorCode = errors.New("invalid two-factor code provided")
+
+// ErrTwoFactorNotEnrolled is used when confirming two-factor authentication without enrolling first
+var ErrTwoFactorNotEnrolled = errors.New("two-factor authentication is not enrolled")
+
+// ErrTwoFactorAlreadyEnabled is used when enrolling while two-factor authentication is already enabled
+var ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+// ErrInvalidLoginChallenge is used when the login challenge is unknown or expired
+var ErrInvalidLoginChallenge = errors.New("invalid login challenge provided")
+
+// ErrInvalidOIDCState is used when the state of an OpenID Connect callback is unknown or expired
+var ErrInvalidOIDCState = errors.New("invalid OpenID Connect state provided")
+
+// ErrOIDCLinkRefused is used when an OpenID Connect login matches the email of an account that can't be linked to automatically
+var ErrOIDCLinkRefused = errors.New("account can't be linked to the identity provider automatically")
@@ -11,17 +11,20 @@ require (
 	github.com/jmoiron/sqlx v1.3.5
 	github.com/joho/godotenv v1.5.1
 	github.com/lib/pq v1.10.2
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/moraes/isbn v0.0.0-20151007102746-e6388fb1bfd5
 	github.com/nullism/bqb v1.3.1
 	github.com/puzpuzpuz/xsync v1.5.2
+	github.com/thanhpk/randstr v1.0.6
+	github.com/wagslane/go-password-validator v0.3.0
 	golang.org/x/crypto v0.9.0
+	golang.org/x/image v0.18.0
 )
 
 require (
 	github.com/ajg/form v1.5.1 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
-	github.com/thanhpk/randstr v1.0.6 // indirect
-	github.com/wagslane/go-password-validator v0.3.0 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
+	golang.org/x/sys v0.8.0 // indirect
 )
@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -21,7 +22,6 @@ func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	account := *data.Account
-	account.Admin = false
 
 	if data.PasswordHash == "" {
 		_ = render.Render(w, r, ErrInvalidRequest(fmt.Errorf("no password provided")))
@@ -33,6 +33,15 @@ func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.registration == RegistrationClosed {
+		_ = render.Render(w, r, ErrRegistrationClosed)
+		return
+	}
+	if !h.emailDomainAllowed(account.Email) {
+		_ = render.Render(w, r, ErrEmailDomainNotAllowed)
+		return
+	}
+
 	var err error
 	//we hash the password first, since incoming request contains the plain password
 	account.PasswordHash, err = h.auth.Hash(account.PasswordHash)
@@ -40,19 +49,46 @@ func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 		_ = render.Render(w, r, ErrInvalidRequest(err))
 	}
 
+	//the invite is used up first, so concurrent signups can't go past its max uses
+	var invite *bookstore.Invite
+	if h.registration == RegistrationInviteOnly {
+		if data.Invite == "" {
+			_ = render.Render(w, r, ErrInvalidInvite)
+			return
+		}
+		used, err := h.auth.UseInvite(r.Context(), data.Invite, account.Email)
+		if errors.Is(err, bookstore.ErrInvalidInvite) {
+			_ = render.Render(w, r, ErrInvalidInvite)
+			return
+		}
+		if err != nil {
+			_ = render.Render(w, r, ErrQueryResponse(err))
+			return
+		}
+		invite = &used
+	}
+
 	created, err := h.store.CreateAccount(r.Context(), account)
 
 	if err != nil {
+		//the account wasn't created(e.g. the email is taken), so the use is given back
+		if invite != nil {
+			if err := h.auth.ReleaseInvite(r.Context(), invite.ID); err != nil {
+				h.onErr(fmt.Errorf("releasing invite %s: %w", invite.ID, err))
+			}
+		}
 		_ = render.Render(w, r, ErrQueryResponse(err))
 		return
 	}
-	tok, err := h.auth.CreateSession(r.Context(), created)
+	go h.sendEmailVerification(created)
+
+	tok, ses, err := h.auth.CreateSession(r.Context(), created, clientIP(r), r.UserAgent())
 	if err != nil {
 		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
 	}
 
-	render.Status(r, http.StatusOK)
-	_ = render.Render(w, r, NewSessionCreateResponse(tok, created))
+	h.renderSessionCreated(w, r, tok, ses, false)
 }
 
 // GetAccount returns account info for current session
@@ -65,7 +101,16 @@ func (h *Handler) GetAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := render.Render(w, r, NewUserAccountResponse(ses.Account)); err != nil {
+	//access tokens only carry part of the account, so it's looked up instead
+	acc, err := h.store.GetAccount(r.Context(), ses.ID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	resp := NewUserAccountResponse(acc, ses.Permissions)
+	resp.ImpersonatedBy = ses.Meta.ImpersonatorID
+	if err := render.Render(w, r, resp); err != nil {
 		_ = render.Render(w, r, ErrRender(err))
 		return
 	}
@@ -89,11 +134,25 @@ func (h *Handler) UpdateAccount(w http.ResponseWriter, r *http.Request) {
 	//we disallow updating password directly
 	account.PasswordHash = ""
 
+	//the email is used to log in and reset the password, so it's guarded like the password
+	if account.Email != ses.Email && ses.Impersonated() {
+		_ = render.Render(w, r, ErrImpersonationForbidden)
+		return
+	}
+	if account.Email != ses.Email && !h.emailDomainAllowed(account.Email) {
+		_ = render.Render(w, r, ErrEmailDomainNotAllowed)
+		return
+	}
+
 	err := h.store.SafeUpdateAccount(r.Context(), account)
 	if err != nil {
 		_ = render.Render(w, r, ErrQueryResponse(err))
 		return
 	}
+	//the store resets the verification of a changed email, so the new address needs to be confirmed
+	if account.Email != ses.Email {
+		go h.sendEmailVerification(account)
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -158,14 +217,33 @@ func (h *Handler) UpdateAccountPassword(w http.ResponseWriter, r *http.Request)
 
 // CreateAccountSession creates a session token using login credentials
 // yes this is basically the endpoint for logging in
+// failed attempts are throttled per email and per IP, see auth.Auth.LoginFailed
+// accounts with two-factor authentication get a login challenge instead, see Handler.CreateAccountTwoFactorSession
 func (h *Handler) CreateAccountSession(w http.ResponseWriter, r *http.Request) {
 	data := &SessionCreateRequest{}
 	if err := render.Bind(r, data); err != nil {
 		_ = render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	if data.Cookie && h.sessionCookie == nil {
+		_ = render.Render(w, r, ErrSessionCookieUnavailable)
+		return
+	}
+	//blocked attempts are rejected before looking at the password, so they can't be used to keep guessing
+	if err := h.auth.CheckLogin(r.Context(), data.Email, clientIP(r)); err != nil {
+		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
 	acc, err := h.store.GetAccountByEmail(r.Context(), data.Email)
 	if err != nil {
+		var noResErr *bookstore.NoResultError
+		if errors.As(err, &noResErr) {
+			//unknown emails count as failures too, otherwise they could be probed for free
+			if err := h.auth.LoginFailed(r.Context(), data.Email, clientIP(r), r.UserAgent()); err != nil {
+				_ = render.Render(w, r, ErrSessionResponse(err))
+				return
+			}
+		}
 		_ = render.Render(w, r, ErrQueryResponse(err))
 		return
 	}
@@ -175,23 +253,118 @@ func (h *Handler) CreateAccountSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !valid {
+		if err := h.auth.LoginFailed(r.Context(), data.Email, clientIP(r), r.UserAgent()); err != nil {
+			_ = render.Render(w, r, ErrSessionResponse(err))
+			return
+		}
 		_ = render.Render(w, r, ErrInvalidRequest(fmt.Errorf("invalid credentials")))
 		return
 	}
+	//this is only revealed to someone who knows the password
+	if acc.Suspended(time.Now()) {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.NewAccountSuspendedError(acc.Suspension)))
+		return
+	}
+	if h.auth.NeedsRehash(acc.PasswordHash) {
+		//this is the only time we know the password, failing to upgrade the hash shouldn't stop the login
+		if err := h.rehashPassword(r.Context(), acc, data.Password); err != nil {
+			h.onErr(fmt.Errorf("rehashing password of account=%v: %w", acc.ID, err))
+		}
+	}
+
+	twoFactor, _, err := h.auth.TwoFactorStatus(r.Context(), acc.ID)
+	if err != nil {
+		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
+	if twoFactor {
+		//the failed logins are kept until the code checks out, otherwise knowing the password would allow guessing codes forever
+		//the cookie is asked for again when exchanging the challenge
+		challenge, expiresAt, err := h.auth.CreateLoginChallenge(r.Context(), acc)
+		if err != nil {
+			_ = render.Render(w, r, ErrSessionResponse(err))
+			return
+		}
+		render.Status(r, http.StatusAccepted)
+		_ = render.Render(w, r, NewTwoFactorChallengeResponse(challenge, expiresAt))
+		return
+	}
+
+	if err := h.auth.LoginSucceeded(r.Context(), data.Email); err != nil {
+		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
 
-	tok, err := h.auth.CreateSession(r.Context(), acc)
+	tok, ses, err := h.auth.CreateSession(r.Context(), acc, clientIP(r), r.UserAgent())
 	if err != nil {
 		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
 	}
 
+	h.renderSessionCreated(w, r, tok, ses, data.Cookie)
+}
+
+// renderSessionCreated responds with a newly created or refreshed session
+// when asked to, the token is set as a cookie instead of being in the body, which holds the CSRF token instead
+// otherwise an access token is included when they are enabled, the token is the refresh token for it
+func (h *Handler) renderSessionCreated(w http.ResponseWriter, r *http.Request, token string, ses bookstore.Session, cookie bool) {
+	resp := NewSessionCreateResponse(token, ses.Account)
+	switch {
+	case cookie && h.sessionCookie != nil:
+		csrf := csrfToken(token)
+		http.SetCookie(w, h.sessionCookie.cookie(h.sessionCookie.name, token, true))
+		http.SetCookie(w, h.sessionCookie.cookie(h.sessionCookie.csrfName(), csrf, false))
+		resp.Token = ""
+		resp.CSRFToken = csrf
+	case h.auth.AccessTokensEnabled():
+		perms, err := h.sessionPermissions(r.Context(), ses)
+		if err != nil {
+			_ = render.Render(w, r, ErrQueryResponse(err))
+			return
+		}
+		accessToken, expiresAt, err := h.auth.CreateAccessToken(ses, perms)
+		if err != nil {
+			_ = render.Render(w, r, ErrSessionResponse(err))
+			return
+		}
+		resp.AccessToken = accessToken
+		resp.AccessTokenExpiresAt = &expiresAt
+	}
 	render.Status(r, http.StatusOK)
-	_ = render.Render(w, r, NewSessionCreateResponse(tok, acc))
+	_ = render.Render(w, r, resp)
+}
+
+// RefreshAccountSession exchanges the refresh token for a new one along with a new access token
+// the refresh token can only be used once, using it again revokes the session
+func (h *Handler) RefreshAccountSession(w http.ResponseWriter, r *http.Request) {
+	data := &SessionRefreshRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	tok, ses, err := h.auth.RefreshSession(r.Context(), data.RefreshToken)
+	if err != nil {
+		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
+	h.renderSessionCreated(w, r, tok, ses, false)
+}
+
+// rehashPassword hashes the password again using the current hasher and saves it
+func (h *Handler) rehashPassword(ctx context.Context, acc bookstore.Account, password string) error {
+	hash, err := h.auth.Hash(password)
+	if err != nil {
+		return err
+	}
+	acc.PasswordHash = hash
+	return h.store.UpdateAccount(ctx, acc)
 }
 
 // DeleteAccountSession removes current active session token(aka log out)
 // using parameter all=true will log out all active session for current user
+// the session cookie is cleared as well, when it's enabled
 func (h *Handler) DeleteAccountSession(w http.ResponseWriter, r *http.Request) {
-	ses, tok, ok := GetSessionAndToken(r.Context())
+	ses, ok := GetSession(r.Context())
 	if !ok {
 		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrMissingSessionData))
 		return
@@ -207,13 +380,62 @@ func (h *Handler) DeleteAccountSession(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if all {
+	tok, hasToken := GetSessionToken(r.Context())
+	switch {
+	case all:
 		err = h.auth.DeleteSessionFor(r.Context(), ses.ID)
-	} else {
+	case hasToken:
 		err = h.auth.DeleteSession(r.Context(), tok)
+	default:
+		//access tokens refer to their session by ID instead, the token itself stays valid until it expires
+		err = h.auth.RevokeSession(r.Context(), ses.ID, ses.Meta.ID)
+		var noResErr *bookstore.NoResultError
+		if errors.As(err, &noResErr) {
+			//the session is already gone, which is what logging out is after anyway
+			err = nil
+		}
 	}
 	if err != nil {
 		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
+	h.clearSessionCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListAccountSessions lists active sessions of the current account
+func (h *Handler) ListAccountSessions(w http.ResponseWriter, r *http.Request) {
+	ses, ok := GetSession(r.Context())
+	if !ok {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrMissingSessionData))
+		return
+	}
+
+	sessions, err := h.auth.ListSessions(r.Context(), ses.ID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, NewListSessionResponse(sessions, ses.Meta.ID)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// RevokeAccountSession removes a single session of the current account using the session ID
+func (h *Handler) RevokeAccountSession(w http.ResponseWriter, r *http.Request) {
+	ses, ok := GetSession(r.Context())
+	if !ok {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrMissingSessionData))
+		return
+	}
+	sessionID := r.Context().Value(ctxSessionIDKey).(uuid.UUID)
+
+	err := h.auth.RevokeSession(r.Context(), ses.ID, sessionID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -222,7 +444,6 @@ type UserAccountRequest struct {
 	*bookstore.Account
 
 	ProtectedID        uuid.UUID `json:"id"`
-	ProtectedAdmin     bool      `json:"admin"`
 	ProtectedCreatedAt time.Time `json:"created_at"`
 	ProtectedUpdatedAt time.Time `json:"updated_at"`
 }
@@ -235,16 +456,24 @@ func (a *UserAccountRequest) Bind(_ *http.Request) error {
 	a.ProtectedID = uuid.Nil
 	a.ProtectedCreatedAt = time.Time{}
 	a.ProtectedUpdatedAt = time.Time{}
+	a.Suspension = bookstore.Suspension{}
 	return nil
 }
 
 type UserAccountResponse struct {
 	*bookstore.Account
 	ProtectedHash string `json:"password,omitempty"`
+	//Permissions lets clients know which actions are available to the account
+	Permissions []bookstore.Permission `json:"permissions"`
+	//ImpersonatedBy is the admin acting as the account, so clients can make it obvious, omitted unless impersonating
+	ImpersonatedBy *uuid.UUID `json:"impersonated_by,omitempty"`
 }
 
-func NewUserAccountResponse(account bookstore.Account) *UserAccountResponse {
-	resp := &UserAccountResponse{Account: &account}
+func NewUserAccountResponse(account bookstore.Account, permissions []bookstore.Permission) *UserAccountResponse {
+	if permissions == nil {
+		permissions = []bookstore.Permission{}
+	}
+	resp := &UserAccountResponse{Account: &account, Permissions: permissions}
 	return resp
 }
 
@@ -256,6 +485,8 @@ func (ur *UserAccountResponse) Render(_ http.ResponseWriter, _ *http.Request) er
 type SessionCreateRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	//Cookie sets the token as a cookie instead of returning it, see WithSessionCookie
+	Cookie bool `json:"cookie"`
 }
 
 func (a *SessionCreateRequest) Bind(_ *http.Request) error {
@@ -263,8 +494,13 @@ func (a *SessionCreateRequest) Bind(_ *http.Request) error {
 }
 
 type SessionCreateResponse struct {
-	Token   string            `json:"token"`
+	Token   string            `json:"token,omitempty"`
 	Account bookstore.Account `json:"account"`
+	//AccessToken is included when access tokens are enabled, Token is used to refresh it
+	AccessToken          string     `json:"access_token,omitempty"`
+	AccessTokenExpiresAt *time.Time `json:"access_token_expires_at,omitempty"`
+	//CSRFToken is sent in place of the token when it's set as a cookie, it needs to be sent back in the X-CSRF-Token header
+	CSRFToken string `json:"csrf_token,omitempty"`
 }
 
 func NewSessionCreateResponse(token string, account bookstore.Account) *SessionCreateResponse {
@@ -277,6 +513,42 @@ func (sc *SessionCreateResponse) Render(_ http.ResponseWriter, _ *http.Request)
 	return nil
 }
 
+type SessionRefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (s *SessionRefreshRequest) Bind(_ *http.Request) error {
+	if s.RefreshToken == "" {
+		return errors.New("no refresh token provided")
+	}
+	return nil
+}
+
+type SessionResponse struct {
+	*bookstore.SessionMeta
+	//Current marks the session used to make the request
+	Current bool `json:"current"`
+}
+
+func NewSessionResponse(meta bookstore.SessionMeta, current bool) *SessionResponse {
+	resp := &SessionResponse{SessionMeta: &meta, Current: current}
+	return resp
+}
+
+func (sr *SessionResponse) Render(_ http.ResponseWriter, _ *http.Request) error {
+	return nil
+}
+
+// NewListSessionResponse creates a list of sessions, marking the one matching currentID as the current session
+// uuid.Nil can be used when none of them are
+func NewListSessionResponse(sessions []bookstore.SessionMeta, currentID uuid.UUID) []render.Renderer {
+	list := make([]render.Renderer, 0, len(sessions))
+	for _, meta := range sessions {
+		list = append(list, NewSessionResponse(meta, currentID != uuid.Nil && meta.ID == currentID))
+	}
+	return list
+}
+
 type PasswordUpdateRequest struct {
 	OldPassword string `json:"old_password"`
 	NewPassword string `json:"new_password"`
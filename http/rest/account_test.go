@@ -0,0 +1,156 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thunder33345/bookstore/auth"
+	"github.com/thunder33345/bookstore/http/rest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSignupAndLogin(t *testing.T) {
+	s := newTestServer(t, testConfig{})
+	signup := s.signup("reader@example.com")
+	if signup.Token == "" {
+		t.Fatal("signing up didn't return a token")
+	}
+
+	var account struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	s.expect(http.StatusOK, &account, http.MethodGet, "/account", signup.Token, nil)
+	if account.Email != "reader@example.com" || account.Password != "" {
+		t.Errorf("got account %+v, want the email without the password hash", account)
+	}
+
+	//the email is taken now
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, "/account", "",
+		map[string]string{"name": "Other", "email": "reader@example.com", "password": testPassword})
+	//passwords are checked for entropy
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, "/account", "",
+		map[string]string{"name": "Weak", "email": "weak@example.com", "password": "password"})
+
+	login := s.login(http.StatusOK, "reader@example.com", testPassword)
+	if login.Token == "" || login.Token == signup.Token {
+		t.Fatalf("logging in returned token %q, want a new one", login.Token)
+	}
+	s.login(http.StatusBadRequest, "reader@example.com", "wrong-password")
+	s.login(http.StatusNotFound, "nobody@example.com", testPassword)
+
+	//logging out revokes only the session used
+	s.expect(http.StatusNoContent, nil, http.MethodDelete, "/account/sessions", login.Token, nil)
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/account", login.Token, nil)
+	s.expect(http.StatusOK, nil, http.MethodGet, "/account", signup.Token, nil)
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/account", "", nil)
+}
+
+func TestLoginRehash(t *testing.T) {
+	argon2id := auth.Argon2id{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	s := newTestServer(t, testConfig{auth: []auth.Option{auth.WithHasher(argon2id)}})
+	user := s.signup("reader@example.com")
+	ctx := context.Background()
+
+	//an account from before argon2id, still holding a bcrypt hash
+	legacy, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, err := s.db.GetAccount(ctx, user.Account.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc.PasswordHash = string(legacy)
+	if err = s.db.UpdateAccount(ctx, acc); err != nil {
+		t.Fatal(err)
+	}
+
+	//failing to log in leaves the hash alone
+	s.login(http.StatusBadRequest, "reader@example.com", "wrong-"+testPassword)
+	if acc, err = s.db.GetAccount(ctx, user.Account.ID); err != nil || acc.PasswordHash != string(legacy) {
+		t.Fatalf("got hash %q with error %v after a failed login, want it unchanged", acc.PasswordHash, err)
+	}
+	s.login(http.StatusOK, "reader@example.com", testPassword)
+	if acc, err = s.db.GetAccount(ctx, user.Account.ID); err != nil || !argon2id.Identify(acc.PasswordHash) || argon2id.Outdated(acc.PasswordHash) {
+		t.Fatalf("got hash %q with error %v after logging in, want it rehashed with argon2id", acc.PasswordHash, err)
+	}
+	s.login(http.StatusOK, "reader@example.com", testPassword)
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestServer(t, testConfig{auth: []auth.Option{auth.WithLoginBackoff(0, 0), auth.WithLockout(3, time.Hour)}})
+	admin := s.admin("admin@example.com")
+	user := s.signup("reader@example.com")
+
+	for i := 0; i < 3; i++ {
+		s.login(http.StatusBadRequest, "reader@example.com", "wrong-password")
+	}
+	//the right password doesn't help once locked out
+	resp := s.request(http.MethodPost, "/account/sessions", "", map[string]string{"email": "reader@example.com", "password": testPassword})
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+	}
+	if retry := resp.Header.Get("Retry-After"); retry == "" || retry == "0" {
+		t.Errorf("got Retry-After %q, want the seconds until the lockout ends", retry)
+	}
+	//emails are locked out, not the accounts using them
+	s.login(http.StatusOK, "admin@example.com", testPassword)
+
+	var attempts []struct {
+		Email string `json:"email"`
+	}
+	s.expect(http.StatusOK, &attempts, http.MethodGet, userPath(user.Account.ID, "/login-attempts"), admin.Token, nil)
+	if len(attempts) != 3 {
+		t.Errorf("got %d login attempts, want 3", len(attempts))
+	}
+	s.expect(http.StatusForbidden, nil, http.MethodPost, userPath(user.Account.ID, "/unlock"), user.Token, nil)
+	s.expect(http.StatusNoContent, nil, http.MethodPost, userPath(user.Account.ID, "/unlock"), admin.Token, nil)
+	s.login(http.StatusOK, "reader@example.com", testPassword)
+}
+
+func TestRefreshRotation(t *testing.T) {
+	key := auth.SigningKey{ID: "test", Secret: []byte(strings.Repeat("k", 32))}
+	s := newTestServer(t, testConfig{auth: []auth.Option{auth.WithAccessTokens(time.Minute, key)}})
+	s.signup("reader@example.com")
+	login := s.login(http.StatusOK, "reader@example.com", testPassword)
+	if login.AccessToken == "" {
+		t.Fatal("logging in didn't return an access token")
+	}
+	s.expect(http.StatusOK, nil, http.MethodGet, "/account", login.AccessToken, nil)
+
+	var refreshed testSession
+	s.expect(http.StatusOK, &refreshed, http.MethodPost, "/account/sessions/refresh", "",
+		map[string]string{"refresh_token": login.Token})
+	if refreshed.Token == "" || refreshed.Token == login.Token || refreshed.AccessToken == "" {
+		t.Fatalf("refreshing returned %+v, want a new refresh and access token", refreshed)
+	}
+	s.expect(http.StatusOK, nil, http.MethodGet, "/account", refreshed.AccessToken, nil)
+	//the refresh token is only good for refreshing
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/account", refreshed.Token, nil)
+
+	var latest testSession
+	s.expect(http.StatusOK, &latest, http.MethodPost, "/account/sessions/refresh", "",
+		map[string]string{"refresh_token": refreshed.Token})
+
+	//replaying any earlier refresh token revokes the session, including the token it was rotated to
+	var reused rest.ErrResponse
+	s.expect(http.StatusUnauthorized, &reused, http.MethodPost, "/account/sessions/refresh", "",
+		map[string]string{"refresh_token": login.Token})
+	if !strings.Contains(reused.MessageText, "revoked") {
+		t.Errorf("replaying got %q, want the session to be revoked", reused.MessageText)
+	}
+	s.expect(http.StatusUnauthorized, nil, http.MethodPost, "/account/sessions/refresh", "",
+		map[string]string{"refresh_token": latest.Token})
+	s.expect(http.StatusUnauthorized, nil, http.MethodPost, "/account/sessions/refresh", "",
+		map[string]string{"refresh_token": refreshed.Token})
+
+	//access tokens are only checked by their signature
+	parts := strings.Split(refreshed.AccessToken, ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"someone-else"}`))
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/account", strings.Join(parts, "."), nil)
+}
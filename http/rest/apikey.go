@@ -0,0 +1,151 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// CreateAccountAPIKey creates an api key for the current account
+// the plaintext key is only included in this response
+func (h *Handler) CreateAccountAPIKey(w http.ResponseWriter, r *http.Request) {
+	ses, ok := GetSession(r.Context())
+	if !ok {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrMissingSessionData))
+		return
+	}
+
+	data := &APIKeyCreateRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	//keys can't be scoped beyond the account, they would be useless anyway
+	for _, perm := range data.Scope {
+		if !ses.HasPermission(perm) {
+			_ = render.Render(w, r, ErrInvalidRequest(fmt.Errorf("account does not have permission %s", perm)))
+			return
+		}
+	}
+
+	plain, key, err := h.auth.CreateAPIKey(r.Context(), ses.Account, data.Name, data.Scope, data.ExpiresAt)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	_ = render.Render(w, r, NewAPIKeyCreateResponse(plain, key))
+}
+
+// ListAccountAPIKeys lists api keys of the current account
+func (h *Handler) ListAccountAPIKeys(w http.ResponseWriter, r *http.Request) {
+	ses, ok := GetSession(r.Context())
+	if !ok {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrMissingSessionData))
+		return
+	}
+
+	keys, err := h.auth.ListAPIKeys(r.Context(), ses.ID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, NewListAPIKeyResponse(keys)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// RevokeAccountAPIKey removes an api key of the current account
+func (h *Handler) RevokeAccountAPIKey(w http.ResponseWriter, r *http.Request) {
+	ses, ok := GetSession(r.Context())
+	if !ok {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrMissingSessionData))
+		return
+	}
+	keyID := r.Context().Value(ctxAPIKeyIDKey).(uuid.UUID)
+
+	err := h.auth.RevokeAPIKey(r.Context(), ses.ID, keyID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type APIKeyCreateRequest struct {
+	Name      string          `json:"name"`
+	Scope     bookstore.Scope `json:"scope"`
+	ExpiresAt *time.Time      `json:"expires_at"`
+}
+
+func (a *APIKeyCreateRequest) Bind(_ *http.Request) error {
+	if a.Name == "" {
+		return errors.New("missing required name")
+	}
+	for _, perm := range a.Scope {
+		if !knownPermission(perm) {
+			return fmt.Errorf("unknown permission %s in scope", perm)
+		}
+	}
+	if a.Scope == nil {
+		a.Scope = bookstore.Scope{}
+	}
+	if a.ExpiresAt != nil && !a.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	return nil
+}
+
+type APIKeyCreateResponse struct {
+	//Key is the plaintext key, it can't be retrieved again
+	Key    string           `json:"key"`
+	APIKey bookstore.APIKey `json:"api_key"`
+}
+
+func NewAPIKeyCreateResponse(key string, apiKey bookstore.APIKey) *APIKeyCreateResponse {
+	resp := &APIKeyCreateResponse{Key: key, APIKey: apiKey}
+	return resp
+}
+
+func (ac *APIKeyCreateResponse) Render(_ http.ResponseWriter, _ *http.Request) error {
+	return nil
+}
+
+type APIKeyResponse struct {
+	*bookstore.APIKey
+}
+
+func NewAPIKeyResponse(key bookstore.APIKey) *APIKeyResponse {
+	resp := &APIKeyResponse{APIKey: &key}
+	return resp
+}
+
+func (ar *APIKeyResponse) Render(_ http.ResponseWriter, _ *http.Request) error {
+	return nil
+}
+
+func NewListAPIKeyResponse(keys []bookstore.APIKey) []render.Renderer {
+	list := make([]render.Renderer, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, NewAPIKeyResponse(key))
+	}
+	return list
+}
+
+// knownPermission checks if the permission is one of bookstore.KnownPermissions
+func knownPermission(perm bookstore.Permission) bool {
+	for _, known := range bookstore.KnownPermissions {
+		if perm == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package rest_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thunder33345/bookstore"
+)
+
+// createAPIKey creates an api key of the session limited to the scope, returning the plaintext key
+func (s *testServer) createAPIKey(token string, scope ...bookstore.Permission) string {
+	s.t.Helper()
+	var created struct {
+		Key string `json:"key"`
+	}
+	s.expect(http.StatusOK, &created, http.MethodPost, "/account/apikeys", token, map[string]any{"name": "key", "scope": scope})
+	return created.Key
+}
+
+func TestAPIKeyScope(t *testing.T) {
+	s := newTestServer(t, testConfig{})
+	admin := s.admin("admin@example.com")
+	user := s.signup("reader@example.com")
+
+	key := s.createAPIKey(admin.Token, bookstore.PermissionCatalogWrite)
+	if !strings.HasPrefix(key, "bsk_") {
+		t.Errorf("got key %q, want it prefixed with bsk_", key)
+	}
+	var keys []struct {
+		Key   string          `json:"key"`
+		Name  string          `json:"name"`
+		Scope bookstore.Scope `json:"scope"`
+	}
+	s.expect(http.StatusOK, &keys, http.MethodGet, "/account/apikeys", admin.Token, nil)
+	if len(keys) != 1 || keys[0].Key != "" || len(keys[0].Scope) != 1 {
+		t.Errorf("got keys %+v, want the key listed with its scope but without the plaintext", keys)
+	}
+
+	//the key only gets what's in its scope, even though the admin holds every permission
+	auth := []string{"Authorization", "ApiKey " + key}
+	s.expect(http.StatusOK, nil, http.MethodPost, "/genres", "", map[string]string{"name": "Fantasy"}, auth...)
+	s.expect(http.StatusForbidden, nil, http.MethodGet, "/users", "", nil, auth...)
+	s.expect(http.StatusForbidden, nil, http.MethodDelete, "/books/"+testISBN+"/cover", "", nil, auth...)
+	//the account itself is only managed with a session
+	s.expect(http.StatusForbidden, nil, http.MethodGet, "/account", "", nil, auth...)
+	s.expect(http.StatusForbidden, nil, http.MethodPost, "/account/apikeys", "", map[string]string{"name": "another"}, auth...)
+	//keys look nothing like session tokens, so they aren't accepted as one
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/genres", key, nil)
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/genres", "", nil, "Authorization", "ApiKey bsk_unknown")
+
+	//keys can't be scoped beyond the account, an empty scope only reads the catalog
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, "/account/apikeys", user.Token,
+		map[string]any{"name": "key", "scope": []bookstore.Permission{bookstore.PermissionCatalogWrite}})
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, "/account/apikeys", user.Token,
+		map[string]any{"name": "key", "scope": []string{"everything"}})
+	readOnly := []string{"Authorization", "ApiKey " + s.createAPIKey(user.Token)}
+	s.expect(http.StatusOK, nil, http.MethodGet, "/genres", "", nil, readOnly...)
+	s.expect(http.StatusForbidden, nil, http.MethodPost, "/genres", "", map[string]string{"name": "Horror"}, readOnly...)
+
+	//permissions the account loses are lost by its keys as well
+	if err := s.db.RemoveAccountRole(context.Background(), admin.Account.ID, bookstore.RoleAdministrator); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(http.StatusForbidden, nil, http.MethodPost, "/genres", "", map[string]string{"name": "Horror"}, auth...)
+}
+
+func TestAPIKeyExpiryAndRevoking(t *testing.T) {
+	s := newTestServer(t, testConfig{})
+	user := s.signup("reader@example.com")
+
+	past := time.Now().Add(-time.Minute)
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, "/account/apikeys", user.Token, map[string]any{"name": "key", "expires_at": past})
+	//the API refuses to create expired keys, so it's stored directly
+	expired, _, err := s.auth.CreateAPIKey(context.Background(), user.Account, "expired", bookstore.Scope{}, &past)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/genres", "", nil, "Authorization", "ApiKey "+expired)
+
+	var created struct {
+		Key    string `json:"key"`
+		APIKey struct {
+			ID string `json:"id"`
+		} `json:"api_key"`
+	}
+	s.expect(http.StatusOK, &created, http.MethodPost, "/account/apikeys", user.Token, map[string]string{"name": "key"})
+	s.expect(http.StatusOK, nil, http.MethodGet, "/genres", "", nil, "Authorization", "ApiKey "+created.Key)
+	s.expect(http.StatusNoContent, nil, http.MethodDelete, "/account/apikeys/"+created.APIKey.ID, user.Token, nil)
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/genres", "", nil, "Authorization", "ApiKey "+created.Key)
+}
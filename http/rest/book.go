@@ -149,7 +149,9 @@ func (b *BookRequest) Bind(_ *http.Request) error {
 
 type BookResponse struct {
 	*bookstore.Book
-	cover coverStore
+	//CoverVariantURLs are the URLs of the cover scaled down to each size, by the name of the size
+	CoverVariantURLs map[string]string `json:"cover_variant_urls,omitempty"`
+	cover            coverStore
 }
 
 func NewBookResponse(book bookstore.Book, cover coverStore) *BookResponse {
@@ -163,6 +165,10 @@ func (b *BookResponse) Render(_ http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 	b.Book.CoverURL = url
+	b.CoverVariantURLs, err = b.cover.ResolveCoverVariantURLs(r.Context(), *b.Book)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -0,0 +1,97 @@
+package rest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// csrfHeader is where cookie authenticated requests echo the CSRF cookie back
+const csrfHeader = "X-CSRF-Token"
+
+// sessionCookie is how session tokens are handed to browsers, see WithSessionCookie
+type sessionCookie struct {
+	name     string
+	maxAge   time.Duration
+	secure   bool
+	sameSite http.SameSite
+}
+
+// csrfName is the name of the cookie holding the CSRF token
+// unlike the session cookie, it's readable by the frontend so it can be sent back in the header
+func (c sessionCookie) csrfName() string {
+	return c.name + "_csrf"
+}
+
+// cookie creates a cookie with the configured attributes, an empty value removes it
+func (c sessionCookie) cookie(name string, value string, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: httpOnly,
+		Secure:   c.secure,
+		SameSite: c.sameSite,
+	}
+	switch {
+	case value == "":
+		cookie.MaxAge = -1
+	case c.maxAge > 0:
+		cookie.MaxAge = int(c.maxAge.Seconds())
+	}
+	return cookie
+}
+
+// clearSessionCookie removes the session and CSRF cookies from the browser
+func (h *Handler) clearSessionCookie(w http.ResponseWriter) {
+	if h.sessionCookie == nil {
+		return
+	}
+	http.SetCookie(w, h.sessionCookie.cookie(h.sessionCookie.name, "", true))
+	http.SetCookie(w, h.sessionCookie.cookie(h.sessionCookie.csrfName(), "", false))
+}
+
+// cookieSessionToken returns the session token from the cookie, if session cookies are enabled
+func (h *Handler) cookieSessionToken(r *http.Request) string {
+	if h.sessionCookie == nil {
+		return ""
+	}
+	cookie, err := r.Cookie(h.sessionCookie.name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// validCSRF checks the header matches the CSRF cookie(double-submit), and that the cookie belongs to the session
+// other sites can send requests with our cookies, but they can neither read them nor set the header
+func (h *Handler) validCSRF(r *http.Request, token string) bool {
+	header := r.Header.Get(csrfHeader)
+	cookie, err := r.Cookie(h.sessionCookie.csrfName())
+	if header == "" || err != nil {
+		return false
+	}
+	//the cookie is tied to the session, so a planted cookie(e.g. from a sibling subdomain) doesn't pass either
+	expected := csrfToken(token)
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(expected)) == 1
+}
+
+// csrfToken derives the CSRF token of a session, so it doesn't need to be stored
+func csrfToken(token string) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte("csrf"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// safeMethod reports whether the method only reads, which don't need CSRF protection
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
@@ -1,33 +1,56 @@
 package rest
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/render"
+	"github.com/thunder33345/bookstore"
 )
 
+// coverUploadOverhead is how much larger than the cover file the multipart body of the upload can be
+const coverUploadOverhead = 64 << 10
+
 func (h *Handler) UpdateBookCover(w http.ResponseWriter, r *http.Request) {
 	id := r.Context().Value(ctxISBNKey).(string)
 
-	//limit max file size to 10MB
+	if h.maxCoverUpload > 0 {
+		//the rest of the multipart body comes along with the file, which is checked exactly once parsed
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxCoverUpload+coverUploadOverhead)
+	}
+	//files above 10MB are buffered to disk instead of memory while parsing
 	err := r.ParseMultipartForm(10 << 20)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		_ = render.Render(w, r, ErrCoverTooLarge(h.maxCoverUpload))
+		return
+	}
 	if err != nil {
 		_ = render.Render(w, r, ErrInvalidRequestBody(err))
 		return
 	}
-	file, _, err := r.FormFile("image")
+	file, header, err := r.FormFile("image")
 	if err != nil {
 		_ = render.Render(w, r, ErrProcessingFile(err))
 		return
 	}
 	defer file.Close()
+	if h.maxCoverUpload > 0 && header.Size > h.maxCoverUpload {
+		_ = render.Render(w, r, ErrCoverTooLarge(h.maxCoverUpload))
+		return
+	}
 
 	err = h.cover.StoreCover(r.Context(), id, file)
+	var imgErr *bookstore.InvalidImageError
+	if errors.As(err, &imgErr) {
+		_ = render.Render(w, r, ErrInvalidImage(imgErr))
+		return
+	}
 	if err != nil {
 		_ = render.Render(w, r, ErrQueryResponse(err))
 		return
 	}
-	render.Status(r, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (h *Handler) DeleteBookCover(w http.ResponseWriter, r *http.Request) {
@@ -37,5 +60,5 @@ func (h *Handler) DeleteBookCover(w http.ResponseWriter, r *http.Request) {
 		_ = render.Render(w, r, ErrQueryResponse(err))
 		return
 	}
-	render.Status(r, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,319 @@
+package rest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/cover"
+	"github.com/thunder33345/bookstore/http/rest"
+)
+
+// testISBN is a valid ISBN-13, the books of the tests are created using it
+const testISBN = "9780000000002"
+
+// createBook creates the book with testISBN, along with a genre and author for it
+func (s *testServer) createBook(token string) {
+	s.t.Helper()
+	var genre, author struct {
+		ID string `json:"id"`
+	}
+	s.expect(http.StatusOK, &genre, http.MethodPost, "/genres", token, map[string]string{"name": "Fantasy"})
+	s.expect(http.StatusOK, &author, http.MethodPost, "/authors", token, map[string]string{"name": "Writer"})
+	s.expect(http.StatusOK, nil, http.MethodPost, "/books/"+testISBN, token,
+		map[string]any{"title": "Book", "author_id": author.ID, "genre_id": genre.ID, "publish_year": 2000})
+}
+
+// uploadCover uploads the file as the cover of the book with testISBN, returning the response
+func (s *testServer) uploadCover(token string, data []byte) *http.Response {
+	s.t.Helper()
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	part, err := mw.CreateFormFile("image", "cover")
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	_, _ = part.Write(data)
+	_ = mw.Close()
+	return s.request(http.MethodPut, "/books/"+testISBN+"/cover", token, body, "Content-Type", mw.FormDataContentType())
+}
+
+// coverURLs returns the cover URL of the book with testISBN, along with the URL of each variant
+func (s *testServer) coverURLs(token string) (string, map[string]string) {
+	s.t.Helper()
+	var book struct {
+		CoverURL    string            `json:"cover_url"`
+		VariantURLs map[string]string `json:"cover_variant_urls"`
+	}
+	s.expect(http.StatusOK, &book, http.MethodGet, "/books/"+testISBN, token, nil)
+	return book.CoverURL, book.VariantURLs
+}
+
+// testPNG encodes a gradient of the size as PNG
+func testPNG(t *testing.T, width int, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCoverUploadAndServe(t *testing.T) {
+	s := newTestServer(t, testConfig{})
+	admin := s.admin("admin@example.com")
+	user := s.signup("reader@example.com")
+	s.createBook(admin.Token)
+
+	if resp := s.uploadCover(user.Token, testPNG(t, 400, 600)); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("uploading without permission: got status %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+	if resp := s.uploadCover(admin.Token, []byte("not an image")); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("uploading a non-image: got status %d, want %d", resp.StatusCode, http.StatusUnsupportedMediaType)
+	}
+	if resp := s.uploadCover(admin.Token, testPNG(t, 400, 600)); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("uploading: got status %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+
+	coverURL, variants := s.coverURLs(user.Token)
+	if !strings.HasPrefix(coverURL, "/covers/"+testISBN) || len(variants) == 0 {
+		t.Fatalf("got cover %q with variants %v, want a cover with variants", coverURL, variants)
+	}
+	resp := s.expect(http.StatusOK, nil, http.MethodGet, coverURL, "", nil)
+	if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+		t.Errorf("got Content-Type %q, want image/png", ct)
+	}
+	if cc := resp.Header.Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+		t.Errorf("got Cache-Control %q, want it to be immutable", cc)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("got no ETag")
+	}
+	s.expect(http.StatusNotModified, nil, http.MethodGet, coverURL, "", nil, "If-None-Match", etag)
+
+	thumb := s.expect(http.StatusOK, nil, http.MethodGet, variants["thumb"], "", nil)
+	config, _, err := image.DecodeConfig(thumb.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Width != 160 || config.Height != 240 {
+		t.Errorf("got thumb of %dx%d, want 160x240", config.Width, config.Height)
+	}
+	s.expect(http.StatusBadRequest, nil, http.MethodGet, coverURL+"?size=huge", "", nil)
+
+	//replacing gives the cover a new URL, the old one is gone
+	if resp := s.uploadCover(admin.Token, testPNG(t, 200, 300)); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("replacing: got status %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	replaced, _ := s.coverURLs(user.Token)
+	if replaced == coverURL {
+		t.Fatal("replacing kept the URL of the cover")
+	}
+	s.expect(http.StatusNotFound, nil, http.MethodGet, coverURL, "", nil)
+	s.expect(http.StatusOK, nil, http.MethodGet, replaced, "", nil)
+
+	s.expect(http.StatusNoContent, nil, http.MethodDelete, "/books/"+testISBN+"/cover", admin.Token, nil)
+	s.expect(http.StatusNotFound, nil, http.MethodGet, replaced, "", nil)
+	if removed, _ := s.coverURLs(user.Token); removed != "" {
+		t.Errorf("got cover %q after removing it, want none", removed)
+	}
+}
+
+// testImage draws a gradient of the size and encodes it as JPEG or GIF
+func testImage(t *testing.T, format string, width int, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		t.Fatalf("unknown format %s", format)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCoverVariantSizes(t *testing.T) {
+	s := newTestServer(t, testConfig{})
+	admin := s.admin("admin@example.com")
+	s.createBook(admin.Token)
+
+	tests := []struct {
+		format        string
+		width, height int
+		//want is the size of each variant, covers are scaled to fit keeping their aspect ratio, but never up
+		want map[string]image.Point
+	}{
+		{"jpeg", 600, 900, map[string]image.Point{"thumb": {160, 240}, "medium": {400, 600}, "large": {600, 900}}},
+		{"gif", 600, 900, map[string]image.Point{"thumb": {160, 240}, "medium": {400, 600}, "large": {600, 900}}},
+		{"jpeg", 1000, 500, map[string]image.Point{"thumb": {160, 80}, "medium": {400, 200}, "large": {800, 400}}},
+		{"gif", 300, 1500, map[string]image.Point{"thumb": {48, 240}, "medium": {120, 600}, "large": {240, 1200}}},
+	}
+	for _, tt := range tests {
+		if resp := s.uploadCover(admin.Token, testImage(t, tt.format, tt.width, tt.height)); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("uploading %dx%d %s: got status %d, want %d", tt.width, tt.height, tt.format, resp.StatusCode, http.StatusNoContent)
+		}
+		_, variants := s.coverURLs(admin.Token)
+		for name, want := range tt.want {
+			resp := s.expect(http.StatusOK, nil, http.MethodGet, variants[name], "", nil)
+			config, format, err := image.DecodeConfig(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != tt.format || config.Width != want.X || config.Height != want.Y {
+				t.Errorf("%dx%d %s: got %s of %dx%d %s, want %dx%d %s", tt.width, tt.height, tt.format,
+					name, config.Width, config.Height, format, want.X, want.Y, tt.format)
+			}
+		}
+	}
+}
+
+func TestCoverWebP(t *testing.T) {
+	processor, err := cover.NewProcessor(cover.WithAlternateFormats(cover.PNG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, testConfig{processor: processor})
+	admin := s.admin("admin@example.com")
+	s.createBook(admin.Token)
+
+	webp, err := os.ReadFile("testdata/cover.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := s.uploadCover(admin.Token, webp); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("uploading: got status %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	coverURL, variants := s.coverURLs(admin.Token)
+	if !strings.HasSuffix(coverURL, ".webp") {
+		t.Fatalf("got cover %q, want it kept as WebP", coverURL)
+	}
+
+	//the upload is served to clients taking WebP, the rest get it converted to PNG
+	for accept, want := range map[string]string{"": "image/webp", "image/webp,*/*;q=0.8": "image/webp", "image/png": "image/png"} {
+		resp := s.expect(http.StatusOK, nil, http.MethodGet, coverURL, "", nil, "Accept", accept)
+		if ct := resp.Header.Get("Content-Type"); ct != want {
+			t.Errorf("accepting %q: got Content-Type %q, want %q", accept, ct, want)
+		}
+		if vary := resp.Header.Get("Vary"); vary != "Accept" {
+			t.Errorf("accepting %q: got Vary %q, want Accept", accept, vary)
+		}
+		if _, format, err := image.Decode(resp.Body); err != nil || "image/"+format != want {
+			t.Errorf("accepting %q: got %s image, error %v", accept, format, err)
+		}
+	}
+
+	//the cover is smaller than the variants, so they are the same files negotiated the same way
+	thumb := s.expect(http.StatusOK, nil, http.MethodGet, variants["thumb"], "", nil, "Accept", "image/png")
+	if ct := thumb.Header.Get("Content-Type"); ct != "image/png" {
+		t.Errorf("got thumb Content-Type %q, want image/png", ct)
+	}
+}
+
+func TestCoverWebPVariants(t *testing.T) {
+	s := newTestServer(t, testConfig{})
+	admin := s.admin("admin@example.com")
+	s.createBook(admin.Token)
+
+	tests := []struct {
+		file string
+		size image.Point
+		//fallback is what the scaled variants are written in while WebP can't be encoded
+		fallback string
+		want     map[string]image.Point
+	}{
+		{"testdata/cover-large.webp", image.Pt(600, 400), "jpeg",
+			map[string]image.Point{"thumb": {160, 106}, "medium": {400, 266}, "large": {600, 400}}},
+		{"testdata/cover-alpha.webp", image.Pt(400, 301), "png",
+			map[string]image.Point{"thumb": {160, 120}, "medium": {400, 301}, "large": {400, 301}}},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp := s.uploadCover(admin.Token, data); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("uploading %s: got status %d, want %d", tt.file, resp.StatusCode, http.StatusNoContent)
+		}
+		_, variants := s.coverURLs(admin.Token)
+		for name, want := range tt.want {
+			wantFormat := tt.fallback
+			if cover.WebP.Encode != nil || want == tt.size {
+				//variants the cover fits in are the upload itself
+				wantFormat = "webp"
+			}
+			resp := s.expect(http.StatusOK, nil, http.MethodGet, variants[name], "", nil)
+			config, format, err := image.DecodeConfig(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "image/"+wantFormat {
+				t.Errorf("%s: got %s Content-Type %q, want image/%s", tt.file, name, ct, wantFormat)
+			}
+			if format != wantFormat || config.Width != want.X || config.Height != want.Y {
+				t.Errorf("%s: got %s of %dx%d %s, want %dx%d %s", tt.file, name,
+					config.Width, config.Height, format, want.X, want.Y, wantFormat)
+			}
+		}
+	}
+}
+
+func TestCoverUploadTooLarge(t *testing.T) {
+	limits := cover.DefaultLimits
+	limits.MaxBytes = 4 << 10
+	processor, err := cover.NewProcessor(cover.WithLimits(limits))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, testConfig{processor: processor, rest: []rest.Option{rest.WithMaxCoverUpload(limits.MaxBytes)}})
+	admin := s.admin("admin@example.com")
+	s.createBook(admin.Token)
+
+	//a file just over the limit is caught by its size, a far larger one is cut off while the body is read
+	for _, size := range []int{int(limits.MaxBytes) + 1, 512 << 10} {
+		resp := s.uploadCover(admin.Token, append(testPNG(t, 1, 1), make([]byte, size)...))
+		var body rest.ErrResponse
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		if resp.StatusCode != http.StatusRequestEntityTooLarge || body.Reason != "too_large" {
+			t.Errorf("uploading %d bytes: got status %d with reason %q, want %d with too_large",
+				size, resp.StatusCode, body.Reason, http.StatusRequestEntityTooLarge)
+		}
+	}
+	if resp := s.uploadCover(admin.Token, testPNG(t, 40, 60)); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("uploading within the limit: got status %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+
+	//the processor enforces the limit for callers which don't go through the handler
+	if _, err = processor.Read(bytes.NewReader(make([]byte, limits.MaxBytes+1))); !errors.Is(err, bookstore.ErrInvalidFileType) {
+		t.Errorf("reading an oversized file: got %v, want an invalid image error", err)
+	}
+}
@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/thunder33345/bookstore"
+)
+
+// VerifyAccountEmail marks the email as verified using the token from the verification email
+// the token only works while the account still uses the email it was sent to
+func (h *Handler) VerifyAccountEmail(w http.ResponseWriter, r *http.Request) {
+	data := &EmailVerifyRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	accountID, email, err := h.auth.ConsumeEmailVerification(r.Context(), data.Token)
+	if err != nil {
+		if errors.Is(err, bookstore.ErrInvalidVerificationToken) {
+			_ = render.Render(w, r, ErrInvalidVerificationToken)
+			return
+		}
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	err = h.store.MarkEmailVerified(r.Context(), accountID, email, time.Now())
+	if err != nil {
+		var noResErr *bookstore.NoResultError
+		if errors.As(err, &noResErr) {
+			//the email was changed after the link was sent
+			_ = render.Render(w, r, ErrInvalidVerificationToken)
+			return
+		}
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendAccountVerification sends a new verification email to the current account
+func (h *Handler) ResendAccountVerification(w http.ResponseWriter, r *http.Request) {
+	ses, ok := GetSession(r.Context())
+	if !ok {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrMissingSessionData))
+		return
+	}
+	if h.mailer == nil {
+		_ = render.Render(w, r, ErrMailUnavailable)
+		return
+	}
+
+	//the session may hold an outdated copy of the account
+	acc, err := h.store.GetAccount(r.Context(), ses.ID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	if acc.EmailVerifiedAt != nil {
+		_ = render.Render(w, r, ErrEmailAlreadyVerified)
+		return
+	}
+
+	go h.sendEmailVerification(acc)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendEmailVerification mails a verification link for the current email of the account
+// it does nothing without a mailer, errors are handed to Handler.onErr
+func (h *Handler) sendEmailVerification(acc bookstore.Account) {
+	if h.mailer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	token, err := h.auth.CreateEmailVerification(ctx, acc)
+	if err != nil {
+		h.onErr(fmt.Errorf("requesting email verification: %w", err))
+		return
+	}
+
+	link := h.verifyEmailURL + "?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Hi %s,\n\nPlease confirm this is your email address by opening the link below.\n\n%s\n\n"+
+		"If you didn't sign up, you can safely ignore this email.\n", acc.Name, link)
+	err = h.mailer.Send(ctx, acc.Email, "Verify your email address", body)
+	if err != nil {
+		h.onErr(fmt.Errorf("sending email verification: %w", err))
+	}
+}
+
+type EmailVerifyRequest struct {
+	Token string `json:"token"`
+}
+
+func (e *EmailVerifyRequest) Bind(_ *http.Request) error {
+	if e.Token == "" {
+		return errors.New("no token provided")
+	}
+	return nil
+}
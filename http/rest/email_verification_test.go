@@ -0,0 +1,72 @@
+package rest_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/auth"
+	"github.com/thunder33345/bookstore/http/rest"
+)
+
+const verifySubject = "Verify your email address"
+
+// verified returns whether the email of the account behind the token is verified
+func (s *testServer) verified(token string) bool {
+	s.t.Helper()
+	var acc bookstore.Account
+	s.expect(http.StatusOK, &acc, http.MethodGet, "/account", token, nil)
+	return acc.EmailVerifiedAt != nil
+}
+
+func TestEmailVerification(t *testing.T) {
+	s, outbox := newMailServer(t, testConfig{rest: []rest.Option{rest.WithRequireVerifiedEmail(true)}})
+	user := s.signup("reader@example.com")
+
+	//the catalog stays closed until the email is verified
+	s.expect(http.StatusForbidden, nil, http.MethodGet, "/genres", user.Token, nil)
+	first := mailedToken(t, outbox, "reader@example.com", verifySubject, 1)
+	//resending replaces the token
+	s.expect(http.StatusAccepted, nil, http.MethodPost, "/account/verify/resend", user.Token, nil)
+	token := mailedToken(t, outbox, "reader@example.com", verifySubject, 2)
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, "/account/verify", "", map[string]string{"token": first})
+
+	s.expect(http.StatusNoContent, nil, http.MethodPost, "/account/verify", "", map[string]string{"token": token})
+	if !s.verified(user.Token) {
+		t.Error("the email is not verified after using the token")
+	}
+	s.expect(http.StatusOK, nil, http.MethodGet, "/genres", user.Token, nil)
+	//tokens are single use, and there's nothing left to resend
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, "/account/verify", "", map[string]string{"token": token})
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, "/account/verify/resend", user.Token, nil)
+
+	//changing the email needs the new one verified, by a link sent to it
+	s.expect(http.StatusNoContent, nil, http.MethodPut, "/account", user.Token,
+		map[string]string{"name": "Tester", "email": "moved@example.com"})
+	if s.verified(user.Token) {
+		t.Error("the changed email is still verified")
+	}
+	s.expect(http.StatusForbidden, nil, http.MethodGet, "/genres", user.Token, nil)
+	moved := mailedToken(t, outbox, "moved@example.com", verifySubject, 1)
+
+	//a link only verifies the email it was sent to
+	s.expect(http.StatusNoContent, nil, http.MethodPut, "/account", user.Token,
+		map[string]string{"name": "Tester", "email": "again@example.com"})
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, "/account/verify", "", map[string]string{"token": moved})
+	again := mailedToken(t, outbox, "again@example.com", verifySubject, 1)
+	s.expect(http.StatusNoContent, nil, http.MethodPost, "/account/verify", "", map[string]string{"token": again})
+	s.expect(http.StatusOK, nil, http.MethodGet, "/genres", user.Token, nil)
+}
+
+func TestEmailVerificationExpiry(t *testing.T) {
+	s, outbox := newMailServer(t, testConfig{auth: []auth.Option{auth.WithEmailVerificationTimeout(time.Millisecond)}})
+	user := s.signup("reader@example.com")
+
+	token := mailedToken(t, outbox, "reader@example.com", verifySubject, 1)
+	time.Sleep(2 * time.Millisecond)
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, "/account/verify", "", map[string]string{"token": token})
+	if s.verified(user.Token) {
+		t.Error("the email got verified by an expired token")
+	}
+}
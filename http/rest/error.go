@@ -3,7 +3,10 @@ package rest
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/render"
 	"github.com/thunder33345/bookstore"
@@ -20,9 +23,17 @@ type ErrResponse struct {
 	MessageText string `json:"message"`
 	//ErrorText is the full error chain for debugging
 	ErrorText string `json:"error,omitempty"`
+	//Reason is a machine readable cause of the error, only set for some errors
+	Reason string `json:"reason,omitempty"`
+	//RetryAfter is sent as the Retry-After header when set
+	RetryAfter time.Duration `json:"-"`
 }
 
-func (e *ErrResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	if e.RetryAfter > 0 {
+		//the header only takes whole seconds, rounding up so clients don't retry too early
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+	}
 	render.Status(r, e.HTTPStatusCode)
 	return nil
 }
@@ -77,6 +88,11 @@ func ErrQueryResponse(err error) render.Renderer {
 		e.MessageText = invID.Error()
 	}
 
+	if errors.Is(e.Err, bookstore.ErrInvalidFileType) {
+		e.HTTPStatusCode = http.StatusBadRequest
+		e.MessageText = bookstore.ErrInvalidFileType.Error()
+	}
+
 	return e
 }
 
@@ -117,6 +133,33 @@ func ErrProcessingFile(err error) render.Renderer {
 	}
 }
 
+// ErrInvalidImage creates an error response for a rejected cover upload, naming the reason it was rejected
+func ErrInvalidImage(err *bookstore.InvalidImageError) render.Renderer {
+	status := http.StatusBadRequest
+	if err.Reason == bookstore.ImageUnsupportedFormat {
+		status = http.StatusUnsupportedMediaType
+	}
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: status,
+		MessageText:    "Invalid image.",
+		ErrorText:      err.Error(),
+		Reason:         string(err.Reason),
+	}
+}
+
+// ErrCoverTooLarge creates an error response for cover uploads above the limit, before they are read whole
+func ErrCoverTooLarge(limit int64) render.Renderer {
+	err := bookstore.NewInvalidImageError(bookstore.ImageTooLarge, fmt.Sprintf("file is larger than the maximum of %d bytes", limit))
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusRequestEntityTooLarge,
+		MessageText:    "Invalid image.",
+		ErrorText:      err.Error(),
+		Reason:         string(bookstore.ImageTooLarge),
+	}
+}
+
 func ErrRender(err error) render.Renderer {
 	return &ErrResponse{
 		Err:            err,
@@ -130,6 +173,69 @@ var ErrNotFound = &ErrResponse{HTTPStatusCode: 404, MessageText: "Resource not f
 
 var ErrForbidden = &ErrResponse{HTTPStatusCode: http.StatusForbidden, MessageText: "Unauthorized, insufficient permissions."}
 
+var ErrOutranked = &ErrResponse{HTTPStatusCode: http.StatusForbidden, MessageText: "Unauthorized, the account holds permissions you don't."}
+
+var ErrAPIKeyNotAllowed = &ErrResponse{HTTPStatusCode: http.StatusForbidden, MessageText: "API keys can't be used here, use a session token instead."}
+
+var ErrInvalidResetToken = &ErrResponse{HTTPStatusCode: http.StatusBadRequest, MessageText: "Invalid or expired password reset token."}
+
+var ErrInvalidVerificationToken = &ErrResponse{HTTPStatusCode: http.StatusBadRequest, MessageText: "Invalid or expired email verification token."}
+
+var ErrEmailNotVerified = &ErrResponse{HTTPStatusCode: http.StatusForbidden, MessageText: "Email address needs to be verified first."}
+
+var ErrEmailAlreadyVerified = &ErrResponse{HTTPStatusCode: http.StatusBadRequest, MessageText: "Email address is already verified."}
+
+var ErrMailUnavailable = &ErrResponse{HTTPStatusCode: http.StatusNotImplemented, MessageText: "Sending emails is not available."}
+
+var ErrInvalidTwoFactorCode = &ErrResponse{HTTPStatusCode: http.StatusBadRequest, MessageText: "Invalid two-factor code."}
+
+var ErrTwoFactorNotEnrolled = &ErrResponse{HTTPStatusCode: http.StatusBadRequest, MessageText: "Two-factor authentication is not enrolled."}
+
+var ErrTwoFactorAlreadyEnabled = &ErrResponse{HTTPStatusCode: http.StatusConflict, MessageText: "Two-factor authentication is already enabled."}
+
+var ErrSessionCookieUnavailable = &ErrResponse{HTTPStatusCode: http.StatusNotImplemented, MessageText: "Session cookies are not available."}
+
+var ErrRegistrationClosed = &ErrResponse{HTTPStatusCode: http.StatusForbidden, MessageText: "Signing up is disabled."}
+
+var ErrInvalidInvite = &ErrResponse{HTTPStatusCode: http.StatusForbidden, MessageText: "A valid invite code is required to sign up."}
+
+var ErrEmailDomainNotAllowed = &ErrResponse{HTTPStatusCode: http.StatusBadRequest, MessageText: "Email addresses on this domain are not allowed."}
+
+var ErrImpersonationForbidden = &ErrResponse{HTTPStatusCode: http.StatusForbidden, MessageText: "Not allowed while impersonating the account."}
+
+var ErrOIDCNoAccount = &ErrResponse{HTTPStatusCode: http.StatusForbidden, MessageText: "No account is linked to this login, and one can't be created."}
+
+var ErrReauthRequired = &ErrResponse{HTTPStatusCode: http.StatusForbidden, MessageText: "No password provided, provide it or log in again through your identity provider first."}
+
+var ErrOIDCLinkRefused = &ErrResponse{HTTPStatusCode: http.StatusForbidden, MessageText: "An account using this email already exists, log in with its password instead."}
+
+// ErrOIDCLogin creates an error response for when logging in through the identity provider failed
+func ErrOIDCLogin(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusUnauthorized,
+		MessageText:    "Logging in through the identity provider failed.",
+		ErrorText:      err.Error(),
+	}
+}
+
+// ErrTwoFactorResponse creates an error response for managing two-factor authentication, falling back to ErrQueryResponse
+// throttled attempts are responded to like throttled logins, see ErrSessionResponse
+func ErrTwoFactorResponse(err error) render.Renderer {
+	var throttledErr *bookstore.LoginThrottledError
+	switch {
+	case errors.As(err, &throttledErr):
+		return ErrSessionResponse(err)
+	case errors.Is(err, bookstore.ErrInvalidTwoFactorCode):
+		return ErrInvalidTwoFactorCode
+	case errors.Is(err, bookstore.ErrTwoFactorNotEnrolled):
+		return ErrTwoFactorNotEnrolled
+	case errors.Is(err, bookstore.ErrTwoFactorAlreadyEnabled):
+		return ErrTwoFactorAlreadyEnabled
+	}
+	return ErrQueryResponse(err)
+}
+
 func ErrSessionResponse(err error) render.Renderer {
 	e := &ErrResponse{
 		Err:            err,
@@ -138,6 +244,8 @@ func ErrSessionResponse(err error) render.Renderer {
 		ErrorText:      err.Error(),
 	}
 
+	var throttledErr *bookstore.LoginThrottledError
+	var suspendedErr *bookstore.AccountSuspendedError
 	switch {
 	case errors.Is(e.Err, bookstore.ErrMalformedSession):
 		e.HTTPStatusCode = http.StatusUnauthorized
@@ -151,6 +259,47 @@ func ErrSessionResponse(err error) render.Renderer {
 		e.HTTPStatusCode = http.StatusUnauthorized
 		e.MessageText = "Invalid session token provided."
 		e.ErrorText = ""
+	case errors.Is(e.Err, bookstore.ErrExpiredAccessToken):
+		e.HTTPStatusCode = http.StatusUnauthorized
+		e.MessageText = "Expired access token provided, refresh it using the refresh token."
+		e.ErrorText = ""
+	case errors.Is(e.Err, bookstore.ErrAccessTokenRequired):
+		e.HTTPStatusCode = http.StatusUnauthorized
+		e.MessageText = "Session tokens can only be used to refresh, authorize using the access token instead."
+		e.ErrorText = ""
+	case errors.Is(e.Err, bookstore.ErrRefreshTokenReused):
+		e.HTTPStatusCode = http.StatusUnauthorized
+		e.MessageText = "Refresh token was already used, the session has been revoked."
+		e.ErrorText = ""
+	case errors.Is(e.Err, bookstore.ErrInvalidCSRFToken):
+		e.HTTPStatusCode = http.StatusForbidden
+		e.MessageText = "Missing or invalid CSRF token provided."
+		e.ErrorText = ""
+	case errors.Is(e.Err, bookstore.ErrInvalidAPIKey):
+		e.HTTPStatusCode = http.StatusUnauthorized
+		e.MessageText = "Invalid API key provided."
+		e.ErrorText = ""
+	case errors.Is(e.Err, bookstore.ErrInvalidOIDCState):
+		e.HTTPStatusCode = http.StatusUnauthorized
+		e.MessageText = "Invalid or expired login state, log in again."
+		e.ErrorText = ""
+	case errors.Is(e.Err, bookstore.ErrInvalidLoginChallenge):
+		e.HTTPStatusCode = http.StatusUnauthorized
+		e.MessageText = "Invalid or expired login challenge, log in again."
+		e.ErrorText = ""
+	case errors.Is(e.Err, bookstore.ErrInvalidTwoFactorCode):
+		e.HTTPStatusCode = http.StatusUnauthorized
+		e.MessageText = "Invalid two-factor code provided."
+		e.ErrorText = ""
+	case errors.As(e.Err, &suspendedErr):
+		e.HTTPStatusCode = http.StatusForbidden
+		e.MessageText = "Account is suspended."
+		e.ErrorText = suspendedErr.Error()
+	case errors.As(e.Err, &throttledErr):
+		e.HTTPStatusCode = http.StatusTooManyRequests
+		e.MessageText = "Too many failed login attempts, try again later."
+		e.ErrorText = ""
+		e.RetryAfter = throttledErr.RetryAfter()
 	case errors.Is(e.Err, bookstore.ErrMissingSessionData):
 		e.HTTPStatusCode = http.StatusInternalServerError
 		e.MessageText = "Handler fail to retrieve session data."
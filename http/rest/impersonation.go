@@ -0,0 +1,119 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// ImpersonatedRequest is a request made through an impersonation session, see WithImpersonationLog
+type ImpersonatedRequest struct {
+	//ImpersonatorID is the admin really making the request, as AccountID
+	ImpersonatorID uuid.UUID
+	AccountID      uuid.UUID
+	SessionID      uuid.UUID
+	Method         string
+	Path           string
+	IP             string
+	//RequestID is set by middleware.RequestID, empty if it isn't used
+	RequestID string
+	At        time.Time
+}
+
+// ImpersonateUser creates a time-limited session for the user, marked as an impersonation by the current account
+// the session only gets the permissions both accounts hold, and can't change the credentials of the user,
+// see Handler.MiddlewareNotImpersonated
+func (h *Handler) ImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	id := r.Context().Value(ctxUUIDKey).(uuid.UUID)
+	ses, ok := GetSession(r.Context())
+	if !ok {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrMissingSessionData))
+		return
+	}
+	//impersonations have to be started by the admin themselves, not through another impersonation or an api key
+	if ses.Impersonated() {
+		_ = render.Render(w, r, ErrImpersonationForbidden)
+		return
+	}
+	if ses.APIKey != nil {
+		_ = render.Render(w, r, ErrAPIKeyNotAllowed)
+		return
+	}
+	if ses.ID == id {
+		_ = render.Render(w, r, ErrInvalidRequest(errors.New("can't impersonate your own account")))
+		return
+	}
+
+	acc, err := h.store.GetAccount(r.Context(), id)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	tok, impersonation, err := h.auth.Impersonate(r.Context(), acc, ses.ID, clientIP(r), r.UserAgent())
+	if err != nil {
+		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
+
+	//the token is never set as a cookie, as that would replace the session of the admin in their browser
+	h.renderSessionCreated(w, r, tok, impersonation, false)
+}
+
+// MiddlewareNotImpersonated rejects impersonation sessions, guarding changes to the credentials of the account
+func (h *Handler) MiddlewareNotImpersonated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, ses, err := h.populateSession(r)
+		if err != nil {
+			_ = render.Render(w, r, ErrSessionResponse(err))
+			return
+		}
+		if ses.Impersonated() {
+			_ = render.Render(w, r, ErrImpersonationForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sessionPermissions looks up the permissions granted by the roles of the account
+// impersonations only get the permissions the impersonator holds as well, so they can't be used to gain permissions
+func (h *Handler) sessionPermissions(ctx context.Context, ses bookstore.Session) ([]bookstore.Permission, error) {
+	perms, err := h.store.GetAccountPermissions(ctx, ses.ID)
+	if err != nil || !ses.Impersonated() {
+		return perms, err
+	}
+	impersonatorPerms, err := h.store.GetAccountPermissions(ctx, *ses.Meta.ImpersonatorID)
+	if err != nil {
+		return nil, err
+	}
+	shared := make([]bookstore.Permission, 0, len(perms))
+	for _, perm := range perms {
+		if bookstore.Scope(impersonatorPerms).Contains(perm) {
+			shared = append(shared, perm)
+		}
+	}
+	return shared, nil
+}
+
+// logImpersonated reports the request to the impersonation log if it's made through an impersonation
+func (h *Handler) logImpersonated(r *http.Request, ses bookstore.Session) {
+	if !ses.Impersonated() {
+		return
+	}
+	h.onImpersonated(ImpersonatedRequest{
+		ImpersonatorID: *ses.Meta.ImpersonatorID,
+		AccountID:      ses.ID,
+		SessionID:      ses.Meta.ID,
+		Method:         r.Method,
+		Path:           r.URL.Path,
+		IP:             clientIP(r),
+		RequestID:      middleware.GetReqID(r.Context()),
+		At:             time.Now(),
+	})
+}
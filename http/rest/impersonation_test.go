@@ -0,0 +1,47 @@
+package rest_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestImpersonationGuards(t *testing.T) {
+	s := newTestServer(t, testConfig{})
+	admin := s.admin("admin@example.com")
+	user := s.signup("reader@example.com")
+	other := s.signup("other@example.com")
+
+	//impersonating needs its own permission, and can't target yourself
+	s.expect(http.StatusForbidden, nil, http.MethodPost, userPath(admin.Account.ID, "/impersonate"), user.Token, nil)
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, userPath(admin.Account.ID, "/impersonate"), admin.Token, nil)
+
+	var imp testSession
+	s.expect(http.StatusOK, &imp, http.MethodPost, userPath(user.Account.ID, "/impersonate"), admin.Token, nil)
+	var account struct {
+		Email          string     `json:"email"`
+		Permissions    []string   `json:"permissions"`
+		ImpersonatedBy *uuid.UUID `json:"impersonated_by"`
+	}
+	s.expect(http.StatusOK, &account, http.MethodGet, "/account", imp.Token, nil)
+	if account.Email != "reader@example.com" || account.ImpersonatedBy == nil || *account.ImpersonatedBy != admin.Account.ID {
+		t.Errorf("got account %+v, want the user impersonated by the admin", account)
+	}
+	//the session only gets what both accounts hold, which is nothing here
+	if len(account.Permissions) != 0 {
+		t.Errorf("got permissions %v, want none", account.Permissions)
+	}
+	s.expect(http.StatusForbidden, nil, http.MethodGet, "/users", imp.Token, nil)
+	s.expect(http.StatusForbidden, nil, http.MethodPost, userPath(other.Account.ID, "/impersonate"), imp.Token, nil)
+
+	//the credentials of the account are off limits
+	s.expect(http.StatusForbidden, nil, http.MethodPost, "/account/password", imp.Token,
+		map[string]string{"old_password": testPassword, "new_password": testPassword + "!"})
+	s.expect(http.StatusForbidden, nil, http.MethodDelete, "/account", imp.Token, map[string]string{"password": testPassword})
+	s.expect(http.StatusForbidden, nil, http.MethodPost, "/account/2fa", imp.Token, nil)
+	s.expect(http.StatusForbidden, nil, http.MethodPost, "/account/apikeys", imp.Token, map[string]string{"name": "key"})
+	s.expect(http.StatusForbidden, nil, http.MethodPut, "/account", imp.Token,
+		map[string]string{"name": "Tester", "email": "taken-over@example.com"})
+	s.login(http.StatusOK, "reader@example.com", testPassword)
+}
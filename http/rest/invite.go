@@ -0,0 +1,159 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// RegistrationPolicy decides who can create an account through CreateAccount, see WithRegistration
+type RegistrationPolicy string
+
+const (
+	// RegistrationOpen lets anyone sign up
+	RegistrationOpen RegistrationPolicy = "open"
+	// RegistrationInviteOnly requires a valid invite code to sign up, invites are created on /invites
+	RegistrationInviteOnly RegistrationPolicy = "invite-only"
+	// RegistrationClosed disables signing up, accounts can only be created by admins
+	RegistrationClosed RegistrationPolicy = "closed"
+)
+
+// CreateInvite creates an invite code for signing up while registration is invite-only
+// the code is only included in this response
+func (h *Handler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	data := &InviteCreateRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	invite := bookstore.Invite{
+		Email:     data.Email,
+		MaxUses:   *data.MaxUses,
+		ExpiresAt: data.ExpiresAt,
+	}
+	if ses, ok := GetSession(r.Context()); ok {
+		actor := ses.Actor()
+		invite.CreatedBy = &actor
+	}
+
+	code, invite, err := h.auth.CreateInvite(r.Context(), invite)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	_ = render.Render(w, r, NewInviteCreateResponse(code, invite))
+}
+
+// ListInvites lists every invite, including expired and used up ones
+func (h *Handler) ListInvites(w http.ResponseWriter, r *http.Request) {
+	invites, err := h.auth.ListInvites(r.Context())
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, NewListInviteResponse(invites)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// RevokeInvite deletes an invite, so it can't be used to sign up anymore
+func (h *Handler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	inviteID := r.Context().Value(ctxInviteIDKey).(uuid.UUID)
+
+	err := h.auth.RevokeInvite(r.Context(), inviteID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// emailDomainAllowed checks the domain of the email against the allowlist, every domain is allowed without one
+func (h *Handler) emailDomainAllowed(email string) bool {
+	if len(h.allowedEmailDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range h.allowedEmailDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+type InviteCreateRequest struct {
+	//Email limits the invite to this email, any email can use it when omitted
+	Email string `json:"email"`
+	//MaxUses is how many accounts can sign up using the invite, 0 for unlimited, defaults to 1
+	MaxUses   *int       `json:"max_uses"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (i *InviteCreateRequest) Bind(_ *http.Request) error {
+	if i.Email != "" {
+		if _, err := mail.ParseAddress(i.Email); err != nil {
+			return err
+		}
+	}
+	if i.MaxUses == nil {
+		maxUses := 1
+		i.MaxUses = &maxUses
+	}
+	if *i.MaxUses < 0 {
+		return errors.New("max_uses can't be negative")
+	}
+	if i.ExpiresAt != nil && !i.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	return nil
+}
+
+type InviteCreateResponse struct {
+	//Code is the invite code to sign up with, it can't be retrieved again
+	Code   string           `json:"code"`
+	Invite bookstore.Invite `json:"invite"`
+}
+
+func NewInviteCreateResponse(code string, invite bookstore.Invite) *InviteCreateResponse {
+	return &InviteCreateResponse{Code: code, Invite: invite}
+}
+
+func (ic *InviteCreateResponse) Render(_ http.ResponseWriter, _ *http.Request) error {
+	return nil
+}
+
+type InviteResponse struct {
+	*bookstore.Invite
+}
+
+func NewInviteResponse(invite bookstore.Invite) *InviteResponse {
+	return &InviteResponse{Invite: &invite}
+}
+
+func (ir *InviteResponse) Render(_ http.ResponseWriter, _ *http.Request) error {
+	return nil
+}
+
+func NewListInviteResponse(invites []bookstore.Invite) []render.Renderer {
+	list := make([]render.Renderer, 0, len(invites))
+	for _, invite := range invites {
+		list = append(list, NewInviteResponse(invite))
+	}
+	return list
+}
@@ -0,0 +1,118 @@
+package rest_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/http/rest"
+)
+
+// seedAdmin creates an administrator straight in the store, for when signing up is restricted, returning its session
+func (s *testServer) seedAdmin(email string) testSession {
+	s.t.Helper()
+	hash, err := s.auth.Hash(testPassword)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	acc, err := s.db.CreateAccount(context.Background(), bookstore.Account{Name: "Admin", Email: email, PasswordHash: hash})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if err = s.db.AddAccountRole(context.Background(), acc.ID, bookstore.RoleAdministrator); err != nil {
+		s.t.Fatal(err)
+	}
+	return s.login(http.StatusOK, email, testPassword)
+}
+
+// signupWith signs up using the email and invite code, failing the test unless it's responded to with the status
+func (s *testServer) signupWith(status int, email string, invite string) {
+	s.t.Helper()
+	s.expect(status, nil, http.MethodPost, "/account", "",
+		map[string]string{"name": "Tester", "email": email, "password": testPassword, "invite": invite})
+}
+
+// createInvite creates an invite using the request body, returning its code and ID
+func (s *testServer) createInvite(token string, body map[string]any) (string, string) {
+	s.t.Helper()
+	var created struct {
+		Code   string `json:"code"`
+		Invite struct {
+			ID string `json:"id"`
+		} `json:"invite"`
+	}
+	s.expect(http.StatusCreated, &created, http.MethodPost, "/invites", token, body)
+	if created.Code == "" {
+		s.t.Fatal("creating an invite didn't return its code")
+	}
+	return created.Code, created.Invite.ID
+}
+
+func TestRegistrationClosed(t *testing.T) {
+	s := newTestServer(t, testConfig{rest: []rest.Option{rest.WithRegistration(rest.RegistrationClosed)}})
+	admin := s.seedAdmin("admin@example.com")
+
+	s.signupWith(http.StatusForbidden, "reader@example.com", "")
+	s.login(http.StatusNotFound, "reader@example.com", testPassword)
+	//admins still create accounts
+	s.expect(http.StatusOK, nil, http.MethodPost, "/users", admin.Token,
+		map[string]string{"name": "Reader", "email": "reader@example.com", "password": testPassword})
+	s.login(http.StatusOK, "reader@example.com", testPassword)
+}
+
+func TestRegistrationInviteOnly(t *testing.T) {
+	s := newTestServer(t, testConfig{rest: []rest.Option{rest.WithRegistration(rest.RegistrationInviteOnly)}})
+	admin := s.seedAdmin("admin@example.com")
+
+	s.signupWith(http.StatusForbidden, "reader@example.com", "")
+	s.signupWith(http.StatusForbidden, "reader@example.com", "made-up")
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, "/invites", admin.Token,
+		map[string]any{"expires_at": time.Now().Add(-time.Hour)})
+
+	//an invite lasts for as many uses as it was created with
+	code, _ := s.createInvite(admin.Token, map[string]any{"max_uses": 2})
+	s.signupWith(http.StatusOK, "first@example.com", code)
+	//failing to sign up, as the email is taken, gives the use back
+	s.signupWith(http.StatusBadRequest, "first@example.com", code)
+	s.signupWith(http.StatusOK, "second@example.com", code)
+	s.signupWith(http.StatusForbidden, "third@example.com", code)
+	var invites []bookstore.Invite
+	s.expect(http.StatusOK, &invites, http.MethodGet, "/invites", admin.Token, nil)
+	if len(invites) != 1 || invites[0].Uses != 2 || invites[0].CreatedBy == nil || *invites[0].CreatedBy != admin.Account.ID {
+		t.Errorf("got invites %+v, want the one created by the admin used twice", invites)
+	}
+	//accounts without users:write can't hand out invites
+	reader := s.login(http.StatusOK, "first@example.com", testPassword)
+	s.expect(http.StatusForbidden, nil, http.MethodPost, "/invites", reader.Token, map[string]any{})
+
+	//invites for an email only work for it
+	code, _ = s.createInvite(admin.Token, map[string]any{"email": "bound@example.com"})
+	s.signupWith(http.StatusForbidden, "other@example.com", code)
+	s.signupWith(http.StatusOK, "bound@example.com", code)
+
+	//revoked and expired invites stop working
+	code, id := s.createInvite(admin.Token, map[string]any{})
+	s.expect(http.StatusNoContent, nil, http.MethodDelete, "/invites/"+id, admin.Token, nil)
+	s.signupWith(http.StatusForbidden, "revoked@example.com", code)
+	code, _ = s.createInvite(admin.Token, map[string]any{"expires_at": time.Now().Add(50 * time.Millisecond)})
+	time.Sleep(100 * time.Millisecond)
+	s.signupWith(http.StatusForbidden, "expired@example.com", code)
+}
+
+func TestAllowedEmailDomains(t *testing.T) {
+	s := newTestServer(t, testConfig{rest: []rest.Option{rest.WithAllowedEmailDomains("Example.com")}})
+
+	s.signupWith(http.StatusBadRequest, "reader@elsewhere.com", "")
+	//subdomains are domains of their own
+	s.signupWith(http.StatusBadRequest, "reader@mail.example.com", "")
+	s.signupWith(http.StatusOK, "reader@EXAMPLE.com", "")
+	user := s.login(http.StatusOK, "reader@EXAMPLE.com", testPassword)
+
+	//the email can't be moved off the allowed domains either
+	s.expect(http.StatusBadRequest, nil, http.MethodPut, "/account", user.Token,
+		map[string]string{"name": "Tester", "email": "reader@elsewhere.com"})
+	s.expect(http.StatusNoContent, nil, http.MethodPut, "/account", user.Token,
+		map[string]string{"name": "Tester", "email": "moved@example.com"})
+}
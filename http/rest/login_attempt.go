@@ -0,0 +1,71 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// ListUserLoginAttempts lists the latest failed logins using the user's email, newest first
+func (h *Handler) ListUserLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	id := r.Context().Value(ctxUUIDKey).(uuid.UUID)
+	limit := r.Context().Value(ctxKeyLimit).(int)
+
+	acc, err := h.store.GetAccount(r.Context(), id)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	attempts, err := h.auth.ListLoginAttempts(r.Context(), acc.Email, limit)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, NewListLoginAttemptResponse(attempts)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// UnlockUser lifts the login lockout of the user, along with any backoff on their email
+func (h *Handler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	id := r.Context().Value(ctxUUIDKey).(uuid.UUID)
+
+	acc, err := h.store.GetAccount(r.Context(), id)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	err = h.auth.UnlockLogin(r.Context(), acc.Email)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type LoginAttemptResponse struct {
+	*bookstore.LoginAttempt
+}
+
+func NewLoginAttemptResponse(attempt bookstore.LoginAttempt) *LoginAttemptResponse {
+	resp := &LoginAttemptResponse{LoginAttempt: &attempt}
+	return resp
+}
+
+func (lr *LoginAttemptResponse) Render(_ http.ResponseWriter, _ *http.Request) error {
+	return nil
+}
+
+func NewListLoginAttemptResponse(attempts []bookstore.LoginAttempt) []render.Renderer {
+	list := make([]render.Renderer, 0, len(attempts))
+	for _, attempt := range attempts {
+		list = append(list, NewLoginAttemptResponse(attempt))
+	}
+	return list
+}
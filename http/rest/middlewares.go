@@ -3,9 +3,11 @@ package rest
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
@@ -105,6 +107,86 @@ func UUIDCtx(next http.Handler) http.Handler {
 	})
 }
 
+var ctxSessionIDKey = ctxKey("session-id")
+
+// SessionIDCtx populates the session ID into context from url param, and perform validation
+// it's separate from UUIDCtx, since session routes are nested under routes that already use it
+func SessionIDCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "sessionID")
+		if id == "" {
+			_ = render.Render(w, r, ErrInvalidIDRequest(fmt.Errorf("session ID not provided")))
+			return
+		}
+		sid, err := uuid.Parse(id)
+		if err != nil || sid == uuid.Nil {
+			_ = render.Render(w, r, ErrInvalidIDRequest(err))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ctxSessionIDKey, sid)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+var ctxAPIKeyIDKey = ctxKey("api-key-id")
+
+// APIKeyIDCtx populates the api key ID into context from url param, and perform validation
+func APIKeyIDCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "keyID")
+		if id == "" {
+			_ = render.Render(w, r, ErrInvalidIDRequest(fmt.Errorf("api key ID not provided")))
+			return
+		}
+		kid, err := uuid.Parse(id)
+		if err != nil || kid == uuid.Nil {
+			_ = render.Render(w, r, ErrInvalidIDRequest(err))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ctxAPIKeyIDKey, kid)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+var ctxInviteIDKey = ctxKey("invite-id")
+
+// InviteIDCtx populates the invite ID into context from url param, and perform validation
+func InviteIDCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "inviteID")
+		if id == "" {
+			_ = render.Render(w, r, ErrInvalidIDRequest(fmt.Errorf("invite ID not provided")))
+			return
+		}
+		iid, err := uuid.Parse(id)
+		if err != nil || iid == uuid.Nil {
+			_ = render.Render(w, r, ErrInvalidIDRequest(err))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ctxInviteIDKey, iid)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+var ctxRoleKey = ctxKey("role")
+
+// RoleCtx populates the role name into context from url param
+func RoleCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := chi.URLParam(r, "role")
+		if role == "" {
+			_ = render.Render(w, r, ErrInvalidIDRequest(fmt.Errorf("role not provided")))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ctxRoleKey, role)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 var ctxISBNKey = ctxKey("isbn")
 
 // ISBNCtx populates the ISBN into context from url param
@@ -141,25 +223,108 @@ func (h *Handler) MiddlewareAuthenticatedOnly(next http.Handler) http.Handler {
 	})
 }
 
-// MiddlewareAdminOnly is a middleware to enforce admin only
-func (h *Handler) MiddlewareAdminOnly(next http.Handler) http.Handler {
+// MiddlewareSessionTokenOnly is a middleware to enforce authentication using a session token
+// api keys are rejected, as they shouldn't be able to manage the account they belong to
+func (h *Handler) MiddlewareSessionTokenOnly(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		//try to populate the session into context
-		//so other handlers can also use them
-		r, account, err := h.populateSession(r)
+		r, ses, err := h.populateSession(r)
 		if err != nil {
 			_ = render.Render(w, r, ErrSessionResponse(err))
 			return
 		}
-		if !account.Admin {
-			_ = render.Render(w, r, ErrForbidden)
+		if ses.APIKey != nil {
+			_ = render.Render(w, r, ErrAPIKeyNotAllowed)
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// RequirePermission creates a middleware that only lets through sessions granted the permission
+func (h *Handler) RequirePermission(perm bookstore.Permission) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			//try to populate the session into context
+			//so other handlers can also use them
+			r, ses, err := h.populateSession(r)
+			if err != nil {
+				_ = render.Render(w, r, ErrSessionResponse(err))
+				return
+			}
+			if !ses.HasPermission(perm) {
+				_ = render.Render(w, r, ErrForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MiddlewareOutranksUser is a middleware that only lets through sessions holding every permission of the user in the URL
+// otherwise users:write alone would be enough to take over an account holding more, e.g. by resetting the password of an admin
+// sessions granted roles:write pass regardless, as they could grant themselves the missing permissions anyway
+func (h *Handler) MiddlewareOutranksUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, ses, err := h.populateSession(r)
+		if err != nil {
+			_ = render.Render(w, r, ErrSessionResponse(err))
+			return
+		}
+		if ses.HasPermission(bookstore.PermissionRolesWrite) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id := r.Context().Value(ctxUUIDKey).(uuid.UUID)
+		perms, err := h.store.GetAccountPermissions(r.Context(), id)
+		if err != nil {
+			_ = render.Render(w, r, ErrQueryResponse(err))
+			return
+		}
+		for _, perm := range perms {
+			if !ses.HasPermission(perm) {
+				_ = render.Render(w, r, ErrOutranked)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MiddlewareVerifiedOnly is a middleware that rejects accounts without a verified email
+// it does nothing unless enabled with WithRequireVerifiedEmail
+func (h *Handler) MiddlewareVerifiedOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.requireVerifiedEmail {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r, ses, err := h.populateSession(r)
+		if err != nil {
+			_ = render.Render(w, r, ErrSessionResponse(err))
+			return
+		}
+		if ses.EmailVerifiedAt == nil {
+			//the session store may hold a copy of the account from when it logged in, so we check again before rejecting
+			acc, err := h.store.GetAccount(r.Context(), ses.ID)
+			if err != nil {
+				_ = render.Render(w, r, ErrQueryResponse(err))
+				return
+			}
+			if acc.EmailVerifiedAt == nil {
+				_ = render.Render(w, r, ErrEmailNotVerified)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // populateSession tries to populate session data into context using header
+// requests made through impersonation sessions are reported to the impersonation log, see WithImpersonationLog
+// the session cookie is used when the header is absent, see WithSessionCookie
+// access tokens are verified by their signature alone, they carry their own permissions so nothing is looked up
+// which also means they keep working until they expire after the account is suspended
+// once they are enabled, session tokens are refresh tokens and are only accepted through the cookie
 func (h *Handler) populateSession(r *http.Request) (*http.Request, bookstore.Session, error) {
 	//if it's already populated, we skip it
 	//this could happen if middlewares got chained
@@ -168,20 +333,71 @@ func (h *Handler) populateSession(r *http.Request) (*http.Request, bookstore.Ses
 	}
 
 	ah := r.Header.Get("Authorization")
-	if ah == "" || ah == "Bearer" {
+	cookie := h.cookieSessionToken(r)
+
+	var account bookstore.Session
+	var err error
+	switch {
+	case ah == "" && cookie != "":
+		//browsers send cookies along with requests from other sites, so changes need to prove they came from the frontend
+		if !safeMethod(r.Method) && !h.validCSRF(r, cookie) {
+			return r, bookstore.Session{}, bookstore.ErrInvalidCSRFToken
+		}
+		ah = cookie
+		account, err = h.auth.GetSession(r.Context(), ah)
+	case ah == "" || ah == "Bearer" || ah == "ApiKey":
 		return r, bookstore.Session{}, bookstore.ErrMissingSession
-	}
-	if !strings.HasPrefix(ah, "Bearer ") {
+	case strings.HasPrefix(ah, "Bearer ") && strings.Contains(ah, "."):
+		//session tokens never contain dots, so this is an access token, which is verified without the store
+		//suspensions aren't looked up either, refreshing refuses suspended accounts so the token can't outlast its TTL
+		account, err = h.auth.VerifyAccessToken(strings.TrimPrefix(ah, "Bearer "))
+		if err != nil {
+			return r, bookstore.Session{}, err
+		}
+		h.logImpersonated(r, account)
+		return r.WithContext(context.WithValue(r.Context(), ctxKey("user"), account)), account, nil
+	case strings.HasPrefix(ah, "Bearer ") && h.auth.AccessTokensEnabled():
+		//the session token is the refresh token then, it stays with the client instead of going along with every request
+		return r, bookstore.Session{}, bookstore.ErrAccessTokenRequired
+	case strings.HasPrefix(ah, "Bearer "):
+		ah = strings.TrimPrefix(ah, "Bearer ")
+		account, err = h.auth.GetSession(r.Context(), ah)
+	case strings.HasPrefix(ah, "ApiKey "):
+		account, err = h.auth.GetAPIKeySession(r.Context(), strings.TrimPrefix(ah, "ApiKey "))
+	default:
 		return r, bookstore.Session{}, bookstore.ErrMalformedSession
 	}
-	ah = strings.TrimPrefix(ah, "Bearer ")
+	if err != nil {
+		return r, bookstore.Session{}, err
+	}
+	if account.Suspended(time.Now()) {
+		//suspending revokes the sessions, but api keys are kept for when the suspension ends
+		return r, bookstore.Session{}, bookstore.NewAccountSuspendedError(account.Suspension)
+	}
 
-	account, err := h.auth.GetSession(r.Context(), ah)
+	//permissions are looked up on every request, so role changes apply to existing sessions immediately
+	perms, err := h.sessionPermissions(r.Context(), account)
 	if err != nil {
 		return r, bookstore.Session{}, err
 	}
+	if account.APIKey != nil {
+		//api keys only get the permissions in their scope, that the account still holds
+		scoped := make([]bookstore.Permission, 0, len(perms))
+		for _, perm := range perms {
+			if account.APIKey.Scope.Contains(perm) {
+				scoped = append(scoped, perm)
+			}
+		}
+		perms = scoped
+	}
+	account.Permissions = perms
+	h.logImpersonated(r, account)
+
 	r = r.WithContext(context.WithValue(r.Context(), ctxKey("user"), account))
-	r = r.WithContext(context.WithValue(r.Context(), ctxKey("token"), ah))
+	if account.APIKey == nil {
+		//there is no session token to revoke when using api keys
+		r = r.WithContext(context.WithValue(r.Context(), ctxKey("token"), ah))
+	}
 	return r, account, nil
 }
 
@@ -201,6 +417,16 @@ func GetSessionAndToken(ctx context.Context) (bookstore.Session, string, bool) {
 	return ses, tok, okU && okT
 }
 
+// clientIP returns the address of the client without the port
+// when running behind a proxy, middleware.RealIP should be used to populate RemoteAddr
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // validateISBN validates ISBN upon book creation
 // h.ignoreInvalidIBSN allows ignoring validating ISBN checksum
 func (h *Handler) validateISBN(id string) (string, error) {
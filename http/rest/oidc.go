@@ -0,0 +1,272 @@
+package rest
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/thanhpk/randstr"
+	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/oidc"
+)
+
+// oidcProvider is an OpenID Connect identity provider accounts can log in with
+type oidcProvider struct {
+	client oidcClient
+	//provision creates accounts for unknown users on their first login
+	provision bool
+	//groupRoles maps the groups of the provider to roles, see Handler.syncGroupRoles
+	groupRoles map[string]string
+}
+
+var ctxOIDCProviderKey = ctxKey("oidc-provider")
+
+// OIDCProviderCtx populates the configured provider into context from url param
+func (h *Handler) OIDCProviderCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "provider")
+		if _, ok := h.oidcProviders[name]; !ok {
+			_ = render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ctxOIDCProviderKey, name)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// oidcStateCookie holds the state of the login started by the browser, see Handler.StartOIDCLogin
+const oidcStateCookie = "oidc_state"
+
+// StartOIDCLogin redirects to the identity provider to log in
+// the state is also set as a cookie, so the callback only completes in the browser which started the login
+func (h *Handler) StartOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	name := r.Context().Value(ctxOIDCProviderKey).(string)
+	provider := h.oidcProviders[name]
+
+	state, pending, err := h.auth.CreateOIDCState(r.Context(), name)
+	if err != nil {
+		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
+	http.SetCookie(w, h.oidcStateCookie(r, state, time.Until(pending.ExpiresAt)))
+	http.Redirect(w, r, provider.client.AuthCodeURL(state, pending.Nonce, pending.CodeVerifier), http.StatusFound)
+}
+
+// FinishOIDCLogin is where the identity provider redirects back to, it logs into the account linked to the user
+// the state has to match the cookie set by StartOIDCLogin, otherwise anyone could get a victim logged into their account
+// by sending them a callback of their own, the nonce is stored along with the state so it's bound to the browser too
+// unknown users are linked to the account with the same email when the provider has verified it, unless the account
+// has two-factor authentication or any role, as logging in through the provider would skip its checks,
+// otherwise a new account is created if the provider allows provisioning and anyone can sign up
+// two-factor authentication is left to the provider, as is throttling failed logins
+func (h *Handler) FinishOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	name := r.Context().Value(ctxOIDCProviderKey).(string)
+	provider := h.oidcProviders[name]
+
+	query := r.URL.Query()
+	//the state is single use either way, so the cookie is of no use past this point
+	http.SetCookie(w, h.oidcStateCookie(r, "", 0))
+	if errCode := query.Get("error"); errCode != "" {
+		_ = render.Render(w, r, ErrOIDCLogin(fmt.Errorf("provider returned %s: %s", errCode, query.Get("error_description"))))
+		return
+	}
+	if query.Get("state") == "" || query.Get("code") == "" {
+		_ = render.Render(w, r, ErrInvalidRequest(errors.New("missing state or code")))
+		return
+	}
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(query.Get("state"))) != 1 {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrInvalidOIDCState))
+		return
+	}
+
+	pending, err := h.auth.ConsumeOIDCState(r.Context(), query.Get("state"))
+	if err != nil {
+		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
+	//a state issued for another provider could otherwise be used to skip its checks
+	if pending.Provider != name {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrInvalidOIDCState))
+		return
+	}
+
+	claims, err := provider.client.Exchange(r.Context(), query.Get("code"), pending.CodeVerifier, pending.Nonce)
+	if err != nil {
+		_ = render.Render(w, r, ErrOIDCLogin(err))
+		return
+	}
+
+	acc, err := h.oidcAccount(r.Context(), name, provider, claims)
+	if err != nil {
+		var noResErr *bookstore.NoResultError
+		switch {
+		case errors.As(err, &noResErr):
+			_ = render.Render(w, r, ErrOIDCNoAccount)
+		case errors.Is(err, bookstore.ErrOIDCLinkRefused):
+			_ = render.Render(w, r, ErrOIDCLinkRefused)
+		default:
+			_ = render.Render(w, r, ErrQueryResponse(err))
+		}
+		return
+	}
+	if err := h.syncGroupRoles(r.Context(), acc.ID, provider.groupRoles, claims.Groups); err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	tok, ses, err := h.auth.CreateSession(r.Context(), acc, clientIP(r), r.UserAgent())
+	if err != nil {
+		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
+
+	//the callback is always reached by a browser, so the cookie is used whenever it's enabled
+	h.renderSessionCreated(w, r, tok, ses, true)
+}
+
+// oidcAccount finds the account linked to the user, linking or provisioning one if there is none
+func (h *Handler) oidcAccount(ctx context.Context, name string, provider oidcProvider, claims oidc.Claims) (bookstore.Account, error) {
+	acc, err := h.store.GetAccountByIdentity(ctx, name, claims.Subject)
+	var noResErr *bookstore.NoResultError
+	if err == nil || !errors.As(err, &noResErr) {
+		return acc, err
+	}
+	//without a verified email, we can't tell whether the user owns the account using it
+	if claims.Email == "" || !claims.EmailVerified {
+		return bookstore.Account{}, err
+	}
+
+	acc, err = h.store.GetAccountByEmail(ctx, claims.Email)
+	//provisioning is signing up, so it follows the registration policy, there's no way to hand over an invite though
+	if errors.As(err, &noResErr) && provider.provision && h.registration == RegistrationOpen && h.emailDomainAllowed(claims.Email) {
+		acc, err = h.provisionAccount(ctx, claims)
+	} else if err == nil {
+		err = h.checkOIDCLink(ctx, acc)
+	}
+	if err != nil {
+		return bookstore.Account{}, err
+	}
+
+	err = h.store.CreateIdentity(ctx, bookstore.Identity{Provider: name, Subject: claims.Subject, AccountID: acc.ID})
+	if err != nil {
+		return bookstore.Account{}, err
+	}
+	return acc, nil
+}
+
+// checkOIDCLink refuses linking the existing account to a user of the identity provider by their email
+// the provider logs in without the password, so accounts guarded by more than that can't be linked by it:
+// two-factor authentication would be skipped, and roles make the account worth taking over through the provider
+func (h *Handler) checkOIDCLink(ctx context.Context, acc bookstore.Account) error {
+	twoFactor, _, err := h.auth.TwoFactorStatus(ctx, acc.ID)
+	if err != nil {
+		return err
+	}
+	roles, err := h.store.ListAccountRoles(ctx, acc.ID)
+	if err != nil {
+		return err
+	}
+	if twoFactor || len(roles) > 0 {
+		return bookstore.ErrOIDCLinkRefused
+	}
+	return nil
+}
+
+// oidcStateCookie creates the cookie holding the state, an empty value removes it
+// it's limited to the paths of the provider, and has to be sent along with the redirect back from the provider,
+// which is a cross-site navigation, so it's always lax
+func (h *Handler) oidcStateCookie(r *http.Request, state string, maxAge time.Duration) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     strings.TrimSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/callback"),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || h.sessionCookie != nil && h.sessionCookie.secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if state == "" || maxAge <= 0 {
+		cookie.MaxAge = -1
+	} else {
+		cookie.MaxAge = int(maxAge.Seconds())
+	}
+	return cookie
+}
+
+// provisionAccount creates an account for the user of the identity provider
+// the account gets an unguessable password, one can be set through a password reset later
+func (h *Handler) provisionAccount(ctx context.Context, claims oidc.Claims) (bookstore.Account, error) {
+	hash, err := h.auth.Hash(randstr.Base62(32))
+	if err != nil {
+		return bookstore.Account{}, err
+	}
+	account := bookstore.Account{Name: claims.Name, Email: claims.Email, PasswordHash: hash}
+	if account.Name == "" {
+		account.Name = claims.Email
+	}
+	created, err := h.store.CreateAccount(ctx, account)
+	if err != nil {
+		return bookstore.Account{}, err
+	}
+
+	//only verified emails make it this far
+	now := time.Now()
+	err = h.store.MarkEmailVerified(ctx, created.ID, created.Email, now)
+	if err != nil {
+		return bookstore.Account{}, err
+	}
+	created.EmailVerifiedAt = &now
+	return created, nil
+}
+
+// syncGroupRoles grants the roles mapped to the groups of the user, and removes the mapped roles of groups they are no longer in
+// roles outside the mapping are left alone, so they can still be managed by hand
+func (h *Handler) syncGroupRoles(ctx context.Context, accountID uuid.UUID, groupRoles map[string]string, groups []string) error {
+	if len(groupRoles) == 0 {
+		return nil
+	}
+	granted := make(map[string]struct{})
+	for _, group := range groups {
+		if role, ok := groupRoles[group]; ok {
+			granted[role] = struct{}{}
+		}
+	}
+	mapped := make(map[string]struct{}, len(groupRoles))
+	for _, role := range groupRoles {
+		mapped[role] = struct{}{}
+	}
+
+	current, err := h.store.ListAccountRoles(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	for _, role := range current {
+		_, isMapped := mapped[role.Name]
+		_, isGranted := granted[role.Name]
+		if isMapped && !isGranted {
+			if err := h.store.RemoveAccountRole(ctx, accountID, role.Name); err != nil {
+				return err
+			}
+		}
+	}
+	for role := range granted {
+		if err := h.store.AddAccountRole(ctx, accountID, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// oidcClient is a minimal interface of oidc.Provider
+type oidcClient interface {
+	AuthCodeURL(state string, nonce string, verifier string) string
+	Exchange(ctx context.Context, code string, verifier string, nonce string) (oidc.Claims, error)
+}
@@ -0,0 +1,292 @@
+package rest_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thanhpk/randstr"
+	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/http/rest"
+	"github.com/thunder33345/bookstore/oidc"
+)
+
+// stubIdP is an identity provider which logs in whoever the test tells it to, see stubIdP.authorize
+type stubIdP struct {
+	*httptest.Server
+	t   *testing.T
+	key *ecdsa.PrivateKey
+
+	mu sync.Mutex
+	//codes are the pending logins by their code
+	codes map[string]stubLogin
+}
+
+// stubLogin is a login waiting for its code to be exchanged
+type stubLogin struct {
+	nonce     string
+	challenge string
+	claims    map[string]any
+}
+
+// newStubIdP starts an identity provider which is closed along with the test
+func newStubIdP(t *testing.T) *stubIdP {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &stubIdP{t: t, key: key, codes: make(map[string]stubLogin)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "EC", "kid": "stub", "use": "sig", "crv": "P-256",
+			"x": base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			"y": base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// provider connects to the identity provider as the bookstore client
+func (idp *stubIdP) provider() *oidc.Provider {
+	idp.t.Helper()
+	p, err := oidc.NewProvider(context.Background(), oidc.Config{Issuer: idp.URL, ClientID: "bookstore"}, idp.Client())
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return p
+}
+
+// authorize logs the user in as if they went through the login page, authURL is where the bookstore redirected to
+// it returns the code to hand back to the callback
+func (idp *stubIdP) authorize(authURL string, claims map[string]any) string {
+	idp.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		idp.t.Fatalf("got code_challenge_method %q, want S256", query.Get("code_challenge_method"))
+	}
+	code := randstr.Hex(16)
+	idp.mu.Lock()
+	idp.codes[code] = stubLogin{nonce: query.Get("nonce"), challenge: query.Get("code_challenge"), claims: claims}
+	idp.mu.Unlock()
+	return code
+}
+
+// token exchanges the code for an ID token, once the PKCE verifier checks out
+func (idp *stubIdP) token(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	login, ok := idp.codes[r.PostFormValue("code")]
+	delete(idp.codes, r.PostFormValue("code"))
+	idp.mu.Unlock()
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != login.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := map[string]any{"iss": idp.URL, "aud": "bookstore", "exp": time.Now().Add(time.Minute).Unix(), "nonce": login.nonce}
+	for name, value := range login.claims {
+		claims[name] = value
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "stub"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sigR, sigS, err := ecdsa.Sign(rand.Reader, idp.key, digest[:])
+	if err != nil {
+		idp.t.Error(err)
+		return
+	}
+	sig := append(sigR.FillBytes(make([]byte, 32)), sigS.FillBytes(make([]byte, 32))...)
+	_ = json.NewEncoder(w).Encode(map[string]string{"id_token": signed + "." + base64.RawURLEncoding.EncodeToString(sig)})
+}
+
+// oidcLogin goes through logging in with the provider, sending the state cookie back unless it's replaced by stateCookie
+func (s *testServer) oidcLogin(idp *stubIdP, claims map[string]any, stateCookie *http.Cookie) *http.Response {
+	s.t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	start, err := client.Get(s.URL + "/api/v1/account/oidc/stub")
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	_ = start.Body.Close()
+	if start.StatusCode != http.StatusFound {
+		s.t.Fatalf("starting login: got status %d, want %d", start.StatusCode, http.StatusFound)
+	}
+	location := start.Header.Get("Location")
+	u, _ := url.Parse(location)
+	code := idp.authorize(location, claims)
+
+	req, _ := http.NewRequest(http.MethodGet, s.URL+"/api/v1/account/oidc/stub/callback?"+
+		url.Values{"state": {u.Query().Get("state")}, "code": {code}}.Encode(), nil)
+	if stateCookie == nil {
+		for _, cookie := range start.Cookies() {
+			if cookie.Name == "oidc_state" {
+				stateCookie = cookie
+			}
+		}
+	}
+	if stateCookie != nil {
+		req.AddCookie(stateCookie)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+// expectStatus fails the test unless the response has the status
+func expectStatus(t *testing.T, resp *http.Response, status int) {
+	t.Helper()
+	if resp.StatusCode != status {
+		var body rest.ErrResponse
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		t.Fatalf("got status %d, want %d: %s", resp.StatusCode, status, body.MessageText)
+	}
+}
+
+// oidcClaims are the claims of a user with a verified email
+func oidcClaims(subject string, email string, groups ...string) map[string]any {
+	return map[string]any{"sub": subject, "email": email, "email_verified": true, "name": "Tester", "groups": groups}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newStubIdP(t)
+	s := newTestServer(t, testConfig{rest: []rest.Option{
+		rest.WithOIDCProvider("stub", idp.provider(), true, map[string]string{"editors": "editor"}),
+	}})
+
+	resp := s.oidcLogin(idp, oidcClaims("user-1", "new@example.com", "editors"), nil)
+	expectStatus(t, resp, http.StatusOK)
+	var ses testSession
+	if err := json.NewDecoder(resp.Body).Decode(&ses); err != nil {
+		t.Fatal(err)
+	}
+	var account struct {
+		Email       string   `json:"email"`
+		Permissions []string `json:"permissions"`
+	}
+	s.expect(http.StatusOK, &account, http.MethodGet, "/account", ses.Token, nil)
+	if account.Email != "new@example.com" || len(account.Permissions) == 0 {
+		t.Errorf("got account %+v, want it provisioned with the permissions of the editor role", account)
+	}
+
+	//the subject is what's linked, the email can change at the provider
+	resp = s.oidcLogin(idp, oidcClaims("user-1", "renamed@example.com"), nil)
+	expectStatus(t, resp, http.StatusOK)
+	var again testSession
+	_ = json.NewDecoder(resp.Body).Decode(&again)
+	if again.Account.ID != ses.Account.ID {
+		t.Errorf("logged into account %s, want %s", again.Account.ID, ses.Account.ID)
+	}
+	s.expect(http.StatusOK, &account, http.MethodGet, "/account", again.Token, nil)
+	if len(account.Permissions) != 0 {
+		t.Errorf("got permissions %v after leaving the group, want none", account.Permissions)
+	}
+
+	//unverified emails aren't trusted for creating or linking accounts
+	unverified := oidcClaims("user-2", "unverified@example.com")
+	unverified["email_verified"] = false
+	expectStatus(t, s.oidcLogin(idp, unverified, nil), http.StatusForbidden)
+}
+
+func TestOIDCLoginCSRF(t *testing.T) {
+	idp := newStubIdP(t)
+	s := newTestServer(t, testConfig{rest: []rest.Option{rest.WithOIDCProvider("stub", idp.provider(), true, nil)}})
+
+	//an attacker starting a login of their own can't have it finished by someone else's browser
+	expectStatus(t, s.oidcLogin(idp, oidcClaims("attacker", "attacker@example.com"), &http.Cookie{Name: "other"}), http.StatusUnauthorized)
+	expectStatus(t, s.oidcLogin(idp, oidcClaims("attacker", "attacker@example.com"),
+		&http.Cookie{Name: "oidc_state", Value: "state-of-another-login"}), http.StatusUnauthorized)
+	expectStatus(t, s.oidcLogin(idp, oidcClaims("attacker", "attacker@example.com"), nil), http.StatusOK)
+}
+
+func TestOIDCLink(t *testing.T) {
+	idp := newStubIdP(t)
+	s := newTestServer(t, testConfig{rest: []rest.Option{rest.WithOIDCProvider("stub", idp.provider(), false, nil)}})
+	plain := s.signup("plain@example.com")
+	s.admin("admin@example.com")
+	guarded := s.signup("guarded@example.com")
+	s.enrollTwoFactor(guarded.Token)
+
+	resp := s.oidcLogin(idp, oidcClaims("user-1", "plain@example.com"), nil)
+	expectStatus(t, resp, http.StatusOK)
+	var ses testSession
+	_ = json.NewDecoder(resp.Body).Decode(&ses)
+	if ses.Account.ID != plain.Account.ID {
+		t.Errorf("logged into account %s, want the one using the email", ses.Account.ID)
+	}
+
+	//logging in through the provider would skip the second factor, and roles make the account worth taking over
+	expectStatus(t, s.oidcLogin(idp, oidcClaims("user-2", "admin@example.com"), nil), http.StatusForbidden)
+	expectStatus(t, s.oidcLogin(idp, oidcClaims("user-3", "guarded@example.com"), nil), http.StatusForbidden)
+	//without provisioning, unknown emails can't log in
+	expectStatus(t, s.oidcLogin(idp, oidcClaims("user-4", "unknown@example.com"), nil), http.StatusForbidden)
+}
+
+func TestOIDCRegistrationPolicy(t *testing.T) {
+	for _, policy := range []rest.RegistrationPolicy{rest.RegistrationClosed, rest.RegistrationInviteOnly} {
+		t.Run(string(policy), func(t *testing.T) {
+			idp := newStubIdP(t)
+			s := newTestServer(t, testConfig{rest: []rest.Option{
+				rest.WithOIDCProvider("stub", idp.provider(), true, nil), rest.WithRegistration(policy),
+			}})
+			expectStatus(t, s.oidcLogin(idp, oidcClaims("user-1", "new@example.com"), nil), http.StatusForbidden)
+
+			//existing accounts can still log in
+			if _, err := s.db.CreateAccount(context.Background(), bookstore.Account{Name: "Tester", Email: "existing@example.com", PasswordHash: "unusable"}); err != nil {
+				t.Fatal(err)
+			}
+			expectStatus(t, s.oidcLogin(idp, oidcClaims("user-2", "existing@example.com"), nil), http.StatusOK)
+		})
+	}
+}
+
+func TestOIDCCloseAccount(t *testing.T) {
+	idp := newStubIdP(t)
+	s := newTestServer(t, testConfig{rest: []rest.Option{rest.WithOIDCProvider("stub", idp.provider(), true, nil)}})
+	plain := s.signup("plain@example.com")
+
+	resp := s.oidcLogin(idp, oidcClaims("user-1", "new@example.com"), nil)
+	expectStatus(t, resp, http.StatusOK)
+	var ses testSession
+	_ = json.NewDecoder(resp.Body).Decode(&ses)
+
+	//accounts with a password still need it
+	s.expect(http.StatusForbidden, nil, http.MethodDelete, "/account", plain.Token, map[string]string{})
+
+	//provisioned accounts don't know their password, logging in through the provider shortly before stands in for it
+	stale := s.storeSession(ses.Account, bookstore.SessionMeta{CreatedAt: time.Now().Add(-time.Hour), LastSeenAt: time.Now()})
+	s.expect(http.StatusForbidden, nil, http.MethodDelete, "/account", stale, map[string]string{})
+	s.expect(http.StatusNoContent, nil, http.MethodDelete, "/account", ses.Token, map[string]string{})
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/account", ses.Token, nil)
+}
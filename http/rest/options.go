@@ -1,5 +1,11 @@
 package rest
 
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
 // Option is a callable that modifies the Handler's parameter
 type Option func(h Handler) Handler
 
@@ -25,3 +31,107 @@ func WithMinPasswordEntropy(minEntropy float64) Option {
 		return h
 	}
 }
+
+// WithMailer sets the mailer used to send password reset and email verification emails
+// neither is available without one
+func WithMailer(m mailer) Option {
+	return func(h Handler) Handler {
+		h.mailer = m
+		return h
+	}
+}
+
+// WithPasswordResetURL sets the page linked in password reset emails, the token is added as the token query parameter
+func WithPasswordResetURL(url string) Option {
+	return func(h Handler) Handler {
+		h.passwordResetURL = url
+		return h
+	}
+}
+
+// WithVerifyEmailURL sets the page linked in email verification emails, the token is added as the token query parameter
+func WithVerifyEmailURL(url string) Option {
+	return func(h Handler) Handler {
+		h.verifyEmailURL = url
+		return h
+	}
+}
+
+// WithRequireVerifiedEmail blocks accounts that haven't verified their email from the catalog endpoints
+func WithRequireVerifiedEmail(b bool) Option {
+	return func(h Handler) Handler {
+		h.requireVerifiedEmail = b
+		return h
+	}
+}
+
+// WithRegistration sets who can sign up through CreateAccount, RegistrationOpen by default
+// admins can always create accounts, regardless of the policy
+func WithRegistration(policy RegistrationPolicy) Option {
+	return func(h Handler) Handler {
+		h.registration = policy
+		return h
+	}
+}
+
+// WithAllowedEmailDomains only allows signing up, or changing the email of an account, to emails on the domains
+// it also applies to accounts provisioned through identity providers
+func WithAllowedEmailDomains(domains ...string) Option {
+	return func(h Handler) Handler {
+		h.allowedEmailDomains = make([]string, 0, len(domains))
+		for _, domain := range domains {
+			h.allowedEmailDomains = append(h.allowedEmailDomains, strings.ToLower(domain))
+		}
+		return h
+	}
+}
+
+// WithErrorHandler sets where errors from background work are reported, such as failing to send an email
+func WithErrorHandler(onErr func(err error)) Option {
+	return func(h Handler) Handler {
+		h.onErr = onErr
+		return h
+	}
+}
+
+// WithImpersonationLog sets where requests made through impersonation sessions are reported, they are dropped by default
+func WithImpersonationLog(log func(req ImpersonatedRequest)) Option {
+	return func(h Handler) Handler {
+		h.onImpersonated = log
+		return h
+	}
+}
+
+// WithOIDCProvider adds an identity provider accounts can log in with on /account/oidc/{name}
+// provision creates accounts for users logging in for the first time,
+// groupRoles grants roles based on the groups of the user, keeping them in sync on every login
+func WithOIDCProvider(name string, client oidcClient, provision bool, groupRoles map[string]string) Option {
+	return func(h Handler) Handler {
+		providers := make(map[string]oidcProvider, len(h.oidcProviders)+1)
+		for n, p := range h.oidcProviders {
+			providers[n] = p
+		}
+		providers[name] = oidcProvider{client: client, provision: provision, groupRoles: groupRoles}
+		h.oidcProviders = providers
+		return h
+	}
+}
+
+// WithMaxCoverUpload sets the largest cover file accepted, which should match the limit of the cover processor
+// the request body is cut off just above it, so oversized uploads aren't read whole, 0 removes the limit
+func WithMaxCoverUpload(maxBytes int64) Option {
+	return func(h Handler) Handler {
+		h.maxCoverUpload = maxBytes
+		return h
+	}
+}
+
+// WithSessionCookie allows logging in with the session token set as an HttpOnly cookie, for browser clients
+// the cookie is used when there's no Authorization header, changes made with it need the CSRF token in the X-CSRF-Token header
+// maxAge of 0 makes it last until the browser is closed
+func WithSessionCookie(name string, maxAge time.Duration, secure bool, sameSite http.SameSite) Option {
+	return func(h Handler) Handler {
+		h.sessionCookie = &sessionCookie{name: name, maxAge: maxAge, secure: secure, sameSite: sameSite}
+		return h
+	}
+}
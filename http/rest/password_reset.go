@@ -0,0 +1,141 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/thunder33345/bookstore"
+	passwordvalidator "github.com/wagslane/go-password-validator"
+)
+
+// RequestPasswordReset emails a password reset link to the account holder
+// the response is always the same, so it can't be used to find out which emails are registered
+func (h *Handler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	if h.mailer == nil {
+		_ = render.Render(w, r, ErrMailUnavailable)
+		return
+	}
+	data := &PasswordResetRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	//the lookup and sending happens in the background, otherwise the response time would give away whether the account exists
+	go h.sendPasswordReset(data.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ConfirmPasswordReset sets a new password using the token from the reset email
+// every session of the account is logged out afterwards
+func (h *Handler) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	data := &PasswordResetConfirmRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	//we validate the password first, so a weak password doesn't use up the token
+	if err := passwordvalidator.Validate(data.Password, h.minPWEntropy); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	accountID, err := h.auth.ConsumePasswordReset(r.Context(), data.Token)
+	if err != nil {
+		if errors.Is(err, bookstore.ErrInvalidResetToken) {
+			_ = render.Render(w, r, ErrInvalidResetToken)
+			return
+		}
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	acc, err := h.store.GetAccount(r.Context(), accountID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	acc.PasswordHash, err = h.auth.Hash(data.Password)
+	if err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	err = h.store.UpdateAccount(r.Context(), acc)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	//whoever knew the old password shouldn't stay logged in
+	err = h.auth.DeleteSessionFor(r.Context(), acc.ID)
+	if err != nil {
+		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendPasswordReset creates a reset token for the account of the email and mails the link to it
+// unknown emails are silently ignored, other errors are handed to Handler.onErr
+func (h *Handler) sendPasswordReset(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	acc, err := h.store.GetAccountByEmail(ctx, email)
+	if err != nil {
+		var noResErr *bookstore.NoResultError
+		if !errors.As(err, &noResErr) {
+			h.onErr(fmt.Errorf("requesting password reset: %w", err))
+		}
+		return
+	}
+
+	token, err := h.auth.CreatePasswordReset(ctx, acc)
+	if err != nil {
+		h.onErr(fmt.Errorf("requesting password reset: %w", err))
+		return
+	}
+
+	link := h.passwordResetURL + "?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Hi %s,\n\nSomeone requested a password reset for your account.\n"+
+		"Use the link below to set a new password, it can only be used once and expires soon.\n\n%s\n\n"+
+		"If you didn't request this, you can safely ignore this email.\n", acc.Name, link)
+	err = h.mailer.Send(ctx, acc.Email, "Reset your password", body)
+	if err != nil {
+		h.onErr(fmt.Errorf("sending password reset: %w", err))
+	}
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+func (p *PasswordResetRequest) Bind(_ *http.Request) error {
+	if p.Email == "" {
+		return errors.New("no email provided")
+	}
+	return nil
+}
+
+type PasswordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (p *PasswordResetConfirmRequest) Bind(_ *http.Request) error {
+	if p.Token == "" {
+		return errors.New("no token provided")
+	}
+	if p.Password == "" {
+		return errors.New("no password provided")
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package rest_test
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thunder33345/bookstore/auth"
+	"github.com/thunder33345/bookstore/http/rest"
+	"github.com/thunder33345/bookstore/mail"
+)
+
+// linkToken matches the token of the links sent by email
+var linkToken = regexp.MustCompile(`\?token=(\S+)`)
+
+// mailedToken waits until the address got count emails with the subject, returning the token of the link in the last one
+// emails are sent in the background, so they show up some time after the response
+func mailedToken(t *testing.T, outbox *mail.Outbox, to string, subject string, count int) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var sent []mail.Message
+		for _, msg := range outbox.Messages() {
+			if msg.To == to && msg.Subject == subject {
+				sent = append(sent, msg)
+			}
+		}
+		if len(sent) >= count {
+			match := linkToken.FindStringSubmatch(sent[count-1].Body)
+			if match == nil {
+				t.Fatalf("got email without a link: %s", sent[count-1].Body)
+			}
+			token, err := url.QueryUnescape(match[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d emails to %s about %q, want %d", len(sent), to, subject, count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+const resetSubject = "Reset your password"
+
+// newMailServer starts a test server sending its emails into the returned outbox
+func newMailServer(t *testing.T, cfg testConfig) (*testServer, *mail.Outbox) {
+	t.Helper()
+	outbox, err := mail.NewOutbox("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.rest = append(cfg.rest, rest.WithMailer(outbox),
+		rest.WithPasswordResetURL("https://example.com/reset"), rest.WithVerifyEmailURL("https://example.com/verify"))
+	return newTestServer(t, cfg), outbox
+}
+
+// expectInvalidToken confirms the password reset, failing the test unless the token is refused
+func (s *testServer) expectInvalidToken(token string) {
+	s.t.Helper()
+	var body rest.ErrResponse
+	s.expect(http.StatusBadRequest, &body, http.MethodPost, "/account/password-reset/confirm", "",
+		map[string]string{"token": token, "password": "another-" + testPassword})
+	if !strings.Contains(body.MessageText, "reset token") {
+		s.t.Errorf("got %q, want the token refused", body.MessageText)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	s, outbox := newMailServer(t, testConfig{})
+	user := s.signup("reader@example.com")
+
+	//unknown emails get the same response, without anything being sent
+	s.expect(http.StatusAccepted, nil, http.MethodPost, "/account/password-reset", "", map[string]string{"email": "nobody@example.com"})
+	s.expect(http.StatusAccepted, nil, http.MethodPost, "/account/password-reset", "", map[string]string{"email": "reader@example.com"})
+	first := mailedToken(t, outbox, "reader@example.com", resetSubject, 1)
+	//requesting again replaces the token
+	s.expect(http.StatusAccepted, nil, http.MethodPost, "/account/password-reset", "", map[string]string{"email": "reader@example.com"})
+	token := mailedToken(t, outbox, "reader@example.com", resetSubject, 2)
+	s.expectInvalidToken(first)
+
+	//a weak password doesn't use the token up
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, "/account/password-reset/confirm", "",
+		map[string]string{"token": token, "password": "password"})
+	s.expect(http.StatusNoContent, nil, http.MethodPost, "/account/password-reset/confirm", "",
+		map[string]string{"token": token, "password": "new-" + testPassword})
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/account", user.Token, nil)
+	s.login(http.StatusBadRequest, "reader@example.com", testPassword)
+	s.login(http.StatusOK, "reader@example.com", "new-"+testPassword)
+
+	//tokens are single use
+	s.expectInvalidToken(token)
+	s.login(http.StatusOK, "reader@example.com", "new-"+testPassword)
+	for _, msg := range outbox.Messages() {
+		if msg.To == "nobody@example.com" {
+			t.Errorf("got email %q to an unknown address", msg.Subject)
+		}
+	}
+}
+
+func TestPasswordResetExpiry(t *testing.T) {
+	s, outbox := newMailServer(t, testConfig{auth: []auth.Option{auth.WithPasswordResetTimeout(time.Millisecond)}})
+	s.signup("reader@example.com")
+
+	s.expect(http.StatusAccepted, nil, http.MethodPost, "/account/password-reset", "", map[string]string{"email": "reader@example.com"})
+	token := mailedToken(t, outbox, "reader@example.com", resetSubject, 1)
+	time.Sleep(2 * time.Millisecond)
+	s.expectInvalidToken(token)
+	s.login(http.StatusOK, "reader@example.com", testPassword)
+}
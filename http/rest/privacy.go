@@ -0,0 +1,255 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/thanhpk/randstr"
+	"github.com/thunder33345/bookstore"
+)
+
+// exportLoginAttemptLimit caps the failed logins included in an export, they are only kept for a while anyway
+const exportLoginAttemptLimit = 1000
+
+// anonymizedName replaces the name of anonymized accounts
+const anonymizedName = "Anonymized user"
+
+// ExportAccount returns everything stored about the current account as a downloadable JSON archive
+func (h *Handler) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	ses, ok := GetSession(r.Context())
+	if !ok {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrMissingSessionData))
+		return
+	}
+
+	export, err := h.exportAccount(r, ses.ID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="bookstore-account-%s.json"`, ses.ID))
+	if err := render.Render(w, r, export); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// exportAccount gathers the account along with its roles, sessions, api keys, linked identities and failed logins
+func (h *Handler) exportAccount(r *http.Request, accountID uuid.UUID) (*AccountExportResponse, error) {
+	ctx := r.Context()
+	acc, err := h.store.GetAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := h.store.ListAccountRoles(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := h.auth.ListSessions(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := h.auth.ListAPIKeys(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := h.store.ListIdentities(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	enabled, remaining, err := h.auth.TwoFactorStatus(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	attempts, err := h.auth.ListLoginAttempts(ctx, acc.Email, exportLoginAttemptLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	//the hash isn't the user's data to take, and it's only useful for cracking the password
+	acc.PasswordHash = ""
+	return &AccountExportResponse{
+		ExportedAt:    time.Now(),
+		Account:       acc,
+		Roles:         nonNil(roles),
+		Sessions:      nonNil(sessions),
+		APIKeys:       nonNil(keys),
+		Identities:    nonNil(identities),
+		TwoFactor:     TwoFactorStatusResponse{Enabled: enabled, RecoveryCodesRemaining: remaining},
+		LoginAttempts: nonNil(attempts),
+	}, nil
+}
+
+// closeReauthWindow is how recently the session has to be created to close the account without the password
+const closeReauthWindow = 5 * time.Minute
+
+// CloseAccount deletes the current account along with everything tied to it
+// the password, and the two-factor code if it's enabled, are required so a stolen session can't delete the account
+// accounts created through an identity provider don't know their password, so logging in again through it shortly before works instead
+func (h *Handler) CloseAccount(w http.ResponseWriter, r *http.Request) {
+	ses, ok := GetSession(r.Context())
+	if !ok {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrMissingSessionData))
+		return
+	}
+	data := &AccountCloseRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	acc, err := h.store.GetAccount(r.Context(), ses.ID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	if data.Password == "" {
+		identities, err := h.store.ListIdentities(r.Context(), ses.ID)
+		if err != nil {
+			_ = render.Render(w, r, ErrQueryResponse(err))
+			return
+		}
+		recent, err := h.recentSession(r.Context(), ses)
+		if err != nil {
+			_ = render.Render(w, r, ErrQueryResponse(err))
+			return
+		}
+		if len(identities) == 0 || !recent {
+			_ = render.Render(w, r, ErrReauthRequired)
+			return
+		}
+	} else if ok, err := h.auth.Validate(acc.PasswordHash, data.Password); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	} else if !ok {
+		_ = render.Render(w, r, ErrInvalidRequest(fmt.Errorf("invalid credentials")))
+		return
+	}
+	enabled, _, err := h.auth.TwoFactorStatus(r.Context(), ses.ID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	if enabled {
+		if data.Code == "" {
+			_ = render.Render(w, r, ErrInvalidRequest(errors.New("no two-factor code provided")))
+			return
+		}
+		if err := h.auth.VerifyTwoFactor(r.Context(), ses.ID, data.Code); err != nil {
+			_ = render.Render(w, r, ErrTwoFactorResponse(err))
+			return
+		}
+	}
+
+	//sessions, api keys and everything else tied to the account are deleted along with it
+	if err := h.store.DeleteAccount(r.Context(), ses.ID); err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	//failed logins are only tied to the email, so they are removed separately
+	if err := h.auth.ForgetLogins(r.Context(), acc.Email); err != nil {
+		h.onErr(fmt.Errorf("forgetting logins of closed account %s: %w", ses.ID, err))
+	}
+	h.clearSessionCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recentSession reports whether the session was created within closeReauthWindow
+// it's looked up by ID, as sessions from access tokens don't carry when they were created
+func (h *Handler) recentSession(ctx context.Context, ses bookstore.Session) (bool, error) {
+	sessions, err := h.auth.ListSessions(ctx, ses.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, meta := range sessions {
+		if meta.ID == ses.Meta.ID {
+			return time.Since(meta.CreatedAt) <= closeReauthWindow, nil
+		}
+	}
+	return false, nil
+}
+
+// AnonymizeUser erases the personal data of the user instead of deleting the account
+// the account is kept with a placeholder name and email, so suspensions, invites and anything else referencing it stay intact,
+// while its sessions, api keys, roles, linked identities and two-factor secret are deleted
+func (h *Handler) AnonymizeUser(w http.ResponseWriter, r *http.Request) {
+	id := r.Context().Value(ctxUUIDKey).(uuid.UUID)
+	if ses, ok := GetSession(r.Context()); ok && ses.ID == id {
+		_ = render.Render(w, r, ErrInvalidRequest(errors.New("can't anonymize your own account, close it instead")))
+		return
+	}
+
+	acc, err := h.store.GetAccount(r.Context(), id)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	if acc.AnonymizedAt != nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	//nobody knows the password, so the account can't be logged into anymore
+	hash, err := h.auth.Hash(randstr.Base62(32))
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	now := time.Now()
+	anonymized := bookstore.Account{
+		ID:           id,
+		Name:         anonymizedName,
+		Email:        id.String() + "@anonymized.invalid",
+		PasswordHash: hash,
+		AnonymizedAt: &now,
+	}
+	if err := h.store.AnonymizeAccount(r.Context(), anonymized); err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	if err := h.auth.ForgetLogins(r.Context(), acc.Email); err != nil {
+		h.onErr(fmt.Errorf("forgetting logins of anonymized account %s: %w", id, err))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type AccountCloseRequest struct {
+	//Password is only optional for accounts linked to an identity provider, as long as they logged in through it recently
+	Password string `json:"password"`
+	//Code is the two-factor code, only required when two-factor authentication is enabled
+	Code string `json:"code"`
+}
+
+func (a *AccountCloseRequest) Bind(_ *http.Request) error {
+	return nil
+}
+
+// AccountExportResponse is everything stored about an account
+type AccountExportResponse struct {
+	ExportedAt    time.Time                `json:"exported_at"`
+	Account       bookstore.Account        `json:"account"`
+	Roles         []bookstore.Role         `json:"roles"`
+	Sessions      []bookstore.SessionMeta  `json:"sessions"`
+	APIKeys       []bookstore.APIKey       `json:"api_keys"`
+	Identities    []bookstore.Identity     `json:"identities"`
+	TwoFactor     TwoFactorStatusResponse  `json:"two_factor"`
+	LoginAttempts []bookstore.LoginAttempt `json:"login_attempts"`
+}
+
+func (ae *AccountExportResponse) Render(_ http.ResponseWriter, _ *http.Request) error {
+	return nil
+}
+
+// nonNil turns nil slices into empty ones, so they are exported as [] instead of null
+func nonNil[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
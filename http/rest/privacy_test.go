@@ -0,0 +1,113 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/thunder33345/bookstore"
+)
+
+func TestAccountExport(t *testing.T) {
+	s := newTestServer(t, testConfig{})
+	user := s.signup("reader@example.com")
+	s.loginAs("reader@example.com", "laptop")
+	if err := s.db.AddAccountRole(context.Background(), user.Account.ID, "editor"); err != nil {
+		t.Fatal(err)
+	}
+	key := s.createAPIKey(user.Token, bookstore.PermissionCatalogWrite)
+	s.login(http.StatusBadRequest, "reader@example.com", "wrong-"+testPassword)
+
+	resp := s.expect(http.StatusOK, nil, http.MethodGet, "/account/export", user.Token, nil)
+	if disposition := resp.Header.Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment;") ||
+		!strings.Contains(disposition, user.Account.ID.String()) {
+		t.Errorf("got Content-Disposition %q, want the export downloaded as a file named after the account", disposition)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]json.RawMessage
+	var export struct {
+		Account       map[string]any           `json:"account"`
+		Roles         []bookstore.Role         `json:"roles"`
+		Sessions      []bookstore.SessionMeta  `json:"sessions"`
+		APIKeys       []bookstore.APIKey       `json:"api_keys"`
+		LoginAttempts []bookstore.LoginAttempt `json:"login_attempts"`
+		TwoFactor     struct {
+			Enabled bool `json:"enabled"`
+		} `json:"two_factor"`
+	}
+	if err = json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, &export); err != nil {
+		t.Fatal(err)
+	}
+
+	if export.Account["email"] != "reader@example.com" || export.Account["password"] != nil {
+		t.Errorf("got account %v, want it without the password hash", export.Account)
+	}
+	if len(export.Roles) != 1 || export.Roles[0].Name != "editor" {
+		t.Errorf("got roles %+v, want the editor role", export.Roles)
+	}
+	if len(export.Sessions) != 2 {
+		t.Errorf("got %d sessions, want the 2 logged in", len(export.Sessions))
+	}
+	if len(export.APIKeys) != 1 || strings.Contains(string(raw["api_keys"]), key) {
+		t.Errorf("got api keys %s, want the one created without the key itself", raw["api_keys"])
+	}
+	if len(export.LoginAttempts) != 1 || export.LoginAttempts[0].Email != "reader@example.com" {
+		t.Errorf("got login attempts %+v, want the failed one", export.LoginAttempts)
+	}
+	//nothing stored is exported as empty, rather than left out
+	if string(raw["identities"]) != "[]" || export.TwoFactor.Enabled {
+		t.Errorf("got identities %s and two-factor %s, want neither set up", raw["identities"], raw["two_factor"])
+	}
+	s.expect(http.StatusForbidden, nil, http.MethodGet, "/account/export", "", nil, "Authorization", "ApiKey "+key)
+}
+
+func TestAnonymizeUser(t *testing.T) {
+	s := newTestServer(t, testConfig{})
+	admin := s.admin("admin@example.com")
+	user := s.signup("reader@example.com")
+	key := s.createAPIKey(user.Token)
+	s.login(http.StatusBadRequest, "reader@example.com", "wrong-"+testPassword)
+	if err := s.db.AddAccountRole(context.Background(), user.Account.ID, "editor"); err != nil {
+		t.Fatal(err)
+	}
+	path := userPath(user.Account.ID, "/anonymize")
+
+	s.expect(http.StatusForbidden, nil, http.MethodPost, userPath(admin.Account.ID, "/anonymize"), user.Token, nil)
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, userPath(admin.Account.ID, "/anonymize"), admin.Token, nil)
+	s.expect(http.StatusNoContent, nil, http.MethodPost, path, admin.Token, nil)
+	//anonymizing again changes nothing
+	s.expect(http.StatusNoContent, nil, http.MethodPost, path, admin.Token, nil)
+
+	//the account is kept, without anything identifying the person behind it
+	var acc bookstore.Account
+	s.expect(http.StatusOK, &acc, http.MethodGet, userPath(user.Account.ID, ""), admin.Token, nil)
+	if acc.Name == user.Account.Name || strings.Contains(acc.Email, "reader") || acc.AnonymizedAt == nil || acc.EmailVerifiedAt != nil {
+		t.Errorf("got account %+v, want its name and email replaced", acc)
+	}
+	var roles []bookstore.Role
+	s.expect(http.StatusOK, &roles, http.MethodGet, userPath(user.Account.ID, "/roles"), admin.Token, nil)
+	if len(roles) != 0 {
+		t.Errorf("got roles %+v, want them removed", roles)
+	}
+	attempts, err := s.auth.ListLoginAttempts(context.Background(), "reader@example.com", 10)
+	if err != nil || len(attempts) != 0 {
+		t.Errorf("got login attempts %+v with error %v, want those of the old email forgotten", attempts, err)
+	}
+
+	//nothing can be used to get back in
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/account", user.Token, nil)
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/account", "", nil, "Authorization", "ApiKey "+key)
+	s.login(http.StatusNotFound, "reader@example.com", testPassword)
+	s.login(http.StatusBadRequest, acc.Email, testPassword)
+	//the email is free to sign up with again
+	s.signup("reader@example.com")
+}
@@ -0,0 +1,93 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// ListRoles lists every role that can be assigned
+func (h *Handler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.store.ListRoles(r.Context())
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, NewListRoleResponse(roles)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// ListUserRoles lists the roles assigned to the user
+func (h *Handler) ListUserRoles(w http.ResponseWriter, r *http.Request) {
+	id := r.Context().Value(ctxUUIDKey).(uuid.UUID)
+
+	//make sure the user exist, otherwise we can't tell it apart from a user without roles
+	_, err := h.store.GetAccount(r.Context(), id)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	roles, err := h.store.ListAccountRoles(r.Context(), id)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, NewListRoleResponse(roles)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// AddUserRole assigns the role to the user
+func (h *Handler) AddUserRole(w http.ResponseWriter, r *http.Request) {
+	id := r.Context().Value(ctxUUIDKey).(uuid.UUID)
+	role := r.Context().Value(ctxRoleKey).(string)
+
+	err := h.store.AddAccountRole(r.Context(), id, role)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveUserRole removes the role from the user
+func (h *Handler) RemoveUserRole(w http.ResponseWriter, r *http.Request) {
+	id := r.Context().Value(ctxUUIDKey).(uuid.UUID)
+	role := r.Context().Value(ctxRoleKey).(string)
+
+	err := h.store.RemoveAccountRole(r.Context(), id, role)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type RoleResponse struct {
+	*bookstore.Role
+}
+
+func NewRoleResponse(role bookstore.Role) *RoleResponse {
+	resp := &RoleResponse{Role: &role}
+	return resp
+}
+
+func (rd *RoleResponse) Render(_ http.ResponseWriter, _ *http.Request) error {
+	return nil
+}
+
+func NewListRoleResponse(roles []bookstore.Role) []render.Renderer {
+	list := make([]render.Renderer, 0, len(roles))
+	for _, role := range roles {
+		list = append(list, NewRoleResponse(role))
+	}
+	return list
+}
@@ -3,6 +3,7 @@ package rest
 import (
 	"context"
 	"io"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -19,6 +20,27 @@ type Handler struct {
 	maxListLimit      int
 	ignoreInvalidIBSN bool
 	minPWEntropy      float64
+	mailer            mailer
+	//passwordResetURL is the page the reset token gets appended to
+	passwordResetURL string
+	//verifyEmailURL is the page the email verification token gets appended to
+	verifyEmailURL string
+	//requireVerifiedEmail blocks accounts without a verified email from the catalog
+	requireVerifiedEmail bool
+	//sessionCookie hands sessions to browsers as cookies when set
+	sessionCookie *sessionCookie
+	//registration decides who can sign up through CreateAccount
+	registration RegistrationPolicy
+	//allowedEmailDomains limits the emails accounts can sign up or switch to, any domain is allowed when empty
+	allowedEmailDomains []string
+	//oidcProviders are the identity providers accounts can log in with, by their name
+	oidcProviders map[string]oidcProvider
+	//maxCoverUpload is the largest cover file accepted, in bytes
+	maxCoverUpload int64
+	//onErr receives errors from background work, where there is no response to report them in
+	onErr func(err error)
+	//onImpersonated receives every request made through an impersonation session
+	onImpersonated func(req ImpersonatedRequest)
 }
 
 // NewHandler creates a new Handler with given parameters
@@ -30,6 +52,10 @@ func NewHandler(store store, cover coverStore, auth authService, options ...Opti
 		defaultListLimit: 50,
 		maxListLimit:     100,
 		minPWEntropy:     65,
+		maxCoverUpload:   10 << 20,
+		registration:     RegistrationOpen,
+		onErr:            func(error) {},
+		onImpersonated:   func(ImpersonatedRequest) {},
 	}
 	for _, option := range options {
 		h = option(h)
@@ -40,67 +66,143 @@ func NewHandler(store store, cover coverStore, auth authService, options ...Opti
 // Mount will mount the whole rest handlers onto the given chi router
 func (h *Handler) Mount(r chi.Router) {
 	r.With(h.MiddlewareAuthenticatedOnly).Group(func(r chi.Router) {
-		r.Route("/genres", func(r chi.Router) {
+		catalogWrite := h.RequirePermission(bookstore.PermissionCatalogWrite)
+		usersRead := h.RequirePermission(bookstore.PermissionUsersRead)
+		usersWrite := h.RequirePermission(bookstore.PermissionUsersWrite)
+
+		r.With(h.MiddlewareVerifiedOnly).Route("/genres", func(r chi.Router) {
 			r.With(h.PaginationLimitMiddleware, h.PaginationUUIDMiddleware).Get("/", h.ListGenres)
-			r.With(h.MiddlewareAdminOnly).Post("/", h.CreateGenre)
+			r.With(catalogWrite).Post("/", h.CreateGenre)
 			r.With(UUIDCtx).Route("/{uuid}", func(r chi.Router) {
 				r.Get("/", h.GetGenre)
-				r.With(h.MiddlewareAdminOnly).Put("/", h.UpdateGenre)
-				r.With(h.MiddlewareAdminOnly).Delete("/", h.DeleteGenre)
+				r.With(catalogWrite).Put("/", h.UpdateGenre)
+				r.With(catalogWrite).Delete("/", h.DeleteGenre)
 			})
 		})
 
-		r.Route("/authors", func(r chi.Router) {
+		r.With(h.MiddlewareVerifiedOnly).Route("/authors", func(r chi.Router) {
 			r.With(h.PaginationLimitMiddleware, h.PaginationUUIDMiddleware).Get("/", h.ListAuthors)
 			r.Group(func(r chi.Router) {
-				r.With(h.MiddlewareAdminOnly).Post("/", h.CreateAuthor)
+				r.With(catalogWrite).Post("/", h.CreateAuthor)
 				r.With(UUIDCtx).Route("/{uuid}", func(r chi.Router) {
 					r.Get("/", h.GetAuthor)
-					r.With(h.MiddlewareAdminOnly).Put("/", h.UpdateAuthor)
-					r.With(h.MiddlewareAdminOnly).Delete("/", h.DeleteAuthor)
+					r.With(catalogWrite).Put("/", h.UpdateAuthor)
+					r.With(catalogWrite).Delete("/", h.DeleteAuthor)
 				})
 			})
 		})
 
-		r.Route("/books", func(r chi.Router) {
+		r.With(h.MiddlewareVerifiedOnly).Route("/books", func(r chi.Router) {
 			r.With(h.PaginationLimitMiddleware, h.PaginationIBSNMiddleware).Get("/", h.ListBooks)
 			r.With(ISBNCtx).Route("/{isbn}", func(r chi.Router) {
 				r.Get("/", h.GetBook)
-				r.With(h.MiddlewareAdminOnly).Group(func(r chi.Router) {
+				r.With(catalogWrite).Group(func(r chi.Router) {
 					r.Post("/", h.CreateBook)
 					r.Put("/", h.UpdateBook)
 					r.Delete("/", h.DeleteBook)
+				})
+				r.With(h.RequirePermission(bookstore.PermissionCoversWrite)).Group(func(r chi.Router) {
 					r.Put("/cover", h.UpdateBookCover)
 					r.Delete("/cover", h.DeleteBookCover)
 				})
 			})
 		})
 
-		r.With(h.MiddlewareAdminOnly).Route("/users", func(r chi.Router) {
-			r.With(h.PaginationLimitMiddleware, h.PaginationUUIDMiddleware).Get("/", h.ListUsers)
-			r.Post("/", h.CreateUser)
+		r.Route("/users", func(r chi.Router) {
+			r.With(usersRead, h.PaginationLimitMiddleware, h.PaginationUUIDMiddleware).Get("/", h.ListUsers)
+			r.With(usersWrite).Post("/", h.CreateUser)
 			r.With(UUIDCtx).Route("/{uuid}", func(r chi.Router) {
-				r.Get("/", h.GetUser)
-				r.Put("/", h.UpdateUser)
-				r.Delete("/", h.DeleteUser)
-				r.Post("/password", h.UpdateUserPassword)
-				r.Delete("/password", h.DeleteUserSessions)
-				r.Delete("/sessions", h.DeleteUserSessions)
+				r.With(usersRead).Get("/", h.GetUser)
+				//accounts can only be changed by those holding every permission of theirs, see MiddlewareOutranksUser
+				r.With(usersWrite, h.MiddlewareOutranksUser).Group(func(r chi.Router) {
+					r.Put("/", h.UpdateUser)
+					r.Delete("/", h.DeleteUser)
+					r.Post("/anonymize", h.AnonymizeUser)
+					r.Post("/password", h.UpdateUserPassword)
+					r.Delete("/password", h.DeleteUserSessions)
+				})
+				r.Route("/sessions", func(r chi.Router) {
+					r.With(usersRead).Get("/", h.ListUserSessions)
+					r.With(usersWrite, h.MiddlewareOutranksUser).Delete("/", h.DeleteUserSessions)
+					r.With(usersWrite, h.MiddlewareOutranksUser, SessionIDCtx).Delete("/{sessionID}", h.RevokeUserSession)
+				})
+				r.With(usersRead, h.PaginationLimitMiddleware).Get("/login-attempts", h.ListUserLoginAttempts)
+				r.With(usersWrite).Post("/unlock", h.UnlockUser)
+				r.With(h.RequirePermission(bookstore.PermissionUsersImpersonate)).Post("/impersonate", h.ImpersonateUser)
+				r.With(usersWrite, h.MiddlewareOutranksUser).Delete("/2fa", h.ResetUserTwoFactor)
+				r.With(usersWrite, h.MiddlewareOutranksUser).Route("/suspend", func(r chi.Router) {
+					r.Post("/", h.SuspendUser)
+					r.Delete("/", h.ReinstateUser)
+				})
+				r.Route("/roles", func(r chi.Router) {
+					r.With(usersRead).Get("/", h.ListUserRoles)
+					//assigning roles needs its own permission, as it can grant any other permission
+					r.With(h.RequirePermission(bookstore.PermissionRolesWrite), RoleCtx).Group(func(r chi.Router) {
+						r.Put("/{role}", h.AddUserRole)
+						r.Delete("/{role}", h.RemoveUserRole)
+					})
+				})
 			})
 		})
+
+		r.With(usersRead).Get("/roles", h.ListRoles)
+
+		r.Route("/invites", func(r chi.Router) {
+			r.With(usersRead).Get("/", h.ListInvites)
+			r.With(usersWrite).Post("/", h.CreateInvite)
+			r.With(usersWrite, InviteIDCtx).Delete("/{inviteID}", h.RevokeInvite)
+		})
 	})
 
 	//this allows user to manage the currently authenticated account
+	//api keys are not accepted here, only the account owner should be able to manage the account
 	r.Route("/account", func(r chi.Router) {
 		r.Post("/", h.CreateAccount)
-		r.With(h.MiddlewareAuthenticatedOnly).Group(func(r chi.Router) {
+		r.With(h.MiddlewareSessionTokenOnly).Group(func(r chi.Router) {
 			r.Get("/", h.GetAccount)
 			r.Put("/", h.UpdateAccount)
-			r.Post("/password", h.UpdateAccountPassword)
+			r.Get("/export", h.ExportAccount)
+			r.With(h.MiddlewareNotImpersonated).Group(func(r chi.Router) {
+				r.Delete("/", h.CloseAccount)
+				r.Post("/password", h.UpdateAccountPassword)
+			})
+		})
+		r.Route("/verify", func(r chi.Router) {
+			r.Post("/", h.VerifyAccountEmail)
+			r.With(h.MiddlewareSessionTokenOnly).Post("/resend", h.ResendAccountVerification)
+		})
+		r.Route("/password-reset", func(r chi.Router) {
+			r.Post("/", h.RequestPasswordReset)
+			r.Post("/confirm", h.ConfirmPasswordReset)
+		})
+		r.With(h.OIDCProviderCtx).Route("/oidc/{provider}", func(r chi.Router) {
+			r.Get("/", h.StartOIDCLogin)
+			r.Get("/callback", h.FinishOIDCLogin)
 		})
 		r.Route("/sessions", func(r chi.Router) {
 			r.Post("/", h.CreateAccountSession)
-			r.With(h.MiddlewareAuthenticatedOnly).Delete("/", h.DeleteAccountSession)
+			r.Post("/2fa", h.CreateAccountTwoFactorSession)
+			r.Post("/refresh", h.RefreshAccountSession)
+			r.With(h.MiddlewareSessionTokenOnly).Group(func(r chi.Router) {
+				r.Get("/", h.ListAccountSessions)
+				r.Delete("/", h.DeleteAccountSession)
+				r.With(SessionIDCtx).Delete("/{sessionID}", h.RevokeAccountSession)
+			})
+		})
+		r.With(h.MiddlewareSessionTokenOnly).Route("/2fa", func(r chi.Router) {
+			r.Get("/", h.GetAccountTwoFactor)
+			r.With(h.MiddlewareNotImpersonated).Group(func(r chi.Router) {
+				r.Post("/", h.EnrollAccountTwoFactor)
+				r.Delete("/", h.DisableAccountTwoFactor)
+				r.Post("/confirm", h.ConfirmAccountTwoFactor)
+				r.Post("/recovery-codes", h.RegenerateAccountRecoveryCodes)
+			})
+		})
+		r.With(h.MiddlewareSessionTokenOnly).Route("/apikeys", func(r chi.Router) {
+			r.Get("/", h.ListAccountAPIKeys)
+			//api keys would outlive the impersonation
+			r.With(h.MiddlewareNotImpersonated).Post("/", h.CreateAccountAPIKey)
+			r.With(APIKeyIDCtx).Delete("/{keyID}", h.RevokeAccountAPIKey)
 		})
 	})
 }
@@ -127,10 +229,22 @@ type store interface {
 	CreateAccount(ctx context.Context, account bookstore.Account) (bookstore.Account, error)
 	GetAccount(ctx context.Context, accountID uuid.UUID) (bookstore.Account, error)
 	GetAccountByEmail(ctx context.Context, email string) (bookstore.Account, error)
+	GetAccountByIdentity(ctx context.Context, provider string, subject string) (bookstore.Account, error)
+	CreateIdentity(ctx context.Context, identity bookstore.Identity) error
+	ListIdentities(ctx context.Context, accountID uuid.UUID) ([]bookstore.Identity, error)
 	ListAccounts(ctx context.Context, limit int, after uuid.UUID) ([]bookstore.Account, error)
 	UpdateAccount(ctx context.Context, account bookstore.Account) error
 	SafeUpdateAccount(ctx context.Context, account bookstore.Account) error
+	MarkEmailVerified(ctx context.Context, accountID uuid.UUID, email string, verifiedAt time.Time) error
+	SuspendAccount(ctx context.Context, accountID uuid.UUID, suspension bookstore.Suspension) error
+	ReinstateAccount(ctx context.Context, accountID uuid.UUID) error
+	AnonymizeAccount(ctx context.Context, account bookstore.Account) error
 	DeleteAccount(ctx context.Context, accountID uuid.UUID) error
+	ListRoles(ctx context.Context) ([]bookstore.Role, error)
+	ListAccountRoles(ctx context.Context, accountID uuid.UUID) ([]bookstore.Role, error)
+	GetAccountPermissions(ctx context.Context, accountID uuid.UUID) ([]bookstore.Permission, error)
+	AddAccountRole(ctx context.Context, accountID uuid.UUID, role string) error
+	RemoveAccountRole(ctx context.Context, accountID uuid.UUID, role string) error
 }
 
 // coverStore is a minimal interface of fs.Store
@@ -139,13 +253,57 @@ type coverStore interface {
 	RemoveCover(ctx context.Context, isbn string) error
 	GetCoverURL(ctx context.Context, isbn string) (string, error)
 	ResolveCoverURL(ctx context.Context, book bookstore.Book) (string, error)
+	ResolveCoverVariantURLs(ctx context.Context, book bookstore.Book) (map[string]string, error)
 }
 
 type authService interface {
 	Hash(password string) (string, error)
 	Validate(hash string, password string) (bool, error)
+	NeedsRehash(hash string) bool
 	GetSession(ctx context.Context, token string) (bookstore.Session, error)
-	CreateSession(ctx context.Context, account bookstore.Account) (string, error)
+	CreateSession(ctx context.Context, account bookstore.Account, ip string, userAgent string) (string, bookstore.Session, error)
+	Impersonate(ctx context.Context, account bookstore.Account, impersonator uuid.UUID, ip string, userAgent string) (string, bookstore.Session, error)
+	RefreshSession(ctx context.Context, token string) (string, bookstore.Session, error)
+	AccessTokensEnabled() bool
+	CreateAccessToken(ses bookstore.Session, permissions []bookstore.Permission) (string, time.Time, error)
+	VerifyAccessToken(token string) (bookstore.Session, error)
 	DeleteSession(ctx context.Context, token string) error
 	DeleteSessionFor(ctx context.Context, user uuid.UUID) error
+	ListSessions(ctx context.Context, user uuid.UUID) ([]bookstore.SessionMeta, error)
+	RevokeSession(ctx context.Context, user uuid.UUID, sessionID uuid.UUID) error
+	CreateAPIKey(ctx context.Context, account bookstore.Account, name string, scope bookstore.Scope, expiresAt *time.Time) (string, bookstore.APIKey, error)
+	GetAPIKeySession(ctx context.Context, key string) (bookstore.Session, error)
+	ListAPIKeys(ctx context.Context, user uuid.UUID) ([]bookstore.APIKey, error)
+	RevokeAPIKey(ctx context.Context, user uuid.UUID, keyID uuid.UUID) error
+	CreatePasswordReset(ctx context.Context, account bookstore.Account) (string, error)
+	ConsumePasswordReset(ctx context.Context, token string) (uuid.UUID, error)
+	CreateEmailVerification(ctx context.Context, account bookstore.Account) (string, error)
+	ConsumeEmailVerification(ctx context.Context, token string) (uuid.UUID, string, error)
+	CheckLogin(ctx context.Context, email string, ip string) error
+	LoginFailed(ctx context.Context, email string, ip string, userAgent string) error
+	LoginSucceeded(ctx context.Context, email string) error
+	UnlockLogin(ctx context.Context, email string) error
+	ForgetLogins(ctx context.Context, email string) error
+	ListLoginAttempts(ctx context.Context, email string, limit int) ([]bookstore.LoginAttempt, error)
+	EnrollTOTP(ctx context.Context, account bookstore.Account) (string, string, error)
+	ConfirmTOTP(ctx context.Context, accountID uuid.UUID, code string) ([]string, error)
+	TwoFactorStatus(ctx context.Context, accountID uuid.UUID) (bool, int, error)
+	VerifyTwoFactor(ctx context.Context, accountID uuid.UUID, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, accountID uuid.UUID) ([]string, error)
+	DisableTwoFactor(ctx context.Context, accountID uuid.UUID) error
+	CreateLoginChallenge(ctx context.Context, account bookstore.Account) (string, time.Time, error)
+	GetLoginChallenge(ctx context.Context, token string) (uuid.UUID, error)
+	DeleteLoginChallenge(ctx context.Context, token string) error
+	CreateOIDCState(ctx context.Context, provider string) (string, bookstore.OIDCState, error)
+	ConsumeOIDCState(ctx context.Context, state string) (bookstore.OIDCState, error)
+	CreateInvite(ctx context.Context, invite bookstore.Invite) (string, bookstore.Invite, error)
+	ListInvites(ctx context.Context) ([]bookstore.Invite, error)
+	RevokeInvite(ctx context.Context, inviteID uuid.UUID) error
+	UseInvite(ctx context.Context, code string, email string) (bookstore.Invite, error)
+	ReleaseInvite(ctx context.Context, inviteID uuid.UUID) error
+}
+
+// mailer is a minimal interface of mail.Mailer
+type mailer interface {
+	Send(ctx context.Context, to string, subject string, body string) error
 }
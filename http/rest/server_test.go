@@ -0,0 +1,221 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/thanhpk/randstr"
+	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/auth"
+	"github.com/thunder33345/bookstore/cover"
+	"github.com/thunder33345/bookstore/cover/fs"
+	"github.com/thunder33345/bookstore/db/memory"
+	"github.com/thunder33345/bookstore/http/rest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testPassword passes the default password entropy check
+const testPassword = "correct-horse-battery-staple-42"
+
+// testServer is the API mounted the way bookstore_server does, over the in memory store
+type testServer struct {
+	*httptest.Server
+	t    *testing.T
+	db   *memory.Store
+	auth *auth.Auth
+}
+
+// testConfig holds the options a test server is created with
+type testConfig struct {
+	auth []auth.Option
+	rest []rest.Option
+	//processor defaults to cover.NewProcessor without options
+	processor *cover.Processor
+}
+
+// newTestServer starts a server which is closed along with the test
+// passwords are hashed with the cheapest bcrypt cost, so tests don't spend their time hashing
+func newTestServer(t *testing.T, cfg testConfig) *testServer {
+	t.Helper()
+	db := memory.New()
+	if err := db.Init(); err != nil {
+		t.Fatal(err)
+	}
+	authService := auth.NewAuth(db, append([]auth.Option{auth.WithHasher(auth.NewBcrypt(bcrypt.MinCost))}, cfg.auth...)...)
+
+	processor := cfg.processor
+	if processor == nil {
+		var err error
+		if processor, err = cover.NewProcessor(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	covers, err := fs.NewStore(t.TempDir(), "/covers/", db, processor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := rest.NewHandler(db, covers, authService, append([]rest.Option{rest.WithErrorHandler(func(err error) {
+		t.Errorf("background task: %v", err)
+	})}, cfg.rest...)...)
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	r.Route("/api/v1/", func(r chi.Router) {
+		r.Use(render.SetContentType(render.ContentTypeJSON))
+		handler.Mount(r)
+	})
+	r.Get("/covers/{image}", covers.HandleCoverRequest)
+	r.Head("/covers/{image}", covers.HandleCoverRequest)
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return &testServer{Server: srv, t: t, db: db, auth: authService}
+}
+
+// request sends a request to the API, body is encoded as JSON unless it's a *bytes.Buffer, which is sent as is
+// token is sent as a bearer token when it's not empty
+func (s *testServer) request(method string, path string, token string, body any, header ...string) *http.Response {
+	s.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case *bytes.Buffer:
+		reader = b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	if !strings.HasPrefix(path, "/covers/") {
+		path = "/api/v1" + path
+	}
+	req, err := http.NewRequest(method, s.URL+path, reader)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+// expect sends the request, failing the test unless it's responded to with the status
+// the response is decoded into out when it's not nil
+func (s *testServer) expect(status int, out any, method string, path string, token string, body any, header ...string) *http.Response {
+	s.t.Helper()
+	resp := s.request(method, path, token, body, header...)
+	if resp.StatusCode != status {
+		data, _ := io.ReadAll(resp.Body)
+		s.t.Fatalf("%s %s: got status %d, want %d: %s", method, path, resp.StatusCode, status, data)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			s.t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+// testSession is the response to logging in
+type testSession struct {
+	Token       string            `json:"token"`
+	Account     bookstore.Account `json:"account"`
+	AccessToken string            `json:"access_token"`
+	Challenge   string            `json:"challenge"`
+}
+
+// signup creates an account using the email and testPassword, returning its session
+func (s *testServer) signup(email string) testSession {
+	s.t.Helper()
+	var ses testSession
+	s.expect(http.StatusOK, &ses, http.MethodPost, "/account", "",
+		map[string]string{"name": "Tester", "email": email, "password": testPassword})
+	return ses
+}
+
+// login logs in using the email and password, failing the test unless it's responded to with the status
+func (s *testServer) login(status int, email string, password string) testSession {
+	s.t.Helper()
+	var ses testSession
+	var out any
+	if status == http.StatusOK || status == http.StatusAccepted {
+		out = &ses
+	}
+	s.expect(status, out, http.MethodPost, "/account/sessions", "",
+		map[string]string{"email": email, "password": password})
+	return ses
+}
+
+// admin signs up an account holding the administrator role
+func (s *testServer) admin(email string) testSession {
+	s.t.Helper()
+	ses := s.signup(email)
+	if err := s.db.AddAccountRole(context.Background(), ses.Account.ID, bookstore.RoleAdministrator); err != nil {
+		s.t.Fatal(err)
+	}
+	return ses
+}
+
+// storeSession stores a session of the account straight into the store, so its timestamps can be made up
+// the ID of meta is generated when it's not set, the token of the session is returned
+func (s *testServer) storeSession(account bookstore.Account, meta bookstore.SessionMeta) string {
+	s.t.Helper()
+	if meta.ID == uuid.Nil {
+		meta.ID = uuid.New()
+	}
+	token := randstr.Base62(32)
+	digest := sha256.Sum256([]byte(token))
+	if err := s.db.StoreSession(context.Background(), hex.EncodeToString(digest[:]), account, meta); err != nil {
+		s.t.Fatal(err)
+	}
+	return token
+}
+
+// userPath is the path of the user under /users
+func userPath(id uuid.UUID, path string) string {
+	return "/users/" + id.String() + path
+}
+
+// totpCode computes the current code of the secret, like an authenticator app would
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:])&0x7fffffff)%1_000_000)
+}
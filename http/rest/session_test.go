@@ -0,0 +1,146 @@
+package rest_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/auth"
+)
+
+// storedSessions returns the sessions of the account kept by the store by their ID, expired ones included
+func (s *testServer) storedSessions(accountID uuid.UUID) map[uuid.UUID]bookstore.SessionMeta {
+	s.t.Helper()
+	list, err := s.db.ListSessions(context.Background(), accountID)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	sessions := make(map[uuid.UUID]bookstore.SessionMeta, len(list))
+	for _, meta := range list {
+		sessions[meta.ID] = meta
+	}
+	return sessions
+}
+
+func TestSessionExpiry(t *testing.T) {
+	s := newTestServer(t, testConfig{auth: []auth.Option{auth.WithIdleTimeout(time.Hour), auth.WithAbsoluteTimeout(24 * time.Hour)}})
+	user := s.signup("reader@example.com")
+	now := time.Now()
+
+	//new sessions expire at the absolute timeout
+	for _, meta := range s.storedSessions(user.Account.ID) {
+		if meta.ExpiresAt == nil || meta.ExpiresAt.Sub(now) < 23*time.Hour || meta.ExpiresAt.Sub(now) > 24*time.Hour {
+			t.Errorf("got session expiring at %v, want it a day from now", meta.ExpiresAt)
+		}
+	}
+
+	expires := now.Add(-time.Minute)
+	expired := s.storeSession(user.Account, bookstore.SessionMeta{CreatedAt: now.Add(-24 * time.Hour), LastSeenAt: now, ExpiresAt: &expires})
+	idle := s.storeSession(user.Account, bookstore.SessionMeta{CreatedAt: now.Add(-2 * time.Hour), LastSeenAt: now.Add(-2 * time.Hour)})
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/account", expired, nil)
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/account", idle, nil)
+
+	//using a session slides its idle timeout forward
+	activeID := uuid.New()
+	active := s.storeSession(user.Account, bookstore.SessionMeta{ID: activeID, CreatedAt: now.Add(-2 * time.Hour), LastSeenAt: now.Add(-50 * time.Minute)})
+	s.expect(http.StatusOK, nil, http.MethodGet, "/account", active, nil)
+	if seen := s.storedSessions(user.Account.ID)[activeID].LastSeenAt; time.Since(seen) > time.Minute {
+		t.Errorf("got session last seen at %v, want it renewed", seen)
+	}
+	s.expect(http.StatusOK, nil, http.MethodGet, "/account", active, nil)
+
+	//the sweeper removes what expired without being used again
+	expiredID, idleID := uuid.New(), uuid.New()
+	s.storeSession(user.Account, bookstore.SessionMeta{ID: expiredID, CreatedAt: now.Add(-24 * time.Hour), LastSeenAt: now, ExpiresAt: &expires})
+	s.storeSession(user.Account, bookstore.SessionMeta{ID: idleID, CreatedAt: now.Add(-2 * time.Hour), LastSeenAt: now.Add(-2 * time.Hour)})
+	if err := s.auth.Sweep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sessions := s.storedSessions(user.Account.ID)
+	if _, ok := sessions[expiredID]; ok {
+		t.Error("the sweeper kept a session past its absolute timeout")
+	}
+	if _, ok := sessions[idleID]; ok {
+		t.Error("the sweeper kept an idle session")
+	}
+	if _, ok := sessions[activeID]; !ok || len(sessions) != 2 {
+		t.Errorf("got %d sessions after sweeping, want the one signed up with and the active one", len(sessions))
+	}
+}
+
+// listedSession is a session as listed by the API
+type listedSession struct {
+	ID        uuid.UUID `json:"id"`
+	UserAgent string    `json:"user_agent"`
+	Current   bool      `json:"current"`
+}
+
+// listSessions lists the sessions at the path, by the user agent they were created with
+func (s *testServer) listSessions(path string, token string) map[string]listedSession {
+	s.t.Helper()
+	var list []listedSession
+	s.expect(http.StatusOK, &list, http.MethodGet, path, token, nil)
+	sessions := make(map[string]listedSession, len(list))
+	for _, ses := range list {
+		sessions[ses.UserAgent] = ses
+	}
+	return sessions
+}
+
+// loginAs logs in with testPassword from a client with the user agent
+func (s *testServer) loginAs(email string, userAgent string) testSession {
+	s.t.Helper()
+	var ses testSession
+	s.expect(http.StatusOK, &ses, http.MethodPost, "/account/sessions", "",
+		map[string]string{"email": email, "password": testPassword}, "User-Agent", userAgent)
+	return ses
+}
+
+func TestSessionListAndRevoke(t *testing.T) {
+	s := newTestServer(t, testConfig{})
+	admin := s.admin("admin@example.com")
+	s.signup("reader@example.com")
+	laptop := s.loginAs("reader@example.com", "laptop")
+	phone := s.loginAs("reader@example.com", "phone")
+	tablet := s.loginAs("reader@example.com", "tablet")
+	other := s.loginAs(s.signup("other@example.com").Account.Email, "other")
+
+	sessions := s.listSessions("/account/sessions", laptop.Token)
+	if len(sessions) != 4 {
+		t.Fatalf("got %d sessions, want the 4 of the account", len(sessions))
+	}
+	for agent, ses := range sessions {
+		if ses.Current != (agent == "laptop") {
+			t.Errorf("got session of %q marked current=%v, want only the one listing them current", agent, ses.Current)
+		}
+	}
+	otherID := s.listSessions("/account/sessions", other.Token)["other"].ID
+
+	//sessions of other accounts can't be revoked by their ID, neither can malformed IDs
+	s.expect(http.StatusNotFound, nil, http.MethodDelete, "/account/sessions/"+otherID.String(), laptop.Token, nil)
+	s.expect(http.StatusBadRequest, nil, http.MethodDelete, "/account/sessions/not-an-id", laptop.Token, nil)
+	s.expect(http.StatusOK, nil, http.MethodGet, "/account", other.Token, nil)
+
+	//revoking a session logs only it out
+	s.expect(http.StatusNoContent, nil, http.MethodDelete, "/account/sessions/"+sessions["phone"].ID.String(), laptop.Token, nil)
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/account", phone.Token, nil)
+	s.expect(http.StatusOK, nil, http.MethodGet, "/account", laptop.Token, nil)
+	s.expect(http.StatusNotFound, nil, http.MethodDelete, "/account/sessions/"+sessions["phone"].ID.String(), laptop.Token, nil)
+
+	//admins manage them through the user, where none of them is current
+	userID := laptop.Account.ID
+	s.expect(http.StatusForbidden, nil, http.MethodGet, userPath(userID, "/sessions"), laptop.Token, nil)
+	listed := s.listSessions(userPath(userID, "/sessions"), admin.Token)
+	if len(listed) != 3 || listed["laptop"].Current {
+		t.Errorf("got sessions %+v, want the 3 remaining, none of them current", listed)
+	}
+	s.expect(http.StatusForbidden, nil, http.MethodDelete, userPath(userID, "/sessions/"+sessions["tablet"].ID.String()), laptop.Token, nil)
+	s.expect(http.StatusNotFound, nil, http.MethodDelete, userPath(userID, "/sessions/"+otherID.String()), admin.Token, nil)
+	s.expect(http.StatusOK, nil, http.MethodGet, "/account", other.Token, nil)
+	s.expect(http.StatusNoContent, nil, http.MethodDelete, userPath(userID, "/sessions/"+sessions["tablet"].ID.String()), admin.Token, nil)
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/account", tablet.Token, nil)
+	s.expect(http.StatusOK, nil, http.MethodGet, "/account", laptop.Token, nil)
+}
@@ -0,0 +1,74 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// SuspendUser stops the user from logging in or using the account, without deleting it
+// the sessions of the user are revoked right away, api keys are kept but rejected until the suspension ends
+func (h *Handler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	id := r.Context().Value(ctxUUIDKey).(uuid.UUID)
+	data := &SuspendRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	now := time.Now()
+	suspension := bookstore.Suspension{
+		SuspendedAt:    &now,
+		SuspendedUntil: data.Until,
+		SuspendReason:  data.Reason,
+	}
+	if ses, ok := GetSession(r.Context()); ok {
+		if ses.ID == id {
+			_ = render.Render(w, r, ErrInvalidRequest(errors.New("can't suspend your own account")))
+			return
+		}
+		actor := ses.Actor()
+		suspension.SuspendedBy = &actor
+	}
+
+	if err := h.store.SuspendAccount(r.Context(), id, suspension); err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	if err := h.auth.DeleteSessionFor(r.Context(), id); err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReinstateUser lifts the suspension of the user, the user has to log in again as their sessions were revoked
+func (h *Handler) ReinstateUser(w http.ResponseWriter, r *http.Request) {
+	id := r.Context().Value(ctxUUIDKey).(uuid.UUID)
+
+	if err := h.store.ReinstateAccount(r.Context(), id); err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type SuspendRequest struct {
+	Reason string `json:"reason"`
+	//Until is when the suspension ends on its own, it lasts until reinstated when omitted
+	Until *time.Time `json:"until"`
+}
+
+func (s *SuspendRequest) Bind(_ *http.Request) error {
+	if s.Reason == "" {
+		return errors.New("no reason provided")
+	}
+	if s.Until != nil && !s.Until.After(time.Now()) {
+		return errors.New("until has already passed")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package rest_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thunder33345/bookstore"
+	"github.com/thunder33345/bookstore/auth"
+)
+
+func TestSuspension(t *testing.T) {
+	s := newTestServer(t, testConfig{})
+	admin := s.admin("admin@example.com")
+	user := s.signup("reader@example.com")
+
+	s.expect(http.StatusForbidden, nil, http.MethodPost, userPath(admin.Account.ID, "/suspend"), user.Token,
+		map[string]string{"reason": "spam"})
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, userPath(admin.Account.ID, "/suspend"), admin.Token,
+		map[string]string{"reason": "spam"})
+	s.expect(http.StatusNoContent, nil, http.MethodPost, userPath(user.Account.ID, "/suspend"), admin.Token,
+		map[string]string{"reason": "spam"})
+
+	//suspending revokes the sessions, and logging in again is refused
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/account", user.Token, nil)
+	s.login(http.StatusForbidden, "reader@example.com", testPassword)
+
+	s.expect(http.StatusNoContent, nil, http.MethodDelete, userPath(user.Account.ID, "/suspend"), admin.Token, nil)
+	login := s.login(http.StatusOK, "reader@example.com", testPassword)
+	s.expect(http.StatusOK, nil, http.MethodGet, "/account", login.Token, nil)
+}
+
+func TestSuspensionRefresh(t *testing.T) {
+	key := auth.SigningKey{ID: "test", Secret: []byte(strings.Repeat("k", 32))}
+	s := newTestServer(t, testConfig{auth: []auth.Option{auth.WithAccessTokens(time.Minute, key)}})
+	s.signup("reader@example.com")
+	login := s.login(http.StatusOK, "reader@example.com", testPassword)
+
+	//suspended without going through the API, so the session is left behind
+	now := time.Now()
+	if err := s.db.SuspendAccount(context.Background(), login.Account.ID, bookstore.Suspension{SuspendedAt: &now, SuspendReason: "spam"}); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(http.StatusForbidden, nil, http.MethodPost, "/account/sessions/refresh", "",
+		map[string]string{"refresh_token": login.Token})
+
+	//refreshing works again once reinstated, as the session wasn't used up
+	if err := s.db.ReinstateAccount(context.Background(), login.Account.ID); err != nil {
+		t.Fatal(err)
+	}
+	var refreshed testSession
+	s.expect(http.StatusOK, &refreshed, http.MethodPost, "/account/sessions/refresh", "",
+		map[string]string{"refresh_token": login.Token})
+	s.expect(http.StatusOK, nil, http.MethodGet, "/account", refreshed.AccessToken, nil)
+}
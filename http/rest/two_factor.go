@@ -0,0 +1,314 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/thunder33345/bookstore"
+)
+
+// GetAccountTwoFactor shows whether two-factor authentication is enabled for the current account
+func (h *Handler) GetAccountTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ses, ok := GetSession(r.Context())
+	if !ok {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrMissingSessionData))
+		return
+	}
+
+	enabled, remaining, err := h.auth.TwoFactorStatus(r.Context(), ses.ID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	if err := render.Render(w, r, &TwoFactorStatusResponse{Enabled: enabled, RecoveryCodesRemaining: remaining}); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// EnrollAccountTwoFactor generates a new TOTP secret for the current account
+// it has to be confirmed with a code before it's required for logging in
+func (h *Handler) EnrollAccountTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ses, ok := GetSession(r.Context())
+	if !ok {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrMissingSessionData))
+		return
+	}
+
+	//the session may hold an outdated copy of the account, and the email ends up in the authenticator
+	acc, err := h.store.GetAccount(r.Context(), ses.ID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	secret, uri, err := h.auth.EnrollTOTP(r.Context(), acc)
+	if err != nil {
+		_ = render.Render(w, r, ErrTwoFactorResponse(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	if err := render.Render(w, r, &TwoFactorEnrollResponse{Secret: secret, URI: uri}); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// ConfirmAccountTwoFactor enables two-factor authentication using a code from the authenticator
+// the recovery codes are only shown in this response
+func (h *Handler) ConfirmAccountTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ses, ok := GetSession(r.Context())
+	if !ok {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrMissingSessionData))
+		return
+	}
+	data := &TwoFactorCodeRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	codes, err := h.auth.ConfirmTOTP(r.Context(), ses.ID, data.Code)
+	if err != nil {
+		_ = render.Render(w, r, ErrTwoFactorResponse(err))
+		return
+	}
+
+	if err := render.Render(w, r, &RecoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// RegenerateAccountRecoveryCodes replaces the recovery codes of the current account
+// a valid code is required, so a stolen session can't be used to take over the second factor
+// wrong codes are throttled like failed logins, see Handler.verifyAccountTwoFactor
+func (h *Handler) RegenerateAccountRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ses, ok := GetSession(r.Context())
+	if !ok {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrMissingSessionData))
+		return
+	}
+	data := &TwoFactorCodeRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if err := h.verifyAccountTwoFactor(r, ses.ID, data.Code); err != nil {
+		_ = render.Render(w, r, ErrTwoFactorResponse(err))
+		return
+	}
+	codes, err := h.auth.RegenerateRecoveryCodes(r.Context(), ses.ID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	if err := render.Render(w, r, &RecoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// DisableAccountTwoFactor turns off two-factor authentication for the current account, a valid code is required
+// wrong codes are throttled like failed logins, see Handler.verifyAccountTwoFactor
+func (h *Handler) DisableAccountTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ses, ok := GetSession(r.Context())
+	if !ok {
+		_ = render.Render(w, r, ErrSessionResponse(bookstore.ErrMissingSessionData))
+		return
+	}
+	data := &TwoFactorCodeRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if err := h.verifyAccountTwoFactor(r, ses.ID, data.Code); err != nil {
+		_ = render.Render(w, r, ErrTwoFactorResponse(err))
+		return
+	}
+	if err := h.auth.DisableTwoFactor(r.Context(), ses.ID); err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyAccountTwoFactor checks the code of the account, counting wrong codes as failed logins of its email
+// otherwise a stolen session could guess codes forever, while logging in is throttled
+// a bookstore.LoginThrottledError is returned while the email or IP is blocked, without looking at the code
+func (h *Handler) verifyAccountTwoFactor(r *http.Request, accountID uuid.UUID, code string) error {
+	//the session may hold an outdated copy of the account, and the throttle is keyed by the current email
+	acc, err := h.store.GetAccount(r.Context(), accountID)
+	if err != nil {
+		return err
+	}
+	if err := h.auth.CheckLogin(r.Context(), acc.Email, clientIP(r)); err != nil {
+		return err
+	}
+	err = h.auth.VerifyTwoFactor(r.Context(), acc.ID, code)
+	if errors.Is(err, bookstore.ErrInvalidTwoFactorCode) {
+		if err := h.auth.LoginFailed(r.Context(), acc.Email, clientIP(r), r.UserAgent()); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return h.auth.LoginSucceeded(r.Context(), acc.Email)
+}
+
+// CreateAccountTwoFactorSession exchanges the login challenge and a code for a session token
+// this is the second half of logging in when two-factor authentication is enabled
+// wrong codes count as failed logins, so they are throttled the same way wrong passwords are
+func (h *Handler) CreateAccountTwoFactorSession(w http.ResponseWriter, r *http.Request) {
+	data := &TwoFactorSessionRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if data.Cookie && h.sessionCookie == nil {
+		_ = render.Render(w, r, ErrSessionCookieUnavailable)
+		return
+	}
+
+	accountID, err := h.auth.GetLoginChallenge(r.Context(), data.Challenge)
+	if err != nil {
+		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
+	acc, err := h.store.GetAccount(r.Context(), accountID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	if err := h.auth.CheckLogin(r.Context(), acc.Email, clientIP(r)); err != nil {
+		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
+
+	err = h.auth.VerifyTwoFactor(r.Context(), acc.ID, data.Code)
+	if errors.Is(err, bookstore.ErrInvalidTwoFactorCode) {
+		if err := h.auth.LoginFailed(r.Context(), acc.Email, clientIP(r), r.UserAgent()); err != nil {
+			_ = render.Render(w, r, ErrSessionResponse(err))
+			return
+		}
+	}
+	if err != nil {
+		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
+
+	//the challenge is only deleted once the code checks out, so a typo doesn't require logging in again
+	if err := h.auth.DeleteLoginChallenge(r.Context(), data.Challenge); err != nil {
+		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
+	if err := h.auth.LoginSucceeded(r.Context(), acc.Email); err != nil {
+		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
+
+	tok, ses, err := h.auth.CreateSession(r.Context(), acc, clientIP(r), r.UserAgent())
+	if err != nil {
+		_ = render.Render(w, r, ErrSessionResponse(err))
+		return
+	}
+
+	h.renderSessionCreated(w, r, tok, ses, data.Cookie)
+}
+
+// ResetUserTwoFactor turns off two-factor authentication for the user, for when they lost both their authenticator and recovery codes
+func (h *Handler) ResetUserTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id := r.Context().Value(ctxUUIDKey).(uuid.UUID)
+
+	//we check the user exists, so an unknown ID isn't reported as success
+	if _, err := h.store.GetAccount(r.Context(), id); err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	if err := h.auth.DisableTwoFactor(r.Context(), id); err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+func (t *TwoFactorCodeRequest) Bind(_ *http.Request) error {
+	if t.Code == "" {
+		return errors.New("no code provided")
+	}
+	return nil
+}
+
+type TwoFactorSessionRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+	//Cookie sets the token as a cookie instead of returning it, see WithSessionCookie
+	Cookie bool `json:"cookie"`
+}
+
+func (t *TwoFactorSessionRequest) Bind(_ *http.Request) error {
+	if t.Challenge == "" {
+		return errors.New("no challenge provided")
+	}
+	if t.Code == "" {
+		return errors.New("no code provided")
+	}
+	return nil
+}
+
+type TwoFactorStatusResponse struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+func (t *TwoFactorStatusResponse) Render(_ http.ResponseWriter, _ *http.Request) error {
+	return nil
+}
+
+type TwoFactorEnrollResponse struct {
+	//Secret is the base32 encoded secret, for entering into authenticator apps by hand
+	Secret string `json:"secret"`
+	//URI is the otpauth:// URI, usually shown as a QR code
+	URI string `json:"uri"`
+}
+
+func (t *TwoFactorEnrollResponse) Render(_ http.ResponseWriter, _ *http.Request) error {
+	return nil
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (rc *RecoveryCodesResponse) Render(_ http.ResponseWriter, _ *http.Request) error {
+	return nil
+}
+
+// TwoFactorChallengeResponse is sent in place of SessionCreateResponse when the account has two-factor authentication enabled
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	Challenge         string    `json:"challenge"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+func NewTwoFactorChallengeResponse(challenge string, expiresAt time.Time) *TwoFactorChallengeResponse {
+	resp := &TwoFactorChallengeResponse{TwoFactorRequired: true, Challenge: challenge, ExpiresAt: expiresAt}
+	return resp
+}
+
+func (t *TwoFactorChallengeResponse) Render(_ http.ResponseWriter, _ *http.Request) error {
+	return nil
+}
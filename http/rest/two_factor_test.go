@@ -0,0 +1,100 @@
+package rest_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/thunder33345/bookstore/auth"
+)
+
+// enrollTwoFactor turns on two-factor authentication for the session, returning the secret and the recovery codes
+func (s *testServer) enrollTwoFactor(token string) (string, []string) {
+	s.t.Helper()
+	var enroll struct {
+		Secret string `json:"secret"`
+	}
+	s.expect(http.StatusCreated, &enroll, http.MethodPost, "/account/2fa", token, nil)
+	var confirm struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	s.expect(http.StatusOK, &confirm, http.MethodPost, "/account/2fa/confirm", token,
+		map[string]string{"code": totpCode(s.t, enroll.Secret, time.Now())})
+	return enroll.Secret, confirm.RecoveryCodes
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	s := newTestServer(t, testConfig{})
+	user := s.signup("reader@example.com")
+	secret, recovery := s.enrollTwoFactor(user.Token)
+	if len(recovery) == 0 {
+		t.Fatal("confirming didn't return recovery codes")
+	}
+
+	var status struct {
+		Enabled   bool `json:"enabled"`
+		Remaining int  `json:"recovery_codes_remaining"`
+	}
+	s.expect(http.StatusOK, &status, http.MethodGet, "/account/2fa", user.Token, nil)
+	if !status.Enabled || status.Remaining != len(recovery) {
+		t.Errorf("got status %+v, want enabled with %d recovery codes", status, len(recovery))
+	}
+
+	//the password alone only gets a challenge
+	login := s.login(http.StatusAccepted, "reader@example.com", testPassword)
+	if login.Challenge == "" || login.Token != "" {
+		t.Fatalf("got %+v, want a challenge instead of a token", login)
+	}
+	s.expect(http.StatusUnauthorized, nil, http.MethodPost, "/account/sessions/2fa", "",
+		map[string]string{"challenge": login.Challenge, "code": "000000"})
+	s.expect(http.StatusUnauthorized, nil, http.MethodPost, "/account/sessions/2fa", "",
+		map[string]string{"challenge": "unknown", "code": recovery[0]})
+
+	//the code used to confirm can't be replayed, recovery codes work in its place
+	var ses testSession
+	s.expect(http.StatusOK, &ses, http.MethodPost, "/account/sessions/2fa", "",
+		map[string]string{"challenge": login.Challenge, "code": recovery[0]})
+	if ses.Token == "" {
+		t.Fatal("passing the challenge didn't return a token")
+	}
+	//challenges and recovery codes are used up
+	s.expect(http.StatusUnauthorized, nil, http.MethodPost, "/account/sessions/2fa", "",
+		map[string]string{"challenge": login.Challenge, "code": recovery[1]})
+	login = s.login(http.StatusAccepted, "reader@example.com", testPassword)
+	s.expect(http.StatusUnauthorized, nil, http.MethodPost, "/account/sessions/2fa", "",
+		map[string]string{"challenge": login.Challenge, "code": recovery[0]})
+
+	//disabling needs a valid code too
+	s.expect(http.StatusBadRequest, nil, http.MethodDelete, "/account/2fa", ses.Token, map[string]string{"code": "000000"})
+	s.expect(http.StatusNoContent, nil, http.MethodDelete, "/account/2fa", ses.Token,
+		map[string]string{"code": totpCode(t, secret, time.Now().Add(30*time.Second))})
+	s.login(http.StatusOK, "reader@example.com", testPassword)
+}
+
+func TestTwoFactorManagementThrottled(t *testing.T) {
+	s := newTestServer(t, testConfig{auth: []auth.Option{auth.WithLoginBackoff(0, 0), auth.WithLockout(3, time.Hour)}})
+	user := s.signup("reader@example.com")
+	_, recovery := s.enrollTwoFactor(user.Token)
+
+	//wrong codes count as failed logins, whichever of the two endpoints they are sent to
+	s.expect(http.StatusBadRequest, nil, http.MethodDelete, "/account/2fa", user.Token, map[string]string{"code": "000000"})
+	s.expect(http.StatusBadRequest, nil, http.MethodPost, "/account/2fa/recovery-codes", user.Token, map[string]string{"code": "000000"})
+	s.expect(http.StatusBadRequest, nil, http.MethodDelete, "/account/2fa", user.Token, map[string]string{"code": "00000-00000"})
+
+	//valid codes are refused too once locked out, along with logging in
+	resp := s.expect(http.StatusTooManyRequests, nil, http.MethodDelete, "/account/2fa", user.Token, map[string]string{"code": recovery[0]})
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("got no Retry-After")
+	}
+	s.expect(http.StatusTooManyRequests, nil, http.MethodPost, "/account/2fa/recovery-codes", user.Token, map[string]string{"code": recovery[0]})
+	s.login(http.StatusTooManyRequests, "reader@example.com", testPassword)
+
+	var status struct {
+		Enabled   bool `json:"enabled"`
+		Remaining int  `json:"recovery_codes_remaining"`
+	}
+	s.expect(http.StatusOK, &status, http.MethodGet, "/account/2fa", user.Token, nil)
+	if !status.Enabled || status.Remaining != len(recovery) {
+		t.Errorf("got status %+v, want it enabled with no recovery code used", status)
+	}
+}
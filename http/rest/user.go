@@ -143,12 +143,52 @@ func (h *Handler) DeleteUserSessions(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// ListUserSessions lists active sessions of the user
+func (h *Handler) ListUserSessions(w http.ResponseWriter, r *http.Request) {
+	id := r.Context().Value(ctxUUIDKey).(uuid.UUID)
+
+	//make sure the user exist, otherwise we can't tell it apart from a user without sessions
+	_, err := h.store.GetAccount(r.Context(), id)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	sessions, err := h.auth.ListSessions(r.Context(), id)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, NewListSessionResponse(sessions, uuid.Nil)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// RevokeUserSession removes a single session of the user using the session ID
+func (h *Handler) RevokeUserSession(w http.ResponseWriter, r *http.Request) {
+	id := r.Context().Value(ctxUUIDKey).(uuid.UUID)
+	sessionID := r.Context().Value(ctxSessionIDKey).(uuid.UUID)
+
+	err := h.auth.RevokeSession(r.Context(), id, sessionID)
+	if err != nil {
+		_ = render.Render(w, r, ErrQueryResponse(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 type AccountRequest struct {
 	*bookstore.Account
 
-	ProtectedID        uuid.UUID `json:"id"`
-	ProtectedCreatedAt time.Time `json:"created_at"`
-	ProtectedUpdatedAt time.Time `json:"updated_at"`
+	ProtectedID              uuid.UUID  `json:"id"`
+	ProtectedEmailVerifiedAt *time.Time `json:"email_verified_at"`
+	ProtectedCreatedAt       time.Time  `json:"created_at"`
+	ProtectedUpdatedAt       time.Time  `json:"updated_at"`
+
+	//Invite is the invite code for signing up while registration is invite-only, it's ignored elsewhere
+	Invite string `json:"invite"`
 }
 
 func (a *AccountRequest) Bind(_ *http.Request) error {
@@ -157,8 +197,12 @@ func (a *AccountRequest) Bind(_ *http.Request) error {
 	}
 
 	a.ProtectedID = uuid.Nil
+	a.ProtectedEmailVerifiedAt = nil
 	a.ProtectedCreatedAt = time.Time{}
 	a.ProtectedUpdatedAt = time.Time{}
+	//suspensions are only changed through SuspendUser and ReinstateUser
+	a.Suspension = bookstore.Suspension{}
+	a.AnonymizedAt = nil
 
 	_, err := mail.ParseAddress(a.Email)
 	if err != nil {
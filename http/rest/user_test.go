@@ -0,0 +1,45 @@
+package rest_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/thunder33345/bookstore"
+)
+
+func TestUserManagementOutranking(t *testing.T) {
+	s := newTestServer(t, testConfig{})
+	admin := s.admin("admin@example.com")
+	target := s.admin("target@example.com")
+	user := s.signup("reader@example.com")
+	//a service holding users:write but not the rest of the permissions of an admin
+	manager := s.createAPIKey(admin.Token, bookstore.PermissionUsersRead, bookstore.PermissionUsersWrite)
+	auth := []string{"Authorization", "ApiKey " + manager}
+
+	//taking over the admin is refused, whichever way it's tried
+	s.expect(http.StatusForbidden, nil, http.MethodPost, userPath(target.Account.ID, "/password"), "",
+		map[string]string{"password": testPassword + "!"}, auth...)
+	s.expect(http.StatusForbidden, nil, http.MethodPut, userPath(target.Account.ID, ""), "",
+		map[string]string{"name": "Target", "email": "taken-over@example.com"}, auth...)
+	s.expect(http.StatusForbidden, nil, http.MethodDelete, userPath(target.Account.ID, "/sessions"), "", nil, auth...)
+	s.expect(http.StatusForbidden, nil, http.MethodDelete, userPath(target.Account.ID, "/2fa"), "", nil, auth...)
+	s.expect(http.StatusForbidden, nil, http.MethodPost, userPath(target.Account.ID, "/suspend"), "",
+		map[string]string{"reason": "spam"}, auth...)
+	s.expect(http.StatusForbidden, nil, http.MethodDelete, userPath(target.Account.ID, ""), "", nil, auth...)
+	s.expect(http.StatusOK, nil, http.MethodGet, "/account", target.Token, nil)
+	s.login(http.StatusOK, "target@example.com", testPassword)
+	//reading is not affected
+	s.expect(http.StatusOK, nil, http.MethodGet, userPath(target.Account.ID, ""), "", nil, auth...)
+
+	//accounts holding nothing the caller lacks are managed as before
+	s.expect(http.StatusNoContent, nil, http.MethodPost, userPath(user.Account.ID, "/password"), "",
+		map[string]string{"password": testPassword + "!"}, auth...)
+	s.login(http.StatusOK, "reader@example.com", testPassword+"!")
+	s.expect(http.StatusNoContent, nil, http.MethodDelete, userPath(user.Account.ID, "/sessions"), "", nil, auth...)
+	s.expect(http.StatusUnauthorized, nil, http.MethodGet, "/account", user.Token, nil)
+
+	//holding roles:write is enough, as the permissions could be granted anyway
+	s.expect(http.StatusNoContent, nil, http.MethodPost, userPath(target.Account.ID, "/password"), admin.Token,
+		map[string]string{"password": testPassword + "!"})
+	s.login(http.StatusOK, "target@example.com", testPassword+"!")
+}
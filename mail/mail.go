@@ -0,0 +1,26 @@
+// Package mail delivers emails to account holders, such as password reset links
+package mail
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Mailer sends plain text emails
+type Mailer interface {
+	Send(ctx context.Context, to string, subject string, body string) error
+}
+
+// ErrInvalidHeader is returned when the recipient or subject would break out of their header
+var ErrInvalidHeader = errors.New("mail header contains a line break")
+
+// checkHeaders prevents header injection through the recipient or subject
+func checkHeaders(values ...string) error {
+	for _, v := range values {
+		if strings.ContainsAny(v, "\r\n") {
+			return ErrInvalidHeader
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is an email kept by Outbox
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	SentAt  time.Time
+}
+
+// Outbox keeps every sent email in memory instead of delivering them, for development and tests
+// when dir is set, each email is also written into it as a file
+type Outbox struct {
+	mu       sync.Mutex
+	messages []Message
+	dir      string
+}
+
+// NewOutbox creates a new outbox, dir is optional
+func NewOutbox(dir string) (*Outbox, error) {
+	if dir != "" {
+		var err error
+		dir, err = filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		err = os.MkdirAll(dir, 0o750)
+		if err != nil {
+			return nil, fmt.Errorf("creating outbox directory: %w", err)
+		}
+	}
+	return &Outbox{dir: dir}, nil
+}
+
+// Send stores the email in the outbox
+func (o *Outbox) Send(_ context.Context, to string, subject string, body string) error {
+	if err := checkHeaders(to, subject); err != nil {
+		return err
+	}
+	msg := Message{To: to, Subject: subject, Body: body, SentAt: time.Now()}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+
+	if o.dir == "" {
+		return nil
+	}
+	//the recipient is only there to make the files easier to find, so anything unusual is replaced
+	name := fmt.Sprintf("%d_%s.txt", msg.SentAt.UnixNano(), strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, to))
+	content := fmt.Sprintf("To: %s\nSubject: %s\nDate: %s\n\n%s\n", msg.To, msg.Subject, msg.SentAt.Format(time.RFC1123Z), msg.Body)
+	err := os.WriteFile(filepath.Join(o.dir, name), []byte(content), 0o640)
+	if err != nil {
+		return fmt.Errorf("writing mail to outbox: %w", err)
+	}
+	return nil
+}
+
+// Messages returns a copy of every email sent so far, oldest first
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Message(nil), o.messages...)
+}
@@ -0,0 +1,66 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTP sends emails through an SMTP server
+type SMTP struct {
+	//addr is the host:port of the server
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTP creates a new SMTP mailer
+// username and password are optional, when provided PLAIN auth is used, which requires TLS unless the server is local
+func NewSMTP(addr string, username string, password string, from string) (*SMTP, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing smtp address: %w", err)
+	}
+	if err := checkHeaders(from); err != nil {
+		return nil, err
+	}
+	s := &SMTP{
+		addr: addr,
+		from: from,
+	}
+	if username != "" {
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return s, nil
+}
+
+// Send sends the email
+// net/smtp doesn't take a context, so ctx is only checked before sending
+func (s *SMTP) Send(ctx context.Context, to string, subject string, body string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := checkHeaders(to, subject); err != nil {
+		return err
+	}
+
+	var msg strings.Builder
+	msg.WriteString("From: " + s.from + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	err := smtp.SendMail(s.addr, s.auth, s.from, []string{to}, []byte(msg.String()))
+	if err != nil {
+		return fmt.Errorf("sending mail to %s: %w", to, err)
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package bookstore
 
 import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -49,15 +52,232 @@ type Account struct {
 	ID           uuid.UUID `json:"ID"`
 	Name         string    `json:"name"`
 	Email        string    `json:"email"`
-	Admin        bool      `json:"admin" db:"is_admin"`
 	PasswordHash string    `json:"password,omitempty" db:"password_hash"`
+	//EmailVerifiedAt is when the current email was confirmed, nil if it hasn't been
+	//changing the email resets it
+	EmailVerifiedAt *time.Time `json:"email_verified_at" db:"email_verified_at"`
+	Suspension
+	//AnonymizedAt is when the personal data of the account was erased, nil if it hasn't been
+	AnonymizedAt *time.Time `json:"anonymized_at,omitempty" db:"anonymized_at"`
 
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// Suspension is why and until when an account can't be used, the zero value means it isn't suspended
+type Suspension struct {
+	SuspendedAt *time.Time `json:"suspended_at,omitempty" db:"suspended_at"`
+	//SuspendedUntil is when the suspension ends on its own, nil if it lasts until the account is reinstated
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty" db:"suspended_until"`
+	//SuspendedBy is the account that suspended it, nil if that account has since been deleted
+	SuspendedBy   *uuid.UUID `json:"suspended_by,omitempty" db:"suspended_by"`
+	SuspendReason string     `json:"suspend_reason,omitempty" db:"suspend_reason"`
+}
+
+// Suspended checks if the suspension is in effect at the given time
+func (s Suspension) Suspended(now time.Time) bool {
+	if s.SuspendedAt == nil {
+		return false
+	}
+	return s.SuspendedUntil == nil || now.Before(*s.SuspendedUntil)
+}
+
 // Session embeds Account
 // mostly for future proofing and distinction
 type Session struct {
 	Account
+	//Meta is the data of the session itself, rather than the account it belongs to
+	Meta SessionMeta `json:"-" db:"session"`
+	//Permissions are granted by the roles of the account, they aren't populated by the session store
+	Permissions []Permission `json:"-" db:"-"`
+	//APIKey is set when authenticated using an API key instead of a session token
+	APIKey *APIKey `json:"-" db:"-"`
+}
+
+// Impersonated reports whether the session is an admin acting as the account
+func (s Session) Impersonated() bool {
+	return s.Meta.ImpersonatorID != nil
+}
+
+// Actor is the account really making the requests, which is the impersonator for impersonations
+func (s Session) Actor() uuid.UUID {
+	if s.Meta.ImpersonatorID != nil {
+		return *s.Meta.ImpersonatorID
+	}
+	return s.ID
+}
+
+// HasPermission checks if the session has been granted the permission
+func (s Session) HasPermission(perm Permission) bool {
+	for _, p := range s.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionMeta holds the lifetime of a session and the client that created it
+type SessionMeta struct {
+	//ID is an opaque identifier of the session, unlike the token it's safe to show
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at" db:"last_seen_at"`
+	//ExpiresAt is when the session expires regardless of activity, nil if it never does
+	ExpiresAt *time.Time `json:"expires_at" db:"expires_at"`
+	IP        string     `json:"ip"`
+	UserAgent string     `json:"user_agent" db:"user_agent"`
+	//ImpersonatorID is the admin acting as the account through the session, nil unless it's an impersonation
+	ImpersonatorID *uuid.UUID `json:"impersonator_id,omitempty" db:"impersonator_id"`
+}
+
+// Permission allows an account to perform a group of actions
+type Permission string
+
+const (
+	// PermissionCatalogWrite allows creating, updating and deleting genres, authors and books
+	PermissionCatalogWrite Permission = "catalog:write"
+	// PermissionCoversWrite allows uploading and removing book covers
+	PermissionCoversWrite Permission = "covers:write"
+	// PermissionUsersRead allows viewing accounts and their sessions
+	PermissionUsersRead Permission = "users:read"
+	// PermissionUsersWrite allows creating, updating and deleting accounts, and revoking their sessions
+	PermissionUsersWrite Permission = "users:write"
+	// PermissionRolesWrite allows assigning roles to accounts
+	// this is separate from PermissionUsersWrite, as it lets the holder grant themselves any permission
+	PermissionRolesWrite Permission = "roles:write"
+	// PermissionUsersImpersonate allows acting as other accounts through time-limited sessions
+	// impersonations only get the permissions both accounts hold
+	PermissionUsersImpersonate Permission = "users:impersonate"
+)
+
+// KnownPermissions lists every permission
+var KnownPermissions = []Permission{
+	PermissionCatalogWrite,
+	PermissionCoversWrite,
+	PermissionUsersRead,
+	PermissionUsersWrite,
+	PermissionRolesWrite,
+	PermissionUsersImpersonate,
+}
+
+// RoleAdministrator is the built-in role holding every permission
+const RoleAdministrator = "administrator"
+
+// Role is a named set of permissions that can be assigned to accounts
+type Role struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions" db:"-"`
+}
+
+// TOTP is the time-based one-time password (RFC 6238) secret of an account
+// it only protects logins once EnabledAt is set, which happens after the first code is confirmed
+type TOTP struct {
+	AccountID uuid.UUID `json:"-" db:"account_id"`
+	//Secret is the base32 encoded shared secret
+	Secret    string     `json:"-"`
+	EnabledAt *time.Time `json:"enabled_at" db:"enabled_at"`
+	//LastStep is the time step of the last accepted code, so a code can't be used twice
+	LastStep  int64     `json:"-" db:"last_step"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Identity links an account to a user of an external identity provider
+type Identity struct {
+	//Provider is the name the provider is configured under
+	Provider string `json:"provider"`
+	//Subject is the ID of the user at the provider, it never changes unlike the email
+	Subject   string    `json:"subject"`
+	AccountID uuid.UUID `json:"account_id" db:"account_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// OIDCState is a pending OpenID Connect login, kept between redirecting to the provider and the callback
+type OIDCState struct {
+	Provider string
+	Nonce    string
+	//CodeVerifier is the PKCE secret, proving the callback comes from whoever started the login
+	CodeVerifier string    `db:"code_verifier"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
+
+// LoginAttempt is a failed login, kept so admins can look into suspicious activity
+type LoginAttempt struct {
+	ID uuid.UUID `json:"id"`
+	//Email is what was used to log in, the account may not exist
+	Email     string    `json:"email"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent" db:"user_agent"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// APIKey is a long-lived credential belonging to an account, meant for automated access
+type APIKey struct {
+	ID        uuid.UUID `json:"id"`
+	AccountID uuid.UUID `json:"account_id" db:"account_id"`
+	Name      string    `json:"name"`
+	//Scope limits the key to these permissions, the account still needs to hold them
+	//an empty scope only allows reading the catalog
+	Scope Scope `json:"scope"`
+	//ExpiresAt is when the key stops working, nil if it never does
+	ExpiresAt  *time.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Invite allows signing up while registration is invite-only
+type Invite struct {
+	ID uuid.UUID `json:"id"`
+	//Email limits the invite to signing up with this email, empty if any email can use it
+	Email string `json:"email"`
+	//MaxUses is how many accounts can sign up using the invite, 0 if there is no limit
+	MaxUses int `json:"max_uses" db:"max_uses"`
+	Uses    int `json:"uses"`
+	//ExpiresAt is when the invite stops working, nil if it never does
+	ExpiresAt *time.Time `json:"expires_at" db:"expires_at"`
+	//CreatedBy is the account that created the invite, nil if that account has since been deleted
+	CreatedBy *uuid.UUID `json:"created_by" db:"created_by"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Scope is a set of permissions, stored as a space separated string
+type Scope []Permission
+
+func (s Scope) Value() (driver.Value, error) {
+	perms := make([]string, 0, len(s))
+	for _, perm := range s {
+		perms = append(perms, string(perm))
+	}
+	return strings.Join(perms, " "), nil
+}
+
+func (s *Scope) Scan(src any) error {
+	var str string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	default:
+		return fmt.Errorf("unsupported scope type %T", src)
+	}
+
+	scope := Scope{}
+	for _, perm := range strings.Fields(str) {
+		scope = append(scope, Permission(perm))
+	}
+	*s = scope
+	return nil
+}
+
+// Contains checks if the scope includes the permission
+func (s Scope) Contains(perm Permission) bool {
+	for _, p := range s {
+		if p == perm {
+			return true
+		}
+	}
+	return false
 }